@@ -0,0 +1,357 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: admin.proto
+
+package adminpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// EzqueueAdminClient is the client API for EzqueueAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EzqueueAdminClient interface {
+	GetControl(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*ControlState, error)
+	ListSegments(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*SegmentList, error)
+	BrowseMessages(ctx context.Context, in *BrowseParams, opts ...grpc.CallOption) (*WalRecordList, error)
+	Flush(ctx context.Context, in *FlushParams, opts ...grpc.CallOption) (*FlushResult, error)
+	CollectSegments(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*CollectResult, error)
+	PauseQueue(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*ControlState, error)
+	ResumeQueue(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*ControlState, error)
+	GetRecoveryStats(ctx context.Context, in *RecoveryStatsParams, opts ...grpc.CallOption) (*RecoveryStats, error)
+}
+
+type ezqueueAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEzqueueAdminClient(cc grpc.ClientConnInterface) EzqueueAdminClient {
+	return &ezqueueAdminClient{cc}
+}
+
+func (c *ezqueueAdminClient) GetControl(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*ControlState, error) {
+	out := new(ControlState)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/GetControl", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueAdminClient) ListSegments(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*SegmentList, error) {
+	out := new(SegmentList)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/ListSegments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueAdminClient) BrowseMessages(ctx context.Context, in *BrowseParams, opts ...grpc.CallOption) (*WalRecordList, error) {
+	out := new(WalRecordList)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/BrowseMessages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueAdminClient) Flush(ctx context.Context, in *FlushParams, opts ...grpc.CallOption) (*FlushResult, error) {
+	out := new(FlushResult)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/Flush", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueAdminClient) CollectSegments(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*CollectResult, error) {
+	out := new(CollectResult)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/CollectSegments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueAdminClient) PauseQueue(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*ControlState, error) {
+	out := new(ControlState)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/PauseQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueAdminClient) ResumeQueue(ctx context.Context, in *QueueRef, opts ...grpc.CallOption) (*ControlState, error) {
+	out := new(ControlState)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/ResumeQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueAdminClient) GetRecoveryStats(ctx context.Context, in *RecoveryStatsParams, opts ...grpc.CallOption) (*RecoveryStats, error) {
+	out := new(RecoveryStats)
+	err := c.cc.Invoke(ctx, "/EzqueueAdmin/GetRecoveryStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EzqueueAdminServer is the server API for EzqueueAdmin service.
+// All implementations must embed UnimplementedEzqueueAdminServer
+// for forward compatibility
+type EzqueueAdminServer interface {
+	GetControl(context.Context, *QueueRef) (*ControlState, error)
+	ListSegments(context.Context, *QueueRef) (*SegmentList, error)
+	BrowseMessages(context.Context, *BrowseParams) (*WalRecordList, error)
+	Flush(context.Context, *FlushParams) (*FlushResult, error)
+	CollectSegments(context.Context, *QueueRef) (*CollectResult, error)
+	PauseQueue(context.Context, *QueueRef) (*ControlState, error)
+	ResumeQueue(context.Context, *QueueRef) (*ControlState, error)
+	GetRecoveryStats(context.Context, *RecoveryStatsParams) (*RecoveryStats, error)
+	mustEmbedUnimplementedEzqueueAdminServer()
+}
+
+// UnimplementedEzqueueAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedEzqueueAdminServer struct {
+}
+
+func (UnimplementedEzqueueAdminServer) GetControl(context.Context, *QueueRef) (*ControlState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetControl not implemented")
+}
+func (UnimplementedEzqueueAdminServer) ListSegments(context.Context, *QueueRef) (*SegmentList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSegments not implemented")
+}
+func (UnimplementedEzqueueAdminServer) BrowseMessages(context.Context, *BrowseParams) (*WalRecordList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BrowseMessages not implemented")
+}
+func (UnimplementedEzqueueAdminServer) Flush(context.Context, *FlushParams) (*FlushResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Flush not implemented")
+}
+func (UnimplementedEzqueueAdminServer) CollectSegments(context.Context, *QueueRef) (*CollectResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CollectSegments not implemented")
+}
+func (UnimplementedEzqueueAdminServer) PauseQueue(context.Context, *QueueRef) (*ControlState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseQueue not implemented")
+}
+func (UnimplementedEzqueueAdminServer) ResumeQueue(context.Context, *QueueRef) (*ControlState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeQueue not implemented")
+}
+func (UnimplementedEzqueueAdminServer) GetRecoveryStats(context.Context, *RecoveryStatsParams) (*RecoveryStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRecoveryStats not implemented")
+}
+func (UnimplementedEzqueueAdminServer) mustEmbedUnimplementedEzqueueAdminServer() {}
+
+// UnsafeEzqueueAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EzqueueAdminServer will
+// result in compilation errors.
+type UnsafeEzqueueAdminServer interface {
+	mustEmbedUnimplementedEzqueueAdminServer()
+}
+
+func RegisterEzqueueAdminServer(s grpc.ServiceRegistrar, srv EzqueueAdminServer) {
+	s.RegisterService(&EzqueueAdmin_ServiceDesc, srv)
+}
+
+func _EzqueueAdmin_GetControl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).GetControl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/GetControl",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).GetControl(ctx, req.(*QueueRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueAdmin_ListSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).ListSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/ListSegments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).ListSegments(ctx, req.(*QueueRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueAdmin_BrowseMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BrowseParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).BrowseMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/BrowseMessages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).BrowseMessages(ctx, req.(*BrowseParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueAdmin_Flush_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FlushParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).Flush(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/Flush",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).Flush(ctx, req.(*FlushParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueAdmin_CollectSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).CollectSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/CollectSegments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).CollectSegments(ctx, req.(*QueueRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueAdmin_PauseQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).PauseQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/PauseQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).PauseQueue(ctx, req.(*QueueRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueAdmin_ResumeQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).ResumeQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/ResumeQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).ResumeQueue(ctx, req.(*QueueRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueAdmin_GetRecoveryStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecoveryStatsParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueAdminServer).GetRecoveryStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueAdmin/GetRecoveryStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueAdminServer).GetRecoveryStats(ctx, req.(*RecoveryStatsParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EzqueueAdmin_ServiceDesc is the grpc.ServiceDesc for EzqueueAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EzqueueAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "EzqueueAdmin",
+	HandlerType: (*EzqueueAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetControl",
+			Handler:    _EzqueueAdmin_GetControl_Handler,
+		},
+		{
+			MethodName: "ListSegments",
+			Handler:    _EzqueueAdmin_ListSegments_Handler,
+		},
+		{
+			MethodName: "BrowseMessages",
+			Handler:    _EzqueueAdmin_BrowseMessages_Handler,
+		},
+		{
+			MethodName: "Flush",
+			Handler:    _EzqueueAdmin_Flush_Handler,
+		},
+		{
+			MethodName: "CollectSegments",
+			Handler:    _EzqueueAdmin_CollectSegments_Handler,
+		},
+		{
+			MethodName: "PauseQueue",
+			Handler:    _EzqueueAdmin_PauseQueue_Handler,
+		},
+		{
+			MethodName: "ResumeQueue",
+			Handler:    _EzqueueAdmin_ResumeQueue_Handler,
+		},
+		{
+			MethodName: "GetRecoveryStats",
+			Handler:    _EzqueueAdmin_GetRecoveryStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
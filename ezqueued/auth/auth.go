@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+)
+
+//Permissions that can be granted to a key
+const (
+	PermCreate  = "create"
+	PermEnqueue = "enqueue"
+	PermDequeue = "dequeue"
+	PermAdmin   = "admin"
+
+	AllApps = "*"
+)
+
+//Metadata keys a client can use to pass its api key
+const (
+	AuthorizationHeader = "authorization"
+	ApiKeyHeader        = "x-api-key"
+	bearerPrefix        = "bearer "
+)
+
+//MethodPermissions maps a full gRPC method name to the permissions needed to call it.
+//Methods that are not listed require the admin permission. No permissions let any key scoped to the app call it
+var MethodPermissions = map[string][]string{
+	"/Ezqueued/Create":  {PermCreate},
+	"/Ezqueued/Enqueue": {PermEnqueue},
+	"/Ezqueued/Dequeue": {PermDequeue},
+	"/Ezqueued/Peek":    {PermDequeue},
+
+	"/EzqueueQueues/CreateQueue":           {PermCreate},
+	"/EzqueueQueues/ListQueues":            nil,
+	"/EzqueueQueues/GetQueueStats":         nil,
+	"/EzqueueQueues/PurgeQueue":            {PermAdmin},
+	"/EzqueueQueues/DeleteQueue":           {PermAdmin},
+	"/EzqueueQueues/Receive":               {PermDequeue},
+	"/EzqueueQueues/DeleteMessage":         {PermDequeue},
+	"/EzqueueQueues/SendMessages":          {PermEnqueue},
+	"/EzqueueQueues/ChangeVisibility":      {PermDequeue},
+	"/EzqueueQueues/ChangeVisibilityBatch": {PermDequeue},
+	"/EzqueueQueues/CreateSchedule":        {PermCreate, PermEnqueue},
+	"/EzqueueQueues/ListSchedules":         nil,
+	"/EzqueueQueues/PauseSchedule":         {PermCreate, PermEnqueue},
+	"/EzqueueQueues/ResumeSchedule":        {PermCreate, PermEnqueue},
+	"/EzqueueQueues/DeleteSchedule":        {PermCreate, PermEnqueue},
+}
+
+//PublicMethods can be called without an api key, Ex: health checks from container probes
+var PublicMethods = map[string]bool{
+	"/grpc.health.v1.Health/Check": true,
+	"/grpc.health.v1.Health/Watch": true,
+}
+
+//Key is a single entry in the keys file
+type Key struct {
+	Id          string   `json:"id"`          //Name of the client that owns the key. Used for logging and auditing
+	Key         string   `json:"key"`         //The secret sent by the client
+	Apps        []string `json:"apps"`        //App names this key can access. "*" means all apps
+	Permissions []string `json:"permissions"` //Any of create, enqueue, dequeue, admin
+}
+
+type KeysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+//Identity is the authenticated caller attached to the request context
+type Identity struct {
+	Id          string
+	Apps        []string
+	Permissions []string
+}
+
+func (i *Identity) String() string {
+	return i.Id
+}
+
+//HasPermission reports if the identity has perm. Admin implies every permission
+func (i *Identity) HasPermission(perm string) bool {
+
+	for _, p := range i.Permissions {
+		if p == perm || p == PermAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+//CanAccessApp reports if the identity is scoped to appName
+func (i *Identity) CanAccessApp(appName string) bool {
+
+	for _, a := range i.Apps {
+		if a == appName || a == AllApps {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Authorize checks that the identity has every one of perms on appName. An empty perm only checks the app
+func (i *Identity) Authorize(appName string, perms ...string) error {
+
+	for _, perm := range perms {
+		if len(perm) != 0 && !i.HasPermission(perm) {
+			return status.Errorf(codes.PermissionDenied, "%s does not have the %s permission", i.Id, perm)
+		}
+	}
+
+	if len(appName) != 0 && !i.CanAccessApp(appName) {
+		return status.Errorf(codes.PermissionDenied, "%s is not allowed to access %s", i.Id, appName)
+	}
+
+	return nil
+}
+
+type identityKey struct{}
+
+//NewContext returns a copy of ctx that carries the identity
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+//FromContext returns the identity stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+//KeyStore holds the keys loaded from the keys file. It is safe for concurrent use and can be reloaded
+type KeyStore struct {
+	path string
+	keys map[string]*Identity
+	mx   sync.RWMutex
+}
+
+//NewKeyStore loads the keys file at path
+func NewKeyStore(path string) (*KeyStore, error) {
+
+	ks := &KeyStore{path: path}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+//Reload re-reads the keys file. The current keys are kept if the file cannot be read
+func (ks *KeyStore) Reload() error {
+
+	b, err := os.ReadFile(ks.path)
+	if err != nil {
+		return err
+	}
+
+	keysFile := KeysFile{}
+	if err := json.Unmarshal(b, &keysFile); err != nil {
+		return &KeysFileError{Path: ks.path, Message: err.Error()}
+	}
+
+	keys := make(map[string]*Identity, len(keysFile.Keys))
+	for _, k := range keysFile.Keys {
+
+		if len(strings.TrimSpace(k.Key)) == 0 || len(strings.TrimSpace(k.Id)) == 0 {
+			return &KeysFileError{Path: ks.path, Message: "every key needs an id and a key"}
+		}
+
+		if _, ok := keys[k.Key]; ok {
+			return &KeysFileError{Path: ks.path, Message: fmt.Sprintf("duplicate key for %s", k.Id)}
+		}
+
+		keys[k.Key] = &Identity{Id: k.Id, Apps: k.Apps, Permissions: k.Permissions}
+	}
+
+	ks.mx.Lock()
+	ks.keys = keys
+	ks.mx.Unlock()
+
+	logging.Default().Info("Loaded api keys", "keys", len(keys), "path", ks.path)
+
+	return nil
+}
+
+//Lookup returns the identity for an api key
+func (ks *KeyStore) Lookup(key string) (*Identity, bool) {
+
+	ks.mx.RLock()
+	defer ks.mx.RUnlock()
+
+	//Compare every key in constant time so the lookup does not leak how much of a key matched
+	var found *Identity
+	for k, id := range ks.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = id
+		}
+	}
+
+	return found, found != nil
+}
+
+//Authenticate resolves the api key passed in the request metadata
+func (ks *KeyStore) Authenticate(ctx context.Context) (*Identity, error) {
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	key := ""
+	if v := md.Get(ApiKeyHeader); len(v) != 0 {
+		key = v[0]
+	} else if v := md.Get(AuthorizationHeader); len(v) != 0 &&
+		strings.HasPrefix(strings.ToLower(v[0]), bearerPrefix) {
+		key = v[0][len(bearerPrefix):]
+	}
+
+	return ks.authenticateKey(key)
+}
+
+//AuthenticateRequest resolves the api key passed in the headers of an http request
+func (ks *KeyStore) AuthenticateRequest(r *http.Request) (*Identity, error) {
+
+	key := r.Header.Get(ApiKeyHeader)
+	if v := r.Header.Get(AuthorizationHeader); len(key) == 0 &&
+		strings.HasPrefix(strings.ToLower(v), bearerPrefix) {
+		key = v[len(bearerPrefix):]
+	}
+
+	return ks.authenticateKey(key)
+}
+
+func (ks *KeyStore) authenticateKey(key string) (*Identity, error) {
+
+	if len(key) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing api key")
+	}
+
+	id, ok := ks.Lookup(key)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+
+	return id, nil
+}
+
+type appNameGetter interface {
+	GetAppName() string
+}
+
+func (ks *KeyStore) authorize(ctx context.Context, method string, req interface{}) (context.Context, error) {
+
+	id, err := ks.Authenticate(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Rejected call", "method", method, "error", status.Convert(err).Message())
+		return ctx, err
+	}
+
+	perms, ok := MethodPermissions[method]
+	if !ok {
+		perms = []string{PermAdmin}
+	}
+
+	appName := ""
+	if r, ok := req.(appNameGetter); ok {
+		appName = r.GetAppName()
+	}
+
+	if err := id.Authorize(appName, perms...); err != nil {
+		logging.FromContext(ctx).Warn("Denied call", "method", method, "caller", id.Id, "error", status.Convert(err).Message())
+		return ctx, err
+	}
+
+	return NewContext(ctx, id), nil
+}
+
+//UnaryServerInterceptor authenticates and authorizes every unary call
+func (ks *KeyStore) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if PublicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		ctx, err := ks.authorize(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+//StreamServerInterceptor authenticates streaming calls. Streams carry no app name up front
+//so only the method permission is checked
+func (ks *KeyStore) StreamServerInterceptor() grpc.StreamServerInterceptor {
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+
+		if PublicMethods[info.FullMethod] {
+			return handler(srv, ss)
+		}
+
+		ctx, err := ks.authorize(ss.Context(), info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authServerStream{ss, ctx})
+	}
+}
+
+//KeysFileError is returned when the keys file is not valid
+type KeysFileError struct {
+	Path    string
+	Message string
+}
+
+func (e *KeysFileError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Path, e.Message)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testKeys = `{"keys":[
+	{"id":"producer","key":"producer-key","apps":["testproducer"],"permissions":["create","enqueue"]},
+	{"id":"creator","key":"creator-key","apps":["testproducer"],"permissions":["create"]},
+	{"id":"operator","key":"operator-key","apps":["*"],"permissions":["admin"]}
+]}`
+
+type testRequest struct {
+	AppName string
+}
+
+func (r *testRequest) GetAppName() string {
+	return r.AppName
+}
+
+func keyStoreSetup(t *testing.T, keys string) *KeyStore {
+
+	filePath := path.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(filePath, []byte(keys), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := NewKeyStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ks
+}
+
+func callWithKey(ks *KeyStore, key, method, appName string) error {
+
+	ctx := context.Background()
+	if len(key) != 0 {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(AuthorizationHeader, "Bearer "+key))
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if _, ok := FromContext(ctx); !ok {
+			return nil, status.Error(codes.Internal, "identity missing from context")
+		}
+		return nil, nil
+	}
+
+	_, err := ks.UnaryServerInterceptor()(ctx, &testRequest{appName}, info, handler)
+	return err
+}
+
+func TestInterceptor(t *testing.T) {
+
+	ks := keyStoreSetup(t, testKeys)
+
+	tests := []struct {
+		key     string
+		method  string
+		appName string
+		want    codes.Code
+	}{
+		{"producer-key", "/Ezqueued/Enqueue", "testproducer", codes.OK},
+		{"producer-key", "/Ezqueued/Dequeue", "testproducer", codes.PermissionDenied},
+		{"producer-key", "/Ezqueued/Enqueue", "otherapp", codes.PermissionDenied},
+		{"operator-key", "/Ezqueued/Dequeue", "otherapp", codes.OK},
+		{"", "/Ezqueued/Enqueue", "testproducer", codes.Unauthenticated},
+		{"wrong-key", "/Ezqueued/Enqueue", "testproducer", codes.Unauthenticated},
+		{"producer-key", "/EzqueueQueues/GetQueueStats", "testproducer", codes.OK},
+		{"producer-key", "/EzqueueQueues/GetQueueStats", "otherapp", codes.PermissionDenied},
+		{"producer-key", "/EzqueueQueues/PurgeQueue", "testproducer", codes.PermissionDenied},
+		{"operator-key", "/EzqueueQueues/PurgeQueue", "testproducer", codes.OK},
+		{"producer-key", "/EzqueueQueues/SendMessages", "testproducer", codes.OK},
+		{"producer-key", "/EzqueueQueues/ChangeVisibility", "testproducer", codes.PermissionDenied},
+		{"producer-key", "/EzqueueQueues/CreateSchedule", "testproducer", codes.OK},
+		{"creator-key", "/EzqueueQueues/CreateQueue", "testproducer", codes.OK},
+		{"creator-key", "/EzqueueQueues/CreateSchedule", "testproducer", codes.PermissionDenied},
+		{"creator-key", "/EzqueueQueues/PauseSchedule", "testproducer", codes.PermissionDenied},
+		{"creator-key", "/EzqueueQueues/ListSchedules", "testproducer", codes.OK},
+	}
+
+	for _, tc := range tests {
+		err := callWithKey(ks, tc.key, tc.method, tc.appName)
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("%s %s %s: want %v, got %v", tc.key, tc.method, tc.appName, tc.want, got)
+		}
+	}
+}
+
+func TestPublicMethods(t *testing.T) {
+
+	ks := keyStoreSetup(t, testKeys)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "serving", nil
+	}
+
+	//Container probes check health without an api key
+	if resp, err := ks.UnaryServerInterceptor()(context.Background(), nil, info, handler); resp != "serving" {
+		t.Errorf("Health check without a key: want the call to go through, got %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+
+	ks := keyStoreSetup(t, testKeys)
+
+	if err := os.WriteFile(ks.path, []byte(`{"keys":[{"id":"new","key":"new-key","apps":["*"],"permissions":["dequeue"]}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ks.Lookup("producer-key"); ok {
+		t.Errorf("Want producer-key removed after reload, still present")
+	}
+
+	if _, ok := ks.Lookup("new-key"); !ok {
+		t.Errorf("Want new-key after reload, not found")
+	}
+
+	//A broken file keeps the previous keys
+	if err := os.WriteFile(ks.path, []byte(`{"keys":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.Reload(); err == nil {
+		t.Errorf("Want error reloading a broken keys file, got nil")
+	}
+
+	if _, ok := ks.Lookup("new-key"); !ok {
+		t.Errorf("Want new-key kept after a failed reload, not found")
+	}
+}
@@ -0,0 +1,277 @@
+//Package client is the Go client of ezqueued. A Client holds one gRPC connection for both the Ezqueued and
+//EzqueueQueues services. Producer batches sends in the background and Consumer runs a handler over received
+//messages, acking or returning them and extending their lease while the handler runs.
+//Errors from the server come back as *errors.Error with the code the server used, see Error
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+)
+
+//Options for Dial. The zero value connects without TLS or an api key
+type Options struct {
+	ApiKey string      //sent as a bearer token with every call
+	TLS    *tls.Config //nil for a plain text connection
+	Retry  RetryPolicy //for calls that fail with codes.Unavailable
+
+	//KeepAlive pings the server when the connection is idle this long so a dead connection is noticed. 0 turns it off
+	KeepAlive time.Duration
+
+	DialOptions []grpc.DialOption //added after the options above
+}
+
+//Client is safe to use from many goroutines
+type Client struct {
+	conn   *grpc.ClientConn
+	queue  ezgrpc.EzqueuedClient
+	queues queuepb.EzqueueQueuesClient
+	apiKey string
+	retry  RetryPolicy
+}
+
+//Message is a received message. It stays hidden from other consumers until Deadline, or until it is deleted
+//or its visibility is changed with Receipt
+type Message struct {
+	Id           string
+	Body         string
+	Receipt      string
+	ReceiveCount uint32
+	Deadline     time.Time
+	Attributes   map[string]string
+	GroupId      string
+}
+
+//ReceiveOptions for Client.Receive. Zero values take the server defaults
+type ReceiveOptions struct {
+	MaxMessages       int           //1 when 0, at most 10
+	Wait              time.Duration //how long to wait for a message when the queue is empty, at most 20s
+	VisibilityTimeout time.Duration //the queue's setting when 0
+}
+
+//QueueOptions for Client.CreateQueue. delay and visibility timeout are in seconds like Create takes them
+type QueueOptions struct {
+	DelaySeconds      uint32
+	VisibilityTimeout uint32 //the server default when 0
+	Priority          bool   //messages with a higher priority are received first, FIFO within a priority
+	RetentionSeconds  uint32 //messages expire this long after they were sent, 0 to keep them until received
+	DeadLetterQueue   string //queue of the same app expired messages are moved to, empty to drop them
+}
+
+//SendOptions for Client.SendBatchWithOptions
+type SendOptions struct {
+	Priority   uint8     //0 to 9, only priority queues take a priority above 0
+	GroupId    string    //messages of a group are received one at a time in order, other groups in parallel
+	TtlSeconds uint32    //the messages expire this long after they were sent, 0 for the retention period of the queue
+	DeliverAt  time.Time //the messages stay hidden until then, at most 14 days ahead. Zero to deliver them right away
+
+	//DeduplicationIds has one id per message when set. A message whose id was sent within the server's dedup window
+	//is not added again and gets the id of the first one, so a batch that is retried does not add its messages twice
+	DeduplicationIds []string
+}
+
+//Dial connects to the ezqueued gRPC port at addr. The connection is made in the background and is
+//made again when it breaks, calls fail with codes.Unavailable while there is none
+func Dial(addr string, opts Options) (*Client, error) {
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: 5 * time.Second}),
+	}
+
+	if opts.TLS != nil {
+		dialOptions = append(dialOptions, grpc.WithTransportCredentials(credentials.NewTLS(opts.TLS)))
+	} else {
+		dialOptions = append(dialOptions, grpc.WithInsecure())
+	}
+
+	if opts.KeepAlive > 0 {
+		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: opts.KeepAlive, Timeout: opts.KeepAlive}))
+	}
+
+	conn, err := grpc.Dial(addr, append(dialOptions, opts.DialOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn:   conn,
+		queue:  ezgrpc.NewEzqueuedClient(conn),
+		queues: queuepb.NewEzqueueQueuesClient(conn),
+		apiKey: opts.ApiKey,
+		retry:  opts.Retry.withDefaults(),
+	}, nil
+}
+
+//Close closes the connection. Producers and consumers of the client must be closed first
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) context(ctx context.Context) context.Context {
+
+	if len(c.apiKey) == 0 {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.apiKey)
+}
+
+//call runs fn with the api key in the context, retrying it while the server is unavailable, and maps the error
+func (c *Client) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Error(c.retry.do(ctx, func() error { return fn(c.context(ctx)) }))
+}
+
+//Create creates a queue. delay and visibilityTimeout are in seconds, the server default visibility is used when it is 0
+func (c *Client) Create(ctx context.Context, appName, queueName string, delay, visibilityTimeout uint32) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queue.Create(ctx, &ezgrpc.CreateParams{AppName: appName, QueueName: queueName, DelaySeconds: delay, VisibilityTimeout: visibilityTimeout})
+		return err
+	})
+}
+
+//CreateQueue is Create for a queue with options, Ex: a priority queue
+func (c *Client) CreateQueue(ctx context.Context, appName, queueName string, opts QueueOptions) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queues.CreateQueue(ctx, &queuepb.CreateQueueParams{AppName: appName, QueueName: queueName,
+			DelaySeconds: opts.DelaySeconds, VisibilityTimeout: opts.VisibilityTimeout, Priority: opts.Priority,
+			RetentionSeconds: opts.RetentionSeconds, DeadLetterQueue: opts.DeadLetterQueue})
+		return err
+	})
+}
+
+//Send adds a message to a queue. A send that is retried after the connection broke may add the message twice
+func (c *Client) Send(ctx context.Context, appName, queueName, message string) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queue.Enqueue(ctx, &ezgrpc.EnqueueParams{AppName: appName, QueueName: queueName, Message: message})
+		return err
+	})
+}
+
+//SendBatch adds up to MaxBatch messages in one call and returns their ids
+func (c *Client) SendBatch(ctx context.Context, appName, queueName string, messages []string) ([]string, error) {
+	return c.SendBatchWithOptions(ctx, appName, queueName, messages, SendOptions{})
+}
+
+//SendBatchWithOptions is SendBatch for messages with options, Ex: their priority. The options apply to every message
+func (c *Client) SendBatchWithOptions(ctx context.Context, appName, queueName string, messages []string, opts SendOptions) ([]string, error) {
+
+	var deliverAt int64
+	if !opts.DeliverAt.IsZero() {
+		deliverAt = opts.DeliverAt.UnixMilli()
+	}
+
+	var ids []string
+	err := c.call(ctx, func(ctx context.Context) error {
+		result, err := c.queues.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: appName, QueueName: queueName, Messages: messages,
+			Priority: uint32(opts.Priority), GroupId: opts.GroupId, DeduplicationIds: opts.DeduplicationIds,
+			TtlSeconds: opts.TtlSeconds, DeliverAt: deliverAt})
+		if err == nil {
+			ids = result.Ids
+		}
+		return err
+	})
+
+	return ids, err
+}
+
+//Receive takes messages from a queue with a lease. It returns no messages and no error when the queue stays empty
+func (c *Client) Receive(ctx context.Context, appName, queueName string, opts ReceiveOptions) ([]*Message, error) {
+
+	var list *queuepb.ReceivedMessageList
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		list, err = c.queues.Receive(ctx, &queuepb.ReceiveParams{
+			AppName:           appName,
+			QueueName:         queueName,
+			VisibilityTimeout: uint32(opts.VisibilityTimeout / time.Second),
+			WaitSeconds:       uint32(opts.Wait / time.Second),
+			MaxMessages:       uint32(opts.MaxMessages),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*Message, 0, len(list.Messages))
+	for _, m := range list.Messages {
+		messages = append(messages, &Message{
+			Id:           m.Id,
+			Body:         m.Body,
+			Receipt:      m.Receipt,
+			ReceiveCount: m.ReceiveCount,
+			Deadline:     time.Unix(0, m.DeadlineUnixMillis*int64(time.Millisecond)),
+			Attributes:   m.Attributes,
+			GroupId:      m.GroupId,
+		})
+	}
+
+	return messages, nil
+}
+
+//Delete removes a received message from the queue for good
+func (c *Client) Delete(ctx context.Context, appName, queueName, receipt string) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queues.DeleteMessage(ctx, &queuepb.DeleteMessageParams{AppName: appName, QueueName: queueName, Receipt: receipt})
+		return err
+	})
+}
+
+//ChangeVisibility hides a received message for visibilityTimeout from now. 0 returns it to the queue at once
+func (c *Client) ChangeVisibility(ctx context.Context, appName, queueName, receipt string, visibilityTimeout time.Duration) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queues.ChangeVisibility(ctx, &queuepb.ChangeVisibilityParams{AppName: appName, QueueName: queueName, Receipt: receipt, VisibilityTimeout: uint32(visibilityTimeout / time.Second)})
+		return err
+	})
+}
+
+//VisibilityChange is one entry of Client.ChangeVisibilityBatch
+type VisibilityChange struct {
+	Receipt           string
+	VisibilityTimeout time.Duration //0 returns the message to the queue at once
+}
+
+//ChangeVisibilityBatch changes the leases of up to 100 received messages of a queue at once. It returns the error of
+//each change in the order of changes, nil where it succeeded. A stale receipt fails with errors.RECEIPT_STALE
+func (c *Client) ChangeVisibilityBatch(ctx context.Context, appName, queueName string, changes []VisibilityChange) ([]error, error) {
+
+	params := &queuepb.ChangeVisibilityBatchParams{AppName: appName, QueueName: queueName}
+	for _, change := range changes {
+		params.Entries = append(params.Entries, &queuepb.ChangeVisibilityEntry{Receipt: change.Receipt, VisibilityTimeout: uint32(change.VisibilityTimeout / time.Second)})
+	}
+
+	var result *queuepb.ChangeVisibilityBatchResult
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = c.queues.ChangeVisibilityBatch(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(changes))
+	for i, r := range result.Results {
+		if i < len(errs) && len(r.ErrorCode) != 0 {
+			errs[i] = &e.Error{AppName: appName, Name: queueName, ErrorCode: codeByName(r.ErrorCode), ErrorMessage: r.Error}
+		}
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+)
+
+//fakeServer keeps one queue in memory with leases
+type fakeServer struct {
+	ezgrpc.UnimplementedEzqueuedServer
+	queuepb.UnimplementedEzqueueQueuesServer
+
+	mutex       sync.Mutex
+	messages    []*queuepb.ReceivedMessage
+	inFlight    map[string]*queuepb.ReceivedMessage
+	batches     [][]string
+	unavailable int //SendMessages calls to fail with Unavailable
+	extensions  int
+	keys        []string
+	next        int
+}
+
+func (f *fakeServer) SendMessages(ctx context.Context, in *queuepb.SendMessagesParams) (*queuepb.SendMessagesResult, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		f.keys = append(f.keys, md.Get("authorization")...)
+	}
+
+	if f.unavailable > 0 {
+		f.unavailable--
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	if in.QueueName != "queue" {
+		return nil, status.Error(codes.NotFound, e.ErrorQueueDoesNotExist)
+	}
+
+	f.batches = append(f.batches, in.Messages)
+
+	result := &queuepb.SendMessagesResult{}
+	for _, body := range in.Messages {
+		f.next++
+		id := strconv.Itoa(f.next)
+		f.messages = append(f.messages, &queuepb.ReceivedMessage{Id: id, Body: body})
+		result.Ids = append(result.Ids, id)
+	}
+
+	return result, nil
+}
+
+func (f *fakeServer) Receive(ctx context.Context, in *queuepb.ReceiveParams) (*queuepb.ReceivedMessageList, error) {
+
+	if in.QueueName != "queue" {
+		return nil, status.Error(codes.NotFound, e.ErrorQueueDoesNotExist)
+	}
+
+	list := &queuepb.ReceivedMessageList{}
+	for wait := time.Now().Add(time.Duration(in.WaitSeconds) * time.Second); ; time.Sleep(10 * time.Millisecond) {
+
+		f.mutex.Lock()
+		for len(f.messages) != 0 && len(list.Messages) < int(in.MaxMessages) {
+			m := f.messages[0]
+			f.messages = f.messages[1:]
+
+			f.next++
+			m.Receipt = "receipt-" + strconv.Itoa(f.next)
+			m.ReceiveCount++
+			m.DeadlineUnixMillis = time.Now().Add(time.Duration(in.VisibilityTimeout)*time.Second).UnixNano() / int64(time.Millisecond)
+			f.inFlight[m.Receipt] = m
+
+			list.Messages = append(list.Messages, m)
+		}
+		f.mutex.Unlock()
+
+		if len(list.Messages) != 0 || time.Now().After(wait) || ctx.Err() != nil {
+			return list, nil
+		}
+	}
+}
+
+func (f *fakeServer) DeleteMessage(ctx context.Context, in *queuepb.DeleteMessageParams) (*queuepb.Result, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.inFlight[in.Receipt]; !ok {
+		return nil, status.Error(codes.InvalidArgument, e.ErrorReceiptInvalid)
+	}
+	delete(f.inFlight, in.Receipt)
+
+	return &queuepb.Result{}, nil
+}
+
+func (f *fakeServer) ChangeVisibility(ctx context.Context, in *queuepb.ChangeVisibilityParams) (*queuepb.Result, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	m, ok := f.inFlight[in.Receipt]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, e.ErrorReceiptInvalid)
+	}
+
+	if in.VisibilityTimeout == 0 {
+		delete(f.inFlight, in.Receipt)
+		f.messages = append(f.messages, m)
+	} else {
+		f.extensions++
+	}
+
+	return &queuepb.Result{}, nil
+}
+
+func (f *fakeServer) ChangeVisibilityBatch(ctx context.Context, in *queuepb.ChangeVisibilityBatchParams) (*queuepb.ChangeVisibilityBatchResult, error) {
+
+	result := &queuepb.ChangeVisibilityBatchResult{}
+	for _, entry := range in.Entries {
+		r := &queuepb.ChangeVisibilityEntryResult{Receipt: entry.Receipt}
+		if _, err := f.ChangeVisibility(ctx, &queuepb.ChangeVisibilityParams{Receipt: entry.Receipt, VisibilityTimeout: entry.VisibilityTimeout}); err != nil {
+			r.ErrorCode, r.Error = e.CodeNames[e.RECEIPT_STALE], e.ErrorReceiptStale
+		}
+		result.Results = append(result.Results, r)
+	}
+
+	return result, nil
+}
+
+func fakeServerSetup(t *testing.T) (*fakeServer, *Client) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeServer{inFlight: make(map[string]*queuepb.ReceivedMessage)}
+	server := grpc.NewServer()
+	ezgrpc.RegisterEzqueuedServer(server, f)
+	queuepb.RegisterEzqueueQueuesServer(server, f)
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	c, err := Dial(listener.Addr().String(), Options{ApiKey: "secret", Retry: RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return f, c
+}
+
+func TestError(t *testing.T) {
+
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{status.Error(codes.NotFound, e.ErrorQueueEmpty), e.QUEUE_EMPTY},
+		{status.Error(codes.NotFound, e.ErrorQueueDoesNotExist), e.QUEUE_DOES_NOT_EXIST},
+		{status.Error(codes.AlreadyExists, e.ErrorAppQuenameExists), e.ALREADY_EXISTS},
+		{status.Error(codes.InvalidArgument, e.ErrorReceiptInvalid), e.RECEIPT_INVALID},
+		{status.Error(codes.InvalidArgument, e.ErrorReceiptStale), e.RECEIPT_STALE},
+		{status.Error(codes.InvalidArgument, e.ErrorReceiptNotInFlight), e.RECEIPT_INVALID},
+		{status.Error(codes.InvalidArgument, "MaxMessages must be at most 10"), e.INVALID_INPUT},
+	}
+
+	for _, test := range tests {
+		if err := Error(test.err); !IsCode(err, test.code) {
+			t.Errorf("Error(%v): want code %s, got %v", test.err, e.CodeNames[test.code], err)
+		}
+	}
+
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	if err := Error(unavailable); err != unavailable || !IsUnavailable(err) {
+		t.Errorf("Error of Unavailable: want the status, got %v", err)
+	}
+	if Error(nil) != nil {
+		t.Error("Error(nil): want nil")
+	}
+}
+
+func TestProducer(t *testing.T) {
+
+	f, c := fakeServerSetup(t)
+	f.unavailable = 2
+
+	p := c.NewProducer("app", "queue", ProducerOptions{BatchSize: 3, Linger: time.Hour})
+	for i := 1; i <= 7; i++ {
+		if err := p.Send(context.Background(), strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: want the batches sent after the retries, got %v", err)
+	}
+
+	f.mutex.Lock()
+	if len(f.batches) != 3 || len(f.batches[0]) != 3 || len(f.batches[2]) != 1 || f.batches[2][0] != "7" {
+		t.Errorf("Producer: want batches of 3, 3 and 1 in order, got %q", f.batches)
+	}
+	if len(f.keys) == 0 || f.keys[0] != "Bearer secret" {
+		t.Errorf("Producer: want the api key as a bearer token, got %q", f.keys)
+	}
+	f.mutex.Unlock()
+
+	//Batches that cannot be sent go to OnError
+	var failed []string
+	var failedErr error
+	p2 := c.NewProducer("app", "missing", ProducerOptions{Linger: time.Millisecond, OnError: func(messages []string, err error) { failed, failedErr = messages, err }})
+	p2.Send(context.Background(), "lost")
+	if err := p2.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || !IsCode(failedErr, e.QUEUE_DOES_NOT_EXIST) {
+		t.Errorf("Producer OnError: want the message and QUEUE_DOES_NOT_EXIST, got %q %v", failed, failedErr)
+	}
+
+	if err := p2.Send(context.Background(), "late"); err != ErrProducerClosed {
+		t.Errorf("Send after Close: want ErrProducerClosed, got %v", err)
+	}
+	p.Close(context.Background())
+}
+
+func TestConsumer(t *testing.T) {
+
+	f, c := fakeServerSetup(t)
+
+	if _, err := c.SendBatch(context.Background(), "app", "queue", []string{"ok", "fail once", "slow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mutex sync.Mutex
+	handled := make(map[string]uint32)
+
+	consumer := c.NewConsumer("app", "queue", ConsumerOptions{Workers: 3, VisibilityTimeout: 2 * time.Second, Wait: time.Second})
+
+	done := make(chan error)
+	go func() {
+		done <- consumer.Run(ctx, func(ctx context.Context, m *Message) error {
+
+			if m.Body == "slow" {
+				time.Sleep(1200 * time.Millisecond)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			handled[m.Body] = m.ReceiveCount
+
+			if m.Body == "fail once" && m.ReceiveCount == 1 {
+				return context.DeadlineExceeded
+			}
+			if len(handled) == 3 && handled["fail once"] == 2 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run: want all three messages handled")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.messages) != 0 || len(f.inFlight) != 0 {
+		t.Errorf("Consumer: want every message acked, got %d queued and %d in flight", len(f.messages), len(f.inFlight))
+	}
+	if handled["fail once"] != 2 {
+		t.Errorf("Consumer: want the failed message received again, got receive count %d", handled["fail once"])
+	}
+	if f.extensions == 0 {
+		t.Error("Consumer: want the lease of the slow message extended")
+	}
+}
+
+func TestConsumerMissingQueue(t *testing.T) {
+
+	_, c := fakeServerSetup(t)
+
+	err := c.NewConsumer("app", "missing", ConsumerOptions{}).Run(context.Background(), func(ctx context.Context, m *Message) error { return nil })
+	if !IsCode(err, e.QUEUE_DOES_NOT_EXIST) {
+		t.Errorf("Run on a missing queue: want QUEUE_DOES_NOT_EXIST, got %v", err)
+	}
+}
+
+func TestChangeVisibilityBatch(t *testing.T) {
+
+	f, c := fakeServerSetup(t)
+	ctx := context.Background()
+
+	if _, err := c.SendBatch(ctx, "app", "queue", []string{"one", "two"}); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := c.Receive(ctx, "app", "queue", ReceiveOptions{MaxMessages: 2})
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Receive: want 2 messages, got %v %v", messages, err)
+	}
+
+	errs, err := c.ChangeVisibilityBatch(ctx, "app", "queue", []VisibilityChange{
+		{messages[0].Receipt, time.Minute}, {"stale", time.Minute}, {messages[1].Receipt, time.Minute}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 3 || errs[0] != nil || !IsCode(errs[1], e.RECEIPT_STALE) || errs[2] != nil {
+		t.Errorf("ChangeVisibilityBatch: want only the stale receipt to fail, got %v", errs)
+	}
+	if f.extensions != 2 {
+		t.Errorf("ChangeVisibilityBatch: want 2 leases extended, got %d", f.extensions)
+	}
+}
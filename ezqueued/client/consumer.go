@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//Handler processes a received message. The message is deleted when it returns nil and returned to the
+//queue for another try when it returns an error
+type Handler func(ctx context.Context, m *Message) error
+
+//ConsumerOptions for NewConsumer. Zero values take the defaults
+type ConsumerOptions struct {
+	Workers int //handlers run at once, 1 when 0
+
+	//VisibilityTimeout is the lease taken on each message, the queue's setting when 0. While the handler runs
+	//the lease is extended by this much each time half of it has passed
+	VisibilityTimeout time.Duration
+
+	Wait time.Duration //how long each receive call waits for messages, 20s when 0
+
+	//OnError is called with errors of receive, ack, nack and lease extension calls. They are ignored when it is nil
+	OnError func(err error)
+}
+
+//Consumer receives the messages of one queue and runs a handler on each in a pool of workers
+type Consumer struct {
+	client    *Client
+	appName   string
+	queueName string
+	opts      ConsumerOptions
+}
+
+//settleTimeout bounds the ack or nack of a message after the consumer was stopped
+const settleTimeout = 10 * time.Second
+
+//NewConsumer makes a consumer for a queue. Nothing is received until Run
+func (c *Client) NewConsumer(appName, queueName string, opts ConsumerOptions) *Consumer {
+
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Wait <= 0 || opts.Wait > 20*time.Second {
+		opts.Wait = 20 * time.Second
+	}
+
+	return &Consumer{client: c, appName: appName, queueName: queueName, opts: opts}
+}
+
+func (c *Consumer) onError(err error) {
+
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
+
+//Run receives messages and runs h on them until ctx is done, then waits for the running handlers to finish.
+//Messages are only received for idle workers, so a slow handler does not hold leases on messages it cannot start.
+//Run returns nil when ctx is done, or the error of a receive that cannot be retried, such as a missing queue
+func (c *Consumer) Run(ctx context.Context, h Handler) error {
+
+	idle := make(chan struct{}, c.opts.Workers)
+	for i := 0; i < c.opts.Workers; i++ {
+		idle <- struct{}{}
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		//Wait for at least one idle worker, then take the others that are idle
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return nil
+		}
+		workers := 1
+		for taking := true; taking && workers < MaxBatch; {
+			select {
+			case <-idle:
+				workers++
+			default:
+				taking = false
+			}
+		}
+
+		messages, err := c.client.Receive(ctx, c.appName, c.queueName, ReceiveOptions{MaxMessages: workers, Wait: c.opts.Wait, VisibilityTimeout: c.opts.VisibilityTimeout})
+		if ctx.Err() != nil {
+			c.release(messages)
+			return nil
+		}
+		if err != nil {
+			if !IsUnavailable(err) {
+				return err
+			}
+
+			//The retries ran out, keep trying at the longest backoff until the server is back
+			c.onError(err)
+			select {
+			case <-time.After(c.client.retry.MaxBackoff):
+			case <-ctx.Done():
+			}
+		}
+
+		//Workers that got no message go back to idle
+		for i := len(messages); i < workers; i++ {
+			idle <- struct{}{}
+		}
+
+		for _, m := range messages {
+			wg.Add(1)
+			go func(m *Message) {
+				defer wg.Done()
+				defer func() { idle <- struct{}{} }()
+				c.handle(ctx, h, m)
+			}(m)
+		}
+	}
+}
+
+//release returns messages that were received as the consumer stopped to the queue
+func (c *Consumer) release(messages []*Message) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+
+	for _, m := range messages {
+		if err := c.client.ChangeVisibility(ctx, c.appName, c.queueName, m.Receipt, 0); err != nil {
+			c.onError(err)
+		}
+	}
+}
+
+//handle runs h on a message while extending its lease, then acks or nacks it
+func (c *Consumer) handle(ctx context.Context, h Handler, m *Message) {
+
+	extension := c.opts.VisibilityTimeout
+	if extension == 0 {
+		extension = time.Until(m.Deadline).Round(time.Second)
+	}
+
+	handled := make(chan struct{})
+	var extender sync.WaitGroup
+	if extension >= 2*time.Second {
+		extender.Add(1)
+		go func() {
+			defer extender.Done()
+			c.extendLease(handled, m, extension)
+		}()
+	}
+
+	err := h(ctx, m)
+	close(handled)
+	extender.Wait()
+
+	settleCtx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+
+	if err == nil {
+		err = c.client.Delete(settleCtx, c.appName, c.queueName, m.Receipt)
+	} else {
+		err = c.client.ChangeVisibility(settleCtx, c.appName, c.queueName, m.Receipt, 0)
+	}
+	if err != nil {
+		c.onError(err)
+	}
+}
+
+//extendLease pushes the deadline of the message out by extension each time half of it has passed, until handled is closed
+func (c *Consumer) extendLease(handled <-chan struct{}, m *Message, extension time.Duration) {
+
+	ticker := time.NewTicker(extension / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-handled:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), extension/2)
+			err := c.client.ChangeVisibility(ctx, c.appName, c.queueName, m.Receipt, extension)
+			cancel()
+
+			if err != nil {
+				c.onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+)
+
+//messageCodes maps the messages the server sends with its statuses back to the error codes
+var messageCodes = map[string]int{
+	e.ErrorAppQuenameExists:     e.ALREADY_EXISTS,
+	e.ErrorQueueEmpty:           e.QUEUE_EMPTY,
+	e.ErrorQueueDoesNotExist:    e.QUEUE_DOES_NOT_EXIST,
+	e.ErrorInvalidInput:         e.INVALID_INPUT,
+	e.ErrorReceiptInvalid:       e.RECEIPT_INVALID,
+	e.ErrorReceiptStale:         e.RECEIPT_STALE,
+	e.ErrorReceiptNotInFlight:   e.RECEIPT_INVALID,
+	e.ErrorScheduleExists:       e.ALREADY_EXISTS,
+	e.ErrorScheduleDoesNotExist: e.SCHEDULE_DOES_NOT_EXIST,
+}
+
+//statusCodes is used for statuses whose message is not one of messageCodes
+var statusCodes = map[codes.Code]int{
+	codes.AlreadyExists:   e.ALREADY_EXISTS,
+	codes.NotFound:        e.QUEUE_DOES_NOT_EXIST,
+	codes.InvalidArgument: e.INVALID_INPUT,
+}
+
+//Error turns a gRPC status from the server into an *errors.Error with the server's error code.
+//Statuses that have no error code, such as codes.Unavailable or codes.PermissionDenied, are returned as they are
+func Error(err error) error {
+
+	s, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+
+	code, ok := messageCodes[s.Message()]
+	if !ok {
+		if code, ok = statusCodes[s.Code()]; !ok {
+			return err
+		}
+	}
+
+	return &e.Error{ErrorCode: code, ErrorMessage: s.Message()}
+}
+
+//codeByName returns the error code with the name, e.CodeNames the other way round. -1 for an unknown name
+func codeByName(name string) int {
+
+	for code, codeName := range e.CodeNames {
+		if codeName == name {
+			return code
+		}
+	}
+
+	return -1
+}
+
+//IsCode reports if err is an *errors.Error with the code
+func IsCode(err error, code int) bool {
+
+	qErr, ok := err.(*e.Error)
+	return ok && qErr.ErrorCode == code
+}
+
+//IsUnavailable reports if err is a codes.Unavailable status, that is the server could not be reached
+func IsUnavailable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+//RetryPolicy retries calls that fail with codes.Unavailable, waiting longer after each attempt
+type RetryPolicy struct {
+	MaxAttempts    int           //calls made before giving up, 5 when 0. 1 turns retries off
+	InitialBackoff time.Duration //wait after the first failure, 100ms when 0
+	MaxBackoff     time.Duration //longest wait, 5s when 0
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 5
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+
+	return p
+}
+
+//do calls fn until it succeeds, fails with another code, runs out of attempts or ctx is done
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+
+	backoff := p.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+
+		err := fn()
+		if !IsUnavailable(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		//Full jitter so clients that lost the server together do not come back together
+		wait := time.Duration(rand.Int63n(int64(backoff)) + 1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		if backoff *= 2; backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
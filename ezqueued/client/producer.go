@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+//MaxBatch is the most messages the server takes in one SendBatch call
+const MaxBatch = 10
+
+//ErrProducerClosed is returned by Send after Close
+var ErrProducerClosed = errors.New("the producer is closed")
+
+//ProducerOptions for NewProducer. Zero values take the defaults
+type ProducerOptions struct {
+	BatchSize  int           //messages sent in one call, MaxBatch when 0
+	Linger     time.Duration //how long a batch that is not full waits for more messages, 10ms when 0
+	BufferSize int           //messages Send can take before it blocks, 1000 when 0
+
+	//OnError is called from the producer's goroutine with the messages of a batch that could not be sent,
+	//after the retries ran out. Messages of failed batches are dropped when it is nil
+	OnError func(messages []string, err error)
+}
+
+//Producer sends messages to one queue in the background, in batches and in the order Send took them
+type Producer struct {
+	client    *Client
+	appName   string
+	queueName string
+	opts      ProducerOptions
+
+	requests chan produceRequest
+	done     chan struct{}
+
+	closeOnce sync.Once
+	mutex     sync.RWMutex
+	closed    bool
+}
+
+//produceRequest is a message to send, or a flush when flushed is set
+type produceRequest struct {
+	message string
+	flushed chan error
+}
+
+//NewProducer starts a producer for a queue. Close it to send what is buffered and stop it
+func (c *Client) NewProducer(appName, queueName string, opts ProducerOptions) *Producer {
+
+	if opts.BatchSize <= 0 || opts.BatchSize > MaxBatch {
+		opts.BatchSize = MaxBatch
+	}
+	if opts.Linger <= 0 {
+		opts.Linger = 10 * time.Millisecond
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1000
+	}
+
+	p := &Producer{
+		client:    c,
+		appName:   appName,
+		queueName: queueName,
+		opts:      opts,
+		requests:  make(chan produceRequest, opts.BufferSize),
+		done:      make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+//Send buffers a message to be sent. It blocks while the buffer is full, until ctx is done
+func (p *Producer) Send(ctx context.Context, message string) error {
+	return p.enqueue(ctx, produceRequest{message: message})
+}
+
+//Flush sends the buffered messages and returns the first error of a batch since the last Flush
+func (p *Producer) Flush(ctx context.Context) error {
+
+	flushed := make(chan error, 1)
+	if err := p.enqueue(ctx, produceRequest{flushed: flushed}); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-flushed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Producer) enqueue(ctx context.Context, r produceRequest) error {
+
+	//The read lock keeps Close from closing the channel while a request is being added to it
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	select {
+	case p.requests <- r:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//Close sends the buffered messages and stops the producer. It returns early with ctx's error, the rest is still sent
+func (p *Producer) Close(ctx context.Context) error {
+
+	p.closeOnce.Do(func() {
+		p.mutex.Lock()
+		p.closed = true
+		close(p.requests)
+		p.mutex.Unlock()
+	})
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//run collects messages into batches and sends a batch when it is full, when it has waited Linger or on a flush
+func (p *Producer) run() {
+
+	defer close(p.done)
+
+	var batch []string
+	var flushErr error
+	linger := time.NewTimer(time.Hour)
+	linger.Stop()
+
+	send := func() {
+
+		if len(batch) == 0 {
+			return
+		}
+
+		_, err := p.client.SendBatch(context.Background(), p.appName, p.queueName, batch)
+		if err != nil {
+			if flushErr == nil {
+				flushErr = err
+			}
+			if p.opts.OnError != nil {
+				p.opts.OnError(batch, err)
+			}
+		}
+
+		batch = nil
+		if !linger.Stop() {
+			select {
+			case <-linger.C:
+			default:
+			}
+		}
+	}
+
+	for {
+		select {
+		case r, ok := <-p.requests:
+			if !ok {
+				send()
+				return
+			}
+
+			if r.flushed != nil {
+				send()
+				r.flushed <- flushErr
+				flushErr = nil
+				continue
+			}
+
+			batch = append(batch, r.message)
+			if len(batch) == 1 {
+				linger.Reset(p.opts.Linger)
+			}
+			if len(batch) == p.opts.BatchSize {
+				send()
+			}
+
+		case <-linger.C:
+			send()
+		}
+	}
+}
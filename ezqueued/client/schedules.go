@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+)
+
+//Schedules are run by the server, which sends their payload to a queue at each tick of a cron expression
+
+//ScheduleOptions for Client.CreateSchedule
+type ScheduleOptions struct {
+	QueueName   string //queue of the app the messages are sent to
+	Cron        string //minute hour day-of-month month day-of-week, Ex: "0 9 * * mon-fri", or a macro like "@daily"
+	Timezone    string //IANA time zone Cron is read in, Ex: "Europe/Berlin". UTC when empty
+	Payload     string //body of the message sent at each tick
+	MissedTicks string //what to send for the ticks missed while the server was down: skip, once or all. once when empty
+}
+
+//Schedule is a schedule returned by Client.ListSchedules
+type Schedule struct {
+	AppName string
+	Name    string
+	ScheduleOptions
+	Paused   bool
+	LastTick time.Time //the latest tick that was handled
+	NextTick time.Time //zero if the expression never matches again
+}
+
+//CreateSchedule adds a schedule named name to the app. Its first message is sent at the first tick after now
+func (c *Client) CreateSchedule(ctx context.Context, appName, name string, opts ScheduleOptions) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queues.CreateSchedule(ctx, &queuepb.CreateScheduleParams{AppName: appName, Name: name, QueueName: opts.QueueName,
+			Cron: opts.Cron, Timezone: opts.Timezone, Payload: opts.Payload, MissedTicks: opts.MissedTicks})
+		return err
+	})
+}
+
+//ListSchedules returns the schedules of the app, or of every app the api key can access when appName is empty
+func (c *Client) ListSchedules(ctx context.Context, appName string) ([]Schedule, error) {
+
+	var list *queuepb.ScheduleList
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		list, err = c.queues.ListSchedules(ctx, &queuepb.ListSchedulesParams{AppName: appName})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]Schedule, 0, len(list.Schedules))
+	for _, s := range list.Schedules {
+		schedule := Schedule{
+			AppName:         s.AppName,
+			Name:            s.Name,
+			ScheduleOptions: ScheduleOptions{s.QueueName, s.Cron, s.Timezone, s.Payload, s.MissedTicks},
+			Paused:          s.Paused,
+			LastTick:        time.UnixMilli(s.LastTickUnixMillis),
+		}
+		if s.NextTickUnixMillis != 0 {
+			schedule.NextTick = time.UnixMilli(s.NextTickUnixMillis)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+//PauseSchedule stops a schedule until it is resumed. Its ticks while it is paused are skipped
+func (c *Client) PauseSchedule(ctx context.Context, appName, name string) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queues.PauseSchedule(ctx, &queuepb.ScheduleParams{AppName: appName, Name: name})
+		return err
+	})
+}
+
+//ResumeSchedule runs a paused schedule again from its next tick
+func (c *Client) ResumeSchedule(ctx context.Context, appName, name string) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queues.ResumeSchedule(ctx, &queuepb.ScheduleParams{AppName: appName, Name: name})
+		return err
+	})
+}
+
+//DeleteSchedule removes a schedule
+func (c *Client) DeleteSchedule(ctx context.Context, appName, name string) error {
+
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.queues.DeleteSchedule(ctx, &queuepb.ScheduleParams{AppName: appName, Name: name})
+		return err
+	})
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+)
+
+//maxReceiveWait is the longest wait the server takes in one Receive call
+const maxReceiveWait = 20 * time.Second
+
+//Queue is the JSON output of list and stats
+type Queue struct {
+	App               string `json:"app"`
+	Queue             string `json:"queue"`
+	DelaySeconds      uint32 `json:"delay_seconds"`
+	VisibilityTimeout uint32 `json:"visibility_timeout"`
+	Visible           uint64 `json:"visible"`
+	InFlight          uint64 `json:"in_flight"`
+	Delayed           uint64 `json:"delayed,omitempty"`
+	Priority          bool   `json:"priority,omitempty"`
+	RetentionSeconds  uint32 `json:"retention_seconds,omitempty"`
+	DeadLetterQueue   string `json:"dead_letter_queue,omitempty"`
+}
+
+func toQueue(d *queuepb.QueueDetails) Queue {
+	return Queue{d.AppName, d.QueueName, d.DelaySeconds, d.VisibilityTimeout, d.Visible, d.InFlight, d.Delayed, d.Priority, d.RetentionSeconds, d.DeadLetterQueue}
+}
+
+//Message is the JSON output of receive and peek
+type Message struct {
+	Id           string            `json:"id,omitempty"`
+	Body         string            `json:"body"`
+	Receipt      string            `json:"receipt,omitempty"`
+	ReceiveCount uint32            `json:"receive_count,omitempty"`
+	Deadline     *time.Time        `json:"deadline,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	GroupId      string            `json:"group_id,omitempty"`
+	Acked        bool              `json:"acked,omitempty"`
+}
+
+var createCommand = &command{
+	usage:   "create [-delay s] [-visibility s] [-priority] [-retention s] [-dlq queue] <app> <queue>",
+	summary: "Create a queue",
+	args:    2,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+
+		delay := fs.Uint("delay", 0, "seconds a message waits before it can be received")
+		visibility := fs.Uint("visibility", 0, "seconds a received message stays hidden. The server default is used when 0")
+		priority := fs.Bool("priority", false, "create a priority queue, messages sent with a higher -priority are received first")
+		retention := fs.Uint("retention", 0, "seconds after which a message expires. Messages are kept until received when 0")
+		dlq := fs.String("dlq", "", "queue of the same app expired messages are moved to. They are dropped when not set")
+
+		return func(c *client, args []string) int {
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			var err error
+			if *priority || *retention != 0 || len(*dlq) != 0 {
+				_, err = c.queues.CreateQueue(ctx, &queuepb.CreateQueueParams{AppName: args[0], QueueName: args[1], DelaySeconds: uint32(*delay), VisibilityTimeout: uint32(*visibility),
+					Priority: *priority, RetentionSeconds: uint32(*retention), DeadLetterQueue: *dlq})
+			} else {
+				_, err = c.queue.Create(ctx, &ezgrpc.CreateParams{AppName: args[0], QueueName: args[1], DelaySeconds: uint32(*delay), VisibilityTimeout: uint32(*visibility)})
+			}
+			if err != nil {
+				return c.fail(err)
+			}
+
+			if c.json {
+				c.printJson(map[string]string{"app": args[0], "queue": args[1]})
+			}
+
+			return exitOk
+		}
+	},
+}
+
+var sendCommand = &command{
+	usage:   "send [-file path] [-priority n] [-group id] [-dedup id] [-ttl s] [-at time] <app> <queue> [message]",
+	summary: "Send the message argument, or each line of the file or stdin as a message",
+	args:    -1,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+
+		fileFlag := fs.String("file", "", "file to read messages from, one per line. - for stdin")
+		priorityFlag := fs.Uint("priority", 0, "priority of the messages in a priority queue, 0 to 9")
+		groupFlag := fs.String("group", "", "group of the messages. A group's messages are received one at a time in order")
+		dedupFlag := fs.String("dedup", "", "deduplication id of the message argument. It is not added again if the id was sent recently")
+		ttlFlag := fs.Uint("ttl", 0, "seconds after which the messages expire. The retention period of the queue is used when 0")
+		atFlag := fs.String("at", "", "when the messages become visible, an RFC 3339 time or a duration from now such as 2h")
+
+		return func(c *client, args []string) int {
+
+			const usage = "send [-file path] [-priority n] [-group id] [-dedup id] [-ttl s] [-at time] <app> <queue> [message]"
+			if !c.checkArgs(args, 2, usage) {
+				return exitUsage
+			}
+
+			file := *fileFlag
+
+			var deliverAt int64
+			if len(*atFlag) != 0 {
+				at, err := parseDeliverAt(*atFlag, time.Now())
+				if err != nil {
+					fmt.Fprintf(c.stderr, "ezq: %v\n", err)
+					return exitUsage
+				}
+				deliverAt = at.UnixMilli()
+			}
+
+			var messages []string
+			switch {
+			case len(args) > 2 && len(file) != 0:
+				fmt.Fprintln(c.stderr, "ezq: give either a message or -file, not both")
+				return exitUsage
+			case len(args) <= 2 && len(*dedupFlag) != 0:
+				fmt.Fprintln(c.stderr, "ezq: -dedup needs a message argument")
+				return exitUsage
+			case len(args) > 2:
+				messages = []string{strings.Join(args[2:], " ")}
+			case len(file) != 0 && file != "-":
+				f, err := os.Open(file)
+				if err != nil {
+					return c.fail(err)
+				}
+				defer f.Close()
+				if messages, err = splitLines(f); err != nil {
+					return c.fail(err)
+				}
+			default:
+				var err error
+				if messages, err = splitLines(c.stdin); err != nil {
+					return c.fail(err)
+				}
+			}
+
+			sent := 0
+			for _, m := range messages {
+				ctx, cancel := c.context(0)
+				var err error
+				if *priorityFlag != 0 || len(*groupFlag) != 0 || len(*dedupFlag) != 0 || *ttlFlag != 0 || deliverAt != 0 {
+					params := &queuepb.SendMessagesParams{AppName: args[0], QueueName: args[1], Messages: []string{m}, Priority: uint32(*priorityFlag), GroupId: *groupFlag,
+						TtlSeconds: uint32(*ttlFlag), DeliverAt: deliverAt}
+					if len(*dedupFlag) != 0 {
+						params.DeduplicationIds = []string{*dedupFlag}
+					}
+					_, err = c.queues.SendMessages(ctx, params)
+				} else {
+					_, err = c.queue.Enqueue(ctx, &ezgrpc.EnqueueParams{AppName: args[0], QueueName: args[1], Message: m})
+				}
+				cancel()
+
+				if err != nil {
+					fmt.Fprintf(c.stderr, "ezq: sent %d of %d messages\n", sent, len(messages))
+					return c.fail(err)
+				}
+				sent++
+			}
+
+			if c.json {
+				c.printJson(map[string]int{"sent": sent})
+			}
+
+			return exitOk
+		}
+	},
+}
+
+var receiveCommand = &command{
+	usage:   "receive [-count n] [-wait d] [-visibility s] [-ack] <app> <queue>",
+	summary: "Receive messages with a lease and print their bodies, or JSON with the receipts",
+	args:    2,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+
+		countFlag := fs.Int("count", 1, "messages to receive. 0 receives until the queue is empty")
+		waitFlag := fs.Duration("wait", 0, "how long to wait for messages when the queue is empty, Ex: 30s")
+		visibilityFlag := fs.Uint("visibility", 0, "seconds the messages stay hidden. The queue's setting is used when 0")
+		ackFlag := fs.Bool("ack", false, "delete each message once it is printed")
+
+		return func(c *client, args []string) int {
+
+			count, wait, visibility, ack := *countFlag, *waitFlag, *visibilityFlag, *ackFlag
+
+			if count < 0 {
+				fmt.Fprintln(c.stderr, "ezq: -count must not be negative")
+				return exitUsage
+			}
+
+			deadline := time.Now().Add(wait)
+			received := 0
+
+			for count == 0 || received < count {
+
+				//Waits longer than the server allows are made of several calls
+				callWait := time.Until(deadline)
+				if callWait < 0 {
+					callWait = 0
+				}
+				if callWait > maxReceiveWait {
+					callWait = maxReceiveWait
+				}
+
+				maxMessages := 10
+				if count != 0 && count-received < maxMessages {
+					maxMessages = count - received
+				}
+
+				ctx, cancel := c.context(callWait)
+				resp, err := c.queues.Receive(ctx, &queuepb.ReceiveParams{
+					AppName:           args[0],
+					QueueName:         args[1],
+					VisibilityTimeout: uint32(visibility),
+					WaitSeconds:       uint32(callWait / time.Second),
+					MaxMessages:       uint32(maxMessages),
+				})
+				cancel()
+
+				if err != nil {
+					return c.fail(err)
+				}
+
+				if len(resp.Messages) == 0 {
+					if time.Now().Before(deadline) {
+						continue
+					}
+					break
+				}
+
+				for _, m := range resp.Messages {
+					if ack {
+						ctx, cancel := c.context(0)
+						_, err := c.queues.DeleteMessage(ctx, &queuepb.DeleteMessageParams{AppName: args[0], QueueName: args[1], Receipt: m.Receipt})
+						cancel()
+
+						if err != nil {
+							return c.fail(err)
+						}
+					}
+
+					c.printMessage(m, ack)
+					received++
+				}
+			}
+
+			if received == 0 {
+				return exitEmpty
+			}
+
+			return exitOk
+		}
+	},
+}
+
+func (c *client) printMessage(m *queuepb.ReceivedMessage, acked bool) {
+
+	if !c.json {
+		fmt.Fprintln(c.stdout, m.Body)
+		return
+	}
+
+	deadline := time.Unix(0, m.DeadlineUnixMillis*int64(time.Millisecond)).UTC()
+	c.printJson(Message{
+		Id:           m.Id,
+		Body:         m.Body,
+		Receipt:      m.Receipt,
+		ReceiveCount: m.ReceiveCount,
+		Deadline:     &deadline,
+		Attributes:   m.Attributes,
+		GroupId:      m.GroupId,
+		Acked:        acked,
+	})
+}
+
+var ackCommand = &command{
+	usage:   "ack <app> <queue> <receipt>...",
+	summary: "Delete received messages by their receipts",
+	args:    -1,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+		return func(c *client, args []string) int {
+
+			if !c.checkArgs(args, 3, "ack <app> <queue> <receipt>...") {
+				return exitUsage
+			}
+
+			for _, receipt := range args[2:] {
+				ctx, cancel := c.context(0)
+				_, err := c.queues.DeleteMessage(ctx, &queuepb.DeleteMessageParams{AppName: args[0], QueueName: args[1], Receipt: receipt})
+				cancel()
+
+				if err != nil {
+					return c.fail(err)
+				}
+			}
+
+			return exitOk
+		}
+	},
+}
+
+var peekCommand = &command{
+	usage:   "peek <app> <queue>",
+	summary: "Print the message at the head of the queue without taking it",
+	args:    2,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+		return func(c *client, args []string) int {
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			item, err := c.queue.Peek(ctx, &ezgrpc.PeekParams{AppName: args[0], QueueName: args[1]})
+			if s, ok := status.FromError(err); ok && s.Code() == codes.NotFound && s.Message() == e.ErrorQueueEmpty {
+				return exitEmpty
+			} else if err != nil {
+				return c.fail(err)
+			}
+
+			if c.json {
+				c.printJson(Message{Body: item.Message})
+			} else {
+				fmt.Fprintln(c.stdout, item.Message)
+			}
+
+			return exitOk
+		}
+	},
+}
+
+var listCommand = &command{
+	usage:   "list [app]",
+	summary: "List the queues, of one app or of every app the api key can access",
+	args:    -1,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+		return func(c *client, args []string) int {
+
+			params := &queuepb.ListQueuesParams{}
+			if len(args) != 0 {
+				params.AppName = args[0]
+			}
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			list, err := c.queues.ListQueues(ctx, params)
+			if err != nil {
+				return c.fail(err)
+			}
+
+			if c.json {
+				queues := make([]Queue, 0, len(list.Queues))
+				for _, d := range list.Queues {
+					queues = append(queues, toQueue(d))
+				}
+				c.printJson(queues)
+				return exitOk
+			}
+
+			w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "APP\tQUEUE\tVISIBLE\tIN FLIGHT\tDELAY\tVISIBILITY")
+			for _, d := range list.Queues {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n", d.AppName, d.QueueName, d.Visible, d.InFlight, d.DelaySeconds, d.VisibilityTimeout)
+			}
+			w.Flush()
+
+			return exitOk
+		}
+	},
+}
+
+var statsCommand = &command{
+	usage:   "stats <app> <queue>",
+	summary: "Print the settings and message counts of a queue",
+	args:    2,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+		return func(c *client, args []string) int {
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			d, err := c.queues.GetQueueStats(ctx, &queuepb.QueueParams{AppName: args[0], QueueName: args[1]})
+			if err != nil {
+				return c.fail(err)
+			}
+
+			if c.json {
+				c.printJson(toQueue(d))
+				return exitOk
+			}
+
+			w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(w, "app\t%s\n", d.AppName)
+			fmt.Fprintf(w, "queue\t%s\n", d.QueueName)
+			fmt.Fprintf(w, "visible\t%d\n", d.Visible)
+			fmt.Fprintf(w, "in flight\t%d\n", d.InFlight)
+			if d.Delayed != 0 {
+				fmt.Fprintf(w, "delayed\t%d\n", d.Delayed)
+			}
+			fmt.Fprintf(w, "delay\t%ds\n", d.DelaySeconds)
+			fmt.Fprintf(w, "visibility\t%ds\n", d.VisibilityTimeout)
+			if d.Priority {
+				fmt.Fprintf(w, "type\tpriority\n")
+			} else {
+				fmt.Fprintf(w, "type\tfifo\n")
+			}
+			if d.RetentionSeconds != 0 {
+				fmt.Fprintf(w, "retention\t%ds\n", d.RetentionSeconds)
+			}
+			if len(d.DeadLetterQueue) != 0 {
+				fmt.Fprintf(w, "dead-letter queue\t%s\n", d.DeadLetterQueue)
+			}
+			w.Flush()
+
+			return exitOk
+		}
+	},
+}
+
+var purgeCommand = &command{
+	usage:   "purge <app> <queue>",
+	summary: "Delete every message in a queue",
+	args:    2,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+		return func(c *client, args []string) int {
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			if _, err := c.queues.PurgeQueue(ctx, &queuepb.QueueParams{AppName: args[0], QueueName: args[1]}); err != nil {
+				return c.fail(err)
+			}
+
+			return exitOk
+		}
+	},
+}
+
+var deleteCommand = &command{
+	usage:   "delete <app> <queue>",
+	summary: "Delete a queue and its files",
+	args:    2,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+		return func(c *client, args []string) int {
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			if _, err := c.queues.DeleteQueue(ctx, &queuepb.QueueParams{AppName: args[0], QueueName: args[1]}); err != nil {
+				return c.fail(err)
+			}
+
+			return exitOk
+		}
+	},
+}
+
+//Schedule is the JSON output of schedules
+type Schedule struct {
+	App         string     `json:"app"`
+	Name        string     `json:"name"`
+	Queue       string     `json:"queue"`
+	Cron        string     `json:"cron"`
+	Timezone    string     `json:"timezone"`
+	Payload     string     `json:"payload"`
+	MissedTicks string     `json:"missed_ticks"`
+	Paused      bool       `json:"paused,omitempty"`
+	LastTick    time.Time  `json:"last_tick"`
+	NextTick    *time.Time `json:"next_tick,omitempty"`
+}
+
+func toSchedule(d *queuepb.ScheduleDetails) Schedule {
+
+	s := Schedule{d.AppName, d.Name, d.QueueName, d.Cron, d.Timezone, d.Payload, d.MissedTicks, d.Paused, time.UnixMilli(d.LastTickUnixMillis), nil}
+	if d.NextTickUnixMillis != 0 {
+		next := time.UnixMilli(d.NextTickUnixMillis)
+		s.NextTick = &next
+	}
+
+	return s
+}
+
+var scheduleCommand = &command{
+	usage:   "schedule [-tz zone] [-missed policy] <app> <name> <queue> <cron> <message>",
+	summary: "Create a schedule that sends the message to the queue at each tick of the cron expression",
+	args:    5,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+
+		tz := fs.String("tz", "", "IANA time zone the cron expression is read in, Ex: Europe/Berlin. UTC when not set")
+		missed := fs.String("missed", "", "what to send for the ticks missed while the server was down: skip, once or all. once when not set")
+
+		return func(c *client, args []string) int {
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			params := &queuepb.CreateScheduleParams{AppName: args[0], Name: args[1], QueueName: args[2], Cron: args[3], Payload: args[4], Timezone: *tz, MissedTicks: *missed}
+			if _, err := c.queues.CreateSchedule(ctx, params); err != nil {
+				return c.fail(err)
+			}
+
+			if c.json {
+				c.printJson(map[string]string{"app": args[0], "name": args[1]})
+			}
+
+			return exitOk
+		}
+	},
+}
+
+var schedulesCommand = &command{
+	usage:   "schedules [app]",
+	summary: "List the schedules, of one app or of every app the api key can access",
+	args:    -1,
+	setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+		return func(c *client, args []string) int {
+
+			params := &queuepb.ListSchedulesParams{}
+			if len(args) != 0 {
+				params.AppName = args[0]
+			}
+
+			ctx, cancel := c.context(0)
+			defer cancel()
+
+			list, err := c.queues.ListSchedules(ctx, params)
+			if err != nil {
+				return c.fail(err)
+			}
+
+			if c.json {
+				schedules := make([]Schedule, 0, len(list.Schedules))
+				for _, d := range list.Schedules {
+					schedules = append(schedules, toSchedule(d))
+				}
+				c.printJson(schedules)
+				return exitOk
+			}
+
+			w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "APP\tNAME\tQUEUE\tCRON\tTIMEZONE\tNEXT")
+			for _, d := range list.Schedules {
+				next := "-"
+				if d.Paused {
+					next = "paused"
+				} else if d.NextTickUnixMillis != 0 {
+					next = time.UnixMilli(d.NextTickUnixMillis).UTC().Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.AppName, d.Name, d.QueueName, d.Cron, d.Timezone, next)
+			}
+			w.Flush()
+
+			return exitOk
+		}
+	},
+}
+
+//scheduleCall makes a command that calls fn with the schedule named by its arguments
+func scheduleCall(usage, summary string, fn func(c *client, ctx context.Context, params *queuepb.ScheduleParams) error) *command {
+
+	return &command{
+		usage:   usage,
+		summary: summary,
+		args:    2,
+		setup: func(fs *flag.FlagSet) func(c *client, args []string) int {
+			return func(c *client, args []string) int {
+
+				ctx, cancel := c.context(0)
+				defer cancel()
+
+				if err := fn(c, ctx, &queuepb.ScheduleParams{AppName: args[0], Name: args[1]}); err != nil {
+					return c.fail(err)
+				}
+
+				return exitOk
+			}
+		},
+	}
+}
+
+var pauseScheduleCommand = scheduleCall("pause-schedule <app> <name>", "Stop sending the messages of a schedule until it is resumed",
+	func(c *client, ctx context.Context, params *queuepb.ScheduleParams) error {
+		_, err := c.queues.PauseSchedule(ctx, params)
+		return err
+	})
+
+var resumeScheduleCommand = scheduleCall("resume-schedule <app> <name>", "Send the messages of a paused schedule again from its next tick",
+	func(c *client, ctx context.Context, params *queuepb.ScheduleParams) error {
+		_, err := c.queues.ResumeSchedule(ctx, params)
+		return err
+	})
+
+var unscheduleCommand = scheduleCall("unschedule <app> <name>", "Delete a schedule",
+	func(c *client, ctx context.Context, params *queuepb.ScheduleParams) error {
+		_, err := c.queues.DeleteSchedule(ctx, params)
+		return err
+	})
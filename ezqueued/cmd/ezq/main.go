@@ -0,0 +1,321 @@
+//ezq is a command line client for ezqueued, for operators and shell scripts.
+//
+//	ezq <command> [flags] <app> <queue> [args]
+//
+//Run ezq help for the commands. The address and api key can also be set with EZQ_ADDR and EZQ_API_KEY
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+)
+
+//Exit codes
+const (
+	exitOk    = 0
+	exitError = 1
+	exitUsage = 2
+	exitEmpty = 3 //peek or receive found the queue empty
+)
+
+const defaultAddr = "localhost:8989"
+
+//options are the flags every command takes
+type options struct {
+	addr    string
+	apiKey  string
+	timeout time.Duration
+	json    bool
+
+	tls                bool
+	caFile             string
+	certFile           string
+	keyFile            string
+	serverName         string
+	insecureSkipVerify bool
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+
+	fs.StringVar(&o.addr, "addr", envOr("EZQ_ADDR", defaultAddr), "address of the ezqueued gRPC port")
+	fs.StringVar(&o.apiKey, "api-key", os.Getenv("EZQ_API_KEY"), "api key sent as a bearer token")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "timeout of each call, on top of any wait")
+	fs.BoolVar(&o.json, "json", false, "print JSON instead of text")
+
+	fs.BoolVar(&o.tls, "tls", false, "connect with TLS, Ex: to a TLS terminating proxy in front of ezqueued")
+	fs.StringVar(&o.caFile, "ca", "", "PEM file of the CAs that sign the server certificate. Implies -tls")
+	fs.StringVar(&o.certFile, "cert", "", "PEM client certificate for mutual TLS. Implies -tls")
+	fs.StringVar(&o.keyFile, "key", "", "PEM key of the client certificate")
+	fs.StringVar(&o.serverName, "server-name", "", "name to verify the server certificate against")
+	fs.BoolVar(&o.insecureSkipVerify, "insecure-skip-verify", false, "do not verify the server certificate")
+}
+
+func envOr(name, value string) string {
+
+	if v := os.Getenv(name); len(v) != 0 {
+		return v
+	}
+
+	return value
+}
+
+func (o *options) transportCredentials() (grpc.DialOption, error) {
+
+	if !o.tls && len(o.caFile) == 0 && len(o.certFile) == 0 {
+		return grpc.WithInsecure(), nil
+	}
+
+	config := &tls.Config{ServerName: o.serverName, InsecureSkipVerify: o.insecureSkipVerify}
+
+	if len(o.caFile) != 0 {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.caFile)
+		}
+	}
+
+	if len(o.certFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(config)), nil
+}
+
+//client holds the connection and the stubs of both services
+type client struct {
+	options
+	conn   *grpc.ClientConn
+	queue  ezgrpc.EzqueuedClient
+	queues queuepb.EzqueueQueuesClient
+
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+func (c *client) dial() error {
+
+	creds, err := c.transportCredentials()
+	if err != nil {
+		return err
+	}
+
+	c.conn, err = grpc.Dial(c.addr, creds)
+	if err != nil {
+		return err
+	}
+
+	c.queue = ezgrpc.NewEzqueuedClient(c.conn)
+	c.queues = queuepb.NewEzqueueQueuesClient(c.conn)
+
+	return nil
+}
+
+//context returns the context of a call that may wait up to wait on the server
+func (c *client) context(wait time.Duration) (context.Context, context.CancelFunc) {
+
+	ctx := context.Background()
+	if len(c.apiKey) != 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.apiKey)
+	}
+
+	return context.WithTimeout(ctx, wait+c.timeout)
+}
+
+//printJson writes v as one line of JSON
+func (c *client) printJson(v interface{}) error {
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.stdout, string(b))
+	return err
+}
+
+//command is a subcommand. setup registers its own flags and returns the function that runs it with the positional arguments
+type command struct {
+	usage   string
+	summary string
+	args    int //number of positional arguments needed, -1 to check them in run
+	setup   func(fs *flag.FlagSet) func(c *client, args []string) int
+}
+
+var commands map[string]*command
+
+func init() {
+
+	commands = map[string]*command{
+		"create":  createCommand,
+		"send":    sendCommand,
+		"receive": receiveCommand,
+		"ack":     ackCommand,
+		"peek":    peekCommand,
+		"list":    listCommand,
+		"stats":   statsCommand,
+		"purge":   purgeCommand,
+		"delete":  deleteCommand,
+
+		"schedule":        scheduleCommand,
+		"schedules":       schedulesCommand,
+		"pause-schedule":  pauseScheduleCommand,
+		"resume-schedule": resumeScheduleCommand,
+		"unschedule":      unscheduleCommand,
+	}
+}
+
+func usage(w io.Writer) {
+
+	fmt.Fprintln(w, "Usage: ezq <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-50s %s\n", commands[name].usage, commands[name].summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run ezq <command> -h for the flags of a command")
+}
+
+//run runs the command line and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOk
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "ezq: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	c := &client{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	fs := flag.NewFlagSet("ezq "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: ezq %s\n\n%s\n\nFlags:\n", cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	c.register(fs)
+	run := cmd.setup(fs)
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOk
+		}
+		return exitUsage
+	}
+
+	if cmd.args >= 0 && fs.NArg() != cmd.args {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := c.dial(); err != nil {
+		fmt.Fprintln(stderr, "ezq:", err)
+		return exitError
+	}
+	defer c.conn.Close()
+
+	return run(c, fs.Args())
+}
+
+//fail prints the error of a call and returns the exit code for it
+func (c *client) fail(err error) int {
+
+	if s, ok := status.FromError(err); ok {
+		fmt.Fprintf(c.stderr, "ezq: %s: %s\n", s.Code(), s.Message())
+	} else {
+		fmt.Fprintln(c.stderr, "ezq:", err)
+	}
+
+	return exitError
+}
+
+//checkArgs checks the number of positional arguments of commands that take a variable number
+func (c *client) checkArgs(args []string, min int, usage string) bool {
+
+	if len(args) < min {
+		fmt.Fprintln(c.stderr, "Usage: ezq", usage)
+		return false
+	}
+
+	return true
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+//splitLines returns the non empty lines of r, one message per line
+func splitLines(r io.Reader) ([]string, error) {
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) != 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+//parseDeliverAt reads the -at flag of send, an RFC 3339 time or a duration from now
+func parseDeliverAt(value string, now time.Time) (time.Time, error) {
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-at %q is neither an RFC 3339 time nor a duration", value)
+	}
+
+	return at, nil
+}
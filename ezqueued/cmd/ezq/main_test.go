@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+)
+
+//fakeServer keeps one queue in memory and serves both services
+type fakeServer struct {
+	ezgrpc.UnimplementedEzqueuedServer
+	queuepb.UnimplementedEzqueueQueuesServer
+
+	mutex     sync.Mutex
+	messages  []string
+	inFlight  map[string]string
+	keys      []string //api keys sent by the client
+	next      int
+	schedules []*queuepb.ScheduleDetails
+}
+
+func (f *fakeServer) recordKey(ctx context.Context) {
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		f.keys = append(f.keys, md.Get("authorization")...)
+	}
+}
+
+func (f *fakeServer) Enqueue(ctx context.Context, in *ezgrpc.EnqueueParams) (*ezgrpc.ReturnStatus, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.recordKey(ctx)
+	f.messages = append(f.messages, in.Message)
+
+	return &ezgrpc.ReturnStatus{Success: 1}, nil
+}
+
+func (f *fakeServer) Peek(ctx context.Context, in *ezgrpc.PeekParams) (*ezgrpc.QueueItem, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.messages) == 0 {
+		return nil, status.Error(codes.NotFound, e.ErrorQueueEmpty)
+	}
+
+	return &ezgrpc.QueueItem{Message: f.messages[0]}, nil
+}
+
+func (f *fakeServer) Receive(ctx context.Context, in *queuepb.ReceiveParams) (*queuepb.ReceivedMessageList, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	list := &queuepb.ReceivedMessageList{}
+	for len(f.messages) != 0 && len(list.Messages) < int(in.MaxMessages) {
+		f.next++
+		receipt := "receipt-" + strconv.Itoa(f.next)
+		f.inFlight[receipt] = f.messages[0]
+
+		list.Messages = append(list.Messages, &queuepb.ReceivedMessage{Id: strconv.Itoa(f.next), Body: f.messages[0], Receipt: receipt, ReceiveCount: 1})
+		f.messages = f.messages[1:]
+	}
+
+	return list, nil
+}
+
+func (f *fakeServer) DeleteMessage(ctx context.Context, in *queuepb.DeleteMessageParams) (*queuepb.Result, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.inFlight[in.Receipt]; !ok {
+		return nil, status.Error(codes.InvalidArgument, e.ErrorReceiptInvalid)
+	}
+	delete(f.inFlight, in.Receipt)
+
+	return &queuepb.Result{}, nil
+}
+
+func (f *fakeServer) ListQueues(ctx context.Context, in *queuepb.ListQueuesParams) (*queuepb.QueueList, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return &queuepb.QueueList{Queues: []*queuepb.QueueDetails{
+		{AppName: "app", QueueName: "queue", VisibilityTimeout: 30, Visible: uint64(len(f.messages)), InFlight: uint64(len(f.inFlight))},
+	}}, nil
+}
+
+func (f *fakeServer) CreateSchedule(ctx context.Context, in *queuepb.CreateScheduleParams) (*queuepb.Result, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.schedules = append(f.schedules, &queuepb.ScheduleDetails{AppName: in.AppName, Name: in.Name, QueueName: in.QueueName, Cron: in.Cron,
+		Timezone: in.Timezone, Payload: in.Payload, MissedTicks: in.MissedTicks, NextTickUnixMillis: 1700000000000})
+
+	return &queuepb.Result{}, nil
+}
+
+func (f *fakeServer) ListSchedules(ctx context.Context, in *queuepb.ListSchedulesParams) (*queuepb.ScheduleList, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return &queuepb.ScheduleList{Schedules: f.schedules}, nil
+}
+
+func fakeServerSetup(t *testing.T) (*fakeServer, string) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeServer{inFlight: make(map[string]string)}
+	server := grpc.NewServer()
+	ezgrpc.RegisterEzqueuedServer(server, f)
+	queuepb.RegisterEzqueueQueuesServer(server, f)
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return f, listener.Addr().String()
+}
+
+func runEzq(t *testing.T, stdin string, args ...string) (int, string, string) {
+
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestSendAndReceive(t *testing.T) {
+
+	f, addr := fakeServerSetup(t)
+
+	//One message per line of stdin, empty lines are skipped
+	if code, _, stderr := runEzq(t, "one\n\ntwo\r\nthree\n", "send", "-addr", addr, "-api-key", "secret", "app", "queue"); code != exitOk {
+		t.Fatalf("send: want %d, got %d %s", exitOk, code, stderr)
+	}
+	if len(f.messages) != 3 || f.messages[1] != "two" {
+		t.Errorf("send: want 3 messages, got %q", f.messages)
+	}
+	if len(f.keys) == 0 || f.keys[0] != "Bearer secret" {
+		t.Errorf("send: want the api key as a bearer token, got %q", f.keys)
+	}
+
+	file := path.Join(t.TempDir(), "messages.txt")
+	os.WriteFile(file, []byte("four\nfive\n"), 0644)
+	runEzq(t, "", "send", "-addr", addr, "-file", file, "app", "queue")
+	runEzq(t, "", "send", "-addr", addr, "app", "queue", "six", "words")
+
+	if code, stdout, _ := runEzq(t, "", "peek", "-addr", addr, "app", "queue"); code != exitOk || stdout != "one\n" {
+		t.Errorf("peek: want one, got %d %q", code, stdout)
+	}
+
+	code, stdout, _ := runEzq(t, "", "receive", "-addr", addr, "-count", "2", "app", "queue")
+	if code != exitOk || stdout != "one\ntwo\n" {
+		t.Errorf("receive -count 2: want one and two, got %d %q", code, stdout)
+	}
+	if len(f.inFlight) != 2 {
+		t.Errorf("receive without -ack: want 2 messages in flight, got %d", len(f.inFlight))
+	}
+
+	//-count 0 receives until the queue is empty
+	code, stdout, _ = runEzq(t, "", "receive", "-addr", addr, "-count", "0", "-ack", "-json", "app", "queue")
+	if code != exitOk {
+		t.Fatalf("receive -count 0: want %d, got %d", exitOk, code)
+	}
+
+	var bodies []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var m Message
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		if !m.Acked || len(m.Receipt) == 0 {
+			t.Errorf("receive -ack -json: want an acked message with its receipt, got %+v", m)
+		}
+		bodies = append(bodies, m.Body)
+	}
+	if strings.Join(bodies, ",") != "three,four,five,six words" {
+		t.Errorf("receive -count 0: want three to six, got %q", bodies)
+	}
+	if len(f.inFlight) != 2 {
+		t.Errorf("receive -ack: want the acked messages deleted, got %d in flight", len(f.inFlight))
+	}
+
+	if code, _, _ := runEzq(t, "", "receive", "-addr", addr, "app", "queue"); code != exitEmpty {
+		t.Errorf("receive from an empty queue: want %d, got %d", exitEmpty, code)
+	}
+	if code, _, _ := runEzq(t, "", "peek", "-addr", addr, "app", "queue"); code != exitEmpty {
+		t.Errorf("peek of an empty queue: want %d, got %d", exitEmpty, code)
+	}
+
+	if code, _, stderr := runEzq(t, "", "ack", "-addr", addr, "app", "queue", "receipt-1", "receipt-404"); code != exitError || !strings.Contains(stderr, "InvalidArgument") {
+		t.Errorf("ack of an unknown receipt: want %d and InvalidArgument, got %d %q", exitError, code, stderr)
+	}
+	if _, ok := f.inFlight["receipt-1"]; ok {
+		t.Error("ack: want receipt-1 deleted")
+	}
+}
+
+func TestList(t *testing.T) {
+
+	_, addr := fakeServerSetup(t)
+
+	code, stdout, _ := runEzq(t, "", "list", "-addr", addr)
+	if code != exitOk || !strings.HasPrefix(stdout, "APP") || !strings.Contains(stdout, "queue") {
+		t.Errorf("list: want a table, got %d %q", code, stdout)
+	}
+
+	code, stdout, _ = runEzq(t, "", "list", "-addr", addr, "-json")
+	var queues []Queue
+	if err := json.Unmarshal([]byte(stdout), &queues); err != nil || code != exitOk {
+		t.Fatalf("list -json: %d %v", code, err)
+	}
+	if len(queues) != 1 || queues[0].VisibilityTimeout != 30 {
+		t.Errorf("list -json: want the fake queue, got %+v", queues)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+
+	_, addr := fakeServerSetup(t)
+
+	if code, _, stderr := runEzq(t, "", "schedule", "-addr", addr, "-tz", "Europe/Berlin", "-missed", "all", "app", "nightly", "queue", "0 2 * * *", "run the report"); code != exitOk {
+		t.Fatalf("schedule: want %d, got %d %s", exitOk, code, stderr)
+	}
+
+	code, stdout, _ := runEzq(t, "", "schedules", "-addr", addr, "-json")
+	var schedules []Schedule
+	if err := json.Unmarshal([]byte(stdout), &schedules); err != nil || code != exitOk {
+		t.Fatalf("schedules -json: %d %v", code, err)
+	}
+	want := Schedule{App: "app", Name: "nightly", Queue: "queue", Cron: "0 2 * * *", Timezone: "Europe/Berlin", Payload: "run the report", MissedTicks: "all"}
+	if len(schedules) != 1 || schedules[0].Name != want.Name || schedules[0].Cron != want.Cron || schedules[0].Timezone != want.Timezone ||
+		schedules[0].Payload != want.Payload || schedules[0].MissedTicks != want.MissedTicks || schedules[0].NextTick == nil {
+		t.Errorf("schedules -json: want %+v, got %+v", want, schedules)
+	}
+
+	if code, _, _ := runEzq(t, "", "schedule", "-addr", addr, "app", "nightly", "queue", "0 2 * * *"); code != exitUsage {
+		t.Errorf("schedule without a message: want %d, got %d", exitUsage, code)
+	}
+}
+
+func TestUsage(t *testing.T) {
+
+	if code, _, _ := runEzq(t, ""); code != exitUsage {
+		t.Errorf("no command: want %d, got %d", exitUsage, code)
+	}
+	if code, _, _ := runEzq(t, "", "frobnicate"); code != exitUsage {
+		t.Errorf("unknown command: want %d, got %d", exitUsage, code)
+	}
+	if code, _, _ := runEzq(t, "", "stats", "app"); code != exitUsage {
+		t.Errorf("missing queue: want %d, got %d", exitUsage, code)
+	}
+	if code, _, _ := runEzq(t, "", "send", "-at", "tomorrow", "app", "queue", "x"); code != exitUsage {
+		t.Errorf("send -at tomorrow: want %d, got %d", exitUsage, code)
+	}
+}
+
+func TestParseDeliverAt(t *testing.T) {
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"90m":                  now.Add(90 * time.Minute),
+		"2024-03-02T08:30:00Z": time.Date(2024, 3, 2, 8, 30, 0, 0, time.UTC),
+	} {
+		if at, err := parseDeliverAt(value, now); err != nil || !at.Equal(want) {
+			t.Errorf("parseDeliverAt(%q): want %v, got %v %v", value, want, at, err)
+		}
+	}
+}
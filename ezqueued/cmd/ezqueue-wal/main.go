@@ -0,0 +1,470 @@
+//ezqueue-wal reads the control and wal files in a logs directory without a running daemon.
+//
+//	ezqueue-wal <command> [flags] [args]
+//
+//It lists the queues, dumps the items of a wal file, checks control files against the wal files and
+//rebuilds a control file from them. Stop the daemon before running repair
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//Exit codes
+const (
+	exitOk       = 0
+	exitProblems = 1 //verify found problems, or a command failed
+	exitUsage    = 2
+)
+
+type tool struct {
+	dir    string
+	json   bool
+	stdout io.Writer
+	stderr io.Writer
+}
+
+//command is a subcommand. setup registers its own flags and returns the function that runs it with the positional arguments
+type command struct {
+	usage   string
+	summary string
+	setup   func(fs *flag.FlagSet) func(t *tool, args []string) int
+}
+
+var commands map[string]*command
+
+func init() {
+
+	commands = map[string]*command{
+		"list":   listCommand,
+		"dump":   dumpCommand,
+		"verify": verifyCommand,
+		"repair": repairCommand,
+	}
+}
+
+func usage(w io.Writer) {
+
+	fmt.Fprintln(w, "Usage: ezqueue-wal <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-55s %s\n", commands[name].usage, commands[name].summary)
+	}
+}
+
+//run runs the command line and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOk
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "ezqueue-wal: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	t := &tool{stdout: stdout, stderr: stderr}
+
+	fs := flag.NewFlagSet("ezqueue-wal "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: ezqueue-wal %s\n\n%s\n\nFlags:\n", cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&t.dir, "dir", wal.Config.Logspath, "logs directory. Defaults to logspath in "+wal.ConfigPath)
+	fs.BoolVar(&t.json, "json", false, "print JSON instead of text")
+	run := cmd.setup(fs)
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOk
+		}
+		return exitUsage
+	}
+
+	if len(t.dir) == 0 {
+		fmt.Fprintln(stderr, "ezqueue-wal: no logs directory, set -dir")
+		return exitUsage
+	}
+
+	return run(t, fs.Args())
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func (t *tool) fail(err error) int {
+
+	fmt.Fprintln(t.stderr, "ezqueue-wal:", err)
+	return exitProblems
+}
+
+//printJson writes v as one line of JSON
+func (t *tool) printJson(v interface{}) {
+
+	b, _ := json.Marshal(v)
+	fmt.Fprintln(t.stdout, string(b))
+}
+
+//controlPath returns the path of a control file given by name, with or without the extension, or by path
+func (t *tool) controlPath(name string) string {
+
+	if !strings.HasSuffix(name, wal.ControlFileExtn) {
+		name += wal.ControlFileExtn
+	}
+	if strings.Contains(name, "/") {
+		return name
+	}
+
+	return path.Join(t.dir, name)
+}
+
+//controlNames returns the control files named in args, or every control file in the directory
+func (t *tool) controlNames(args []string) ([]string, error) {
+
+	if len(args) != 0 {
+		return args, nil
+	}
+
+	return wal.ControlFiles(t.dir)
+}
+
+//Queue is the JSON output of list
+type Queue struct {
+	Control        string `json:"control"`
+	App            string `json:"app"`
+	Queue          string `json:"queue"`
+	HeadLsnFileNum uint64 `json:"headlsnfilenum"`
+	HeadLsn        uint64 `json:"headlsn"`
+	TailLsnFileNum uint64 `json:"taillsnfilenum"`
+	TailLsn        uint64 `json:"taillsn"`
+	NextLsn        uint64 `json:"nextlsn"`
+	Paused         bool   `json:"paused,omitempty"`
+	Files          int    `json:"files"`
+	Bytes          int64  `json:"bytes"`
+	Error          string `json:"error,omitempty"`
+}
+
+var listCommand = &command{
+	usage:   "list [-dir path]",
+	summary: "List the queues from the control files with the size of their wal files",
+	setup: func(fs *flag.FlagSet) func(t *tool, args []string) int {
+		return func(t *tool, args []string) int {
+
+			names, err := wal.ControlFiles(t.dir)
+			if err != nil {
+				return t.fail(err)
+			}
+
+			queues := []Queue{}
+			for _, name := range names {
+				queue := Queue{Control: name}
+
+				c, err := wal.ReadControl(path.Join(t.dir, name))
+				if err != nil {
+					queue.Error = err.Error()
+					queues = append(queues, queue)
+					continue
+				}
+
+				queue.App, queue.Queue, queue.Paused = c.MetaData.AppName, c.MetaData.Name, c.Paused
+				queue.HeadLsnFileNum, queue.HeadLsn = c.HeadLsnFileNum, c.HeadLsn
+				queue.TailLsnFileNum, queue.TailLsn, queue.NextLsn = c.TailLsnFileNum, c.TailLsn, c.NextLsn
+
+				for walFileNum := uint64(1); walFileNum <= c.TailLsnFileNum; walFileNum++ {
+					if fileInfo, err := os.Stat(path.Join(t.dir, wal.SegmentName(c.MetaData.AppName, c.MetaData.Name, walFileNum))); err == nil {
+						queue.Files++
+						queue.Bytes += fileInfo.Size()
+					}
+				}
+
+				queues = append(queues, queue)
+			}
+
+			if t.json {
+				t.printJson(queues)
+				return exitOk
+			}
+
+			w := tabwriter.NewWriter(t.stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "CONTROL\tAPP\tQUEUE\tHEAD\tTAIL\tNEXTLSN\tFILES\tBYTES\tPAUSED")
+			for _, q := range queues {
+				if len(q.Error) != 0 {
+					fmt.Fprintf(w, "%s\t%s\n", q.Control, q.Error)
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d:%d\t%d:%d\t%d\t%d\t%d\t%t\n", q.Control, q.App, q.Queue,
+					q.HeadLsnFileNum, q.HeadLsn, q.TailLsnFileNum, q.TailLsn, q.NextLsn, q.Files, q.Bytes, q.Paused)
+			}
+			w.Flush()
+
+			return exitOk
+		}
+	},
+}
+
+//Record is the JSON output of dump
+type Record struct {
+	Lsn        uint64            `json:"lsn"`
+	Type       string            `json:"type"`
+	FileNum    uint64            `json:"filenum"`
+	Size       uint64            `json:"size"`
+	Id         string            `json:"id,omitempty"`
+	Preview    string            `json:"preview,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Priority   uint8             `json:"priority,omitempty"`
+	GroupId    string            `json:"group_id,omitempty"`
+}
+
+func preview(body string, max int) string {
+
+	if max > 0 && len(body) > max {
+		return body[:max] + "..."
+	}
+
+	return body
+}
+
+var dumpCommand = &command{
+	usage:   "dump [-from lsn] [-limit n] [-preview n] <file.wal>",
+	summary: "Print the items of a wal file: lsn, type, file number, size and a preview of the payload",
+	setup: func(fs *flag.FlagSet) func(t *tool, args []string) int {
+
+		from := fs.Uint64("from", 0, "lsn of the first item to print. It must be the start of an item")
+		limit := fs.Int("limit", 0, "items to print, 0 for all")
+		previewLen := fs.Int("preview", 40, "bytes of the message body to print, 0 for all")
+
+		return func(t *tool, args []string) int {
+
+			if len(args) != 1 {
+				fmt.Fprintln(t.stderr, "Usage: ezqueue-wal dump [-from lsn] [-limit n] [-preview n] <file.wal>")
+				return exitUsage
+			}
+
+			filePath := args[0]
+			if _, err := os.Stat(filePath); os.IsNotExist(err) && !strings.Contains(filePath, "/") {
+				filePath = path.Join(t.dir, filePath)
+			}
+
+			fileInfo, err := os.Stat(filePath)
+			if err != nil {
+				return t.fail(err)
+			}
+
+			var w *tabwriter.Writer
+			if !t.json {
+				w = tabwriter.NewWriter(t.stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "LSN\tTYPE\tFILE\tSIZE\tID\tPAYLOAD")
+			}
+
+			printed := 0
+			read, err := wal.ReadItems(filePath, *from, func(item wal.WalItem) bool {
+
+				if *limit > 0 && printed == *limit {
+					return false
+				}
+				printed++
+
+				r := Record{Lsn: item.Lsn, Type: wal.TypeName(item.ItemType), FileNum: item.WalFileNum, Size: item.Size}
+
+				switch item.ItemType {
+				case wal.ENQUEUE, wal.ENQUEUE_ATTRS, wal.ENQUEUE_OPTIONS:
+					r.Id = item.Id()
+					body, attributes, err := wal.DecodeMessage(item)
+					if err != nil {
+						r.Preview = "unreadable: " + err.Error()
+					} else {
+						r.Preview, r.Attributes = preview(body, *previewLen), attributes
+					}
+					if opts, err := wal.DecodeOptions(item); err == nil {
+						r.Priority, r.GroupId = opts.Priority, opts.GroupId
+					}
+				case wal.DELETE, wal.EXPIRE:
+					if id, ok := wal.DeletedId(item); ok {
+						r.Id = id
+					}
+				}
+
+				if t.json {
+					t.printJson(r)
+				} else {
+					fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\n", r.Lsn, r.Type, r.FileNum, r.Size, r.Id, strconv.Quote(r.Preview))
+				}
+
+				return true
+			})
+
+			if w != nil {
+				w.Flush()
+			}
+			if err != nil {
+				return t.fail(err)
+			}
+
+			if end := int64(*from) + read; (*limit == 0 || printed < *limit) && end < fileInfo.Size() {
+				fmt.Fprintf(t.stderr, "ezqueue-wal: %d bytes after the last whole item at offset %d\n", fileInfo.Size()-end, end)
+			}
+
+			return exitOk
+		}
+	},
+}
+
+//Check is the JSON output of verify
+type Check struct {
+	Control  string   `json:"control"`
+	App      string   `json:"app,omitempty"`
+	Queue    string   `json:"queue,omitempty"`
+	Messages int      `json:"messages"`
+	Files    int      `json:"files"`
+	Problems []string `json:"problems"`
+}
+
+var verifyCommand = &command{
+	usage:   "verify [-dir path] [control]...",
+	summary: "Check headlsn, taillsn and nextlsn of control files against their wal files. Exits with 1 on problems",
+	setup: func(fs *flag.FlagSet) func(t *tool, args []string) int {
+		return func(t *tool, args []string) int {
+
+			names, err := t.controlNames(args)
+			if err != nil {
+				return t.fail(err)
+			}
+
+			code := exitOk
+			checks := []Check{}
+
+			for _, name := range names {
+				check := Check{Control: path.Base(t.controlPath(name)), Problems: []string{}}
+
+				c, err := wal.ReadControl(t.controlPath(name))
+				if err != nil {
+					check.Problems = append(check.Problems, "unable to read the control file: "+err.Error())
+				} else {
+					check.App, check.Queue = c.MetaData.AppName, c.MetaData.Name
+
+					result, err := wal.CheckQueue(t.dir, c)
+					if err != nil {
+						check.Problems = append(check.Problems, err.Error())
+					}
+					check.Messages, check.Problems = result.Messages, append(check.Problems, result.Problems...)
+					for _, s := range result.Segments {
+						if !s.Missing {
+							check.Files++
+						}
+					}
+				}
+
+				if len(check.Problems) != 0 {
+					code = exitProblems
+				}
+				checks = append(checks, check)
+			}
+
+			if t.json {
+				t.printJson(checks)
+				return code
+			}
+
+			for _, check := range checks {
+				if len(check.Problems) == 0 {
+					fmt.Fprintf(t.stdout, "ok       %s: %d messages in %d wal files\n", check.Control, check.Messages, check.Files)
+					continue
+				}
+				fmt.Fprintf(t.stdout, "problems %s:\n", check.Control)
+				for _, p := range check.Problems {
+					fmt.Fprintf(t.stdout, "  %s\n", p)
+				}
+			}
+
+			return code
+		}
+	},
+}
+
+var repairCommand = &command{
+	usage:   "repair [-dry-run] [-app name -queue name] <control>",
+	summary: "Rebuild a control file from the wal files. The old file is kept with a .bak extension",
+	setup: func(fs *flag.FlagSet) func(t *tool, args []string) int {
+
+		dryRun := fs.Bool("dry-run", false, "print the changes without making them")
+		appName := fs.String("app", "", "app of the queue, to rebuild a control file that cannot be read")
+		queueName := fs.String("queue", "", "name of the queue, to rebuild a control file that cannot be read")
+
+		return func(t *tool, args []string) int {
+
+			if len(args) != 1 {
+				fmt.Fprintln(t.stderr, "Usage: ezqueue-wal repair [-dry-run] [-app name -queue name] <control>")
+				return exitUsage
+			}
+
+			controlPath := t.controlPath(args[0])
+
+			c, err := wal.ReadControl(controlPath)
+			if err != nil {
+				if len(*appName) == 0 || len(*queueName) == 0 {
+					fmt.Fprintf(t.stderr, "ezqueue-wal: unable to read %s: %s. Give -app and -queue to rebuild it\n", controlPath, err.Error())
+					return exitProblems
+				}
+				c = wal.WalControl{MetaData: wal.QueueMetaData{AppName: *appName, Name: *queueName}, HeadLsnFileNum: 1, TailLsnFileNum: 1}
+			}
+
+			repaired, changes, err := wal.RepairQueue(t.dir, c, *dryRun)
+			if err != nil {
+				return t.fail(err)
+			}
+
+			if len(changes) == 0 {
+				fmt.Fprintf(t.stdout, "%s: nothing to repair\n", path.Base(controlPath))
+				return exitOk
+			}
+
+			for _, change := range changes {
+				fmt.Fprintf(t.stdout, "%s: %s\n", path.Base(controlPath), change)
+			}
+
+			if *dryRun {
+				return exitOk
+			}
+
+			if b, err := os.ReadFile(controlPath); err == nil {
+				if err := os.WriteFile(controlPath+".bak", b, 0664); err != nil {
+					return t.fail(err)
+				}
+			}
+
+			if err := wal.WriteControl(controlPath, repaired); err != nil {
+				return t.fail(err)
+			}
+
+			return exitOk
+		}
+	},
+}
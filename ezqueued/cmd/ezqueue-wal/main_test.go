@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+func runTool(args ...string) (int, string, string) {
+
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+//queueSetup writes a control file and a wal file with two messages to a new directory
+func queueSetup(t *testing.T) string {
+
+	logspath := wal.Config.Logspath
+	wal.Config.Logspath = t.TempDir()
+	t.Cleanup(func() { wal.Config.Logspath = logspath })
+
+	walInfo, err := wal.Create("app", "queue", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	walInfo.Append("first message")
+	walInfo.Append("second message")
+	walInfo.Close()
+
+	return wal.Config.Logspath
+}
+
+func TestVerifyAndRepair(t *testing.T) {
+
+	dir := queueSetup(t)
+	controlPath := path.Join(dir, "appqueue.control")
+
+	if code, stdout, _ := runTool("verify", "-dir", dir); code != exitOk || !strings.Contains(stdout, "2 messages") {
+		t.Fatalf("verify: want ok with 2 messages, got %d %q", code, stdout)
+	}
+
+	//Lose the last save of the control file
+	c, _ := wal.ReadControl(controlPath)
+	good := c
+	c.NextLsn, c.TailLsn = 0, 0
+	wal.WriteControl(controlPath, c)
+
+	if code, stdout, _ := runTool("verify", "-dir", dir, "appqueue"); code != exitProblems || !strings.Contains(stdout, "nextlsn") {
+		t.Errorf("verify of a stale control file: want %d and a nextlsn problem, got %d %q", exitProblems, code, stdout)
+	}
+
+	if code, _, stderr := runTool("repair", "-dir", dir, "appqueue"); code != exitOk {
+		t.Fatalf("repair: want %d, got %d %s", exitOk, code, stderr)
+	}
+	if c, _ := wal.ReadControl(controlPath); c != good {
+		t.Errorf("repair: want %+v, got %+v", good, c)
+	}
+	if _, err := os.Stat(controlPath + ".bak"); err != nil {
+		t.Errorf("repair: want a backup of the control file, got %v", err)
+	}
+
+	code, stdout, _ := runTool("verify", "-dir", dir, "-json")
+	var checks []Check
+	if err := json.Unmarshal([]byte(stdout), &checks); err != nil || code != exitOk {
+		t.Fatalf("verify -json: %d %v", code, err)
+	}
+	if len(checks) != 1 || checks[0].Messages != 2 || len(checks[0].Problems) != 0 {
+		t.Errorf("verify -json after repair: want 2 messages and no problems, got %+v", checks)
+	}
+}
+
+func TestDump(t *testing.T) {
+
+	dir := queueSetup(t)
+
+	code, stdout, _ := runTool("dump", "-dir", dir, "-preview", "5", "appqueue-1.wal")
+	if code != exitOk || !strings.Contains(stdout, `"first..."`) || !strings.Contains(stdout, `"secon..."`) {
+		t.Errorf("dump: want both messages with a preview, got %d %q", code, stdout)
+	}
+
+	code, stdout, _ = runTool("dump", "-dir", dir, "-limit", "1", "-json", "appqueue-1.wal")
+	var r Record
+	if err := json.Unmarshal([]byte(stdout), &r); err != nil || code != exitOk {
+		t.Fatalf("dump -json: %d %v", code, err)
+	}
+	if r.Lsn != 0 || r.Type != "ENQUEUE" || r.Preview != "first message" {
+		t.Errorf("dump -json: want the first item, got %+v", r)
+	}
+}
@@ -0,0 +1,216 @@
+//Package cron parses cron expressions and finds the times they match
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//maxSearchYears is how far Next looks ahead before it decides an expression never matches, Ex: 0 0 30 2 *
+const maxSearchYears = 5
+
+//Expression is a parsed cron expression. It matches the minutes whose fields are all in their sets,
+//with the day matching the day of the month or the day of the week when both are restricted
+type Expression struct {
+	minute, hour, dom, month, dow uint64 //bit i is set when value i is in the field
+	domAny, dowAny                bool   //the field was *
+}
+
+//field is the range of values one of the five fields takes
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}}
+)
+
+//macros are the shorthands for common expressions
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+//Parse reads a five field expression: minute, hour, day of month, month and day of week.
+//A field is * or a list of values, ranges like 1-5 and steps like */15 or 0-30/10. Months and days
+//of the week can be given by their first three letters, and Sunday is 0 or 7. The macros @yearly,
+//@monthly, @weekly, @daily and @hourly can be used instead of the fields
+func Parse(expr string) (*Expression, error) {
+
+	if m, ok := macros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, it has %d", expr, len(fields))
+	}
+
+	e := &Expression{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+
+	var err error
+	if e.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if e.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if e.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if e.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if e.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	//7 is another name for Sunday
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+
+	return e, nil
+}
+
+//parse returns the set of values of one field
+func (f field) parse(s string) (uint64, error) {
+
+	var set uint64
+
+	for _, part := range strings.Split(s, ",") {
+
+		rangePart, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in the %s field", part[i+1:], f.name)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.IndexByte(rangePart, '-') > 0:
+			i := strings.IndexByte(rangePart, '-')
+			var err error
+			if lo, err = f.value(rangePart[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(rangePart[i+1:]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in the %s field", rangePart, f.name)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rangePart); err != nil {
+				return 0, err
+			}
+			//A single value with a step runs to the end of the field, Ex: 5/15 is 5,20,35,50
+			if step == 1 {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+//value reads a number or a name of the field
+func (f field) value(s string) (int, error) {
+
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q in the %s field, it must be %d to %d", s, f.name, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+//dayMatches applies the usual cron rule: when both day fields are restricted either one can match
+func (e *Expression) dayMatches(t time.Time) bool {
+
+	dom, dow := has(e.dom, t.Day()), has(e.dow, int(t.Weekday()))
+
+	switch {
+	case e.domAny && e.dowAny:
+		return true
+	case e.domAny:
+		return dow
+	case e.dowAny:
+		return dom
+	}
+
+	return dom || dow
+}
+
+/*
+	Next returns the first minute after t that the expression matches, in the location of t.
+	The fields are compared with the wall clock of the location, so a time that is skipped when the clocks
+	go forward does not match and one that is repeated when they go back matches twice.
+	It returns the zero time if nothing matches in the next 5 years
+*/
+func (e *Expression) Next(t time.Time) time.Time {
+
+	loc := t.Location()
+	end := t.AddDate(maxSearchYears, 0, 0)
+
+	//Hours and minutes are stepped in absolute time, which always moves forward even across a clock change
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(end) {
+
+		if !has(e.month, int(t.Month())) {
+			next := time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			if !next.After(t) {
+				next = t.Add(time.Hour)
+			}
+			t = next
+			continue
+		}
+
+		if !e.dayMatches(t) || !has(e.hour, t.Hour()) {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+
+		if !has(e.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
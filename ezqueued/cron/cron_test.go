@@ -0,0 +1,74 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+
+	for _, expr := range []string{"* * * * *", "*/15 0-6 1,15 jan-mar mon-fri", "5/10 * * * 7", "@daily", "@Hourly", "0 9 * * SUN"} {
+		if _, err := Parse(expr); err != nil {
+			t.Errorf("Parse(%q): %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"5-1 * * * *", "*/0 * * * *", "a * * * *", "@every5m"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): want an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	for _, c := range []struct {
+		expr     string
+		from     time.Time
+		want     []time.Time
+		location *time.Location
+	}{
+		{"*/15 * * * *", time.Date(2026, 1, 1, 10, 7, 30, 0, time.UTC), []time.Time{
+			time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC), time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)}, time.UTC},
+		{"0 9 * * mon-fri", time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC), []time.Time{
+			time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC), time.Date(2026, 1, 6, 9, 0, 0, 0, time.UTC)}, time.UTC},
+		{"@monthly", time.Date(2026, 1, 31, 23, 59, 0, 0, time.UTC), []time.Time{
+			time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}, time.UTC},
+		{"0 0 29 2 *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), []time.Time{
+			time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)}, time.UTC},
+		//Either day field matches when both are set
+		{"0 12 13 * fri", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), []time.Time{
+			time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC), time.Date(2026, 3, 13, 12, 0, 0, 0, time.UTC), time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)}, time.UTC},
+		//2:30 does not exist on the day the clocks go forward
+		{"30 2 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), []time.Time{
+			time.Date(2026, 3, 9, 2, 30, 0, 0, newYork)}, newYork},
+		{"0 9 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), []time.Time{
+			time.Date(2026, 3, 8, 9, 0, 0, 0, newYork), time.Date(2026, 3, 9, 9, 0, 0, 0, newYork)}, newYork},
+	} {
+		e, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.expr, err)
+		}
+
+		from := c.from.In(c.location)
+		for _, want := range c.want {
+			got := e.Next(from)
+			if !got.Equal(want) {
+				t.Errorf("%q Next(%s): want %s, got %s", c.expr, from, want, got)
+				break
+			}
+			from = got
+		}
+	}
+
+	e, _ := Parse("0 0 30 2 *")
+	if next := e.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next of a day that does not exist: want the zero time, got %s", next)
+	}
+}
@@ -14,14 +14,39 @@ const (
 	WAL_FILE_APPEND_FAILED
 	WAL_CONTROL_SAVE_FAILED
 	INVALID_INPUT
+	RECEIPT_INVALID
+	SCHEDULE_DOES_NOT_EXIST
+	RECEIPT_STALE //the message was received again, only the receipt of the new lease works
 )
 
+//CodeNames maps the error codes to their names for clients that receive them as text
+var CodeNames = map[int]string{
+	ALREADY_EXISTS:                    "ALREADY_EXISTS",
+	QUEUE_EMPTY:                       "QUEUE_EMPTY",
+	QUEUE_DOES_NOT_EXIST:              "QUEUE_DOES_NOT_EXIST",
+	WAL_FILE_DOES_NOT_EXIST:           "WAL_FILE_DOES_NOT_EXIST",
+	WAL_CONTROL_FILE_DOES_NOT_EXIST:   "WAL_CONTROL_FILE_DOES_NOT_EXIST",
+	WAL_FILE_FAILED_TO_CREATE:         "WAL_FILE_FAILED_TO_CREATE",
+	WAL_CONTROL_FILE_FAILED_TO_CREATE: "WAL_CONTROL_FILE_FAILED_TO_CREATE",
+	WAL_FILE_APPEND_FAILED:            "WAL_FILE_APPEND_FAILED",
+	WAL_CONTROL_SAVE_FAILED:           "WAL_CONTROL_SAVE_FAILED",
+	INVALID_INPUT:                     "INVALID_INPUT",
+	RECEIPT_INVALID:                   "RECEIPT_INVALID",
+	SCHEDULE_DOES_NOT_EXIST:           "SCHEDULE_DOES_NOT_EXIST",
+	RECEIPT_STALE:                     "RECEIPT_STALE",
+}
+
 const (
-	ErrorExceedsMaxQueueSize = "Message exceeds max queue size"
-	ErrorAppQuenameExists    = "The application and queue combo already exists"
-	ErrorQueueDoesNotExist   = "The application and queue combo does not exist"
-	ErrorQueueEmpty          = "Empty"
-	ErrorInvalidInput        = "Input was either empty or not valid"
+	ErrorExceedsMaxQueueSize  = "Message exceeds max queue size"
+	ErrorAppQuenameExists     = "The application and queue combo already exists"
+	ErrorQueueDoesNotExist    = "The application and queue combo does not exist"
+	ErrorQueueEmpty           = "Empty"
+	ErrorInvalidInput         = "Input was either empty or not valid"
+	ErrorReceiptInvalid       = "The receipt is not valid or the message is no longer in flight"
+	ErrorReceiptStale         = "The receipt is stale, the message was received again with a new receipt"
+	ErrorReceiptNotInFlight   = "The message of the receipt is no longer in flight, it was deleted or its lease ran out"
+	ErrorScheduleExists       = "The application and schedule combo already exists"
+	ErrorScheduleDoesNotExist = "The application and schedule combo does not exist"
 )
 
 //QueueError stores info about an error that occurs during creation of a queue
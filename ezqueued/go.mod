@@ -4,15 +4,15 @@ go 1.17
 
 require (
 	github.com/coderagr/ezqueuegrpc v0.0.0-20211023145353-115d142bf676
+	github.com/golang/protobuf v1.4.3
 	github.com/google/uuid v1.3.0
 	google.golang.org/grpc v1.41.0
+	google.golang.org/protobuf v1.25.0
 )
 
 require (
-	github.com/golang/protobuf v1.4.3 // indirect
 	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
 	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd // indirect
 	golang.org/x/text v0.3.0 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
-	google.golang.org/protobuf v1.25.0 // indirect
 )
@@ -0,0 +1,291 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+//Levelled logger that writes one record per line as logfmt or JSON.
+//Fields are passed as key value pairs, Ex: log.Info("created queue", "app", appName, "queue", name)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %q, want one of %s", s, strings.Join(levelNames, ", "))
+}
+
+//Record formats
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+type Options struct {
+	Level          Level
+	Format         string    //FormatLogfmt or FormatJSON
+	RedactPayloads bool      //replace message bodies with their size
+	Output         io.Writer //defaults to stderr
+}
+
+//output is shared by a logger and every logger derived from it with With
+type output struct {
+	mutex   sync.Mutex
+	options Options
+}
+
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+var std = New(Options{Level: LevelInfo, Format: FormatLogfmt})
+
+func New(o Options) *Logger {
+
+	l := &Logger{out: &output{}}
+	l.out.set(o)
+
+	return l
+}
+
+func (o *output) set(options Options) {
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if options.Output == nil {
+		options.Output = os.Stderr
+	}
+	if options.Format != FormatJSON {
+		options.Format = FormatLogfmt
+	}
+
+	o.options = options
+}
+
+//Default returns the daemon wide logger
+func Default() *Logger {
+	return std
+}
+
+//Configure changes the options of the default logger and of every logger derived from it
+func Configure(o Options) {
+	std.out.set(o)
+}
+
+//With returns a logger that adds the key value pairs to every record
+func (l *Logger) With(kv ...interface{}) *Logger {
+
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{l.out, fields}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+
+	return level >= l.out.options.Level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+//Fatal logs at the error level and exits
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+
+	l.log(LevelError, msg, kv)
+	os.Exit(1)
+}
+
+//Payload returns the message body to log, or its size when payloads are redacted
+func (l *Logger) Payload(msg string) string {
+
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+
+	if l.out.options.RedactPayloads {
+		return "[redacted " + strconv.Itoa(len(msg)) + " bytes]"
+	}
+
+	return msg
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+
+	o := l.out.options
+	if level < o.Level {
+		return
+	}
+
+	fields := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	fields = append(fields, "time", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	//A key without a value is kept rather than dropped
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+
+	var b bytes.Buffer
+	if o.Format == FormatJSON {
+		writeJSON(&b, fields)
+	} else {
+		writeLogfmt(&b, fields)
+	}
+	b.WriteByte('\n')
+
+	o.Output.Write(b.Bytes())
+}
+
+func writeLogfmt(b *bytes.Buffer, fields []interface{}) {
+
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteByte('=')
+
+		s := valueString(fields[i+1])
+		if needsQuotes(s) {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	}
+}
+
+func needsQuotes(s string) bool {
+
+	if len(s) == 0 {
+		return true
+	}
+
+	for _, r := range s {
+		if r == '"' || r == '=' || r == '\\' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeJSON(b *bytes.Buffer, fields []interface{}) {
+
+	b.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		b.Write(key)
+		b.WriteByte(':')
+
+		var value []byte
+		switch v := fields[i+1].(type) {
+		case bool, int, int32, int64, uint, uint16, uint32, uint64, float32, float64:
+			value, _ = json.Marshal(v)
+		default:
+			value, _ = json.Marshal(valueString(v))
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+}
+
+func valueString(v interface{}) string {
+
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case nil:
+		return "nil"
+	}
+
+	return fmt.Sprint(v)
+}
+
+//Writer returns an io.Writer that logs every line written to it at the level, Ex: for log.SetOutput
+func (l *Logger) Writer(level Level) io.Writer {
+	return &lineWriter{l, level}
+}
+
+type lineWriter struct {
+	l     *Logger
+	level Level
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.l.log(w.level, line, nil)
+	}
+
+	return len(p), nil
+}
+
+type contextKey struct{}
+
+//NewContext returns a context that carries the logger, Ex: one with the request id
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+//FromContext returns the logger in the context, or the default logger
+func FromContext(ctx context.Context) *Logger {
+
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+
+	return std
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogfmt(t *testing.T) {
+
+	var b bytes.Buffer
+	l := New(Options{Level: LevelInfo, Output: &b}).With("app", "billing", "queue", "invoices")
+
+	l.Debug("Hidden", "lsn", 1)
+	l.Info("Appended message", "message_id", "1-42", "payload", "hello world", "error", errors.New("disk full"))
+
+	line := strings.TrimSpace(b.String())
+	if strings.Contains(line, "Hidden") {
+		t.Errorf("Debug records should be dropped at the info level: %s", line)
+	}
+
+	for _, want := range []string{`level=info`, `msg="Appended message"`, `app=billing`, `queue=invoices`, `message_id=1-42`, `payload="hello world"`, `error="disk full"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("want %s in %s", want, line)
+		}
+	}
+
+	if strings.Count(b.String(), "\n") != 1 {
+		t.Errorf("want one record, got %q", b.String())
+	}
+}
+
+func TestJSONAndRedaction(t *testing.T) {
+
+	var b bytes.Buffer
+	l := New(Options{Level: LevelDebug, Format: FormatJSON, RedactPayloads: true, Output: &b})
+
+	ctx := NewContext(context.Background(), l.With("request_id", "abc"))
+	FromContext(ctx).Debug("Appended message", "lsn", uint64(42), "payload", l.Payload("secret"))
+
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(b.Bytes(), &record); err != nil {
+		t.Fatalf("want a JSON record, got %q: %s", b.String(), err)
+	}
+
+	if record["level"] != "debug" || record["request_id"] != "abc" || record["lsn"] != float64(42) {
+		t.Errorf("unexpected record %v", record)
+	}
+
+	if record["payload"] != "[redacted 6 bytes]" {
+		t.Errorf("want the payload redacted, got %v", record["payload"])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+
+	if l, err := ParseLevel("WARN"); err != nil || l != LevelWarn {
+		t.Errorf("ParseLevel(WARN): got %v, %v", l, err)
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("ParseLevel(verbose): want an error")
+	}
+}
@@ -0,0 +1,300 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Counters, gauges and histograms written in the Prometheus text exposition format
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//DefBuckets are latency buckets in seconds, from 100us to 10s
+var DefBuckets = []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//Default is the registry the daemon serves on /metrics
+var Default = NewRegistry()
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+//Write writes every metric in the order it was registered
+func (r *Registry) Write(w io.Writer) error {
+
+	r.mutex.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+//ServeHTTP serves the metrics to a Prometheus scrape
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+
+	rw.Header().Set("Content-Type", ContentType)
+	r.Write(rw)
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64 //histograms only, cumulative counts are worked out when written
+	count       uint64
+}
+
+//vec holds the series of one metric, one for each combination of label values
+type vec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, kind string, labelNames []string) *vec {
+	return &vec{name: name, help: help, kind: kind, labelNames: labelNames, series: map[string]*series{}}
+}
+
+//get returns the series for the label values. The caller must hold the lock
+func (v *vec) get(labelValues []string) *series {
+
+	if len(labelValues) != len(v.labelNames) {
+		panic("metrics: " + v.name + " wants " + strconv.Itoa(len(v.labelNames)) + " label values")
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if v.kind == "histogram" {
+			s.buckets = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+//Delete drops the series for the label values, Ex: when a queue is deleted
+func (v *vec) Delete(labelValues ...string) {
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	delete(v.series, strings.Join(labelValues, "\xff"))
+}
+
+func (v *vec) write(w *bufio.Writer) {
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	writeHeader(w, v.name, v.help, v.kind)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := v.series[k]
+
+		if v.kind != "histogram" {
+			writeSample(w, v.name, v.labelNames, s.labelValues, "", "", s.value)
+			continue
+		}
+
+		cumulative := uint64(0)
+		for i, bound := range v.buckets {
+			cumulative += s.buckets[i]
+			writeSample(w, v.name+"_bucket", v.labelNames, s.labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, v.name+"_bucket", v.labelNames, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, v.name+"_sum", v.labelNames, s.labelValues, "", "", s.value)
+		writeSample(w, v.name+"_count", v.labelNames, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+//Counter only goes up, Ex: the number of messages enqueued
+type Counter struct {
+	*vec
+}
+
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+
+	c := &Counter{newVec(name, help, "counter", labelNames)}
+	r.register(c)
+
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.get(labelValues).value += delta
+}
+
+//Gauge is a value that goes up and down, Ex: how long recovery took
+type Gauge struct {
+	*vec
+}
+
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+
+	g := &Gauge{newVec(name, help, "gauge", labelNames)}
+	r.register(g)
+
+	return g
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.get(labelValues).value = value
+}
+
+//Histogram counts observations into buckets, Ex: request latency
+type Histogram struct {
+	*vec
+}
+
+//NewHistogram registers a histogram. buckets are upper bounds in increasing order
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+
+	h := &Histogram{newVec(name, help, "histogram", labelNames)}
+	h.buckets = buckets
+	r.register(h)
+
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.get(labelValues)
+
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.buckets) {
+		s.buckets[i]++
+	}
+	s.count++
+	s.value += value
+}
+
+//GaugeFunc reads its values when the metrics are written. It suits values that are already kept
+//somewhere else, Ex: the depth of every queue
+type GaugeFunc struct {
+	name       string
+	help       string
+	labelNames []string
+	collect    func(set func(value float64, labelValues ...string))
+}
+
+//NewGaugeFunc registers a gauge whose collect function calls set once for every series
+func (r *Registry) NewGaugeFunc(name, help string, labelNames []string, collect func(set func(value float64, labelValues ...string))) *GaugeFunc {
+
+	g := &GaugeFunc{name, help, labelNames, collect}
+	r.register(g)
+
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+
+	writeHeader(w, g.name, g.help, "gauge")
+
+	g.collect(func(value float64, labelValues ...string) {
+		writeSample(w, g.name, g.labelNames, labelValues, "", "", value)
+	})
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+
+	w.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"")
+
+//writeSample writes one line. extraName and extraValue add the le label of histogram buckets
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, extraName, extraValue string, value float64) {
+
+	w.WriteString(name)
+
+	if len(labelNames) != 0 || len(extraName) != 0 {
+		w.WriteByte('{')
+		for i, l := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l + "=\"" + labelEscaper.Replace(labelValues[i]) + "\"")
+		}
+		if len(extraName) != 0 {
+			if len(labelNames) != 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + "=\"" + extraValue + "\"")
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(f float64) string {
+
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
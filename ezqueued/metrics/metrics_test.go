@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+
+	r := NewRegistry()
+
+	c := r.NewCounter("test_requests_total", "Requests", "method", "code")
+	c.Inc("/Ezqueued/Enqueue", "OK")
+	c.Add(2, "/Ezqueued/Enqueue", "OK")
+	c.Inc("/Ezqueued/Dequeue", "NotFound")
+
+	g := r.NewGauge("test_recovery_seconds", "Recovery")
+	g.Set(1.5)
+
+	h := r.NewHistogram("test_latency_seconds", "Latency", []float64{0.1, 1}, "method")
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(5, "a")
+
+	r.NewGaugeFunc("test_depth", "Depth", []string{"queue"}, func(set func(float64, ...string)) {
+		set(3, `odd"name`)
+	})
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP test_requests_total Requests
+# TYPE test_requests_total counter
+test_requests_total{method="/Ezqueued/Dequeue",code="NotFound"} 1
+test_requests_total{method="/Ezqueued/Enqueue",code="OK"} 3
+# HELP test_recovery_seconds Recovery
+# TYPE test_recovery_seconds gauge
+test_recovery_seconds 1.5
+# HELP test_latency_seconds Latency
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{method="a",le="0.1"} 1
+test_latency_seconds_bucket{method="a",le="1"} 2
+test_latency_seconds_bucket{method="a",le="+Inf"} 3
+test_latency_seconds_sum{method="a"} 5.55
+test_latency_seconds_count{method="a"} 3
+# HELP test_depth Depth
+# TYPE test_depth gauge
+test_depth{queue="odd\"name"} 3
+`
+
+	if b.String() != want {
+		t.Errorf("want\n%s\ngot\n%s", want, b.String())
+	}
+
+	c.Delete("/Ezqueued/Dequeue", "NotFound")
+	b.Reset()
+	r.Write(&b)
+	if strings.Contains(b.String(), "NotFound") {
+		t.Errorf("Delete: want the series gone, got\n%s", b.String())
+	}
+}
@@ -1,7 +1,9 @@
 package queue
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -11,26 +13,61 @@ const (
 	MaxMessageSize = 256 //KB
 	QueueTypeFifo  = true
 	MessageIDStart = uint32(1001)
+
+	MaxDelaySeconds = 30 //seconds, the longest delay of a queue
+
+	DefaultVisibilityTimeout = 30        //seconds a received message stays hidden when the queue does not set it
+	MaxVisibilityTimeout     = 12 * 3600 //seconds, the longest lease unless maxvisibilitytimeout in the config file sets another
+
+	MaxPriority = 9 //priorities of messages in a priority queue are 0 to MaxPriority, the highest is handed out first
+
+	MaxGroupIdLength = 128 //bytes, also the limit for deduplication ids
+
+	MaxRetentionSeconds = 14 * 24 * 3600 //longest retention period of a queue and time to live of a message
+	MaxScheduleSeconds  = 14 * 24 * 3600 //how far ahead a message can be scheduled for delivery
 )
 
 type Message struct {
-	Value string
-	Prev  *Message
-	Next  *Message
+	Value        string
+	Attributes   map[string]string //stored with the message in the wal and never changed, Ex: the trace context of the producer
+	WalFileNum   uint64            //wal file that holds the message
+	Lsn          uint64            //position of the message in the wal file
+	ReceiveCount uint32            //number of times the message was handed out with a lease
+	EnqueuedAt   time.Time         //when the message was appended. Messages read back from the wal get the time they were recovered
+	Priority     uint8             //0 to MaxPriority. Only priority queues hand out messages by priority
+	GroupId      string            //messages of a group are handed out one at a time in order, empty if it has none
+	ExpiresAt    time.Time         //when the message is dropped or moved to the dead-letter queue, zero if it does not expire
+	DeliverAt    time.Time         //when a scheduled message becomes visible, zero once it is
 }
 
+//Id returns the message id. It is derived from the position of the message in the wal
+//so it stays the same after the queue is recovered
+func (m *Message) Id() string {
+	return fmt.Sprintf("%d-%d", m.WalFileNum, m.Lsn)
+}
+
+//Before reports if m was written to the wal before o
+func (m *Message) Before(o *Message) bool {
+	return m.WalFileNum < o.WalFileNum || (m.WalFileNum == o.WalFileNum && m.Lsn < o.Lsn)
+}
+
+//ErrQueueEmpty is returned by Peek and DeQueue of an empty queue
+var ErrQueueEmpty = errors.New("queue is empty")
+
 //Type definitons
 //PersistantQueue is responsible for persisting and managing the queue items
+//A fifo queue keeps its messages in one ring in wal order. A priority queue keeps a ring for each priority and
+//hands out the messages of the highest priority first, in wal order within the priority
 type Queue struct {
-	Head              *Message //earliest message in the queue
-	Tail              *Message //latest message in the queue
-	AppName           string   //Should belong to an app
-	Name              string   //Queue Name
-	Id                string   //Unique identifier for this queue
-	FifoQueue         bool     //this is true by default and the only value supported for now
-	DelaySeconds      uint16   //number of seconds to delay
-	VisibilityTimeout uint16   //number of milliseconds to wait after the message is enqueued and
-	Count             uint16   //Number of messages curently in the queue
+	AppName           string //Should belong to an app
+	Name              string //Queue Name
+	Id                string //Unique identifier for this queue
+	FifoQueue         bool   //true for a fifo queue, false for a priority queue
+	DelaySeconds      uint16 //number of seconds to delay
+	VisibilityTimeout uint16 //number of milliseconds to wait after the message is enqueued and
+	Count             uint64 //Number of messages curently in the queue
+
+	levels []ring //one for a fifo queue, MaxPriority+1 for a priority queue with the highest priority last
 }
 
 func (q *Queue) Bytes() []byte {
@@ -47,30 +84,160 @@ func (q *Queue) String() string {
 }
 
 func (q *Queue) Enqueue(msg string) {
-	//First item being added to an empty queue
-	if q.Head == nil {
-		q.Head = newMessage(msg)
-		q.Tail = q.Head
 
-	} else {
-		//Add it to the tail and move the tail
-		q.Tail.Next = newMessage(msg)
-		q.Tail.Next.Prev = q.Tail
-		q.Tail = q.Tail.Next
+	q.Push(newMessage(msg))
+}
+
+//level returns the ring that holds the messages of m's priority
+func (q *Queue) level(m *Message) *ring {
+
+	if q.FifoQueue {
+		return &q.levels[0]
+	}
+
+	p := int(m.Priority)
+	if p > MaxPriority {
+		p = MaxPriority
+	}
+
+	return &q.levels[p]
+}
+
+//Push adds a message to the tail of the queue, or of its priority in a priority queue
+func (q *Queue) Push(m *Message) {
+
+	q.level(m).push(m)
+	q.Count++
+}
+
+//next returns the ring the next message is handed out from, nil if the queue is empty
+func (q *Queue) next() *ring {
+
+	for i := len(q.levels) - 1; i >= 0; i-- {
+		if q.levels[i].count != 0 {
+			return &q.levels[i]
+		}
+	}
+
+	return nil
+}
+
+//Pop removes and returns the message at the head of the queue, nil if the queue is empty.
+//In a priority queue that is the earliest message of the highest priority
+func (q *Queue) Pop() *Message {
+
+	r := q.next()
+	if r == nil {
+		return nil
+	}
+
+	q.Count--
+	return r.pop()
+}
+
+//Front returns the message Pop would return, nil if the queue is empty
+func (q *Queue) Front() *Message {
+
+	r := q.next()
+	if r == nil {
+		return nil
+	}
+
+	return r.front()
+}
+
+//Oldest returns the message written to the wal first, nil if the queue is empty.
+//It is Front except in a priority queue
+func (q *Queue) Oldest() *Message {
+
+	var oldest *Message
+	for i := range q.levels {
+		if m := q.levels[i].front(); m != nil && (oldest == nil || m.Before(oldest)) {
+			oldest = m
+		}
+	}
+
+	return oldest
+}
+
+//At returns message i in the order Pop hands them out. i must be less than Count
+func (q *Queue) At(i uint64) *Message {
+
+	for l := len(q.levels) - 1; ; l-- {
+		if i < q.levels[l].count {
+			return q.levels[l].at(i)
+		}
+		i -= q.levels[l].count
 	}
+}
+
+//Find returns the position in Pop order of the first message ok accepts. found is false if there is none
+func (q *Queue) Find(ok func(m *Message) bool) (i uint64, found bool) {
+
+	for l := len(q.levels) - 1; l >= 0; l-- {
+		r := &q.levels[l]
+		for j := uint64(0); j < r.count; j, i = j+1, i+1 {
+			if ok(r.at(j)) {
+				return i, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+//Remove takes message i in Pop order out of the queue. i must be less than Count
+func (q *Queue) Remove(i uint64) *Message {
+
+	for l := len(q.levels) - 1; ; l-- {
+		if i < q.levels[l].count {
+			q.Count--
+			return q.levels[l].remove(i)
+		}
+		i -= q.levels[l].count
+	}
+}
 
+//Filter removes the messages keep returns false for, in Pop order. The other messages keep their order
+func (q *Queue) Filter(keep func(m *Message) bool) {
+
+	for l := len(q.levels) - 1; l >= 0; l-- {
+		q.Count -= q.levels[l].filter(keep)
+	}
+}
+
+//InsertInOrder puts a message back into the queue ahead of every message of its priority that was written after it.
+//It is used to return messages whose lease expired
+func (q *Queue) InsertInOrder(m *Message) {
+
+	q.level(m).insertInOrder(m)
 	q.Count++
 }
 
+//Clear removes every message from the queue
+func (q *Queue) Clear() {
+
+	for i := range q.levels {
+		q.levels[i] = ring{}
+	}
+	q.Count = 0
+}
+
 func (q *Queue) Peek() (string, error) {
 
-	return q.Head.Value, nil
+	m := q.Front()
+	if m == nil {
+		return "", ErrQueueEmpty
+	}
+
+	return m.Value, nil
 }
 
 func (q *Queue) DeQueue() error {
 
-	q.Head = q.Head.Next
-	q.Count--
+	if q.Pop() == nil {
+		return ErrQueueEmpty
+	}
 
 	return nil
 }
@@ -87,18 +254,29 @@ func NewQueue(appName, name string, id string, delaySeconds,
 		id = uuid.NewString()
 	}
 
-	q := Queue{nil, nil, appName, name, id, true, delaySeconds, visibilityTimeout, 0}
+	q := Queue{AppName: appName, Name: name, Id: id, FifoQueue: true, DelaySeconds: delaySeconds, VisibilityTimeout: visibilityTimeout, levels: make([]ring, 1)}
 
 	return &q
 }
 
+//NewPriorityQueue creates a Queue that hands out messages by their priority
+func NewPriorityQueue(appName, name string, id string, delaySeconds,
+	visibilityTimeout uint16) *Queue {
+
+	q := NewQueue(appName, name, id, delaySeconds, visibilityTimeout)
+	if q != nil {
+		q.FifoQueue = false
+		q.levels = make([]ring, MaxPriority+1)
+	}
+
+	return q
+}
+
 //NewMessage creates a new Message object
 func newMessage(value string) *Message {
 
 	m := new(Message)
 	m.Value = value
-	m.Next = new(Message)
-	m.Prev = new(Message)
 
 	return m
 }
@@ -0,0 +1,440 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func message(lsn uint64) *Message {
+	return &Message{WalFileNum: 1, Lsn: lsn}
+}
+
+//lsns returns the lsns of the messages in the queue from the head
+func lsns(q *Queue) []uint64 {
+
+	var l []uint64
+	for i := uint64(0); i < q.Count; i++ {
+		l = append(l, q.At(i).Lsn)
+	}
+
+	return l
+}
+
+func TestQueue(t *testing.T) {
+
+	q := NewQueue("app", "queue", "", 0, 0)
+
+	if q.Pop() != nil || q.Front() != nil {
+		t.Fatal("Pop of an empty queue: want nil")
+	}
+	if _, err := q.Peek(); err != ErrQueueEmpty {
+		t.Errorf("Peek of an empty queue: want ErrQueueEmpty, got %v", err)
+	}
+
+	//Wrap around the ring and grow it while it wraps
+	next, popped := uint64(0), uint64(0)
+	for round := 0; round < 50; round++ {
+		for i := 0; i < 7; i++ {
+			q.Push(message(next))
+			next++
+		}
+		for i := 0; i < 5; i++ {
+			if m := q.Pop(); m == nil || m.Lsn != popped {
+				t.Fatalf("Pop: want lsn %d, got %v", popped, m)
+			}
+			popped++
+		}
+	}
+	if q.Count != next-popped || q.Front().Lsn != popped {
+		t.Fatalf("Count and Front: want %d messages from lsn %d, got %d from %v", next-popped, popped, q.Count, q.Front())
+	}
+
+	//A burst past what a 16 bit count held, the ring shrinks back as the queue drains
+	for i := 0; i < 70000; i++ {
+		q.Push(message(next))
+		next++
+	}
+	if q.Count != next-popped || len(q.levels[0].slots) != 131072 {
+		t.Errorf("Ring of %d messages: want 131072 slots, got %d", q.Count, len(q.levels[0].slots))
+	}
+	for q.Count != 0 {
+		if m := q.Pop(); m.Lsn != popped {
+			t.Fatalf("Pop: want lsn %d, got %d", popped, m.Lsn)
+		}
+		popped++
+	}
+	if len(q.levels[0].slots) != keptRingSize {
+		t.Errorf("Ring after the queue was drained: want %d slots, got %d", keptRingSize, len(q.levels[0].slots))
+	}
+
+	q.Clear()
+	q.Enqueue("one")
+	if value, err := q.Peek(); err != nil || value != "one" || q.DeQueue() != nil || q.DeQueue() != ErrQueueEmpty {
+		t.Errorf("Enqueue, Peek and DeQueue: want one then ErrQueueEmpty, got %q %v", value, err)
+	}
+}
+
+func TestQueueInsertInOrder(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1))
+
+	for round := 0; round < 200; round++ {
+
+		q := NewQueue("app", "queue", "", 0, 0)
+		var want []uint64
+
+		//Start the head somewhere in the ring so inserts wrap
+		for i, start := 0, r.Intn(minRingSize+4); i < start; i++ {
+			q.Push(message(0))
+			q.Pop()
+		}
+
+		//Even lsns are queued, odd ones come back in any order like expired leases
+		n := uint64(r.Intn(40))
+		for lsn := uint64(0); lsn < n; lsn += 2 {
+			q.Push(message(lsn))
+		}
+		back := r.Perm(int(n))
+		for _, lsn := range back {
+			if lsn%2 == 1 {
+				q.InsertInOrder(message(uint64(lsn)))
+			}
+		}
+		for lsn := uint64(0); lsn < n; lsn++ {
+			want = append(want, lsn)
+		}
+
+		if got := lsns(q); len(got) != len(want) {
+			t.Fatalf("InsertInOrder: want %v, got %v", want, got)
+		} else {
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("InsertInOrder: want %v, got %v", want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestQueueFindRemove(t *testing.T) {
+
+	for _, start := range []int{0, 5, minRingSize - 2} {
+		for remove := uint64(0); remove < 10; remove++ {
+
+			//Start the head somewhere in the ring so removes wrap
+			q := NewQueue("app", "queue", "", 0, 0)
+			for i := 0; i < start; i++ {
+				q.Push(message(0))
+				q.Pop()
+			}
+			for lsn := uint64(0); lsn < 10; lsn++ {
+				q.Push(message(lsn))
+			}
+
+			i, found := q.Find(func(m *Message) bool { return m.Lsn == remove })
+			if !found || i != remove {
+				t.Fatalf("Find lsn %d: want position %d, got %d %v", remove, remove, i, found)
+			}
+			if m := q.Remove(i); m.Lsn != remove {
+				t.Fatalf("Remove %d: want lsn %d, got %d", i, remove, m.Lsn)
+			}
+
+			got := lsns(q)
+			for j, lsn := 0, uint64(0); lsn < 10; lsn++ {
+				if lsn == remove {
+					continue
+				}
+				if j >= len(got) || got[j] != lsn {
+					t.Fatalf("Remove lsn %d with the head at %d: got %v", remove, start, got)
+				}
+				j++
+			}
+		}
+	}
+
+	q := NewPriorityQueue("app", "queue", "", 0, 0)
+	for lsn, p := range []uint8{0, 3, 0, 3} {
+		m := message(uint64(lsn))
+		m.Priority = p
+		q.Push(m)
+	}
+	if i, found := q.Find(func(m *Message) bool { return m.Priority == 0 }); !found || i != 2 || q.Remove(i).Lsn != 0 {
+		t.Errorf("Find in a priority queue: want position 2 to hold lsn 0, got %d %v", i, found)
+	}
+	if _, found := q.Find(func(m *Message) bool { return m.Lsn > 10 }); found {
+		t.Errorf("Find without a match: want found false")
+	}
+}
+
+func TestQueueFilter(t *testing.T) {
+
+	//Start the head near the end of the ring so the kept messages wrap
+	q := NewQueue("app", "queue", "", 0, 0)
+	for i := 0; i < 12; i++ {
+		q.Push(message(0))
+		q.Pop()
+	}
+	for lsn := uint64(0); lsn < 10; lsn++ {
+		q.Push(message(lsn))
+	}
+
+	q.Filter(func(m *Message) bool { return m.Lsn%3 != 0 })
+	if got := lsns(q); fmt.Sprint(got) != "[1 2 4 5 7 8]" || q.Count != 6 {
+		t.Errorf("Filter: want lsns [1 2 4 5 7 8], got %v with count %d", got, q.Count)
+	}
+	if m := q.Pop(); m == nil || m.Lsn != 1 {
+		t.Errorf("Pop after Filter: want lsn 1, got %v", m)
+	}
+
+	pq := NewPriorityQueue("app", "queue", "", 0, 0)
+	for lsn, p := range []uint8{0, 3, 0, 3} {
+		m := message(uint64(lsn))
+		m.Priority = p
+		pq.Push(m)
+	}
+	pq.Filter(func(m *Message) bool { return m.Lsn != 1 && m.Lsn != 2 })
+	if got := lsns(pq); fmt.Sprint(got) != "[3 0]" || pq.Count != 2 {
+		t.Errorf("Filter of a priority queue: want lsns [3 0], got %v with count %d", got, pq.Count)
+	}
+}
+
+func TestPriorityQueue(t *testing.T) {
+
+	q := NewPriorityQueue("app", "queue", "", 0, 0)
+	if q.FifoQueue {
+		t.Fatal("NewPriorityQueue: want a queue that is not fifo")
+	}
+
+	//lsn 0 to 8 with priorities 1 2 0 2 1 9 0 2 1
+	priorities := []uint8{1, 2, 0, 2, 1, 9, 0, 2, 1}
+	for lsn, p := range priorities {
+		m := message(uint64(lsn))
+		m.Priority = p
+		q.Push(m)
+	}
+
+	if m := q.Oldest(); m == nil || m.Lsn != 0 {
+		t.Errorf("Oldest: want lsn 0, got %v", m)
+	}
+
+	//The highest priority first, in wal order within a priority
+	want := []uint64{5, 1, 3, 7, 0, 4, 8, 2, 6}
+	if got := lsns(q); len(got) != len(want) {
+		t.Fatalf("At: want %v, got %v", want, got)
+	} else {
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("At: want %v, got %v", want, got)
+			}
+		}
+	}
+
+	//An expired lease goes back ahead of the later messages of its priority only
+	first, second := q.Pop(), q.Pop()
+	if first.Lsn != 5 || second.Lsn != 1 || q.Front().Lsn != 3 {
+		t.Fatalf("Pop: want lsn 5 and 1, got %d and %d", first.Lsn, second.Lsn)
+	}
+	q.InsertInOrder(second)
+	for _, lsn := range want[1:] {
+		if m := q.Pop(); m == nil || m.Lsn != lsn {
+			t.Fatalf("Pop after InsertInOrder: want lsn %d, got %v", lsn, m)
+		}
+	}
+	if q.Count != 0 || q.Pop() != nil || q.Oldest() != nil {
+		t.Errorf("Pop: want an empty queue, got %d messages", q.Count)
+	}
+
+	//A fifo queue ignores the priority of its messages
+	f := NewQueue("app", "queue", "", 0, 0)
+	for lsn, p := range priorities {
+		m := message(uint64(lsn))
+		m.Priority = p
+		f.Push(m)
+	}
+	if m := f.Front(); m.Lsn != 0 {
+		t.Errorf("Front of a fifo queue: want lsn 0, got %d", m.Lsn)
+	}
+}
+
+//listQueue is the doubly linked list the queue was before the ring, kept to compare against
+type listQueue struct {
+	head, tail *listMessage
+	count      uint16
+}
+
+type listMessage struct {
+	Message
+	prev, next *listMessage
+}
+
+func (l *listQueue) push(lm *listMessage) {
+
+	lm.prev, lm.next = l.tail, nil
+	if l.head == nil {
+		l.head = lm
+	} else {
+		l.tail.next = lm
+	}
+	l.tail = lm
+	l.count++
+}
+
+func (l *listQueue) pop() *listMessage {
+
+	m := l.head
+	if m == nil {
+		return nil
+	}
+
+	l.head = m.next
+	l.count--
+	if l.head == nil {
+		l.tail = nil
+	} else {
+		l.head.prev = nil
+	}
+	m.next = nil
+
+	return m
+}
+
+//insertInOrder walks from the head to the first message written after lm, as the list did
+func (l *listQueue) insertInOrder(lm *listMessage) {
+
+	next := l.head
+	for next != nil && next.Before(&lm.Message) {
+		next = next.next
+	}
+
+	if next == nil {
+		l.push(lm)
+		return
+	}
+
+	lm.next, lm.prev = next, next.prev
+	if next.prev == nil {
+		l.head = lm
+	} else {
+		next.prev.next = lm
+	}
+	next.prev = lm
+	l.count++
+}
+
+//remove unlinks lm
+func (l *listQueue) remove(lm *listMessage) {
+
+	if lm.prev == nil {
+		l.head = lm.next
+	} else {
+		lm.prev.next = lm.next
+	}
+	if lm.next == nil {
+		l.tail = lm.prev
+	} else {
+		lm.next.prev = lm.prev
+	}
+	lm.prev, lm.next = nil, nil
+	l.count--
+}
+
+const benchmarkDepth = 1000
+
+//BenchmarkPushPop keeps benchmarkDepth messages queued and pushes and pops one per op
+func BenchmarkPushPop(b *testing.B) {
+
+	b.Run("ring", func(b *testing.B) {
+		q := NewQueue("app", "queue", "", 0, 0)
+		for i := 0; i < benchmarkDepth; i++ {
+			q.Push(message(uint64(i)))
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			q.Push(message(uint64(i)))
+			q.Pop()
+		}
+	})
+
+	b.Run("list", func(b *testing.B) {
+		var l listQueue
+		for i := 0; i < benchmarkDepth; i++ {
+			l.push(&listMessage{Message: Message{WalFileNum: 1, Lsn: uint64(i)}})
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			l.push(&listMessage{Message: Message{WalFileNum: 1, Lsn: uint64(i)}})
+			l.pop()
+		}
+	})
+}
+
+//BenchmarkFillDrain queues benchmarkDepth messages and takes them all out again per op
+func BenchmarkFillDrain(b *testing.B) {
+
+	messages := make([]*Message, benchmarkDepth)
+	listMessages := make([]*listMessage, benchmarkDepth)
+	for i := range messages {
+		messages[i] = message(uint64(i))
+		listMessages[i] = &listMessage{Message: *messages[i]}
+	}
+
+	b.Run("ring", func(b *testing.B) {
+		q := NewQueue("app", "queue", "", 0, 0)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, m := range messages {
+				q.Push(m)
+			}
+			for q.Pop() != nil {
+			}
+		}
+	})
+
+	b.Run("list", func(b *testing.B) {
+		var l listQueue
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, m := range listMessages {
+				l.push(m)
+			}
+			for l.pop() != nil {
+			}
+		}
+	})
+}
+
+//BenchmarkInsertInOrder takes the message in the middle of benchmarkDepth messages out and puts it back in order
+//per op, as receives that skip a busy group and leases that expire do
+func BenchmarkInsertInOrder(b *testing.B) {
+
+	b.Run("ring", func(b *testing.B) {
+		q := NewQueue("app", "queue", "", 0, 0)
+		for i := 0; i < benchmarkDepth; i++ {
+			q.Push(message(uint64(i)))
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			q.InsertInOrder(q.Remove(benchmarkDepth / 2))
+		}
+	})
+
+	b.Run("list", func(b *testing.B) {
+		var l listQueue
+		messages := make([]*listMessage, benchmarkDepth)
+		for i := range messages {
+			messages[i] = &listMessage{Message: Message{WalFileNum: 1, Lsn: uint64(i)}}
+			l.push(messages[i])
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m := messages[benchmarkDepth/2]
+			l.remove(m)
+			l.insertInOrder(m)
+		}
+	})
+}
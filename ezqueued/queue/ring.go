@@ -0,0 +1,201 @@
+package queue
+
+//A ring starts with minRingSize slots and doubles when it is full. After a burst it halves when it is a quarter
+//full, down to keptRingSize, so a queue that fills and drains often does not copy its ring each time
+const (
+	minRingSize  = 64
+	keptRingSize = 1024
+)
+
+//ring keeps messages in wal order. The slot of message i from the head is (head+i)&(len(slots)-1)
+type ring struct {
+	slots []*Message //len is a power of 2, or 0 before the first message
+	head  uint64     //slot of the earliest message
+	count uint64
+}
+
+//slot returns the index in slots of message i from the head
+func (r *ring) slot(i uint64) uint64 {
+	return (r.head + i) & uint64(len(r.slots)-1)
+}
+
+//resize moves the messages to a ring of size slots, starting at slot 0
+func (r *ring) resize(size int) {
+
+	slots := make([]*Message, size)
+	for i := uint64(0); i < r.count; i++ {
+		slots[i] = r.slots[r.slot(i)]
+	}
+
+	r.slots = slots
+	r.head = 0
+}
+
+//full reports if the ring has no free slot
+func (r *ring) full() bool {
+	return r.count == uint64(len(r.slots))
+}
+
+//grow doubles a full ring
+func (r *ring) grow() {
+
+	size := 2 * len(r.slots)
+	if size < minRingSize {
+		size = minRingSize
+	}
+	r.resize(size)
+}
+
+//shrink gives memory back after a burst of messages was consumed
+func (r *ring) shrink() {
+
+	if len(r.slots) > keptRingSize && r.count < uint64(len(r.slots)/4) {
+		r.resize(len(r.slots) / 2)
+	}
+}
+
+func (r *ring) push(m *Message) {
+
+	if r.full() {
+		r.grow()
+	}
+	r.slots[r.slot(r.count)] = m
+	r.count++
+}
+
+func (r *ring) pop() *Message {
+
+	if r.count == 0 {
+		return nil
+	}
+
+	m := r.slots[r.head]
+	r.slots[r.head] = nil
+	r.head = r.slot(1)
+	r.count--
+
+	//Pop takes one message at a time, so it only has to look when the ring drops below a quarter full
+	if r.count+1 == uint64(len(r.slots)/4) {
+		r.shrink()
+	}
+
+	return m
+}
+
+func (r *ring) front() *Message {
+
+	if r.count == 0 {
+		return nil
+	}
+
+	return r.slots[r.head]
+}
+
+func (r *ring) at(i uint64) *Message {
+	return r.slots[r.slot(i)]
+}
+
+//move copies the n messages from position src on to position dst, positions counted from the head.
+//The slots are copied in runs that do not wrap around, from the end when the messages move up
+func (r *ring) move(dst, src, n uint64) {
+
+	size := uint64(len(r.slots))
+	for n != 0 {
+		if dst < src {
+			d, s := r.slot(dst), r.slot(src)
+			k := n
+			if size-d < k {
+				k = size - d
+			}
+			if size-s < k {
+				k = size - s
+			}
+			copy(r.slots[d:d+k], r.slots[s:s+k])
+			dst, src, n = dst+k, src+k, n-k
+		} else {
+			d, s := r.slot(dst+n-1)+1, r.slot(src+n-1)+1
+			k := n
+			if d < k {
+				k = d
+			}
+			if s < k {
+				k = s
+			}
+			copy(r.slots[d-k:d], r.slots[s-k:s])
+			n -= k
+		}
+	}
+}
+
+//remove takes message i out of the ring, moving the shorter side by one slot to close the gap
+func (r *ring) remove(i uint64) *Message {
+
+	m := r.at(i)
+
+	if i < r.count/2 {
+		r.move(1, 0, i)
+		r.slots[r.head] = nil
+		r.head = r.slot(1)
+	} else {
+		r.move(i, i+1, r.count-1-i)
+		r.slots[r.slot(r.count-1)] = nil
+	}
+
+	r.count--
+	r.shrink()
+
+	return m
+}
+
+//filter removes the messages keep rejects, the others close the gaps in the same order.
+//It returns the number of messages removed
+func (r *ring) filter(keep func(m *Message) bool) uint64 {
+
+	kept := uint64(0)
+	for i := uint64(0); i < r.count; i++ {
+		if m := r.at(i); keep(m) {
+			r.slots[r.slot(kept)] = m
+			kept++
+		}
+	}
+
+	for i := kept; i < r.count; i++ {
+		r.slots[r.slot(i)] = nil
+	}
+
+	removed := r.count - kept
+	r.count = kept
+	r.shrink()
+
+	return removed
+}
+
+//insertInOrder puts m ahead of every message that was written after it
+func (r *ring) insertInOrder(m *Message) {
+
+	//The ring is in wal order, find the first message written after m
+	lo, hi := uint64(0), r.count
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if r.at(mid).Before(m) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	if r.full() {
+		r.grow()
+	}
+
+	//Move the shorter side of the ring by one slot to open slot lo
+	if lo < r.count/2 {
+		r.head = r.slot(uint64(len(r.slots)) - 1)
+		r.move(0, 1, lo)
+	} else {
+		r.move(lo+1, lo, r.count-lo)
+	}
+
+	r.slots[r.slot(lo)] = m
+	r.count++
+}
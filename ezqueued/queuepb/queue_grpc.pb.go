@@ -0,0 +1,609 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: queue.proto
+
+package queuepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// EzqueueQueuesClient is the client API for EzqueueQueues service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EzqueueQueuesClient interface {
+	CreateQueue(ctx context.Context, in *CreateQueueParams, opts ...grpc.CallOption) (*Result, error)
+	ListQueues(ctx context.Context, in *ListQueuesParams, opts ...grpc.CallOption) (*QueueList, error)
+	GetQueueStats(ctx context.Context, in *QueueParams, opts ...grpc.CallOption) (*QueueDetails, error)
+	PurgeQueue(ctx context.Context, in *QueueParams, opts ...grpc.CallOption) (*Result, error)
+	DeleteQueue(ctx context.Context, in *QueueParams, opts ...grpc.CallOption) (*Result, error)
+	Receive(ctx context.Context, in *ReceiveParams, opts ...grpc.CallOption) (*ReceivedMessageList, error)
+	DeleteMessage(ctx context.Context, in *DeleteMessageParams, opts ...grpc.CallOption) (*Result, error)
+	SendMessages(ctx context.Context, in *SendMessagesParams, opts ...grpc.CallOption) (*SendMessagesResult, error)
+	ChangeVisibility(ctx context.Context, in *ChangeVisibilityParams, opts ...grpc.CallOption) (*Result, error)
+	ChangeVisibilityBatch(ctx context.Context, in *ChangeVisibilityBatchParams, opts ...grpc.CallOption) (*ChangeVisibilityBatchResult, error)
+	CreateSchedule(ctx context.Context, in *CreateScheduleParams, opts ...grpc.CallOption) (*Result, error)
+	ListSchedules(ctx context.Context, in *ListSchedulesParams, opts ...grpc.CallOption) (*ScheduleList, error)
+	PauseSchedule(ctx context.Context, in *ScheduleParams, opts ...grpc.CallOption) (*Result, error)
+	ResumeSchedule(ctx context.Context, in *ScheduleParams, opts ...grpc.CallOption) (*Result, error)
+	DeleteSchedule(ctx context.Context, in *ScheduleParams, opts ...grpc.CallOption) (*Result, error)
+}
+
+type ezqueueQueuesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEzqueueQueuesClient(cc grpc.ClientConnInterface) EzqueueQueuesClient {
+	return &ezqueueQueuesClient{cc}
+}
+
+func (c *ezqueueQueuesClient) CreateQueue(ctx context.Context, in *CreateQueueParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/CreateQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) ListQueues(ctx context.Context, in *ListQueuesParams, opts ...grpc.CallOption) (*QueueList, error) {
+	out := new(QueueList)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/ListQueues", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) GetQueueStats(ctx context.Context, in *QueueParams, opts ...grpc.CallOption) (*QueueDetails, error) {
+	out := new(QueueDetails)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/GetQueueStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) PurgeQueue(ctx context.Context, in *QueueParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/PurgeQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) DeleteQueue(ctx context.Context, in *QueueParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/DeleteQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) Receive(ctx context.Context, in *ReceiveParams, opts ...grpc.CallOption) (*ReceivedMessageList, error) {
+	out := new(ReceivedMessageList)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/Receive", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) DeleteMessage(ctx context.Context, in *DeleteMessageParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/DeleteMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) SendMessages(ctx context.Context, in *SendMessagesParams, opts ...grpc.CallOption) (*SendMessagesResult, error) {
+	out := new(SendMessagesResult)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/SendMessages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) ChangeVisibility(ctx context.Context, in *ChangeVisibilityParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/ChangeVisibility", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) ChangeVisibilityBatch(ctx context.Context, in *ChangeVisibilityBatchParams, opts ...grpc.CallOption) (*ChangeVisibilityBatchResult, error) {
+	out := new(ChangeVisibilityBatchResult)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/ChangeVisibilityBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) CreateSchedule(ctx context.Context, in *CreateScheduleParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/CreateSchedule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) ListSchedules(ctx context.Context, in *ListSchedulesParams, opts ...grpc.CallOption) (*ScheduleList, error) {
+	out := new(ScheduleList)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/ListSchedules", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) PauseSchedule(ctx context.Context, in *ScheduleParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/PauseSchedule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) ResumeSchedule(ctx context.Context, in *ScheduleParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/ResumeSchedule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ezqueueQueuesClient) DeleteSchedule(ctx context.Context, in *ScheduleParams, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/EzqueueQueues/DeleteSchedule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EzqueueQueuesServer is the server API for EzqueueQueues service.
+// All implementations must embed UnimplementedEzqueueQueuesServer
+// for forward compatibility
+type EzqueueQueuesServer interface {
+	CreateQueue(context.Context, *CreateQueueParams) (*Result, error)
+	ListQueues(context.Context, *ListQueuesParams) (*QueueList, error)
+	GetQueueStats(context.Context, *QueueParams) (*QueueDetails, error)
+	PurgeQueue(context.Context, *QueueParams) (*Result, error)
+	DeleteQueue(context.Context, *QueueParams) (*Result, error)
+	Receive(context.Context, *ReceiveParams) (*ReceivedMessageList, error)
+	DeleteMessage(context.Context, *DeleteMessageParams) (*Result, error)
+	SendMessages(context.Context, *SendMessagesParams) (*SendMessagesResult, error)
+	ChangeVisibility(context.Context, *ChangeVisibilityParams) (*Result, error)
+	ChangeVisibilityBatch(context.Context, *ChangeVisibilityBatchParams) (*ChangeVisibilityBatchResult, error)
+	CreateSchedule(context.Context, *CreateScheduleParams) (*Result, error)
+	ListSchedules(context.Context, *ListSchedulesParams) (*ScheduleList, error)
+	PauseSchedule(context.Context, *ScheduleParams) (*Result, error)
+	ResumeSchedule(context.Context, *ScheduleParams) (*Result, error)
+	DeleteSchedule(context.Context, *ScheduleParams) (*Result, error)
+	mustEmbedUnimplementedEzqueueQueuesServer()
+}
+
+// UnimplementedEzqueueQueuesServer must be embedded to have forward compatible implementations.
+type UnimplementedEzqueueQueuesServer struct {
+}
+
+func (UnimplementedEzqueueQueuesServer) CreateQueue(context.Context, *CreateQueueParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateQueue not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) ListQueues(context.Context, *ListQueuesParams) (*QueueList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQueues not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) GetQueueStats(context.Context, *QueueParams) (*QueueDetails, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQueueStats not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) PurgeQueue(context.Context, *QueueParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeQueue not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) DeleteQueue(context.Context, *QueueParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteQueue not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) Receive(context.Context, *ReceiveParams) (*ReceivedMessageList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Receive not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) DeleteMessage(context.Context, *DeleteMessageParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMessage not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) SendMessages(context.Context, *SendMessagesParams) (*SendMessagesResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessages not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) ChangeVisibility(context.Context, *ChangeVisibilityParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeVisibility not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) ChangeVisibilityBatch(context.Context, *ChangeVisibilityBatchParams) (*ChangeVisibilityBatchResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeVisibilityBatch not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) CreateSchedule(context.Context, *CreateScheduleParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSchedule not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) ListSchedules(context.Context, *ListSchedulesParams) (*ScheduleList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSchedules not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) PauseSchedule(context.Context, *ScheduleParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseSchedule not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) ResumeSchedule(context.Context, *ScheduleParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeSchedule not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) DeleteSchedule(context.Context, *ScheduleParams) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSchedule not implemented")
+}
+func (UnimplementedEzqueueQueuesServer) mustEmbedUnimplementedEzqueueQueuesServer() {}
+
+// UnsafeEzqueueQueuesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EzqueueQueuesServer will
+// result in compilation errors.
+type UnsafeEzqueueQueuesServer interface {
+	mustEmbedUnimplementedEzqueueQueuesServer()
+}
+
+func RegisterEzqueueQueuesServer(s grpc.ServiceRegistrar, srv EzqueueQueuesServer) {
+	s.RegisterService(&EzqueueQueues_ServiceDesc, srv)
+}
+
+func _EzqueueQueues_CreateQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateQueueParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).CreateQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/CreateQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).CreateQueue(ctx, req.(*CreateQueueParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_ListQueues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQueuesParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).ListQueues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/ListQueues",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).ListQueues(ctx, req.(*ListQueuesParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_GetQueueStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).GetQueueStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/GetQueueStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).GetQueueStats(ctx, req.(*QueueParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_PurgeQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).PurgeQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/PurgeQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).PurgeQueue(ctx, req.(*QueueParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_DeleteQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).DeleteQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/DeleteQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).DeleteQueue(ctx, req.(*QueueParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_Receive_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReceiveParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).Receive(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/Receive",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).Receive(ctx, req.(*ReceiveParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_DeleteMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMessageParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).DeleteMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/DeleteMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).DeleteMessage(ctx, req.(*DeleteMessageParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_SendMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessagesParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).SendMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/SendMessages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).SendMessages(ctx, req.(*SendMessagesParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_ChangeVisibility_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeVisibilityParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).ChangeVisibility(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/ChangeVisibility",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).ChangeVisibility(ctx, req.(*ChangeVisibilityParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_ChangeVisibilityBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeVisibilityBatchParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).ChangeVisibilityBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/ChangeVisibilityBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).ChangeVisibilityBatch(ctx, req.(*ChangeVisibilityBatchParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_CreateSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateScheduleParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).CreateSchedule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/CreateSchedule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).CreateSchedule(ctx, req.(*CreateScheduleParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_ListSchedules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSchedulesParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).ListSchedules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/ListSchedules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).ListSchedules(ctx, req.(*ListSchedulesParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_PauseSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduleParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).PauseSchedule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/PauseSchedule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).PauseSchedule(ctx, req.(*ScheduleParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_ResumeSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduleParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).ResumeSchedule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/ResumeSchedule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).ResumeSchedule(ctx, req.(*ScheduleParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EzqueueQueues_DeleteSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduleParams)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EzqueueQueuesServer).DeleteSchedule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/EzqueueQueues/DeleteSchedule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EzqueueQueuesServer).DeleteSchedule(ctx, req.(*ScheduleParams))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EzqueueQueues_ServiceDesc is the grpc.ServiceDesc for EzqueueQueues service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EzqueueQueues_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "EzqueueQueues",
+	HandlerType: (*EzqueueQueuesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateQueue",
+			Handler:    _EzqueueQueues_CreateQueue_Handler,
+		},
+		{
+			MethodName: "ListQueues",
+			Handler:    _EzqueueQueues_ListQueues_Handler,
+		},
+		{
+			MethodName: "GetQueueStats",
+			Handler:    _EzqueueQueues_GetQueueStats_Handler,
+		},
+		{
+			MethodName: "PurgeQueue",
+			Handler:    _EzqueueQueues_PurgeQueue_Handler,
+		},
+		{
+			MethodName: "DeleteQueue",
+			Handler:    _EzqueueQueues_DeleteQueue_Handler,
+		},
+		{
+			MethodName: "Receive",
+			Handler:    _EzqueueQueues_Receive_Handler,
+		},
+		{
+			MethodName: "DeleteMessage",
+			Handler:    _EzqueueQueues_DeleteMessage_Handler,
+		},
+		{
+			MethodName: "SendMessages",
+			Handler:    _EzqueueQueues_SendMessages_Handler,
+		},
+		{
+			MethodName: "ChangeVisibility",
+			Handler:    _EzqueueQueues_ChangeVisibility_Handler,
+		},
+		{
+			MethodName: "ChangeVisibilityBatch",
+			Handler:    _EzqueueQueues_ChangeVisibilityBatch_Handler,
+		},
+		{
+			MethodName: "CreateSchedule",
+			Handler:    _EzqueueQueues_CreateSchedule_Handler,
+		},
+		{
+			MethodName: "ListSchedules",
+			Handler:    _EzqueueQueues_ListSchedules_Handler,
+		},
+		{
+			MethodName: "PauseSchedule",
+			Handler:    _EzqueueQueues_PauseSchedule_Handler,
+		},
+		{
+			MethodName: "ResumeSchedule",
+			Handler:    _EzqueueQueues_ResumeSchedule_Handler,
+		},
+		{
+			MethodName: "DeleteSchedule",
+			Handler:    _EzqueueQueues_DeleteSchedule_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "queue.proto",
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/adminpb"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//EzqueueAdmin service for operators. It shows the control state and wal files of a queue
+//and runs maintenance on them. Authentication puts every call under the admin permission
+
+const (
+	defaultBrowseLimit = 100
+	maxBrowseLimit     = 1000
+)
+
+//QueueRecovery is what recovery found for one queue
+type QueueRecovery struct {
+	AppName   string
+	QueueName string
+	Messages  uint64 //messages added back to the queue
+	Records   uint64 //wal items read
+	BytesRead int64
+	Error     string //why the queue could not be recovered, it is not served if this is set
+}
+
+type recoveryStats struct {
+	mutex     sync.Mutex
+	startedAt time.Time
+	duration  time.Duration
+	queues    []QueueRecovery
+}
+
+var lastRecovery recoveryStats
+
+func setRecoveryStats(startedAt time.Time, queues []QueueRecovery) {
+
+	lastRecovery.mutex.Lock()
+	defer lastRecovery.mutex.Unlock()
+
+	lastRecovery.startedAt = startedAt
+	lastRecovery.duration = time.Since(startedAt)
+	lastRecovery.queues = queues
+}
+
+type EzqueueAdminServer struct {
+	adminpb.UnimplementedEzqueueAdminServer
+}
+
+//adminQueue returns the queue named in the request or a NotFound error
+func adminQueue(appName, queueName string) (*wal.QueueInfo, error) {
+
+	appQueue, ok := queueInfo.Get(appName + queueName)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s", e.ErrorQueueDoesNotExist)
+	}
+
+	return appQueue, nil
+}
+
+func controlState(appQueue *wal.QueueInfo) *adminpb.ControlState {
+
+	c := appQueue.Control()
+	visible, inFlight, _ := appQueue.Counts()
+
+	return &adminpb.ControlState{
+		AppName:           c.MetaData.AppName,
+		QueueName:         c.MetaData.Name,
+		DelaySeconds:      uint32(c.MetaData.DelaySeconds),
+		VisibilityTimeout: uint32(c.MetaData.VisibilityTimeout),
+		HeadLsn:           c.HeadLsn,
+		HeadLsnFileNum:    c.HeadLsnFileNum,
+		TailLsn:           c.TailLsn,
+		TailLsnFileNum:    c.TailLsnFileNum,
+		NextLsn:           c.NextLsn,
+		Paused:            c.Paused,
+		Visible:           uint64(visible),
+		InFlight:          uint64(inFlight),
+	}
+}
+
+func toSegment(s wal.SegmentInfo) *adminpb.Segment {
+	return &adminpb.Segment{FileNum: s.FileNum, Name: s.Name, SizeBytes: s.Size, Live: s.Live, Missing: s.Missing}
+}
+
+func (EzqueueAdminServer) GetControl(ctx context.Context, in *adminpb.QueueRef) (*adminpb.ControlState, error) {
+
+	appQueue, err := adminQueue(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, err
+	}
+
+	return controlState(appQueue), nil
+}
+
+func (EzqueueAdminServer) ListSegments(ctx context.Context, in *adminpb.QueueRef) (*adminpb.SegmentList, error) {
+
+	appQueue, err := adminQueue(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &adminpb.SegmentList{}
+	for _, s := range appQueue.Segments() {
+		list.Segments = append(list.Segments, toSegment(s))
+	}
+
+	return list, nil
+}
+
+func (EzqueueAdminServer) BrowseMessages(ctx context.Context, in *adminpb.BrowseParams) (*adminpb.WalRecordList, error) {
+
+	appQueue, err := adminQueue(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = defaultBrowseLimit
+	}
+	if limit > maxBrowseLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "Limit must be at most %d", maxBrowseLimit)
+	}
+
+	records, nextFileNum, nextLsn, err := appQueue.Browse(in.StartFileNum, in.StartLsn, in.EndFileNum, in.EndLsn, limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to read the wal: %s", err.Error())
+	}
+
+	list := &adminpb.WalRecordList{NextFileNum: nextFileNum, NextLsn: nextLsn}
+	for _, r := range records {
+		list.Records = append(list.Records, &adminpb.WalRecord{
+			FileNum:    r.WalFileNum,
+			Lsn:        r.Lsn,
+			Type:       wal.TypeName(r.ItemType),
+			Id:         r.Id,
+			Body:       []byte(r.Body),
+			Attributes: r.Attributes,
+			State:      r.State,
+			Priority:   uint32(r.Priority),
+			GroupId:    r.GroupId,
+		})
+	}
+
+	return list, nil
+}
+
+func (EzqueueAdminServer) Flush(ctx context.Context, in *adminpb.FlushParams) (*adminpb.FlushResult, error) {
+
+	var queues []*wal.QueueInfo
+
+	if len(in.AppName) == 0 && len(in.QueueName) == 0 {
+		for _, appQueue := range queueInfo.Iter() {
+			queues = append(queues, appQueue)
+		}
+	} else {
+		appQueue, err := adminQueue(in.AppName, in.QueueName)
+		if err != nil {
+			return nil, err
+		}
+		queues = append(queues, appQueue)
+	}
+
+	for _, appQueue := range queues {
+		if err := appQueue.Flush(); err != nil {
+			return nil, status.Errorf(codes.Internal, "Unable to flush %s: %s", appQueue.Control().MetaData.Name, err.Error())
+		}
+	}
+
+	logging.FromContext(ctx).Info("Flushed queues", "caller", caller(ctx), "queues", len(queues))
+
+	return &adminpb.FlushResult{Queues: uint32(len(queues))}, nil
+}
+
+func (EzqueueAdminServer) CollectSegments(ctx context.Context, in *adminpb.QueueRef) (*adminpb.CollectResult, error) {
+
+	appQueue, err := adminQueue(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := appQueue.CollectSegments()
+
+	result := &adminpb.CollectResult{}
+	for _, s := range removed {
+		result.Removed = append(result.Removed, toSegment(s))
+		result.BytesFreed += s.Size
+	}
+
+	if err != nil {
+		return result, status.Errorf(codes.Internal, "Unable to remove a wal file: %s", err.Error())
+	}
+
+	return result, nil
+}
+
+func (EzqueueAdminServer) PauseQueue(ctx context.Context, in *adminpb.QueueRef) (*adminpb.ControlState, error) {
+	return setPaused(ctx, in, true)
+}
+
+func (EzqueueAdminServer) ResumeQueue(ctx context.Context, in *adminpb.QueueRef) (*adminpb.ControlState, error) {
+	return setPaused(ctx, in, false)
+}
+
+func setPaused(ctx context.Context, in *adminpb.QueueRef, paused bool) (*adminpb.ControlState, error) {
+
+	appQueue, err := adminQueue(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := appQueue.SetPaused(paused); err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to save the control file: %s", err.Error())
+	}
+
+	logging.FromContext(ctx).Info("Changed queue state", "caller", caller(ctx), "app", in.AppName, "queue", in.QueueName, "paused", paused)
+
+	return controlState(appQueue), nil
+}
+
+func (EzqueueAdminServer) GetRecoveryStats(ctx context.Context, in *adminpb.RecoveryStatsParams) (*adminpb.RecoveryStats, error) {
+
+	lastRecovery.mutex.Lock()
+	defer lastRecovery.mutex.Unlock()
+
+	stats := &adminpb.RecoveryStats{
+		StartedAtUnixMillis: lastRecovery.startedAt.UnixNano() / int64(time.Millisecond),
+		DurationMillis:      lastRecovery.duration.Milliseconds(),
+		Queues:              uint32(len(lastRecovery.queues)),
+	}
+
+	for _, r := range lastRecovery.queues {
+		stats.Messages += r.Messages
+		stats.Records += r.Records
+		stats.BytesRead += r.BytesRead
+
+		stats.QueueStats = append(stats.QueueStats, &adminpb.QueueRecovery{
+			AppName:   r.AppName,
+			QueueName: r.QueueName,
+			Messages:  r.Messages,
+			Records:   r.Records,
+			BytesRead: r.BytesRead,
+			Error:     r.Error,
+		})
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/adminpb"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+func isQueueEmpty(err error) bool {
+
+	qerr, ok := err.(*e.Error)
+	return ok && qerr.ErrorCode == e.QUEUE_EMPTY
+}
+
+func TestAdminPauseAndBrowse(t *testing.T) {
+
+	defer removeQueue("admintest", "queue-1")
+
+	if err := Create("admintest", "queue-1", 0, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	admin := EzqueueAdminServer{}
+	ref := &adminpb.QueueRef{AppName: "admintest", QueueName: "queue-1"}
+
+	for _, body := range []string{"first", "second", "third"} {
+		if _, err := EnQueue("admintest", "queue-1", body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//first is deleted, second is in flight and third is visible
+	if _, err := DeQueue("admintest", "queue-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Receive("admintest", "queue-1", 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := admin.BrowseMessages(ctx, &adminpb.BrowseParams{AppName: "admintest", QueueName: "queue-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var enqueued []*adminpb.WalRecord
+	for _, r := range list.Records {
+		if r.Type == "ENQUEUE" {
+			enqueued = append(enqueued, r)
+		}
+	}
+	want := []struct{ body, state string }{{"first", wal.StateRemoved}, {"second", wal.StateInFlight}, {"third", wal.StateVisible}}
+	if len(enqueued) != len(want) {
+		t.Fatalf("Browse: want %d enqueue records, got %d", len(want), len(enqueued))
+	}
+	for i, w := range want {
+		if string(enqueued[i].Body) != w.body || enqueued[i].State != w.state {
+			t.Errorf("Browse %d: want %s %s, got %s %s", i, w.body, w.state, enqueued[i].Body, enqueued[i].State)
+		}
+	}
+
+	//Browsing does not take anything from the queue
+	state, err := admin.GetControl(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Visible != 1 || state.InFlight != 1 {
+		t.Errorf("GetControl: want 1 visible and 1 in flight, got %d and %d", state.Visible, state.InFlight)
+	}
+
+	//A limit of one pages through the records
+	page, err := admin.BrowseMessages(ctx, &adminpb.BrowseParams{AppName: "admintest", QueueName: "queue-1", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 1 || page.NextFileNum == 0 {
+		t.Errorf("Browse with limit 1: want 1 record and a next position, got %d records at %d,%d", len(page.Records), page.NextFileNum, page.NextLsn)
+	}
+
+	if _, err := admin.BrowseMessages(ctx, &adminpb.BrowseParams{AppName: "admintest", QueueName: "queue-1", Limit: maxBrowseLimit + 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Browse over the limit: want InvalidArgument, got %v", err)
+	}
+
+	//A paused queue takes messages but hands none out
+	if state, err = admin.PauseQueue(ctx, ref); err != nil || !state.Paused {
+		t.Fatalf("PauseQueue: want paused, got %v %v", state, err)
+	}
+	if _, err := EnQueue("admintest", "queue-1", "fourth"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeQueue("admintest", "queue-1"); !isQueueEmpty(err) {
+		t.Errorf("DeQueue while paused: want %s, got %v", e.ErrorQueueEmpty, err)
+	}
+
+	if state, err = admin.ResumeQueue(ctx, ref); err != nil || state.Paused {
+		t.Fatalf("ResumeQueue: want resumed, got %v %v", state, err)
+	}
+	if value, err := DeQueue("admintest", "queue-1"); err != nil || value != "third" {
+		t.Errorf("DeQueue after resume: want third, got %q %v", value, err)
+	}
+
+	if _, err := admin.GetControl(ctx, &adminpb.QueueRef{AppName: "admintest", QueueName: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetControl of a missing queue: want NotFound, got %v", err)
+	}
+}
+
+func TestAdminSegments(t *testing.T) {
+
+	defer removeQueue("admintest", "queue-2")
+
+	if err := Create("admintest", "queue-2", 0, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	admin := EzqueueAdminServer{}
+	ref := &adminpb.QueueRef{AppName: "admintest", QueueName: "queue-2"}
+
+	EnQueue("admintest", "queue-2", "message")
+
+	if _, err := admin.Flush(ctx, &adminpb.FlushParams{AppName: "admintest", QueueName: "queue-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := admin.ListSegments(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Segments) == 0 {
+		t.Fatal("ListSegments: want the tail file, got none")
+	}
+	tail := list.Segments[len(list.Segments)-1]
+	if !tail.Live || tail.Missing || tail.SizeBytes == 0 {
+		t.Errorf("ListSegments: want a live tail file with data, got %+v", tail)
+	}
+
+	//The live files are kept
+	result, err := admin.CollectSegments(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range result.Removed {
+		if s.Live {
+			t.Errorf("CollectSegments removed the live file %s", s.Name)
+		}
+	}
+}
+
+func TestAdminRecoveryStats(t *testing.T) {
+
+	setRecoveryStats(time.Now().Add(-time.Second), []QueueRecovery{
+		{AppName: "a", QueueName: "q1", Messages: 2, Records: 3, BytesRead: 100},
+		{AppName: "a", QueueName: "q2", Messages: 1, Records: 1, BytesRead: 50},
+	})
+
+	stats, err := EzqueueAdminServer{}.GetRecoveryStats(context.Background(), &adminpb.RecoveryStatsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Queues != 2 || stats.Messages != 3 || stats.Records != 4 || stats.BytesRead != 150 {
+		t.Errorf("GetRecoveryStats: want 2 queues, 3 messages, 4 records and 150 bytes, got %+v", stats)
+	}
+	if stats.DurationMillis < 1000 {
+		t.Errorf("GetRecoveryStats: want at least 1000ms, got %d", stats.DurationMillis)
+	}
+}
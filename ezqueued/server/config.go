@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+const configPath = "/etc/ezqueue/ezqueue.config"
+
+//ServiceConfig holds the daemon level settings from the config file.
+//The wal package reads its own settings from the same file
+type ServiceConfig struct {
+	LogLevel       string `json:"loglevel"`       //debug, info, warn or error. Defaults to info
+	LogFormat      string `json:"logformat"`      //logfmt or json. Defaults to logfmt
+	RedactPayloads bool   `json:"redactpayloads"` //log the size of message bodies instead of their content
+
+	KeysFile string `json:"keysfile"` //api keys file. Authentication is disabled when empty
+	HttpPort string `json:"httpport"` //address of the REST api, Ex: ":8990". The REST api is disabled when empty
+
+	SqsPort    string `json:"sqsport"`    //address of the SQS compatible endpoint, Ex: ":9324". Disabled when empty
+	SqsAppName string `json:"sqsappname"` //app that queues created through the SQS endpoint belong to
+
+	MetricsPort string `json:"metricsport"` //address of the Prometheus /metrics endpoint, Ex: ":9100". Disabled when empty
+	HealthPort  string `json:"healthport"`  //address of the /healthz and /readyz container probes, Ex: ":8086". Disabled when empty
+
+	RespPort string `json:"respport"` //address of the Redis protocol listener, Ex: ":6379". Disabled when empty
+
+	StompPort   string `json:"stompport"`   //address of the STOMP listener, Ex: ":61613". Disabled when empty
+	StompWsPort string `json:"stompwsport"` //address of the STOMP over WebSocket listener, Ex: ":15674". Disabled when empty
+
+	//longest lease in seconds a queue, a receive or a visibility change can ask for, at most 65535. Defaults to 12 hours
+	MaxVisibilityTimeout int `json:"maxvisibilitytimeout"`
+
+	Tracing TracingConfig `json:"tracing"`
+}
+
+//TracingConfig chooses where spans are exported. Tracing is off when no exporter is set
+type TracingConfig struct {
+	Exporter    string `json:"exporter"`    //otlp or file
+	Endpoint    string `json:"endpoint"`    //OTLP/HTTP collector for the otlp exporter, Ex: "http://localhost:4318"
+	File        string `json:"file"`        //file the file exporter appends to
+	ServiceName string `json:"servicename"` //service.name of the spans. Defaults to ezqueued
+}
+
+var serviceConfig = ServiceConfig{SqsAppName: "sqs"}
+
+//configureLogging applies the logging settings to the default logger
+func configureLogging() error {
+
+	options := logging.Options{Level: logging.LevelInfo, Format: serviceConfig.LogFormat, RedactPayloads: serviceConfig.RedactPayloads}
+
+	if len(serviceConfig.LogLevel) != 0 {
+		level, err := logging.ParseLevel(serviceConfig.LogLevel)
+		if err != nil {
+			return err
+		}
+		options.Level = level
+	}
+
+	if len(serviceConfig.LogFormat) != 0 && serviceConfig.LogFormat != logging.FormatLogfmt && serviceConfig.LogFormat != logging.FormatJSON {
+		return &ConfigError{"logformat must be " + logging.FormatLogfmt + " or " + logging.FormatJSON}
+	}
+
+	logging.Configure(options)
+
+	return nil
+}
+
+//configureVisibility checks the maximum visibility timeout, queues keep their visibility timeout in 16 bits
+func configureVisibility() error {
+
+	if serviceConfig.MaxVisibilityTimeout < 0 || serviceConfig.MaxVisibilityTimeout > math.MaxUint16 {
+		return &ConfigError{"maxvisibilitytimeout must be between 0 and " + strconv.Itoa(math.MaxUint16) + " seconds, 0 for the default of " + strconv.Itoa(q.MaxVisibilityTimeout)}
+	}
+
+	return nil
+}
+
+//maxVisibilityTimeout returns the longest visibility timeout in seconds
+func maxVisibilityTimeout() int {
+
+	if serviceConfig.MaxVisibilityTimeout == 0 {
+		return q.MaxVisibilityTimeout
+	}
+
+	return serviceConfig.MaxVisibilityTimeout
+}
+
+type ConfigError struct {
+	Message string
+}
+
+func (c *ConfigError) Error() string {
+	return c.Message
+}
+
+func loadServiceConfig(filePath string) error {
+
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, &serviceConfig)
+}
@@ -0,0 +1,481 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//The crash test runs a workload against the wal through a file system that records every change it makes to the
+//logs directory. The directory is then rebuilt as it would be after a crash at each change, recovered, and the
+//recovered queue is checked against the calls that had returned before the crash.
+//
+//A crash is one of
+//	kill: the process dies, every write that returned is in the page cache and survives
+//	killTorn: the process dies in the middle of a write, half of it is in the file
+//	powerLoss: the machine loses power, files keep what was synced. Creates, renames and removes survive in order.
+//	A rename only changes the directory, a file renamed over another keeps what was synced of it and nothing more
+//	powerLossTorn: powerLoss where half of what was written after the last sync of each file reached the disk
+//	controlTorn: powerLoss where the control file also lost half of what was synced, as a damaged disk can leave it.
+//	Recovery must refuse the queue instead of restoring it from a partial control file
+
+type crashMode int
+
+const (
+	kill crashMode = iota
+	killTorn
+	powerLoss
+	powerLossTorn
+	controlTorn
+)
+
+var crashModes = map[crashMode]string{kill: "kill", killTorn: "killTorn", powerLoss: "powerLoss", powerLossTorn: "powerLossTorn", controlTorn: "controlTorn"}
+
+//fsOp is a change to the logs directory, or a call of the workload that returned
+type fsOp struct {
+	kind    string //open, write, sync, rename, remove, truncate, syncdir, or enqueued, removed and flushed for the calls
+	name    string
+	newName string
+	handle  int
+	flag    int
+	data    []byte
+	size    int64
+}
+
+//recordingFS makes the changes in dir and records them
+type recordingFS struct {
+	mutex   sync.Mutex
+	ops     []fsOp
+	handles int
+}
+
+func (r *recordingFS) record(op fsOp) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ops = append(r.ops, op)
+}
+
+func (r *recordingFS) OpenFile(name string, flag int, perm os.FileMode) (wal.File, error) {
+
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	r.handles++
+	handle := r.handles
+	r.ops = append(r.ops, fsOp{kind: "open", name: filepath.Base(name), handle: handle, flag: flag})
+	r.mutex.Unlock()
+
+	return &recordingFile{File: f, fs: r, handle: handle}, nil
+}
+
+func (r *recordingFS) Rename(oldPath, newPath string) error {
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	r.record(fsOp{kind: "rename", name: filepath.Base(oldPath), newName: filepath.Base(newPath)})
+
+	return nil
+}
+
+func (r *recordingFS) Remove(name string) error {
+
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	r.record(fsOp{kind: "remove", name: filepath.Base(name)})
+
+	return nil
+}
+
+func (r *recordingFS) Truncate(name string, size int64) error {
+
+	if err := os.Truncate(name, size); err != nil {
+		return err
+	}
+	r.record(fsOp{kind: "truncate", name: filepath.Base(name), size: size})
+
+	return nil
+}
+
+func (r *recordingFS) SyncDir(name string) error {
+
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return err
+	}
+	r.record(fsOp{kind: "syncdir", name: filepath.Base(name)})
+
+	return nil
+}
+
+type recordingFile struct {
+	*os.File
+	fs     *recordingFS
+	handle int
+}
+
+func (f *recordingFile) Write(b []byte) (int, error) {
+
+	n, err := f.File.Write(b)
+	f.fs.record(fsOp{kind: "write", handle: f.handle, data: append([]byte(nil), b[:n]...)})
+
+	return n, err
+}
+
+func (f *recordingFile) Sync() error {
+
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	f.fs.record(fsOp{kind: "sync", handle: f.handle})
+
+	return nil
+}
+
+//inode is a file of the rebuilt directory
+type inode struct {
+	data   []byte //what the process wrote
+	synced []byte //what is on the disk
+}
+
+//crashImage writes the logs directory to dir as it is after a crash at ops[crashAt]
+func crashImage(dir string, ops []fsOp, crashAt int, mode crashMode) error {
+
+	names := make(map[string]*inode)
+	handles := make(map[int]*inode)
+
+	write := func(n *inode, data []byte) {
+		n.data = append(n.data, data...)
+	}
+
+	for i, op := range ops[:crashAt] {
+		switch op.kind {
+		case "open":
+			n, ok := names[op.name]
+			if !ok {
+				if op.flag&os.O_CREATE == 0 {
+					return fmt.Errorf("op %d opens %s that does not exist", i, op.name)
+				}
+				n = &inode{}
+				names[op.name] = n
+			}
+			if op.flag&os.O_TRUNC != 0 {
+				n.data, n.synced = nil, nil
+			}
+			handles[op.handle] = n
+		case "write":
+			write(handles[op.handle], op.data)
+		case "sync":
+			n := handles[op.handle]
+			n.synced = append([]byte(nil), n.data...)
+		case "rename":
+			names[op.newName] = names[op.name]
+			delete(names, op.name)
+		case "remove":
+			delete(names, op.name)
+		case "truncate":
+			n := names[op.name]
+			if int64(len(n.data)) > op.size {
+				n.data = n.data[:op.size]
+			}
+			if int64(len(n.synced)) > op.size {
+				n.synced = n.synced[:op.size]
+			}
+		}
+	}
+
+	if mode == killTorn && crashAt < len(ops) && ops[crashAt].kind == "write" {
+		op := ops[crashAt]
+		write(handles[op.handle], op.data[:len(op.data)/2])
+	}
+
+	for name, n := range names {
+		content := n.data
+		switch mode {
+		case powerLoss:
+			content = n.synced
+		case powerLossTorn:
+			content = n.data[:len(n.synced)+(len(n.data)-len(n.synced))/2]
+		case controlTorn:
+			content = n.synced
+			if strings.HasSuffix(name, wal.ControlFileExtn) {
+				content = content[:len(content)/2]
+			}
+		}
+
+		if err := os.WriteFile(path.Join(dir, name), content, 0664); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//crashWorkload enqueues enough messages to fill several wal files, removing some of them with DeQueue and with
+//leases deleted out of order. The calls that returned are recorded with the file changes
+func crashWorkload(t *testing.T, r *recordingFS) []string {
+
+	const appName, queueName = "crash", "queue"
+
+	if err := Create(appName, queueName, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var bodies []string
+	padding := strings.Repeat("x", 900)
+
+	for i := 0; i < 60; i++ {
+
+		body := fmt.Sprintf("m%03d %s", i, padding)
+		bodies = append(bodies, body)
+		if _, err := EnQueue(appName, queueName, body); err != nil {
+			t.Fatal(err)
+		}
+		r.record(fsOp{kind: "enqueued", name: body})
+
+		switch {
+		case i%7 == 3:
+			value, err := DeQueue(appName, queueName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.record(fsOp{kind: "removed", name: value})
+
+		case i%11 == 5:
+			//Deleting the second lease first writes a delete item, the first one then moves the head
+			first, err := Receive(appName, queueName, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := Receive(appName, queueName, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range []wal.ReceivedMessage{second, first} {
+				if err := DeleteMessage(appName, queueName, m.Receipt); err != nil {
+					t.Fatal(err)
+				}
+				r.record(fsOp{kind: "removed", name: m.Body})
+			}
+
+		case i == 40:
+			//A message in flight at the crash comes back
+			if _, err := Receive(appName, queueName, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if i%20 == 19 {
+			flushQueues()
+			r.record(fsOp{kind: "flushed"})
+		}
+	}
+
+	return bodies
+}
+
+//crashExpectations returns the messages that must be recovered after a crash at ops[crashAt] and the ones that must not
+func crashExpectations(ops []fsOp, crashAt int, mode crashMode) (present, absent map[string]bool) {
+
+	//After a power loss only the calls that returned before the last flush are durable
+	durable := crashAt
+	if mode != kill && mode != killTorn {
+		durable = 0
+		for i, op := range ops[:crashAt] {
+			if op.kind == "flushed" {
+				durable = i
+			}
+		}
+	}
+
+	present, absent = make(map[string]bool), make(map[string]bool)
+	removed := make(map[string]bool)
+	for i, op := range ops[:crashAt] {
+		switch op.kind {
+		case "enqueued":
+			if i < durable {
+				present[op.name] = true
+			}
+		case "removed":
+			removed[op.name] = true
+			if i < durable {
+				absent[op.name] = true
+			}
+		}
+	}
+
+	//The call in progress at the crash may or may not have removed its message
+	for _, op := range ops[crashAt:] {
+		if op.kind == "removed" {
+			removed[op.name] = true
+		}
+		if op.kind == "enqueued" || op.kind == "removed" || op.kind == "flushed" {
+			break
+		}
+	}
+
+	for body := range removed {
+		delete(present, body)
+	}
+
+	return present, absent
+}
+
+//recoverCrashImage recovers the queues in dir and returns the messages of the crash queue
+func recoverCrashImage(dir string) ([]string, error) {
+
+	closeQueues()
+	wal.Config.Logspath, queueInfo = dir, NewQueueWalInfo()
+
+	if err := RecoverQueues(); err != nil {
+		return nil, err
+	}
+
+	walInfo, ok := queueInfo.Get("crashqueue")
+	if !ok {
+		return nil, nil
+	}
+
+	return walInfo.Messages(), nil
+}
+
+func closeQueues() {
+
+	for _, walInfo := range queueInfo.Iter() {
+		walInfo.Close()
+	}
+}
+
+func TestCrashRecovery(t *testing.T) {
+
+	fs, logsPath, queues := wal.FS, wal.Config.Logspath, queueInfo
+	defer func() {
+		closeQueues()
+		wal.FS, wal.Config.Logspath, queueInfo = fs, logsPath, queues
+	}()
+
+	r := &recordingFS{}
+	wal.FS, wal.Config.Logspath, queueInfo = r, t.TempDir(), NewQueueWalInfo()
+
+	bodies := crashWorkload(t, r)
+	wal.FS = fs
+
+	order := make(map[string]int)
+	for i, body := range bodies {
+		order[body] = i
+	}
+
+	ops := r.ops
+	base := t.TempDir()
+
+	for mode := kill; mode <= controlTorn; mode++ {
+		for crashAt := 0; crashAt <= len(ops); crashAt++ {
+
+			dir := path.Join(base, fmt.Sprintf("%s-%d", crashModes[mode], crashAt))
+			if err := os.Mkdir(dir, 0775); err != nil {
+				t.Fatal(err)
+			}
+
+			fail := func(format string, args ...interface{}) {
+				t.Fatalf("%s crash before op %d of %d: %s", crashModes[mode], crashAt, len(ops), fmt.Sprintf(format, args...))
+			}
+
+			if err := crashImage(dir, ops, crashAt, mode); err != nil {
+				fail("%v", err)
+			}
+
+			recovered, err := recoverCrashImage(dir)
+			if mode == controlTorn && !crashedBeforeCreate(ops, crashAt) {
+				if _, ok := err.(*RecoveryError); !ok {
+					fail("recovered a torn control file: %v", err)
+				}
+				closeQueues()
+				os.RemoveAll(dir)
+				continue
+			}
+			if err != nil {
+				fail("recovery failed: %v", err)
+			}
+			if _, ok := queueInfo.Get("crashqueue"); !ok {
+				if crashedBeforeCreate(ops, crashAt) {
+					os.RemoveAll(dir)
+					continue
+				}
+				fail("the queue was not recovered")
+			}
+
+			//Every message once, in the order it was enqueued
+			seen := make(map[string]bool)
+			last := -1
+			for _, body := range recovered {
+				i, ok := order[body]
+				switch {
+				case !ok:
+					fail("recovered a message that was not enqueued: %.20q", body)
+				case seen[body]:
+					fail("recovered %.4s twice", body)
+				case i < last:
+					fail("recovered %.4s after a later message", body)
+				}
+				seen[body], last = true, i
+			}
+
+			present, absent := crashExpectations(ops, crashAt, mode)
+			for body := range present {
+				if !seen[body] {
+					fail("acknowledged message %.4s was lost", body)
+				}
+			}
+			for body := range absent {
+				if seen[body] {
+					fail("acknowledged removal of %.4s was undone", body)
+				}
+			}
+
+			//The wal goes on where recovery left it, and a second recovery finds the same messages
+			if _, err := EnQueue("crash", "queue", "after"); err != nil {
+				fail("enqueue after recovery: %v", err)
+			}
+			again, err := recoverCrashImage(dir)
+			if err != nil {
+				fail("second recovery failed: %v", err)
+			}
+			if want := append(recovered, "after"); strings.Join(again, ",") != strings.Join(want, ",") {
+				fail("second recovery: want %d messages ending with after, got %d", len(want), len(again))
+			}
+
+			closeQueues()
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+//crashedBeforeCreate reports if the crash came before the control file of the queue was in place
+func crashedBeforeCreate(ops []fsOp, crashAt int) bool {
+
+	for _, op := range ops[:crashAt] {
+		if op.kind == "rename" && strings.HasSuffix(op.newName, wal.ControlFileExtn) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+	"github.com/coderagr/ezqueue-service/ezqueued/tracing"
+)
+
+//RequestIdHeader is the metadata key that carries the correlation id of a call.
+//A new id is made for calls that do not send one, and it is returned in the response header
+const RequestIdHeader = "x-request-id"
+
+//DeduplicationIdHeader is the metadata key of the deduplication id of an Enqueue call.
+//EnqueueParams has no field for it, so it is sent next to the call like the request id
+const DeduplicationIdHeader = "x-deduplication-id"
+
+//deduplicationId returns the deduplication id sent by the client, empty if there is none
+func deduplicationId(ctx context.Context) string {
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(DeduplicationIdHeader); len(ids) != 0 {
+			return ids[0]
+		}
+	}
+
+	return ""
+}
+
+//requestId returns the correlation id sent by the client, or a new one
+func requestId(ctx context.Context) string {
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIdHeader); len(ids) != 0 && len(ids[0]) != 0 {
+			return ids[0]
+		}
+	}
+
+	return uuid.NewString()
+}
+
+//loggingUnaryInterceptor puts a logger with the request id in the context of every call
+func loggingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	id := requestId(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIdHeader, id))
+
+	l := logger.With("request_id", id, "method", info.FullMethod)
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		l = l.With("trace_id", sc.TraceID.String())
+	}
+
+	start := time.Now()
+	resp, err := handler(logging.NewContext(ctx, l), req)
+
+	l.Debug("Finished call", "code", status.Code(err).String(), "duration", time.Since(start))
+
+	return resp, err
+}
+
+//caller returns the authenticated client id for logging and auditing
+func caller(ctx context.Context) string {
+
+	if id, ok := auth.FromContext(ctx); ok {
+		return id.String()
+	}
+
+	return "anonymous"
+}
+
+type EzqueuedServer struct {
+	ezgrpc.UnimplementedEzqueuedServer
+}
+
+func (EzqueuedServer) Create(ctx context.Context, r *ezgrpc.CreateParams) (*ezgrpc.ReturnStatus, error) {
+
+	returnStatus := ezgrpc.ReturnStatus{Success: 0}
+
+	delaySeconds, visibilityTimeout, err := queueTimeouts(r.AppName, r.QueueName, r.DelaySeconds, r.VisibilityTimeout)
+	if err == nil {
+		err = Create(r.AppName, r.QueueName, delaySeconds, visibilityTimeout)
+	}
+
+	if err != nil {
+
+		qErr, ok := err.(*e.Error)
+		if !ok {
+			return &returnStatus, status.Error(codes.Internal, err.Error())
+		}
+
+		if qErr.ErrorCode == e.ALREADY_EXISTS {
+			grpcErr := status.Errorf(codes.AlreadyExists, qErr.ErrorMessage)
+			return &returnStatus, grpcErr
+		} else if qErr.ErrorCode == e.INVALID_INPUT {
+			grpcErr := status.Errorf(codes.InvalidArgument, qErr.ErrorMessage)
+			return &returnStatus, grpcErr
+		}
+
+		return &returnStatus, status.Error(codes.Internal, qErr.ErrorMessage)
+	}
+
+	logging.FromContext(ctx).Info("Created queue", "caller", caller(ctx), "app", r.AppName, "queue", r.QueueName)
+
+	returnStatus.Success = 1
+	return &returnStatus, nil
+}
+
+func (EzqueuedServer) Enqueue(ctx context.Context, in *ezgrpc.EnqueueParams) (*ezgrpc.ReturnStatus, error) {
+	returnStatus := ezgrpc.ReturnStatus{Success: 0}
+
+	id, err := EnQueueWithOptions(ctx, in.AppName, in.QueueName, in.Message, EnqueueOptions{DeduplicationId: deduplicationId(ctx)})
+	if err != nil {
+		qErr, ok := err.(*e.Error)
+		if !ok {
+			return &returnStatus, status.Error(codes.Internal, err.Error())
+		}
+
+		if qErr.ErrorCode == e.QUEUE_DOES_NOT_EXIST {
+			grpcErr := status.Errorf(codes.NotFound, qErr.ErrorMessage)
+			return &returnStatus, grpcErr
+		} else if qErr.ErrorCode == e.WAL_FILE_APPEND_FAILED {
+			logging.FromContext(ctx).Error("Unable to append the message", "app", in.AppName, "queue", in.QueueName, "error", err)
+			grpcErr := status.Errorf(codes.Internal, qErr.ErrorMessage)
+			return &returnStatus, grpcErr
+		}
+
+		return &returnStatus, status.Error(codes.Internal, qErr.ErrorMessage)
+	}
+
+	logging.FromContext(ctx).Debug("Enqueued message", "app", in.AppName, "queue", in.QueueName, "message_id", id)
+
+	returnStatus.Success = 1
+	return &returnStatus, nil
+}
+
+func (EzqueuedServer) Dequeue(ctx context.Context, in *ezgrpc.DequeueParams) (*ezgrpc.QueueItem, error) {
+
+	message := ezgrpc.QueueItem{Message: ""}
+
+	m, err := DeQueueContext(ctx, in.AppName, in.QueueName)
+
+	if err != nil {
+		qErr, ok := err.(*e.Error)
+		if !ok {
+			return &message, status.Error(codes.Internal, err.Error())
+		}
+
+		if qErr.ErrorCode == e.QUEUE_DOES_NOT_EXIST || qErr.ErrorCode == e.QUEUE_EMPTY {
+			grpcErr := status.Errorf(codes.NotFound, qErr.ErrorMessage)
+			return &message, grpcErr
+		}
+
+		return &message, status.Error(codes.Internal, qErr.ErrorMessage)
+	}
+
+	//QueueItem has no field for it, so the trace context of the producer is returned in the response header
+	if traceParent, ok := m.Attributes[tracing.TraceParentKey]; ok {
+		md := metadata.Pairs(tracing.TraceParentKey, traceParent)
+		if traceState, ok := m.Attributes[tracing.TraceStateKey]; ok {
+			md.Set(tracing.TraceStateKey, traceState)
+		}
+		grpc.SetHeader(ctx, md)
+	}
+
+	message.Message = m.Value
+
+	return &message, nil
+
+}
+
+func (EzqueuedServer) Peek(ctx context.Context, in *ezgrpc.PeekParams) (*ezgrpc.QueueItem, error) {
+
+	message := ezgrpc.QueueItem{Message: ""}
+
+	m, err := Peek(in.AppName, in.QueueName)
+
+	if err != nil {
+		qErr, ok := err.(*e.Error)
+		if !ok {
+			return &message, status.Error(codes.Internal, err.Error())
+		}
+
+		if qErr.ErrorCode == e.QUEUE_DOES_NOT_EXIST || qErr.ErrorCode == e.QUEUE_EMPTY {
+			grpcErr := status.Errorf(codes.NotFound, qErr.ErrorMessage)
+			return &message, grpcErr
+		}
+
+		return &message, status.Error(codes.Internal, qErr.ErrorMessage)
+	}
+
+	message.Message = m
+
+	return &message, nil
+}
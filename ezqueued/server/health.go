@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//Health of the daemon for orchestrators, served by the grpc.health.v1 Health service and on /healthz and /readyz.
+//The daemon is live unless recovery failed or the logs directory cannot be written.
+//It is ready once it is live, the queues are recovered and it is not shutting down
+
+const storageCheckInterval = 10 * time.Second
+
+type healthState struct {
+	mutex        sync.Mutex
+	recovering   bool
+	shuttingDown bool
+	recoveryErr  error //recovery failed, the daemon stays up so probes can report it
+	storageErr   error //the last check of the logs directory failed
+
+	grpcHealth *health.Server
+}
+
+var serviceHealth = newHealthState()
+
+func newHealthState() *healthState {
+
+	h := &healthState{recovering: true, grpcHealth: health.NewServer()}
+	h.update()
+
+	return h
+}
+
+//live returns why the daemon is not live, nil if it is
+func (h *healthState) live() error {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.liveLocked()
+}
+
+func (h *healthState) liveLocked() error {
+
+	if h.recoveryErr != nil {
+		return &HealthError{"recovery failed: " + h.recoveryErr.Error()}
+	}
+	if h.storageErr != nil {
+		return &HealthError{"the logs directory is not writable: " + h.storageErr.Error()}
+	}
+
+	return nil
+}
+
+//ready returns why the daemon is not ready to take calls, nil if it is
+func (h *healthState) ready() error {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.readyLocked()
+}
+
+func (h *healthState) readyLocked() error {
+
+	if err := h.liveLocked(); err != nil {
+		return err
+	}
+	if h.recovering {
+		return &HealthError{"recovering queues"}
+	}
+	if h.shuttingDown {
+		return &HealthError{"shutting down"}
+	}
+
+	return nil
+}
+
+//update sets the status of the Health service from the state. The caller must not hold the lock
+func (h *healthState) update() {
+
+	h.mutex.Lock()
+	serving := healthpb.HealthCheckResponse_SERVING
+	if h.readyLocked() != nil {
+		serving = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	h.mutex.Unlock()
+
+	//The empty name is the status of the whole server
+	h.grpcHealth.SetServingStatus("", serving)
+	h.grpcHealth.SetServingStatus(ezgrpc.Ezqueued_ServiceDesc.ServiceName, serving)
+}
+
+func (h *healthState) set(change func()) {
+
+	h.mutex.Lock()
+	change()
+	h.mutex.Unlock()
+
+	h.update()
+}
+
+func (h *healthState) recovered(err error) {
+	h.set(func() { h.recovering, h.recoveryErr = false, err })
+}
+
+func (h *healthState) shutdown() {
+
+	h.set(func() { h.shuttingDown = true })
+
+	//Watchers are told the server is going away so they stop sending calls
+	h.grpcHealth.Shutdown()
+}
+
+//checkStorage writes and removes a file in the logs directory and records the result
+func (h *healthState) checkStorage() {
+
+	err := probeLogsDirectory()
+
+	h.mutex.Lock()
+	changed := (err == nil) != (h.storageErr == nil)
+	h.mutex.Unlock()
+
+	if changed {
+		if err != nil {
+			logger.Error("The logs directory is not writable", "path", wal.Config.Logspath, "error", err)
+		} else {
+			logger.Info("The logs directory is writable again", "path", wal.Config.Logspath)
+		}
+	}
+
+	h.set(func() { h.storageErr = err })
+}
+
+func probeLogsDirectory() error {
+
+	f, err := os.CreateTemp(wal.Config.Logspath, ".healthcheck-")
+	if err != nil {
+		return err
+	}
+
+	_, werr := f.Write([]byte("ok"))
+	cerr := f.Close()
+	rerr := os.Remove(f.Name())
+
+	for _, err := range []error{werr, cerr, rerr} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//watchStorage checks the logs directory until ctx is done
+func (h *healthState) watchStorage(ctx context.Context) {
+
+	ticker := time.NewTicker(storageCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		h.checkStorage()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type HealthError struct {
+	Message string
+}
+
+func (h *HealthError) Error() string {
+	return h.Message
+}
+
+//HealthResponse is the body of /healthz and /readyz
+type HealthResponse struct {
+	Status string `json:"status"`           //ok or unavailable
+	Reason string `json:"reason,omitempty"` //why the daemon is unavailable
+}
+
+//NewHealthHandler returns the handler for the container probes. /healthz is the liveness probe and /readyz the readiness probe
+func NewHealthHandler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) {
+		writeHealth(rw, serviceHealth.live())
+	})
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, r *http.Request) {
+		writeHealth(rw, serviceHealth.ready())
+	})
+
+	return mux
+}
+
+func writeHealth(rw http.ResponseWriter, err error) {
+
+	if err != nil {
+		writeJson(rw, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Reason: err.Error()})
+		return
+	}
+
+	writeJson(rw, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+//readinessUnaryInterceptor turns calls away while the daemon is not ready. Health checks always go through
+func readinessUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	if !strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		if err := serviceHealth.ready(); err != nil {
+			return nil, status.Errorf(codes.Unavailable, "ezqueued is not ready: %s", err.Error())
+		}
+	}
+
+	return handler(ctx, req)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+func servingStatus(t *testing.T, h *healthState, service string) healthpb.HealthCheckResponse_ServingStatus {
+
+	resp, err := h.grpcHealth.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.Status
+}
+
+func probe(path string) int {
+
+	rw := httptest.NewRecorder()
+	NewHealthHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return rw.Code
+}
+
+func TestHealth(t *testing.T) {
+
+	saved := serviceHealth
+	defer func() { serviceHealth = saved }()
+
+	serviceHealth = newHealthState()
+	h := serviceHealth
+
+	//Recovering: live but not ready
+	if s := servingStatus(t, h, ""); s != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Recovering: want NOT_SERVING, got %s", s)
+	}
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("Recovering /healthz: want %d, got %d", http.StatusOK, code)
+	}
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Recovering /readyz: want %d, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	h.recovered(nil)
+	for _, service := range []string{"", "Ezqueued"} {
+		if s := servingStatus(t, h, service); s != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Recovered %q: want SERVING, got %s", service, s)
+		}
+	}
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("Recovered /readyz: want %d, got %d", http.StatusOK, code)
+	}
+
+	//A logs directory that cannot be written fails both probes until it comes back
+	logsPath := wal.Config.Logspath
+	wal.Config.Logspath = "/nonexistent/ezqueue"
+	h.checkStorage()
+	wal.Config.Logspath = logsPath
+
+	if s := servingStatus(t, h, ""); s != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Unwritable: want NOT_SERVING, got %s", s)
+	}
+	if code := probe("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Unwritable /healthz: want %d, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	h.checkStorage()
+	if s := servingStatus(t, h, ""); s != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Writable again: want SERVING, got %s", s)
+	}
+
+	h.shutdown()
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Shutting down /readyz: want %d, got %d", http.StatusServiceUnavailable, code)
+	}
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("Shutting down /healthz: want %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestReadinessInterceptor(t *testing.T) {
+
+	saved := serviceHealth
+	defer func() { serviceHealth = saved }()
+
+	serviceHealth = newHealthState()
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "called", nil }
+
+	_, err := readinessUnaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/Ezqueued/Enqueue"}, handler)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Enqueue while recovering: want %s, got %v", codes.Unavailable, err)
+	}
+
+	if resp, err := readinessUnaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler); resp != "called" {
+		t.Errorf("Health check while recovering: want the call to go through, got %v", err)
+	}
+
+	serviceHealth.recovered(nil)
+	if resp, err := readinessUnaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/Ezqueued/Enqueue"}, handler); resp != "called" {
+		t.Errorf("Enqueue once recovered: want the call to go through, got %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+//REST api served alongside gRPC. Every route maps onto the same Create, EnQueue, DeQueue and Peek functions
+//
+//	PUT    /v1/apps/{app}/queues/{queue}                 create a queue
+//	POST   /v1/apps/{app}/queues/{queue}/messages        enqueue a message
+//	GET    /v1/apps/{app}/queues/{queue}/messages?wait=  dequeue a message, waiting up to wait seconds.
+//	                                                     With visibility= the message is leased instead of removed
+//	GET    /v1/apps/{app}/queues/{queue}/messages/head   peek at the next message
+//	DELETE /v1/apps/{app}/queues/{queue}/messages/{receipt}  delete a leased message
+
+const (
+	apiPrefix      = "/v1/apps/"
+	maxWaitSeconds = 20
+)
+
+type CreateRequest struct {
+	DelaySeconds      uint16 `json:"delaySeconds"`
+	VisibilityTimeout uint16 `json:"visibilityTimeout"`
+	Priority          bool   `json:"priority"` //create a priority queue
+
+	RetentionSeconds uint32 `json:"retentionSeconds"` //messages expire this long after they were sent, 0 to keep them
+	DeadLetterQueue  string `json:"deadLetterQueue"`  //queue of the same app expired messages are moved to
+}
+
+type EnqueueRequest struct {
+	Message  string `json:"message"`
+	Priority uint8  `json:"priority"` //0 to 9 in a priority queue
+	GroupId  string `json:"groupId"`  //messages of a group are received one at a time in order
+
+	DeduplicationId string    `json:"deduplicationId"` //a message with an id sent within the dedup window is not added again
+	TtlSeconds      uint32    `json:"ttlSeconds"`      //the message expires this long after it was sent
+	DeliverAt       time.Time `json:"deliverAt"`       //RFC 3339 time the message becomes visible at
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+	Id      string `json:"id,omitempty"`
+	Receipt string `json:"receipt,omitempty"`
+	GroupId string `json:"groupId,omitempty"`
+}
+
+type EnqueueResponse struct {
+	Success bool   `json:"success"`
+	Id      string `json:"id"`
+}
+
+type StatusResponse struct {
+	Success bool `json:"success"`
+}
+
+type ErrorBody struct {
+	Code     int    `json:"code"`     //one of the errors package codes, -1 if the error did not come from a queue
+	CodeName string `json:"codeName"` //name of the code, Ex: QUEUE_DOES_NOT_EXIST
+	Message  string `json:"message"`
+}
+
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type httpHandler struct{}
+
+//NewHttpHandler returns the handler for the REST api
+func NewHttpHandler() http.Handler {
+	return httpHandler{}
+}
+
+func (h httpHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	//Split /v1/apps/{app}/queues/{queue}[/messages[/{id}]]
+	if !strings.HasPrefix(r.URL.Path, apiPrefix) {
+		writeError(rw, http.StatusNotFound, -1, "Unknown path "+r.URL.Path)
+		return
+	}
+
+	parts := strings.Split(strings.TrimSuffix(r.URL.Path[len(apiPrefix):], "/"), "/")
+	if len(parts) < 3 || parts[1] != "queues" || len(parts[0]) == 0 || len(parts[2]) == 0 {
+		writeError(rw, http.StatusNotFound, -1, "Unknown path "+r.URL.Path)
+		return
+	}
+
+	appName, queueName := parts[0], parts[2]
+
+	//Clients can pass a correlation id, it is returned in the response either way
+	id := r.Header.Get(RequestIdHeader)
+	if len(id) == 0 {
+		id = uuid.NewString()
+	}
+	rw.Header().Set(RequestIdHeader, id)
+	r = r.WithContext(logging.NewContext(r.Context(), logger.With("request_id", id)))
+
+	var perm, route string
+	var handle func(http.ResponseWriter, *http.Request, string, string)
+
+	switch {
+	case len(parts) == 3 && r.Method == http.MethodPut:
+		perm, route, handle = auth.PermCreate, "/queues/{queue}", h.create
+
+	case len(parts) == 4 && parts[3] == "messages" && r.Method == http.MethodPost:
+		perm, route, handle = auth.PermEnqueue, "/queues/{queue}/messages", h.enqueue
+
+	case len(parts) == 4 && parts[3] == "messages" && r.Method == http.MethodGet:
+		perm, route, handle = auth.PermDequeue, "/queues/{queue}/messages", h.dequeue
+
+	case len(parts) == 5 && parts[3] == "messages" && parts[4] == "head" && r.Method == http.MethodGet:
+		perm, route, handle = auth.PermDequeue, "/queues/{queue}/messages/head", h.peek
+
+	case len(parts) == 5 && parts[3] == "messages" && r.Method == http.MethodDelete:
+		perm, route, handle = auth.PermDequeue, "/queues/{queue}/messages/{receipt}", h.deleteMessage
+
+	default:
+		writeError(rw, http.StatusMethodNotAllowed, -1, r.Method+" is not supported on "+r.URL.Path)
+		return
+	}
+
+	//The span is a child of the traceparent header, if the client sent one
+	r, span := startHttpSpan(r, r.Method+" "+apiPrefix+"{app}"+route)
+	sw := &statusWriter{rw, http.StatusOK}
+	defer finishHttpSpan(span, sw)
+
+	r, ok := h.authorize(sw, r, appName, perm)
+	if !ok {
+		return
+	}
+
+	handle(sw, r, appName, queueName)
+}
+
+//authorize checks the api key when authentication is turned on and writes the error response if it fails
+func (h httpHandler) authorize(rw http.ResponseWriter, r *http.Request, appName, perm string) (*http.Request, bool) {
+
+	if keyStore == nil {
+		return r, true
+	}
+
+	id, err := keyStore.AuthenticateRequest(r)
+	if err == nil {
+		err = id.Authorize(appName, perm)
+	}
+
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Rejected request", "method", r.Method, "path", r.URL.Path, "error", status.Convert(err).Message())
+
+		httpStatus := http.StatusForbidden
+		if status.Code(err) == codes.Unauthenticated {
+			httpStatus = http.StatusUnauthorized
+		}
+
+		writeError(rw, httpStatus, -1, status.Convert(err).Message())
+		return r, false
+	}
+
+	return r.WithContext(auth.NewContext(r.Context(), id)), true
+}
+
+func (h httpHandler) create(rw http.ResponseWriter, r *http.Request, appName, queueName string) {
+
+	req := CreateRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(rw, http.StatusBadRequest, e.INVALID_INPUT, err.Error())
+			return
+		}
+	}
+
+	if err := CreateQueue(appName, queueName, QueueOptions{DelaySeconds: req.DelaySeconds, VisibilityTimeout: req.VisibilityTimeout, Priority: req.Priority,
+		RetentionSeconds: req.RetentionSeconds, DeadLetterQueue: req.DeadLetterQueue}); err != nil {
+		writeQueueError(rw, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Created queue", "caller", caller(r.Context()), "app", appName, "queue", queueName)
+
+	writeJson(rw, http.StatusCreated, StatusResponse{Success: true})
+}
+
+func (h httpHandler) enqueue(rw http.ResponseWriter, r *http.Request, appName, queueName string) {
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, q.MaxMessageSize*1024+1))
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, e.INVALID_INPUT, err.Error())
+		return
+	}
+
+	if len(body) > q.MaxMessageSize*1024 {
+		writeError(rw, http.StatusRequestEntityTooLarge, e.INVALID_INPUT, e.ErrorExceedsMaxQueueSize)
+		return
+	}
+
+	//JSON bodies carry the message in a field, anything else is taken as the message itself
+	//Bodies that are not JSON can send the deduplication id in a header
+	msg, opts := string(body), EnqueueOptions{DeduplicationId: r.Header.Get("X-Deduplication-Id")}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		req := EnqueueRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(rw, http.StatusBadRequest, e.INVALID_INPUT, err.Error())
+			return
+		}
+		msg, opts.Priority, opts.GroupId, opts.TtlSeconds, opts.DeliverAt = req.Message, req.Priority, req.GroupId, req.TtlSeconds, req.DeliverAt
+		if len(req.DeduplicationId) != 0 {
+			opts.DeduplicationId = req.DeduplicationId
+		}
+	}
+
+	id, err := EnQueueWithOptions(r.Context(), appName, queueName, msg, opts)
+	if err != nil {
+		writeQueueError(rw, err)
+		return
+	}
+
+	writeJson(rw, http.StatusCreated, EnqueueResponse{Success: true, Id: id})
+}
+
+func (h httpHandler) dequeue(rw http.ResponseWriter, r *http.Request, appName, queueName string) {
+
+	wait := 0
+	if w := r.URL.Query().Get("wait"); len(w) != 0 {
+		var err error
+		if wait, err = strconv.Atoi(w); err != nil || wait < 0 || wait > maxWaitSeconds {
+			writeError(rw, http.StatusBadRequest, e.INVALID_INPUT, "wait must be between 0 and "+strconv.Itoa(maxWaitSeconds))
+			return
+		}
+	}
+
+	//Without a visibility timeout the message is removed as it is read
+	v := r.URL.Query().Get("visibility")
+	if len(v) == 0 {
+		m, err := DeQueueWait(r.Context(), appName, queueName, time.Duration(wait)*time.Second)
+		if err != nil {
+			writeQueueError(rw, err)
+			return
+		}
+
+		setTraceHeaders(rw.Header(), m.Attributes)
+		writeJson(rw, http.StatusOK, MessageResponse{Message: m.Value, GroupId: m.GroupId})
+		return
+	}
+
+	visibility, err := strconv.Atoi(v)
+	if err != nil || visibility < 0 || visibility > maxVisibilityTimeout() {
+		writeError(rw, http.StatusBadRequest, e.INVALID_INPUT, "visibility must be between 0 and "+strconv.Itoa(maxVisibilityTimeout()))
+		return
+	}
+
+	msg, err := ReceiveWait(r.Context(), appName, queueName, time.Duration(visibility)*time.Second, time.Duration(wait)*time.Second)
+	if err != nil {
+		writeQueueError(rw, err)
+		return
+	}
+
+	setTraceHeaders(rw.Header(), msg.Attributes)
+	writeJson(rw, http.StatusOK, MessageResponse{Message: msg.Body, Id: msg.Id, Receipt: msg.Receipt, GroupId: msg.GroupId})
+}
+
+func (h httpHandler) peek(rw http.ResponseWriter, r *http.Request, appName, queueName string) {
+
+	msg, err := Peek(appName, queueName)
+	if err != nil {
+		writeQueueError(rw, err)
+		return
+	}
+
+	writeJson(rw, http.StatusOK, MessageResponse{Message: msg})
+}
+
+func (h httpHandler) deleteMessage(rw http.ResponseWriter, r *http.Request, appName, queueName string) {
+
+	receipt := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	if err := DeleteMessageContext(r.Context(), appName, queueName, receipt); err != nil {
+		writeQueueError(rw, err)
+		return
+	}
+
+	writeJson(rw, http.StatusOK, StatusResponse{Success: true})
+}
+
+//writeQueueError maps a queue error onto the http status that matches its gRPC code
+func writeQueueError(rw http.ResponseWriter, err error) {
+
+	qErr, ok := err.(*e.Error)
+	if !ok {
+		writeError(rw, http.StatusInternalServerError, -1, err.Error())
+		return
+	}
+
+	httpStatus := http.StatusInternalServerError
+	switch qErr.ErrorCode {
+	case e.ALREADY_EXISTS:
+		httpStatus = http.StatusConflict
+	case e.QUEUE_DOES_NOT_EXIST, e.QUEUE_EMPTY:
+		httpStatus = http.StatusNotFound
+	case e.INVALID_INPUT, e.RECEIPT_INVALID, e.RECEIPT_STALE:
+		httpStatus = http.StatusBadRequest
+	}
+
+	writeError(rw, httpStatus, qErr.ErrorCode, qErr.ErrorMessage)
+}
+
+func writeError(rw http.ResponseWriter, httpStatus, code int, message string) {
+
+	writeJson(rw, httpStatus, ErrorResponse{ErrorBody{Code: code, CodeName: e.CodeNames[code], Message: message}})
+}
+
+func writeJson(rw http.ResponseWriter, httpStatus int, body interface{}) {
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(httpStatus)
+
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logger.Warn("Unable to write the response", "error", err)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+)
+
+//removeQueue drops a queue created by a test so other tests see the queues they expect
+func removeQueue(appName, name string) {
+	DeleteQueue(appName, name)
+}
+
+func doRequest(t *testing.T, method, url, contentType, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	if len(contentType) != 0 {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	rw := httptest.NewRecorder()
+	NewHttpHandler().ServeHTTP(rw, r)
+
+	resp := map[string]interface{}{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Want a JSON body for %s %s, got %q", method, url, rw.Body.String())
+	}
+
+	return rw, resp
+}
+
+func TestHttpApi(t *testing.T) {
+
+	defer removeQueue("resttest", "queue-1")
+
+	base := "/v1/apps/resttest/queues/queue-1"
+
+	if rw, _ := doRequest(t, http.MethodPut, base, "", ""); rw.Code != http.StatusCreated {
+		t.Fatalf("Create: want %d, got %d", http.StatusCreated, rw.Code)
+	}
+
+	rw, resp := doRequest(t, http.MethodPut, base, "", "")
+	if rw.Code != http.StatusConflict {
+		t.Errorf("Create again: want %d, got %d", http.StatusConflict, rw.Code)
+	}
+	if code := resp["error"].(map[string]interface{})["codeName"]; code != e.CodeNames[e.ALREADY_EXISTS] {
+		t.Errorf("Create again: want %s, got %v", e.CodeNames[e.ALREADY_EXISTS], code)
+	}
+
+	if rw, _ := doRequest(t, http.MethodPost, base+"/messages", "text/plain", "first"); rw.Code != http.StatusCreated {
+		t.Errorf("Enqueue text: want %d, got %d", http.StatusCreated, rw.Code)
+	}
+
+	if rw, _ := doRequest(t, http.MethodPost, base+"/messages", "application/json", `{"message":"second"}`); rw.Code != http.StatusCreated {
+		t.Errorf("Enqueue json: want %d, got %d", http.StatusCreated, rw.Code)
+	}
+
+	if _, resp := doRequest(t, http.MethodGet, base+"/messages/head", "", ""); resp["message"] != "first" {
+		t.Errorf("Peek: want first, got %v", resp["message"])
+	}
+
+	for _, want := range []string{"first", "second"} {
+		if _, resp := doRequest(t, http.MethodGet, base+"/messages", "", ""); resp["message"] != want {
+			t.Errorf("Dequeue: want %s, got %v", want, resp["message"])
+		}
+	}
+
+	if rw, _ := doRequest(t, http.MethodGet, base+"/messages", "", ""); rw.Code != http.StatusNotFound {
+		t.Errorf("Dequeue empty: want %d, got %d", http.StatusNotFound, rw.Code)
+	}
+
+	//Leased messages are deleted with their receipt
+	doRequest(t, http.MethodPost, base+"/messages", "text/plain", "leased")
+
+	_, resp = doRequest(t, http.MethodGet, base+"/messages?visibility=30", "", "")
+	receipt, _ := resp["receipt"].(string)
+	if resp["message"] != "leased" || len(receipt) == 0 {
+		t.Fatalf("Receive: want leased with a receipt, got %v", resp)
+	}
+
+	if rw, _ := doRequest(t, http.MethodGet, base+"/messages", "", ""); rw.Code != http.StatusNotFound {
+		t.Errorf("Dequeue while leased: want %d, got %d", http.StatusNotFound, rw.Code)
+	}
+
+	if rw, _ := doRequest(t, http.MethodDelete, base+"/messages/"+receipt, "", ""); rw.Code != http.StatusOK {
+		t.Errorf("Delete: want %d, got %d", http.StatusOK, rw.Code)
+	}
+
+	if rw, _ := doRequest(t, http.MethodDelete, base+"/messages/"+receipt, "", ""); rw.Code != http.StatusBadRequest {
+		t.Errorf("Delete twice: want %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+
+	if rw, _ := doRequest(t, http.MethodPost, "/v1/apps/resttest/queues/missing/messages", "text/plain", "x"); rw.Code != http.StatusNotFound {
+		t.Errorf("Enqueue missing queue: want %d, got %d", http.StatusNotFound, rw.Code)
+	}
+}
+
+func TestHttpDequeueWait(t *testing.T) {
+
+	defer removeQueue("resttest", "queue-wait")
+
+	base := "/v1/apps/resttest/queues/queue-wait"
+	doRequest(t, http.MethodPut, base, "", "")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		EnQueue("resttest", "queue-wait", "late")
+	}()
+
+	start := time.Now()
+	if _, resp := doRequest(t, http.MethodGet, base+"/messages?wait=5", "", ""); resp["message"] != "late" {
+		t.Errorf("Dequeue wait: want late, got %v", resp["message"])
+	}
+
+	if time.Since(start) > 4*time.Second {
+		t.Errorf("Dequeue wait: want to return when the message arrives, waited %v", time.Since(start))
+	}
+}
@@ -0,0 +1,589 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+	w "github.com/coderagr/ezqueue-service/ezqueued/wal"
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	//Open the control file
+	filepath := "/etc/ezqueue/ezqueue.config"
+	wb, ferr := os.ReadFile(filepath)
+	if ferr != nil {
+		log.Panicf("Unable to read the config file %s", filepath)
+		return
+	}
+
+	if ferr = json.Unmarshal(wb, &w.Config); ferr != nil {
+		log.Panicf("Unable to read the config file %s", filepath)
+		return
+	}
+
+}
+
+func fileSetup(t *testing.T) (*w.QueueInfo, error) {
+	//BEGIN: Setup the unit test situation
+	fullQueueName := "testproducerqueue-1000"
+	walInfo := new(w.QueueInfo)
+	walControl := new(w.WalControl)
+	walInfo.WalControlInfo = walControl
+
+	walControlFile := fullQueueName + w.ControlFileExtn
+	filePath := path.Join(w.Config.Logspath, walControlFile)
+
+	//Open the control file
+	wb, ferr := os.ReadFile(filePath)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	//Read the contents of the control file into the structure
+	//The control file has the latest info just before the app was terminated
+	if err := json.Unmarshal(wb, walControl); err != nil {
+		return nil, err
+	}
+
+	//Open the files with file pointers
+	walCtrlFilePtr, cerr := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0664)
+	if cerr != nil {
+		t.Errorf("Unable to open file %s", filePath)
+		return nil, cerr
+	}
+
+	walInfo.Queue = q.NewQueue(walControl.MetaData.AppName, walControl.MetaData.Name, "",
+		walControl.MetaData.DelaySeconds, walControl.MetaData.VisibilityTimeout)
+
+	//Open the wal log file
+	filePath = path.Join(w.Config.Logspath, walInfo.LogFileName(walControl.TailLsnFileNum))
+	walFile, werr := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0664)
+	if werr != nil {
+		t.Errorf("Unable to open file %s", filePath)
+		return nil, werr
+	}
+
+	walInfo.WalFile = walFile
+	walInfo.WalControlFile = walCtrlFilePtr
+
+	return walInfo, nil
+}
+
+func TestRecoverQueues(t *testing.T) {
+
+	RecoverQueues()
+
+	queueCount := queueInfo.Len()
+
+	if queueCount != 1 {
+		t.Errorf("Queues: Want %d, got %d\n", 1, queueCount)
+	}
+}
+
+func TestAppend(t *testing.T) {
+
+	walInfo, werr := fileSetup(t)
+	if werr != nil {
+		t.Errorf(werr.Error())
+		return
+	}
+
+	defer walInfo.WalControlFile.Close()
+	defer walInfo.WalFile.Close()
+
+	msg := time.Now().String()
+
+	walInfo.Append(msg)
+
+}
+
+func TestRecoverDeletedMessages(t *testing.T) {
+
+	defer removeQueue("recovertest", "queue-1")
+
+	if err := Create("recovertest", "queue-1", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{"one", "two", "three"} {
+		EnQueue("recovertest", "queue-1", msg)
+	}
+
+	//"one" is in flight when the daemon stops, "two" was deleted behind it
+	Receive("recovertest", "queue-1", time.Minute)
+	second, _ := Receive("recovertest", "queue-1", time.Minute)
+	if err := DeleteMessage("recovertest", "queue-1", second.Receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	//Simulate a restart
+	walInfo, _ := queueInfo.Delete("recovertestqueue-1")
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+
+	if err := RecoverQueues(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"one", "three"} {
+		if msg, err := DeQueue("recovertest", "queue-1"); msg != want {
+			t.Errorf("DeQueue after recovery: want %s, got %s %v", want, msg, err)
+		}
+	}
+
+	if _, err := DeQueue("recovertest", "queue-1"); err == nil {
+		t.Errorf("DeQueue after recovery: want an empty queue, got a message")
+	}
+}
+
+func TestRecoverQueuesFailure(t *testing.T) {
+
+	controlPath := path.Join(w.Config.Logspath, "recoverfailqueue-1"+w.ControlFileExtn)
+	walPath := path.Join(w.Config.Logspath, w.SegmentName("recoverfail", "queue-1", 1))
+	defer os.Remove(controlPath)
+	defer os.Remove(walPath)
+	defer queueInfo.Release("recoverfailqueue-1")
+
+	if err := Create("recoverfail", "queue-1", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnQueue("recoverfail", "queue-1", "kept"); err != nil {
+		t.Fatal(err)
+	}
+
+	//Restart with a control file that cannot be read
+	walInfo, _ := queueInfo.Delete("recoverfailqueue-1")
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+	if err := os.WriteFile(controlPath, []byte("{"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	walBefore, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := serviceHealth
+	defer func() { serviceHealth = saved }()
+	serviceHealth = newHealthState()
+
+	err = recoverService()
+	if rErr, ok := err.(*RecoveryError); !ok || len(rErr.Failed) != 1 {
+		t.Fatalf("recoverService with a bad control file: want a RecoveryError for one queue, got %v", err)
+	}
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz after a failed recovery: want %d, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	//The name stays taken and the files of the queue are left as they are
+	if err := Create("recoverfail", "queue-1", 0, 0); !isQueueError(err, e.ALREADY_EXISTS) {
+		t.Errorf("Create of a queue that was not recovered: want ALREADY_EXISTS, got %v", err)
+	}
+	queueInfo.Release("recoverfailqueue-1")
+	if err := Create("recoverfail", "queue-1", 0, 0); !isQueueError(err, e.WAL_FILE_FAILED_TO_CREATE) {
+		t.Errorf("Create over the files of a queue that was not recovered: want WAL_FILE_FAILED_TO_CREATE, got %v", err)
+	}
+	params := &ezgrpc.CreateParams{AppName: "recoverfail", QueueName: "queue-1"}
+	if _, err := (EzqueuedServer{}).Create(context.Background(), params); status.Code(err) != codes.Internal {
+		t.Errorf("grpc Create over the files of a queue that was not recovered: want %v, got %v", codes.Internal, err)
+	}
+	if walAfter, _ := os.ReadFile(walPath); string(walAfter) != string(walBefore) {
+		t.Errorf("Create over the files of a queue that was not recovered: want the wal file unchanged")
+	}
+}
+
+func TestMessageGroups(t *testing.T) {
+
+	defer removeQueue("grouptest", "queue-1")
+
+	if err := Create("grouptest", "queue-1", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, m := range []struct{ body, group string }{{"a1", "a"}, {"a2", "a"}, {"b1", "b"}, {"none", ""}, {"a3", "a"}, {"b2", "b"}} {
+		if _, err := EnQueueWithOptions(ctx, "grouptest", "queue-1", m.body, EnqueueOptions{GroupId: m.group}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receive := func(want string) w.ReceivedMessage {
+		t.Helper()
+		m, err := Receive("grouptest", "queue-1", time.Minute)
+		if want == "" {
+			if !isQueueError(err, e.QUEUE_EMPTY) {
+				t.Fatalf("Receive: want QUEUE_EMPTY, got %q %v", m.Body, err)
+			}
+		} else if err != nil || m.Body != want {
+			t.Fatalf("Receive: want %s, got %q %v", want, m.Body, err)
+		}
+		return m
+	}
+
+	//One message of each group is in flight, the messages behind them wait
+	a1 := receive("a1")
+	b1 := receive("b1")
+	if a1.GroupId != "a" || b1.GroupId != "b" {
+		t.Errorf("Receive: want the group ids back, got %q and %q", a1.GroupId, b1.GroupId)
+	}
+	if value, err := Peek("grouptest", "queue-1"); value != "none" {
+		t.Errorf("Peek: want none, got %q %v", value, err)
+	}
+	receive("none")
+	receive("")
+	if _, err := DeQueue("grouptest", "queue-1"); !isQueueError(err, e.QUEUE_EMPTY) {
+		t.Errorf("DeQueue while every group is in flight: want QUEUE_EMPTY, got %v", err)
+	}
+
+	//Deleting a1 frees group a, b1 comes back ahead of b2 when its lease is given up
+	if err := DeleteMessage("grouptest", "queue-1", a1.Receipt); err != nil {
+		t.Fatal(err)
+	}
+	a2 := receive("a2")
+	if err := ChangeVisibility("grouptest", "queue-1", b1.Receipt, 0); err != nil {
+		t.Fatal(err)
+	}
+	receive("b1")
+	receive("")
+
+	//After a restart nothing is in flight and the groups are read back from the wal
+	walInfo, _ := queueInfo.Delete("grouptestqueue-1")
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+	if err := RecoverQueues(); err != nil {
+		t.Fatal(err)
+	}
+
+	a2 = receive("a2")
+	receive("b1")
+	receive("none")
+	receive("")
+	if err := DeleteMessage("grouptest", "queue-1", a2.Receipt); err != nil {
+		t.Fatalf("DeleteMessage after recovery: %v", err)
+	}
+	if m := receive("a3"); m.GroupId != "a" {
+		t.Errorf("Receive after recovery: want group a, got %q", m.GroupId)
+	}
+
+	if _, err := EnQueueWithOptions(ctx, "grouptest", "queue-1", "long", EnqueueOptions{GroupId: strings.Repeat("g", q.MaxGroupIdLength+1)}); !isQueueError(err, e.INVALID_INPUT) {
+		t.Errorf("EnQueueWithOptions with a long group id: want INVALID_INPUT, got %v", err)
+	}
+}
+
+func TestRecoverPriorityQueue(t *testing.T) {
+
+	defer removeQueue("recovertest", "queue-2")
+	defer removeQueue("recovertest", "queue-3")
+
+	if err := CreateQueue("recovertest", "queue-2", QueueOptions{Priority: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []struct {
+		body     string
+		priority uint8
+	}{{"batch-1", 0}, {"rebuild-1", 9}, {"normal-1", 5}, {"batch-2", 0}, {"rebuild-2", 9}, {"normal-2", 5}} {
+		if _, err := EnQueueWithOptions(context.Background(), "recovertest", "queue-2", m.body, EnqueueOptions{Priority: m.priority}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//"rebuild-1" is taken while the older "batch-1" stays at the head of the wal, "rebuild-2" is in flight at the restart
+	if msg, err := DeQueue("recovertest", "queue-2"); msg != "rebuild-1" {
+		t.Fatalf("DeQueue: want rebuild-1, got %s %v", msg, err)
+	}
+	if m, err := Receive("recovertest", "queue-2", time.Minute); err != nil || m.Body != "rebuild-2" {
+		t.Fatalf("Receive: want rebuild-2, got %+v %v", m, err)
+	}
+
+	//Simulate a restart
+	walInfo, _ := queueInfo.Delete("recovertestqueue-2")
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+
+	if err := RecoverQueues(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats, err := GetQueueStats("recovertest", "queue-2"); err != nil || !stats.MetaData.Priority {
+		t.Fatalf("GetQueueStats after recovery: want a priority queue, got %+v %v", stats, err)
+	}
+
+	for _, want := range []string{"rebuild-2", "normal-1", "normal-2", "batch-1", "batch-2"} {
+		if msg, err := DeQueue("recovertest", "queue-2"); msg != want {
+			t.Errorf("DeQueue after recovery: want %s, got %s %v", want, msg, err)
+		}
+	}
+
+	//Priorities are checked against the queue type
+	if _, err := EnQueueWithOptions(context.Background(), "recovertest", "queue-2", "too high", EnqueueOptions{Priority: q.MaxPriority + 1}); !isQueueError(err, e.INVALID_INPUT) {
+		t.Errorf("EnQueueWithOptions above MaxPriority: want INVALID_INPUT, got %v", err)
+	}
+	if err := Create("recovertest", "queue-3", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnQueueWithOptions(context.Background(), "recovertest", "queue-3", "fifo", EnqueueOptions{Priority: 1}); !isQueueError(err, e.INVALID_INPUT) {
+		t.Errorf("EnQueueWithOptions with a priority on a fifo queue: want INVALID_INPUT, got %v", err)
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+
+	defer removeQueue("deduptest", "queue-1")
+
+	if err := Create("deduptest", "queue-1", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	send := func(body, dedupId string) string {
+		t.Helper()
+		id, err := EnQueueWithOptions(ctx, "deduptest", "queue-1", body, EnqueueOptions{DeduplicationId: dedupId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	first := send("order-1", "order-1")
+	if retry := send("order-1 retried", "order-1"); retry != first {
+		t.Errorf("EnQueueWithOptions with a sent deduplication id: want id %s, got %s", first, retry)
+	}
+	send("order-2", "order-2")
+
+	//A consumed message still holds its id until the window ends
+	if msg, err := DeQueue("deduptest", "queue-1"); msg != "order-1" {
+		t.Fatalf("DeQueue: want order-1, got %s %v", msg, err)
+	}
+	if retry := send("order-1 again", "order-1"); retry != first {
+		t.Errorf("EnQueueWithOptions after the message was consumed: want id %s, got %s", first, retry)
+	}
+
+	//The ids are read back from the wal after a restart, including ones before the head
+	walInfo, _ := queueInfo.Delete("deduptestqueue-1")
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+	if err := RecoverQueues(); err != nil {
+		t.Fatal(err)
+	}
+
+	if retry := send("order-1 after restart", "order-1"); retry != first {
+		t.Errorf("EnQueueWithOptions after recovery: want id %s, got %s", first, retry)
+	}
+	send("order-2 after restart", "order-2")
+	send("order-3", "order-3")
+
+	for _, want := range []string{"order-2", "order-3"} {
+		if msg, err := DeQueue("deduptest", "queue-1"); msg != want {
+			t.Errorf("DeQueue after recovery: want %s, got %s %v", want, msg, err)
+		}
+	}
+	if _, err := DeQueue("deduptest", "queue-1"); !isQueueError(err, e.QUEUE_EMPTY) {
+		t.Errorf("DeQueue: want QUEUE_EMPTY, got %v", err)
+	}
+
+	//Enqueue takes the id from the request metadata, a retry succeeds without adding the message again
+	md := metadata.NewIncomingContext(ctx, metadata.Pairs(DeduplicationIdHeader, "order-4"))
+	for i := 0; i < 2; i++ {
+		if _, err := (EzqueuedServer{}).Enqueue(md, &ezgrpc.EnqueueParams{AppName: "deduptest", QueueName: "queue-1", Message: "order-4"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msg, err := DeQueue("deduptest", "queue-1"); msg != "order-4" {
+		t.Errorf("DeQueue: want order-4, got %s %v", msg, err)
+	}
+	if _, err := DeQueue("deduptest", "queue-1"); !isQueueError(err, e.QUEUE_EMPTY) {
+		t.Errorf("DeQueue after a retried Enqueue: want QUEUE_EMPTY, got %v", err)
+	}
+
+	//Messages without an id are never deduplicated
+	if send("plain", "") == send("plain", "") {
+		t.Errorf("EnQueueWithOptions without a deduplication id: want two messages")
+	}
+	if _, err := EnQueueWithOptions(ctx, "deduptest", "queue-1", "long", EnqueueOptions{DeduplicationId: strings.Repeat("d", q.MaxGroupIdLength+1)}); !isQueueError(err, e.INVALID_INPUT) {
+		t.Errorf("EnQueueWithOptions with a long deduplication id: want INVALID_INPUT, got %v", err)
+	}
+}
+
+func TestMessageExpiry(t *testing.T) {
+
+	defer removeQueue("expirytest", "dead")
+	defer removeQueue("expirytest", "queue-1")
+	defer removeQueue("expirytest", "queue-2")
+
+	for _, opts := range []QueueOptions{{DeadLetterQueue: "dead"}, {DeadLetterQueue: "queue-1"}, {RetentionSeconds: q.MaxRetentionSeconds + 1}} {
+		if err := CreateQueue("expirytest", "queue-1", opts); !isQueueError(err, e.INVALID_INPUT) {
+			t.Errorf("CreateQueue with %+v: want INVALID_INPUT, got %v", opts, err)
+		}
+	}
+
+	if err := Create("expirytest", "dead", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateQueue("expirytest", "queue-1", QueueOptions{RetentionSeconds: 3600, DeadLetterQueue: "dead"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, m := range []struct {
+		body  string
+		ttl   uint32
+		group string
+	}{{"kept", 0, ""}, {"short-1", 1, ""}, {"leased", 1, ""}, {"short-2", 1, "g"}} {
+		if _, err := EnQueueWithOptions(ctx, "expirytest", "queue-1", m.body, EnqueueOptions{TtlSeconds: m.ttl, GroupId: m.group}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := EnQueueWithOptions(ctx, "expirytest", "queue-1", "forever", EnqueueOptions{TtlSeconds: q.MaxRetentionSeconds + 1}); !isQueueError(err, e.INVALID_INPUT) {
+		t.Errorf("EnQueueWithOptions with a long ttl: want INVALID_INPUT, got %v", err)
+	}
+
+	//"kept" is held at the head while the messages behind it expire
+	kept, err := Receive("expirytest", "queue-1", time.Minute)
+	if err != nil || kept.Body != "kept" {
+		t.Fatalf("Receive: want kept, got %+v %v", kept, err)
+	}
+	inFlight, err := Receive("expirytest", "queue-1", time.Minute)
+	if err != nil || inFlight.Body != "short-1" {
+		t.Fatalf("Receive: want short-1, got %+v %v", inFlight, err)
+	}
+
+	//Messages in flight expire once they are back in the queue
+	expireQueues(time.Now().Add(2 * time.Second))
+	for _, want := range []string{"leased", "short-2"} {
+		if m, err := DeQueueContext(ctx, "expirytest", "dead"); err != nil || m.Value != want {
+			t.Fatalf("DeQueue from the dead-letter queue: want %s, got %v %v", want, m, err)
+		}
+	}
+	if _, err := DeQueue("expirytest", "dead"); !isQueueError(err, e.QUEUE_EMPTY) {
+		t.Errorf("DeQueue from the dead-letter queue: want QUEUE_EMPTY, got %v", err)
+	}
+	if err := ChangeVisibility("expirytest", "queue-1", inFlight.Receipt, 0); err != nil {
+		t.Fatal(err)
+	}
+	expireQueues(time.Now().Add(2 * time.Second))
+	if msg, err := DeQueue("expirytest", "dead"); msg != "short-1" {
+		t.Errorf("DeQueue from the dead-letter queue: want short-1, got %s %v", msg, err)
+	}
+
+	//The expired messages are not recovered after a restart
+	walInfo, _ := queueInfo.Delete("expirytestqueue-1")
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+	if err := RecoverQueues(); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := DeQueue("expirytest", "queue-1"); msg != "kept" {
+		t.Errorf("DeQueue after recovery: want kept, got %s %v", msg, err)
+	}
+	if _, err := DeQueue("expirytest", "queue-1"); !isQueueError(err, e.QUEUE_EMPTY) {
+		t.Errorf("DeQueue after recovery: want QUEUE_EMPTY, got %v", err)
+	}
+
+	//The retention period applies to messages without a ttl, the head moves past them
+	EnQueue("expirytest", "queue-1", "retained")
+	expireQueues(time.Now().Add(2 * time.Hour))
+	if msg, err := DeQueue("expirytest", "dead"); msg != "retained" {
+		t.Errorf("DeQueue from the dead-letter queue: want retained, got %s %v", msg, err)
+	}
+	walInfo, _ = queueInfo.Get("expirytestqueue-1")
+	if c := walInfo.Control(); c.HeadLsnFileNum != c.TailLsnFileNum || c.HeadLsn != c.NextLsn {
+		t.Errorf("Control after expiry: want the head at the end of the wal, got %+v", c)
+	}
+
+	//Without a dead-letter queue expired messages are dropped
+	if err := Create("expirytest", "queue-2", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	EnQueueWithOptions(ctx, "expirytest", "queue-2", "dropped", EnqueueOptions{TtlSeconds: 1})
+	EnQueue("expirytest", "queue-2", "stays")
+	expireQueues(time.Now().Add(2 * time.Second))
+	if msg, err := DeQueue("expirytest", "queue-2"); msg != "stays" {
+		t.Errorf("DeQueue after expiry: want stays, got %s %v", msg, err)
+	}
+}
+
+func TestScheduledMessages(t *testing.T) {
+
+	defer removeQueue("scheduletest", "queue-1")
+
+	if err := CreateQueue("scheduletest", "queue-1", QueueOptions{RetentionSeconds: 3 * 3600}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, m := range []struct {
+		body  string
+		delay time.Duration
+	}{{"later", time.Hour}, {"now", 0}, {"soon", time.Minute}, {"past", -time.Minute}, {"last", 2 * time.Hour}} {
+		opts := EnqueueOptions{}
+		if m.delay != 0 {
+			opts.DeliverAt = now.Add(m.delay)
+		}
+		if _, err := EnQueueWithOptions(ctx, "scheduletest", "queue-1", m.body, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, opts := range []EnqueueOptions{{DeliverAt: now.Add((q.MaxScheduleSeconds + 60) * time.Second)}, {DeliverAt: now.Add(4 * time.Hour)}, {DeliverAt: now.Add(time.Hour), TtlSeconds: 60}} {
+		if _, err := EnQueueWithOptions(ctx, "scheduletest", "queue-1", "invalid", opts); !isQueueError(err, e.INVALID_INPUT) {
+			t.Errorf("EnQueueWithOptions with %+v: want INVALID_INPUT, got %v", opts, err)
+		}
+	}
+
+	for _, want := range []string{"now", "past"} {
+		if msg, err := DeQueue("scheduletest", "queue-1"); msg != want {
+			t.Errorf("DeQueue: want %s, got %s %v", want, msg, err)
+		}
+	}
+	if _, err := DeQueue("scheduletest", "queue-1"); !isQueueError(err, e.QUEUE_EMPTY) {
+		t.Errorf("DeQueue before the scheduled messages are due: want QUEUE_EMPTY, got %v", err)
+	}
+
+	//The scheduled messages hold the head of the wal and are read back after a restart
+	walInfo, _ := queueInfo.Delete("scheduletestqueue-1")
+	if c := walInfo.Control(); c.HeadLsnFileNum != 1 || c.HeadLsn != 0 {
+		t.Errorf("Control: want the head at the first scheduled message, got %d-%d", c.HeadLsnFileNum, c.HeadLsn)
+	}
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+	if err := RecoverQueues(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats, err := GetQueueStats("scheduletest", "queue-1"); err != nil || stats.Delayed != 3 || stats.Visible != 0 {
+		t.Fatalf("GetQueueStats after recovery: want 3 delayed messages, got %+v %v", stats, err)
+	}
+
+	walInfo, _ = queueInfo.Get("scheduletestqueue-1")
+	if n := walInfo.DeliverScheduled(now.Add(2 * time.Minute)); n != 1 {
+		t.Errorf("DeliverScheduled: want soon delivered, got %d messages", n)
+	}
+	if msg, err := DeQueue("scheduletest", "queue-1"); msg != "soon" {
+		t.Errorf("DeQueue: want soon, got %s %v", msg, err)
+	}
+
+	walInfo.DeliverScheduled(now.Add(3 * time.Hour))
+	for _, want := range []string{"later", "last"} {
+		if msg, err := DeQueue("scheduletest", "queue-1"); msg != want {
+			t.Errorf("DeQueue: want %s, got %s %v", want, msg, err)
+		}
+	}
+	if c := walInfo.Control(); c.HeadLsnFileNum != c.TailLsnFileNum || c.HeadLsn != c.NextLsn {
+		t.Errorf("Control: want the head at the end of the wal once every message was consumed, got %+v", c)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/metrics"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//Metrics served on /metrics. Queue level values are read from the queues when they are scraped
+
+var (
+	messagesEnqueued = metrics.Default.NewCounter("ezqueue_messages_enqueued_total",
+		"Messages added to a queue", "app", "queue")
+
+	messagesDequeued = metrics.Default.NewCounter("ezqueue_messages_dequeued_total",
+		"Messages removed from a queue as they were read", "app", "queue")
+
+	messagesReceived = metrics.Default.NewCounter("ezqueue_messages_received_total",
+		"Messages handed out with a lease", "app", "queue")
+
+	messagesAcked = metrics.Default.NewCounter("ezqueue_messages_acked_total",
+		"Leased messages deleted by a consumer", "app", "queue")
+
+	messagesExpired = metrics.Default.NewCounter("ezqueue_messages_expired_total",
+		"Messages dropped or moved to the dead-letter queue when their retention period or time to live ended", "app", "queue")
+
+	recoveryDuration = metrics.Default.NewGauge("ezqueue_recovery_duration_seconds",
+		"Time taken to recover the queues from the wal at startup")
+
+	rpcDuration = metrics.Default.NewHistogram("ezqueue_grpc_request_duration_seconds",
+		"Latency of gRPC calls", metrics.DefBuckets, "method")
+
+	rpcRequests = metrics.Default.NewCounter("ezqueue_grpc_requests_total",
+		"gRPC calls by method and status code", "method", "code")
+)
+
+var queueLabels = []string{"app", "queue"}
+
+func init() {
+
+	queueGauge("ezqueue_queue_depth", "Messages waiting in a queue", func(s wal.Stats) float64 {
+		return float64(s.Visible)
+	})
+
+	queueGauge("ezqueue_queue_in_flight", "Messages handed out with a lease and not yet deleted", func(s wal.Stats) float64 {
+		return float64(s.InFlight)
+	})
+
+	queueGauge("ezqueue_queue_delayed", "Messages scheduled for a later delivery", func(s wal.Stats) float64 {
+		return float64(s.Delayed)
+	})
+
+	queueGauge("ezqueue_queue_oldest_message_age_seconds", "Age of the oldest message waiting or in flight", func(s wal.Stats) float64 {
+		if s.OldestTime.IsZero() {
+			return 0
+		}
+		return time.Since(s.OldestTime).Seconds()
+	})
+
+	metrics.Default.NewGaugeFunc("ezqueue_wal_segments", "Wal files of a queue", queueLabels,
+		func(set func(float64, ...string)) {
+			for _, walInfo := range queueInfo.Iter() {
+				segments, _ := walInfo.WalSize()
+				set(float64(segments), walInfo.Queue.AppName, walInfo.Queue.Name)
+			}
+		})
+
+	metrics.Default.NewGaugeFunc("ezqueue_wal_bytes", "Size of the wal files of a queue", queueLabels,
+		func(set func(float64, ...string)) {
+			for _, walInfo := range queueInfo.Iter() {
+				_, bytes := walInfo.WalSize()
+				set(float64(bytes), walInfo.Queue.AppName, walInfo.Queue.Name)
+			}
+		})
+}
+
+//queueGauge registers a gauge with one series for every queue
+func queueGauge(name, help string, value func(wal.Stats) float64) {
+
+	metrics.Default.NewGaugeFunc(name, help, queueLabels, func(set func(float64, ...string)) {
+		for _, walInfo := range queueInfo.Iter() {
+			set(value(walInfo.Stats()), walInfo.Queue.AppName, walInfo.Queue.Name)
+		}
+	})
+}
+
+//deleteQueueMetrics drops the counters of a deleted queue so it stops showing up
+func deleteQueueMetrics(appName, name string) {
+
+	messagesEnqueued.Delete(appName, name)
+	messagesDequeued.Delete(appName, name)
+	messagesReceived.Delete(appName, name)
+	messagesAcked.Delete(appName, name)
+	messagesExpired.Delete(appName, name)
+}
+
+//NewMetricsHandler returns the handler that serves /metrics
+func NewMetricsHandler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+
+	return mux
+}
+
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	rpcDuration.Observe(time.Since(start).Seconds(), info.FullMethod)
+	rpcRequests.Inc(info.FullMethod, status.Code(err).String())
+
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	start := time.Now()
+	err := handler(srv, ss)
+
+	rpcDuration.Observe(time.Since(start).Seconds(), info.FullMethod)
+	rpcRequests.Inc(info.FullMethod, status.Code(err).String())
+
+	return err
+}
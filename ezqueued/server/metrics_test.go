@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+
+	Create("metricstest", "queue-1", 0, 0)
+	defer removeQueue("metricstest", "queue-1")
+
+	EnQueue("metricstest", "queue-1", "one")
+	EnQueue("metricstest", "queue-1", "two")
+	DeQueue("metricstest", "queue-1")
+
+	rw := httptest.NewRecorder()
+	NewMetricsHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rw.Body.String()
+	for _, want := range []string{
+		`ezqueue_messages_enqueued_total{app="metricstest",queue="queue-1"} 2`,
+		`ezqueue_messages_dequeued_total{app="metricstest",queue="queue-1"} 1`,
+		`ezqueue_queue_depth{app="metricstest",queue="queue-1"} 1`,
+		`ezqueue_queue_in_flight{app="metricstest",queue="queue-1"} 0`,
+		`ezqueue_wal_segments{app="metricstest",queue="queue-1"} 1`,
+		`# TYPE ezqueue_grpc_request_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want %q in\n%s", want, body)
+		}
+	}
+}
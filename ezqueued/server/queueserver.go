@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+	u "github.com/coderagr/ezqueue-service/ezqueued/utilities"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//EzqueueQueues service. The Ezqueued service only creates queues and removes messages as they are read,
+//this one manages the queues and hands out messages with a lease that is ended with DeleteMessage
+
+const (
+	maxReceiveMessages    = 10
+	maxReceiveWaitSeconds = 20
+	maxSendMessages       = 10
+
+	maxChangeVisibilityEntries = 100
+)
+
+//queueStatus maps a queue error onto a gRPC status
+func queueStatus(err error) error {
+
+	qErr, ok := err.(*e.Error)
+	if !ok {
+		return err
+	}
+
+	code := codes.Internal
+	switch qErr.ErrorCode {
+	case e.ALREADY_EXISTS:
+		code = codes.AlreadyExists
+	case e.QUEUE_DOES_NOT_EXIST, e.QUEUE_EMPTY, e.SCHEDULE_DOES_NOT_EXIST:
+		code = codes.NotFound
+	case e.INVALID_INPUT, e.RECEIPT_INVALID, e.RECEIPT_STALE:
+		code = codes.InvalidArgument
+	}
+
+	return status.Error(code, qErr.ErrorMessage)
+}
+
+type EzqueueQueuesServer struct {
+	queuepb.UnimplementedEzqueueQueuesServer
+}
+
+func queueDetails(stats QueueStats) *queuepb.QueueDetails {
+
+	return &queuepb.QueueDetails{
+		AppName:           stats.MetaData.AppName,
+		QueueName:         stats.MetaData.Name,
+		DelaySeconds:      uint32(stats.MetaData.DelaySeconds),
+		VisibilityTimeout: uint32(stats.MetaData.VisibilityTimeout),
+		Visible:           uint64(stats.Visible),
+		InFlight:          uint64(stats.InFlight),
+		Delayed:           uint64(stats.Delayed),
+		Priority:          stats.MetaData.Priority,
+		RetentionSeconds:  stats.MetaData.RetentionSeconds,
+		DeadLetterQueue:   stats.MetaData.DeadLetterQueue,
+	}
+}
+
+func (EzqueueQueuesServer) CreateQueue(ctx context.Context, in *queuepb.CreateQueueParams) (*queuepb.Result, error) {
+
+	delaySeconds, visibilityTimeout, err := queueTimeouts(in.AppName, in.QueueName, in.DelaySeconds, in.VisibilityTimeout)
+	if err != nil {
+		return nil, queueStatus(err)
+	}
+
+	opts := QueueOptions{DelaySeconds: delaySeconds, VisibilityTimeout: visibilityTimeout, Priority: in.Priority,
+		RetentionSeconds: in.RetentionSeconds, DeadLetterQueue: in.DeadLetterQueue}
+	if err := CreateQueue(in.AppName, in.QueueName, opts); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	logging.FromContext(ctx).Info("Created queue", "caller", caller(ctx), "app", in.AppName, "queue", in.QueueName, "priority", in.Priority)
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) ListQueues(ctx context.Context, in *queuepb.ListQueuesParams) (*queuepb.QueueList, error) {
+
+	id, authenticated := auth.FromContext(ctx)
+
+	list := &queuepb.QueueList{}
+	for _, appQueue := range queueInfo.Iter() {
+		metaData := appQueue.Control().MetaData
+
+		if len(in.AppName) != 0 && metaData.AppName != in.AppName {
+			continue
+		}
+		//Callers only see the apps their key is scoped to
+		if authenticated && !id.CanAccessApp(metaData.AppName) {
+			continue
+		}
+
+		visible, inFlight, delayed := appQueue.Counts()
+		list.Queues = append(list.Queues, queueDetails(QueueStats{metaData, visible, inFlight, delayed}))
+	}
+
+	sort.Slice(list.Queues, func(i, j int) bool {
+		a, b := list.Queues[i], list.Queues[j]
+		if a.AppName != b.AppName {
+			return a.AppName < b.AppName
+		}
+		return a.QueueName < b.QueueName
+	})
+
+	return list, nil
+}
+
+func (EzqueueQueuesServer) GetQueueStats(ctx context.Context, in *queuepb.QueueParams) (*queuepb.QueueDetails, error) {
+
+	stats, err := GetQueueStats(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, queueStatus(err)
+	}
+
+	return queueDetails(stats), nil
+}
+
+func (EzqueueQueuesServer) PurgeQueue(ctx context.Context, in *queuepb.QueueParams) (*queuepb.Result, error) {
+
+	if err := Purge(in.AppName, in.QueueName); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	logging.FromContext(ctx).Info("Purged queue", "caller", caller(ctx), "app", in.AppName, "queue", in.QueueName)
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) DeleteQueue(ctx context.Context, in *queuepb.QueueParams) (*queuepb.Result, error) {
+
+	if err := DeleteQueue(in.AppName, in.QueueName); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	logging.FromContext(ctx).Info("Deleted queue", "caller", caller(ctx), "app", in.AppName, "queue", in.QueueName)
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) Receive(ctx context.Context, in *queuepb.ReceiveParams) (*queuepb.ReceivedMessageList, error) {
+
+	stats, err := GetQueueStats(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, queueStatus(err)
+	}
+
+	maxMessages := int(in.MaxMessages)
+	if maxMessages == 0 {
+		maxMessages = 1
+	}
+	if maxMessages > maxReceiveMessages {
+		return nil, status.Errorf(codes.InvalidArgument, "MaxMessages must be at most %d", maxReceiveMessages)
+	}
+	if in.WaitSeconds > maxReceiveWaitSeconds {
+		return nil, status.Errorf(codes.InvalidArgument, "WaitSeconds must be at most %d", maxReceiveWaitSeconds)
+	}
+
+	visibility := int(in.VisibilityTimeout)
+	if visibility == 0 {
+		visibility = int(stats.MetaData.VisibilityTimeout)
+	}
+	if visibility == 0 {
+		visibility = q.DefaultVisibilityTimeout
+	}
+
+	list := &queuepb.ReceivedMessageList{}
+
+	//Only the first message waits, the rest are taken if they are already there
+	for len(list.Messages) < maxMessages {
+
+		wait := time.Duration(0)
+		if len(list.Messages) == 0 {
+			wait = time.Duration(in.WaitSeconds) * time.Second
+		}
+
+		msg, err := ReceiveWait(ctx, in.AppName, in.QueueName, time.Duration(visibility)*time.Second, wait)
+		if isQueueError(err, e.QUEUE_EMPTY) {
+			break
+		} else if err != nil {
+			return nil, queueStatus(err)
+		}
+
+		list.Messages = append(list.Messages, &queuepb.ReceivedMessage{
+			Id:                 msg.Id,
+			Body:               msg.Body,
+			Receipt:            msg.Receipt,
+			ReceiveCount:       msg.ReceiveCount,
+			DeadlineUnixMillis: msg.Deadline.UnixNano() / int64(time.Millisecond),
+			Attributes:         msg.Attributes,
+			GroupId:            msg.GroupId,
+		})
+	}
+
+	return list, nil
+}
+
+func (EzqueueQueuesServer) DeleteMessage(ctx context.Context, in *queuepb.DeleteMessageParams) (*queuepb.Result, error) {
+
+	if err := DeleteMessageContext(ctx, in.AppName, in.QueueName, in.Receipt); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) SendMessages(ctx context.Context, in *queuepb.SendMessagesParams) (*queuepb.SendMessagesResult, error) {
+
+	if len(in.Messages) == 0 || len(in.Messages) > maxSendMessages {
+		return nil, status.Errorf(codes.InvalidArgument, "Messages must have 1 to %d messages", maxSendMessages)
+	}
+
+	stats, err := GetQueueStats(in.AppName, in.QueueName)
+	if err != nil {
+		return nil, queueStatus(err)
+	}
+
+	//Check the whole batch first so a bad message does not leave part of it in the queue
+	if in.Priority > q.MaxPriority || (in.Priority != 0 && !stats.MetaData.Priority) {
+		return nil, status.Errorf(codes.InvalidArgument, "Priority must be 0 to %d on a priority queue and 0 on other queues", q.MaxPriority)
+	}
+	if len(in.GroupId) > q.MaxGroupIdLength {
+		return nil, status.Errorf(codes.InvalidArgument, "GroupId must be at most %d bytes", q.MaxGroupIdLength)
+	}
+	if len(in.DeduplicationIds) != 0 && len(in.DeduplicationIds) != len(in.Messages) {
+		return nil, status.Errorf(codes.InvalidArgument, "DeduplicationIds must have one id per message")
+	}
+	for i, id := range in.DeduplicationIds {
+		if len(id) > q.MaxGroupIdLength {
+			return nil, status.Errorf(codes.InvalidArgument, "deduplication id %d must be at most %d bytes", i, q.MaxGroupIdLength)
+		}
+	}
+	for i, msg := range in.Messages {
+		if err := u.IsValidMessageInput(in.AppName, in.QueueName, msg); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "message %d: %s", i, err.Error())
+		}
+	}
+
+	result := &queuepb.SendMessagesResult{Ids: make([]string, 0, len(in.Messages))}
+	for i, msg := range in.Messages {
+		opts := EnqueueOptions{Priority: uint8(in.Priority), GroupId: in.GroupId, TtlSeconds: in.TtlSeconds}
+		if in.DeliverAt != 0 {
+			opts.DeliverAt = time.UnixMilli(in.DeliverAt)
+		}
+		if len(in.DeduplicationIds) != 0 {
+			opts.DeduplicationId = in.DeduplicationIds[i]
+		}
+
+		id, err := EnQueueWithOptions(ctx, in.AppName, in.QueueName, msg, opts)
+		if err != nil {
+			logging.FromContext(ctx).Error("Unable to append a message of a batch", "app", in.AppName, "queue", in.QueueName, "sent", len(result.Ids), "error", err)
+			return nil, queueStatus(err)
+		}
+		result.Ids = append(result.Ids, id)
+	}
+
+	logging.FromContext(ctx).Debug("Enqueued messages", "app", in.AppName, "queue", in.QueueName, "count", len(result.Ids))
+
+	return result, nil
+}
+
+func (EzqueueQueuesServer) ChangeVisibility(ctx context.Context, in *queuepb.ChangeVisibilityParams) (*queuepb.Result, error) {
+
+	if err := ChangeVisibility(in.AppName, in.QueueName, in.Receipt, time.Duration(in.VisibilityTimeout)*time.Second); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) ChangeVisibilityBatch(ctx context.Context, in *queuepb.ChangeVisibilityBatchParams) (*queuepb.ChangeVisibilityBatchResult, error) {
+
+	if len(in.Entries) == 0 || len(in.Entries) > maxChangeVisibilityEntries {
+		return nil, status.Errorf(codes.InvalidArgument, "Entries must have 1 to %d entries", maxChangeVisibilityEntries)
+	}
+
+	changes := make([]wal.VisibilityChange, 0, len(in.Entries))
+	for _, entry := range in.Entries {
+		changes = append(changes, wal.VisibilityChange{Receipt: entry.GetReceipt(), Visibility: time.Duration(entry.GetVisibilityTimeout()) * time.Second})
+	}
+
+	errs, err := ChangeVisibilityBatch(in.AppName, in.QueueName, changes)
+	if err != nil {
+		return nil, queueStatus(err)
+	}
+
+	result := &queuepb.ChangeVisibilityBatchResult{Results: make([]*queuepb.ChangeVisibilityEntryResult, 0, len(errs))}
+	failed := 0
+	for i, err := range errs {
+		entryResult := &queuepb.ChangeVisibilityEntryResult{Receipt: in.Entries[i].GetReceipt()}
+		if qErr, ok := err.(*e.Error); ok {
+			entryResult.ErrorCode, entryResult.Error = e.CodeNames[qErr.ErrorCode], qErr.ErrorMessage
+			failed++
+		}
+		result.Results = append(result.Results, entryResult)
+	}
+
+	logging.FromContext(ctx).Debug("Changed visibility", "app", in.AppName, "queue", in.QueueName, "count", len(errs), "failed", failed)
+
+	return result, nil
+}
+
+func (EzqueueQueuesServer) CreateSchedule(ctx context.Context, in *queuepb.CreateScheduleParams) (*queuepb.Result, error) {
+
+	opts := ScheduleOptions{QueueName: in.QueueName, Cron: in.Cron, Timezone: in.Timezone, Payload: in.Payload, MissedTicks: in.MissedTicks}
+	if err := CreateSchedule(in.AppName, in.Name, opts); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	logging.FromContext(ctx).Info("Created schedule", "caller", caller(ctx), "app", in.AppName, "schedule", in.Name, "queue", in.QueueName, "cron", in.Cron)
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) ListSchedules(ctx context.Context, in *queuepb.ListSchedulesParams) (*queuepb.ScheduleList, error) {
+
+	id, authenticated := auth.FromContext(ctx)
+
+	list := &queuepb.ScheduleList{}
+	for _, s := range ListSchedules(in.AppName) {
+
+		//Callers only see the apps their key is scoped to
+		if authenticated && !id.CanAccessApp(s.AppName) {
+			continue
+		}
+
+		details := &queuepb.ScheduleDetails{
+			AppName:            s.AppName,
+			Name:               s.Name,
+			QueueName:          s.QueueName,
+			Cron:               s.Cron,
+			Timezone:           s.Timezone,
+			Payload:            s.Payload,
+			MissedTicks:        s.MissedTicks,
+			Paused:             s.Paused,
+			LastTickUnixMillis: s.LastTick.UnixMilli(),
+		}
+		if !s.NextTick.IsZero() {
+			details.NextTickUnixMillis = s.NextTick.UnixMilli()
+		}
+		list.Schedules = append(list.Schedules, details)
+	}
+
+	return list, nil
+}
+
+func (EzqueueQueuesServer) PauseSchedule(ctx context.Context, in *queuepb.ScheduleParams) (*queuepb.Result, error) {
+
+	if err := PauseSchedule(in.AppName, in.Name); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	logging.FromContext(ctx).Info("Paused schedule", "caller", caller(ctx), "app", in.AppName, "schedule", in.Name)
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) ResumeSchedule(ctx context.Context, in *queuepb.ScheduleParams) (*queuepb.Result, error) {
+
+	if err := ResumeSchedule(in.AppName, in.Name); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	logging.FromContext(ctx).Info("Resumed schedule", "caller", caller(ctx), "app", in.AppName, "schedule", in.Name)
+
+	return &queuepb.Result{}, nil
+}
+
+func (EzqueueQueuesServer) DeleteSchedule(ctx context.Context, in *queuepb.ScheduleParams) (*queuepb.Result, error) {
+
+	if err := DeleteSchedule(in.AppName, in.Name); err != nil {
+		return nil, queueStatus(err)
+	}
+
+	logging.FromContext(ctx).Info("Deleted schedule", "caller", caller(ctx), "app", in.AppName, "schedule", in.Name)
+
+	return &queuepb.Result{}, nil
+}
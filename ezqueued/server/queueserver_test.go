@@ -0,0 +1,319 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+)
+
+func TestQueuesReceiveAndDelete(t *testing.T) {
+
+	defer removeQueue("queuestest", "queue-1")
+
+	if err := Create("queuestest", "queue-1", 0, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	server := EzqueueQueuesServer{}
+	ref := &queuepb.QueueParams{AppName: "queuestest", QueueName: "queue-1"}
+
+	for _, body := range []string{"first", "second", "third"} {
+		EnQueue("queuestest", "queue-1", body)
+	}
+
+	list, err := server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-1", MaxMessages: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Messages) != 2 || list.Messages[0].Body != "first" || list.Messages[1].Body != "second" {
+		t.Fatalf("Receive: want first and second, got %v", list.Messages)
+	}
+	if list.Messages[0].DeadlineUnixMillis == 0 || len(list.Messages[0].Receipt) == 0 {
+		t.Errorf("Receive: want a receipt and deadline, got %v", list.Messages[0])
+	}
+
+	stats, err := server.GetQueueStats(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Visible != 1 || stats.InFlight != 2 || stats.VisibilityTimeout != 30 {
+		t.Errorf("GetQueueStats: want 1 visible, 2 in flight and a 30s visibility, got %v", stats)
+	}
+
+	if _, err := server.DeleteMessage(ctx, &queuepb.DeleteMessageParams{AppName: "queuestest", QueueName: "queue-1", Receipt: list.Messages[0].Receipt}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.DeleteMessage(ctx, &queuepb.DeleteMessageParams{AppName: "queuestest", QueueName: "queue-1", Receipt: list.Messages[0].Receipt}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("DeleteMessage twice: want InvalidArgument, got %v", err)
+	}
+
+	if _, err := server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-1", MaxMessages: maxReceiveMessages + 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Receive over the limit: want InvalidArgument, got %v", err)
+	}
+
+	//An empty queue is not an error
+	if _, err := server.PurgeQueue(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	list, err = server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-1"})
+	if err != nil || len(list.Messages) != 0 {
+		t.Errorf("Receive after purge: want no messages, got %v %v", list, err)
+	}
+
+	if _, err := server.DeleteQueue(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.GetQueueStats(ctx, ref); status.Code(err) != codes.NotFound {
+		t.Errorf("GetQueueStats after delete: want NotFound, got %v", err)
+	}
+}
+
+func TestListQueues(t *testing.T) {
+
+	defer removeQueue("queuestest", "queue-b")
+	defer removeQueue("queuestest", "queue-a")
+	defer removeQueue("queuestest2", "queue-a")
+
+	Create("queuestest", "queue-b", 0, 0)
+	Create("queuestest", "queue-a", 0, 0)
+	Create("queuestest2", "queue-a", 0, 0)
+
+	server := EzqueueQueuesServer{}
+
+	list, err := server.ListQueues(context.Background(), &queuepb.ListQueuesParams{AppName: "queuestest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Queues) != 2 || list.Queues[0].QueueName != "queue-a" || list.Queues[1].QueueName != "queue-b" {
+		t.Errorf("ListQueues of an app: want queue-a and queue-b, got %v", list.Queues)
+	}
+
+	//A key only sees the apps it is scoped to
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Id: "test", Apps: []string{"queuestest2"}})
+	list, err = server.ListQueues(ctx, &queuepb.ListQueuesParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Queues) != 1 || list.Queues[0].AppName != "queuestest2" {
+		t.Errorf("ListQueues with a scoped key: want the queuestest2 queue, got %v", list.Queues)
+	}
+}
+
+func TestQueuesSendMessagesAndChangeVisibility(t *testing.T) {
+
+	defer removeQueue("queuestest", "queue-2")
+
+	if err := Create("queuestest", "queue-2", 0, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	server := EzqueueQueuesServer{}
+
+	//One empty message fails the whole batch
+	if _, err := server.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "queue-2", Messages: []string{"first", " "}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendMessages with an empty message: want InvalidArgument, got %v", err)
+	}
+	if _, err := server.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "queue-2", Messages: make([]string, maxSendMessages+1)}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendMessages over the limit: want InvalidArgument, got %v", err)
+	}
+	if _, err := server.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "missing", Messages: []string{"first"}}); status.Code(err) != codes.NotFound {
+		t.Errorf("SendMessages to a missing queue: want NotFound, got %v", err)
+	}
+
+	result, err := server.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "queue-2", Messages: []string{"first", "second"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Ids) != 2 {
+		t.Fatalf("SendMessages: want 2 ids, got %v", result.Ids)
+	}
+
+	list, err := server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-2"})
+	if err != nil || len(list.Messages) != 1 || list.Messages[0].Id != result.Ids[0] {
+		t.Fatalf("Receive: want the first message, got %v %v", list, err)
+	}
+
+	//A zero visibility returns the message to the queue
+	receipt := list.Messages[0].Receipt
+	if _, err := server.ChangeVisibility(ctx, &queuepb.ChangeVisibilityParams{AppName: "queuestest", QueueName: "queue-2", Receipt: receipt}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ChangeVisibility(ctx, &queuepb.ChangeVisibilityParams{AppName: "queuestest", QueueName: "queue-2", Receipt: receipt, VisibilityTimeout: 10}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ChangeVisibility of a returned message: want InvalidArgument, got %v", err)
+	}
+
+	list, err = server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-2", MaxMessages: 2})
+	if err != nil || len(list.Messages) != 2 || list.Messages[0].Body != "first" || list.Messages[0].ReceiveCount != 2 {
+		t.Errorf("Receive after ChangeVisibility: want first again and second, got %v %v", list, err)
+	}
+
+	//Only priority queues take a priority
+	if _, err := server.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "queue-2", Messages: []string{"urgent"}, Priority: 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendMessages with a priority to a fifo queue: want InvalidArgument, got %v", err)
+	}
+
+	//A retried batch with the same deduplication ids gets the same ids back
+	dedup := &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "queue-2", Messages: []string{"third", "fourth"}, DeduplicationIds: []string{"batch-1/0", "batch-1/1"}}
+	sent, err := server.SendMessages(ctx, dedup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried, err := server.SendMessages(ctx, dedup); err != nil || retried.Ids[0] != sent.Ids[0] || retried.Ids[1] != sent.Ids[1] {
+		t.Errorf("SendMessages retried: want ids %v, got %v %v", sent.Ids, retried, err)
+	}
+	dedup.DeduplicationIds = dedup.DeduplicationIds[:1]
+	if _, err := server.SendMessages(ctx, dedup); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendMessages with fewer deduplication ids than messages: want InvalidArgument, got %v", err)
+	}
+}
+
+func TestQueuesChangeVisibilityBatch(t *testing.T) {
+
+	defer removeQueue("queuestest", "queue-4")
+
+	ctx := context.Background()
+	server := EzqueueQueuesServer{}
+
+	//Queues take visibility timeouts up to the configured maximum
+	if _, err := server.CreateQueue(ctx, &queuepb.CreateQueueParams{AppName: "queuestest", QueueName: "queue-4", VisibilityTimeout: uint32(maxVisibilityTimeout() + 1)}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateQueue with a visibility timeout over the maximum: want InvalidArgument, got %v", err)
+	}
+
+	//Values above 65535 are refused instead of wrapping around to a small timeout or delay
+	for _, in := range []*queuepb.CreateQueueParams{
+		{AppName: "queuestest", QueueName: "queue-4", VisibilityTimeout: 65566},
+		{AppName: "queuestest", QueueName: "queue-4", DelaySeconds: 65536},
+		{AppName: "queuestest", QueueName: "queue-4", DelaySeconds: q.MaxDelaySeconds + 1},
+	} {
+		if _, err := server.CreateQueue(ctx, in); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("CreateQueue with delay %d and visibility timeout %d: want InvalidArgument, got %v", in.DelaySeconds, in.VisibilityTimeout, err)
+		}
+
+		params := &ezgrpc.CreateParams{AppName: in.AppName, QueueName: in.QueueName, DelaySeconds: in.DelaySeconds, VisibilityTimeout: in.VisibilityTimeout}
+		if _, err := (EzqueuedServer{}).Create(ctx, params); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Create with delay %d and visibility timeout %d: want InvalidArgument, got %v", in.DelaySeconds, in.VisibilityTimeout, err)
+		}
+	}
+	if _, err := server.CreateQueue(ctx, &queuepb.CreateQueueParams{AppName: "queuestest", QueueName: "queue-4", VisibilityTimeout: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := server.GetQueueStats(ctx, &queuepb.QueueParams{AppName: "queuestest", QueueName: "queue-4"}); err != nil || d.VisibilityTimeout != 3600 {
+		t.Errorf("GetQueueStats: want a visibility timeout of 3600, got %v %v", d, err)
+	}
+
+	if _, err := server.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "queue-4", Messages: []string{"first", "second", "third"}}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-4", VisibilityTimeout: 1, MaxMessages: 2})
+	if err != nil || len(list.Messages) != 2 {
+		t.Fatalf("Receive: want 2 messages, got %v %v", list, err)
+	}
+	first, stale := list.Messages[0].Receipt, list.Messages[1].Receipt
+
+	//second is received again, which makes its first receipt stale
+	if _, err := server.ChangeVisibility(ctx, &queuepb.ChangeVisibilityParams{AppName: "queuestest", QueueName: "queue-4", Receipt: stale}); err != nil {
+		t.Fatal(err)
+	}
+	list, err = server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-4", VisibilityTimeout: 1})
+	if err != nil || len(list.Messages) != 1 || list.Messages[0].Body != "second" {
+		t.Fatalf("Receive after ChangeVisibility: want second again, got %v %v", list, err)
+	}
+	second := list.Messages[0].Receipt
+
+	in := &queuepb.ChangeVisibilityBatchParams{AppName: "queuestest", QueueName: "queue-4", Entries: []*queuepb.ChangeVisibilityEntry{
+		{Receipt: first, VisibilityTimeout: 3600},
+		{Receipt: stale, VisibilityTimeout: 3600},
+		{Receipt: "not-a-receipt", VisibilityTimeout: 3600},
+		{Receipt: second, VisibilityTimeout: uint32(maxVisibilityTimeout() + 1)},
+	}}
+	result, err := server.ChangeVisibilityBatch(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []struct {
+		code    string
+		message string
+	}{
+		{"", ""},
+		{e.CodeNames[e.RECEIPT_STALE], e.ErrorReceiptStale},
+		{e.CodeNames[e.RECEIPT_INVALID], e.ErrorReceiptInvalid},
+		{e.CodeNames[e.INVALID_INPUT], e.ErrorInvalidInput},
+	} {
+		if r := result.Results[i]; r.Receipt != in.Entries[i].Receipt || r.ErrorCode != want.code || !strings.Contains(r.Error, want.message) {
+			t.Errorf("ChangeVisibilityBatch entry %d: want code %q and error %q, got %v", i, want.code, want.message, r)
+		}
+	}
+
+	//Returning second in the batch hands it out again, first stays hidden
+	in.Entries = []*queuepb.ChangeVisibilityEntry{{Receipt: second}}
+	if result, err := server.ChangeVisibilityBatch(ctx, in); err != nil || len(result.Results[0].ErrorCode) != 0 {
+		t.Fatalf("ChangeVisibilityBatch to 0: want no errors, got %v %v", result, err)
+	}
+	list, err = server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-4", MaxMessages: 10})
+	if err != nil || len(list.Messages) != 2 || list.Messages[0].Body != "second" || list.Messages[1].Body != "third" {
+		t.Errorf("Receive after ChangeVisibilityBatch: want second and third, got %v %v", list, err)
+	}
+
+	if _, err := server.DeleteMessage(ctx, &queuepb.DeleteMessageParams{AppName: "queuestest", QueueName: "queue-4", Receipt: first}); err != nil {
+		t.Fatal(err)
+	}
+	in.Entries = []*queuepb.ChangeVisibilityEntry{{Receipt: first, VisibilityTimeout: 60}}
+	if result, err := server.ChangeVisibilityBatch(ctx, in); err != nil || !strings.Contains(result.Results[0].Error, e.ErrorReceiptNotInFlight) {
+		t.Errorf("ChangeVisibilityBatch of a deleted message: want %q, got %v %v", e.ErrorReceiptNotInFlight, result, err)
+	}
+
+	in.Entries = make([]*queuepb.ChangeVisibilityEntry, maxChangeVisibilityEntries+1)
+	if _, err := server.ChangeVisibilityBatch(ctx, in); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ChangeVisibilityBatch over the limit: want InvalidArgument, got %v", err)
+	}
+	in.QueueName, in.Entries = "missing", in.Entries[:1]
+	if _, err := server.ChangeVisibilityBatch(ctx, in); status.Code(err) != codes.NotFound {
+		t.Errorf("ChangeVisibilityBatch of a missing queue: want NotFound, got %v", err)
+	}
+}
+
+func TestQueuesCreatePriorityQueue(t *testing.T) {
+
+	defer removeQueue("queuestest", "queue-3")
+
+	ctx := context.Background()
+	server := EzqueueQueuesServer{}
+
+	if _, err := server.CreateQueue(ctx, &queuepb.CreateQueueParams{AppName: "queuestest", QueueName: "queue-3", Priority: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.CreateQueue(ctx, &queuepb.CreateQueueParams{AppName: "queuestest", QueueName: "queue-3"}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("CreateQueue of an existing queue: want AlreadyExists, got %v", err)
+	}
+	if d, err := server.GetQueueStats(ctx, &queuepb.QueueParams{AppName: "queuestest", QueueName: "queue-3"}); err != nil || !d.Priority {
+		t.Errorf("GetQueueStats: want a priority queue, got %v %v", d, err)
+	}
+
+	for _, send := range []*queuepb.SendMessagesParams{
+		{AppName: "queuestest", QueueName: "queue-3", Messages: []string{"nightly-1", "nightly-2"}},
+		{AppName: "queuestest", QueueName: "queue-3", Messages: []string{"urgent"}, Priority: 9},
+	} {
+		if _, err := server.SendMessages(ctx, send); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := server.SendMessages(ctx, &queuepb.SendMessagesParams{AppName: "queuestest", QueueName: "queue-3", Messages: []string{"x"}, Priority: 10}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendMessages with priority 10: want InvalidArgument, got %v", err)
+	}
+
+	list, err := server.Receive(ctx, &queuepb.ReceiveParams{AppName: "queuestest", QueueName: "queue-3", MaxMessages: 3})
+	if err != nil || len(list.Messages) != 3 || list.Messages[0].Body != "urgent" || list.Messages[1].Body != "nightly-1" || list.Messages[2].Body != "nightly-2" {
+		t.Errorf("Receive: want urgent then the nightly messages in order, got %v %v", list, err)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"sync"
+
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+type QueueInfoMap map[string]*wal.QueueInfo
+
+//Top level data structures
+//ProtQueueInfoMap holds the queues by app name and queue name. A name that is being created is held by a nil
+//entry, which Get, Delete and Iter leave out. Lookups take the read lock, so calls to different queues do not
+//wait for each other
+type ProtQueueInfoMap struct {
+	queueWalInfo QueueInfoMap
+	mx           sync.RWMutex
+}
+
+func NewQueueWalInfo() *ProtQueueInfoMap {
+
+	return &ProtQueueInfoMap{queueWalInfo: make(QueueInfoMap, q.MaxQueues)}
+}
+
+func (p *ProtQueueInfoMap) Get(key string) (*wal.QueueInfo, bool) {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	w, ok := p.queueWalInfo[key]
+	if !ok || w == nil {
+		return nil, false
+	}
+
+	return w, true
+}
+
+func (p *ProtQueueInfoMap) Set(key string, value *wal.QueueInfo) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.queueWalInfo[key] = value
+}
+
+//Reserve holds key for a queue that is being created. It returns false when there is a queue with the name
+//or another create of it is in progress. The caller ends the reservation with Set, or with Release when the create fails
+func (p *ProtQueueInfoMap) Reserve(key string) bool {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if _, ok := p.queueWalInfo[key]; ok {
+		return false
+	}
+	p.queueWalInfo[key] = nil
+
+	return true
+}
+
+//Release drops the reservation of key made by Reserve
+func (p *ProtQueueInfoMap) Release(key string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if w, ok := p.queueWalInfo[key]; ok && w == nil {
+		delete(p.queueWalInfo, key)
+	}
+}
+
+func (p *ProtQueueInfoMap) Delete(key string) (*wal.QueueInfo, bool) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	w, ok := p.queueWalInfo[key]
+	if !ok || w == nil {
+		return nil, false
+	}
+	delete(p.queueWalInfo, key)
+
+	return w, true
+}
+
+//Iter returns a copy of the map, so the caller can range over it while queues are created and deleted
+func (p *ProtQueueInfoMap) Iter() QueueInfoMap {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	queues := make(QueueInfoMap, len(p.queueWalInfo))
+	for key, w := range p.queueWalInfo {
+		if w != nil {
+			queues[key] = w
+		}
+	}
+
+	return queues
+}
+
+//Len returns the number of queues
+func (p *ProtQueueInfoMap) Len() int {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	n := 0
+	for _, w := range p.queueWalInfo {
+		if w != nil {
+			n++
+		}
+	}
+
+	return n
+}
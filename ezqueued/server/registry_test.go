@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+func TestRegistry(t *testing.T) {
+
+	p := NewQueueWalInfo()
+	walInfo := new(wal.QueueInfo)
+
+	if !p.Reserve("appqueue") || p.Reserve("appqueue") {
+		t.Fatal("Reserve: want the first reservation of a name to succeed and the second to fail")
+	}
+	if _, ok := p.Get("appqueue"); ok || p.Len() != 0 {
+		t.Error("Get of a reserved name: want no queue")
+	}
+	if _, ok := p.Delete("appqueue"); ok {
+		t.Error("Delete of a reserved name: want no queue")
+	}
+
+	p.Set("appqueue", walInfo)
+	p.Release("appqueue")
+	if w, ok := p.Get("appqueue"); !ok || w != walInfo {
+		t.Error("Release after Set: want the queue kept")
+	}
+
+	for i := 0; i < 200; i++ {
+		p.Set(fmt.Sprintf("app%d", i), walInfo)
+	}
+	if n, queues := p.Len(), p.Iter(); n != 201 || len(queues) != 201 {
+		t.Errorf("Len and Iter: want 201 queues, got %d and %d", n, len(queues))
+	}
+
+	if w, ok := p.Delete("appqueue"); !ok || w != walInfo || p.Len() != 200 {
+		t.Error("Delete: want the queue removed")
+	}
+}
+
+//lockedRegistry is a map behind a plain mutex, the registry before lookups took a read lock
+type lockedRegistry struct {
+	queues QueueInfoMap
+	mx     sync.Mutex
+}
+
+func (r *lockedRegistry) Get(key string) (*wal.QueueInfo, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	w, ok := r.queues[key]
+	return w, ok
+}
+
+var benchmarkQueueCounts = []int{1, 100, 1000}
+
+func benchmarkKeys(n int) []string {
+
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("benchq%d", i)
+	}
+
+	return keys
+}
+
+//BenchmarkRegistryGet looks queues up from many goroutines, in the registry and in a map behind a plain mutex
+func BenchmarkRegistryGet(b *testing.B) {
+
+	for _, n := range benchmarkQueueCounts {
+		keys := benchmarkKeys(n)
+
+		p := NewQueueWalInfo()
+		locked := &lockedRegistry{queues: make(QueueInfoMap)}
+		for _, key := range keys {
+			p.Set(key, new(wal.QueueInfo))
+			locked.queues[key] = new(wal.QueueInfo)
+		}
+
+		registries := []struct {
+			name string
+			get  func(key string) (*wal.QueueInfo, bool)
+		}{{"rwmutex", p.Get}, {"mutex", locked.Get}}
+
+		for _, r := range registries {
+			b.Run(fmt.Sprintf("%s/queues=%d", r.name, n), func(b *testing.B) {
+				var next uint32
+				b.RunParallel(func(pb *testing.PB) {
+					i := int(atomic.AddUint32(&next, 1))
+					for pb.Next() {
+						r.get(keys[i%n])
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+//BenchmarkEnqueueDequeue enqueues and dequeues a message per op from many goroutines, spread over the queues
+func BenchmarkEnqueueDequeue(b *testing.B) {
+
+	for _, n := range benchmarkQueueCounts {
+		b.Run(fmt.Sprintf("queues=%d", n), func(b *testing.B) {
+
+			logsPath, queues := wal.Config.Logspath, queueInfo
+			wal.Config.Logspath, queueInfo = b.TempDir(), NewQueueWalInfo()
+			defer func() {
+				closeQueues()
+				wal.Config.Logspath, queueInfo = logsPath, queues
+			}()
+
+			keys := benchmarkKeys(n)
+			for _, key := range keys {
+				if err := Create("bench", key, 0, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			var next uint32
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddUint32(&next, 1))
+				for pb.Next() {
+					key := keys[i%n]
+					if _, err := EnQueue("bench", key, "message"); err != nil {
+						b.Error(err)
+						return
+					}
+					if _, err := DeQueue("bench", key); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
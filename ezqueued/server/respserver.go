@@ -0,0 +1,542 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+/*
+	Redis protocol (RESP) listener for workers that use Redis lists as queues. Keys have the form app:queue.
+	The producer side of a list is the left, so LPUSH enqueues and RPOP/BRPOP dequeue the oldest message.
+	LPUSH creates the queue if it does not exist, like Redis creates a list.
+
+	Supported commands: LPUSH, RPOP, BRPOP, LLEN, LRANGE, PING, ECHO, SELECT, AUTH and QUIT
+*/
+
+//The limits are checked before the command is read, so a client that has not sent AUTH cannot make the server
+//allocate more than a message and a few thousand arguments
+const (
+	respMaxBulkLen = q.MaxMessageSize*1024 + 1024 //a message with room for the length of a key
+	respMaxArgs    = 4096
+)
+
+//respError is written to the client as a RESP error
+type respError struct {
+	Message string
+}
+
+func (r *respError) Error() string {
+	return r.Message
+}
+
+func respErrorf(format string, a ...interface{}) *respError {
+	return &respError{fmt.Sprintf(format, a...)}
+}
+
+var errRespSyntax = &respError{"ERR syntax error"}
+
+type respConn struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	writer   *bufio.Writer
+	identity *auth.Identity //authenticated client, nil until AUTH when authentication is on
+}
+
+//ServeResp accepts Redis protocol connections until the listener is closed
+func ServeResp(listen net.Listener) error {
+
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			return err
+		}
+
+		go serveRespConn(conn)
+	}
+}
+
+func serveRespConn(conn net.Conn) {
+
+	defer conn.Close()
+
+	c := &respConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+
+	for {
+		args, err := c.readCommand()
+		if err == io.EOF {
+			return
+		} else if rErr, ok := err.(*respError); ok {
+			//The stream cannot be trusted after a protocol error, so report it and hang up like Redis does
+			c.writeError(rErr)
+			c.writer.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := c.dispatch(args)
+
+		if err := c.writer.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+//readCommand reads a command sent as a RESP array of bulk strings or as an inline command
+func (c *respConn) readCommand() ([]string, error) {
+
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 0 || count > respMaxArgs {
+		return nil, &respError{"ERR Protocol error: invalid multibulk length"}
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, respErrorf("ERR Protocol error: expected '$', got '%s'", line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > respMaxBulkLen {
+			return nil, &respError{"ERR Protocol error: invalid bulk length"}
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func (c *respConn) readLine() (string, error) {
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *respConn) writeSimple(s string) {
+	c.writer.WriteString("+" + s + "\r\n")
+}
+
+func (c *respConn) writeError(err *respError) {
+	c.writer.WriteString("-" + err.Message + "\r\n")
+}
+
+func (c *respConn) writeInt(i int) {
+	c.writer.WriteString(":" + strconv.Itoa(i) + "\r\n")
+}
+
+func (c *respConn) writeBulk(s string) {
+	c.writer.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (c *respConn) writeNil() {
+	c.writer.WriteString("$-1\r\n")
+}
+
+func (c *respConn) writeNilArray() {
+	c.writer.WriteString("*-1\r\n")
+}
+
+func (c *respConn) writeArray(items []string) {
+
+	c.writer.WriteString("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, item := range items {
+		c.writeBulk(item)
+	}
+}
+
+//dispatch runs one command and reports if the connection should be closed
+func (c *respConn) dispatch(args []string) bool {
+
+	command := strings.ToUpper(args[0])
+
+	var err error
+
+	switch command {
+	case "PING":
+		if len(args) > 1 {
+			c.writeBulk(args[1])
+		} else {
+			c.writeSimple("PONG")
+		}
+
+	case "ECHO":
+		if len(args) != 2 {
+			err = respWrongArgs(command)
+		} else {
+			c.writeBulk(args[1])
+		}
+
+	case "QUIT":
+		c.writeSimple("OK")
+		return true
+
+	case "SELECT":
+		//There is only one keyspace, every database maps onto it
+		c.writeSimple("OK")
+
+	case "AUTH":
+		err = c.auth(args)
+
+	case "LPUSH", "RPOP", "BRPOP", "LLEN", "LRANGE":
+		if keyStore != nil && c.identity == nil {
+			err = &respError{"NOAUTH Authentication required."}
+			break
+		}
+
+		switch command {
+		case "LPUSH":
+			err = c.lpush(args)
+		case "RPOP":
+			err = c.rpop(args)
+		case "BRPOP":
+			err = c.brpop(args)
+		case "LLEN":
+			err = c.llen(args)
+		case "LRANGE":
+			err = c.lrange(args)
+		}
+
+	default:
+		err = respErrorf("ERR unknown command '%s', with args beginning with: %s", args[0], strings.Join(args[1:], " "))
+	}
+
+	if err != nil {
+		c.writeError(toRespError(err))
+	}
+
+	return false
+}
+
+func respWrongArgs(command string) *respError {
+	return respErrorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+}
+
+//toRespError turns queue errors into RESP errors
+func toRespError(err error) *respError {
+
+	if rErr, ok := err.(*respError); ok {
+		return rErr
+	}
+
+	if qErr, ok := err.(*e.Error); ok {
+		return respErrorf("ERR %s %s", e.CodeNames[qErr.ErrorCode], qErr.ErrorMessage)
+	}
+
+	return respErrorf("ERR %s", err.Error())
+}
+
+func (c *respConn) auth(args []string) error {
+
+	//AUTH password or AUTH username password
+	if len(args) != 2 && len(args) != 3 {
+		return respWrongArgs(args[0])
+	}
+
+	if keyStore == nil {
+		return &respError{"ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"}
+	}
+
+	id, ok := keyStore.Lookup(args[len(args)-1])
+	if !ok {
+		logger.Warn("Rejected resp client", "remote", c.conn.RemoteAddr().String(), "error", "invalid api key")
+		return &respError{"WRONGPASS invalid username-password pair or user is disabled."}
+	}
+
+	c.identity = id
+	c.writeSimple("OK")
+
+	return nil
+}
+
+//queueFromKey splits an app:queue key and checks the client can use it
+func (c *respConn) queueFromKey(key, perm string) (string, string, error) {
+
+	i := strings.Index(key, ":")
+	if i <= 0 || i == len(key)-1 {
+		return "", "", respErrorf("ERR key '%s' must have the form app:queue", key)
+	}
+
+	appName, queueName := key[:i], key[i+1:]
+
+	if c.identity != nil {
+		if err := c.identity.Authorize(appName, perm); err != nil {
+			return "", "", &respError{"NOPERM this user has no permissions to run this command on " + key}
+		}
+	}
+
+	return appName, queueName, nil
+}
+
+func isQueueError(err error, code int) bool {
+	qErr, ok := err.(*e.Error)
+	return ok && qErr.ErrorCode == code
+}
+
+func (c *respConn) lpush(args []string) error {
+
+	if len(args) < 3 {
+		return respWrongArgs(args[0])
+	}
+
+	appName, queueName, err := c.queueFromKey(args[1], auth.PermEnqueue)
+	if err != nil {
+		return err
+	}
+
+	//Like Redis, pushing to a key that does not exist creates it
+	if _, ok := queueInfo.Get(appName + queueName); !ok {
+		if _, _, err := c.queueFromKey(args[1], auth.PermCreate); err != nil {
+			return err
+		}
+
+		if err := Create(appName, queueName, 0, 0); err != nil && !isQueueError(err, e.ALREADY_EXISTS) {
+			return err
+		}
+	}
+
+	//Check the sizes first so a push with one message that is too large adds none of them
+	for _, msg := range args[2:] {
+		if len(msg) > q.MaxMessageSize*1024 {
+			return respErrorf("ERR message exceeds the maximum size of %d bytes", q.MaxMessageSize*1024)
+		}
+	}
+
+	for _, msg := range args[2:] {
+		if _, err := EnQueue(appName, queueName, msg); err != nil {
+			return err
+		}
+	}
+
+	stats, err := GetQueueStats(appName, queueName)
+	if err != nil {
+		return err
+	}
+
+	c.writeInt(stats.Visible)
+
+	return nil
+}
+
+func (c *respConn) rpop(args []string) error {
+
+	if len(args) != 2 && len(args) != 3 {
+		return respWrongArgs(args[0])
+	}
+
+	appName, queueName, err := c.queueFromKey(args[1], auth.PermDequeue)
+	if err != nil {
+		return err
+	}
+
+	//RPOP key count replies with an array
+	count := -1
+	if len(args) == 3 {
+		if count, err = strconv.Atoi(args[2]); err != nil || count < 0 {
+			return &respError{"ERR value is out of range, must be positive"}
+		}
+	}
+
+	var messages []string
+	for count < 0 && len(messages) == 0 || len(messages) < count {
+		msg, err := DeQueue(appName, queueName)
+		if isQueueError(err, e.QUEUE_EMPTY) || isQueueError(err, e.QUEUE_DOES_NOT_EXIST) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	switch {
+	case count < 0 && len(messages) == 0:
+		c.writeNil()
+	case count < 0:
+		c.writeBulk(messages[0])
+	case len(messages) == 0 && count > 0:
+		c.writeNilArray()
+	default:
+		c.writeArray(messages)
+	}
+
+	return nil
+}
+
+//brpop pops from the first non empty key, blocking until a message arrives or the timeout runs out
+func (c *respConn) brpop(args []string) error {
+
+	if len(args) < 3 {
+		return respWrongArgs(args[0])
+	}
+
+	timeout, err := strconv.ParseFloat(args[len(args)-1], 64)
+	if err != nil || timeout < 0 {
+		return &respError{"ERR timeout is not a float or out of range"}
+	}
+
+	type key struct {
+		name, appName, queueName string
+	}
+
+	var keys []key
+	for _, k := range args[1 : len(args)-1] {
+		appName, queueName, err := c.queueFromKey(k, auth.PermDequeue)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key{k, appName, queueName})
+	}
+
+	//A zero timeout blocks until a message arrives
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout * float64(time.Second)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		//Get the signals before checking the queues so an append in between is not missed
+		cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(expired)}}
+
+		for _, k := range keys {
+			if appQueue, ok := queueInfo.Get(k.appName + k.queueName); ok {
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(appQueue.MessageAdded())})
+			}
+		}
+
+		for _, k := range keys {
+			msg, err := DeQueue(k.appName, k.queueName)
+			if err == nil {
+				c.writeArray([]string{k.name, msg})
+				return nil
+			} else if !isQueueError(err, e.QUEUE_EMPTY) && !isQueueError(err, e.QUEUE_DOES_NOT_EXIST) {
+				return err
+			}
+		}
+
+		//Queues that do not exist yet are checked again every second
+		poll := time.NewTimer(time.Second)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(poll.C)})
+
+		chosen, _, _ := reflect.Select(cases)
+		poll.Stop()
+
+		if chosen == 0 {
+			c.writeNilArray()
+			return nil
+		}
+	}
+}
+
+func (c *respConn) llen(args []string) error {
+
+	if len(args) != 2 {
+		return respWrongArgs(args[0])
+	}
+
+	appName, queueName, err := c.queueFromKey(args[1], auth.PermDequeue)
+	if err != nil {
+		return err
+	}
+
+	stats, err := GetQueueStats(appName, queueName)
+	if isQueueError(err, e.QUEUE_DOES_NOT_EXIST) {
+		c.writeInt(0)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.writeInt(stats.Visible)
+
+	return nil
+}
+
+//lrange lists messages without removing them. Index 0 is the newest message, the end of the list is the next one RPOP returns
+func (c *respConn) lrange(args []string) error {
+
+	if len(args) != 4 {
+		return respWrongArgs(args[0])
+	}
+
+	appName, queueName, err := c.queueFromKey(args[1], auth.PermDequeue)
+	if err != nil {
+		return err
+	}
+
+	start, serr := strconv.Atoi(args[2])
+	stop, perr := strconv.Atoi(args[3])
+	if serr != nil || perr != nil {
+		return &respError{"ERR value is not an integer or out of range"}
+	}
+
+	appQueue, ok := queueInfo.Get(appName + queueName)
+	if !ok {
+		c.writeArray(nil)
+		return nil
+	}
+
+	messages := appQueue.Messages()
+	length := len(messages)
+
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	var items []string
+	for i := start; i <= stop; i++ {
+		items = append(items, messages[length-1-i])
+	}
+
+	c.writeArray(items)
+
+	return nil
+}
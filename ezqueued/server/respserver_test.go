@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+//respClient sends commands as RESP arrays and reads back the reply
+type respClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRespClient(t *testing.T) *respClient {
+
+	server, client := net.Pipe()
+	go serveRespConn(server)
+
+	return &respClient{t, client, bufio.NewReader(client)}
+}
+
+func (c *respClient) do(args ...string) interface{} {
+
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+
+	if _, err := c.conn.Write([]byte(cmd)); err != nil {
+		c.t.Fatalf("Unable to send %v: %s", args, err.Error())
+	}
+
+	return c.read()
+}
+
+//read returns strings for simple and bulk strings, int for integers, []interface{} for arrays,
+//error for errors and nil for nil replies
+func (c *respClient) read() interface{} {
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("Unable to read the reply: %s", err.Error())
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return &respError{line[1:]}
+	case ':':
+		i, _ := strconv.Atoi(line[1:])
+		return i
+	case '$':
+		size, _ := strconv.Atoi(line[1:])
+		if size < 0 {
+			return nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			c.t.Fatalf("Unable to read the reply: %s", err.Error())
+		}
+		return string(buf[:size])
+	case '*':
+		count, _ := strconv.Atoi(line[1:])
+		if count < 0 {
+			return nil
+		}
+		items := []interface{}{}
+		for i := 0; i < count; i++ {
+			items = append(items, c.read())
+		}
+		return items
+	}
+
+	c.t.Fatalf("Unexpected reply %q", line)
+	return nil
+}
+
+func TestRespListCommands(t *testing.T) {
+
+	defer removeQueue("resptest", "jobs")
+
+	c := newRespClient(t)
+	defer c.conn.Close()
+
+	tests := []struct {
+		args []string
+		want interface{}
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"LLEN", "resptest:jobs"}, 0},
+		{[]string{"LPUSH", "resptest:jobs", "one", "two"}, 2},
+		{[]string{"LPUSH", "resptest:jobs", "three"}, 3},
+		{[]string{"LRANGE", "resptest:jobs", "0", "-1"}, []interface{}{"three", "two", "one"}},
+		{[]string{"RPOP", "resptest:jobs"}, "one"},
+		{[]string{"RPOP", "resptest:jobs", "5"}, []interface{}{"two", "three"}},
+		{[]string{"RPOP", "resptest:jobs"}, nil},
+		{[]string{"LLEN", "resptest:jobs"}, 0},
+	}
+
+	for _, test := range tests {
+		if got := c.do(test.args...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: want %v, got %v", test.args, test.want, got)
+		}
+	}
+
+	for _, args := range [][]string{{"LPUSH", "nocolon", "x"}, {"HSET", "a", "b", "c"}, {"RPOP"}} {
+		if _, ok := c.do(args...).(*respError); !ok {
+			t.Errorf("%v: want an error reply", args)
+		}
+	}
+
+	//A push with a message above the maximum size adds none of its messages
+	large := strings.Repeat("x", q.MaxMessageSize*1024+1)
+	if _, ok := c.do("LPUSH", "resptest:jobs", "small", large).(*respError); !ok {
+		t.Errorf("LPUSH of a message above the maximum size: want an error reply")
+	}
+	if got := c.do("LLEN", "resptest:jobs"); got != 0 {
+		t.Errorf("LLEN after a rejected LPUSH: want 0, got %v", got)
+	}
+}
+
+func TestRespLimits(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		command string
+	}{
+		{"too many arguments", "*" + strconv.Itoa(respMaxArgs+1) + "\r\n"},
+		{"negative argument count", "*-1\r\n"},
+		{"bulk string above the maximum", "*1\r\n$" + strconv.Itoa(respMaxBulkLen+1) + "\r\n"},
+	}
+
+	for _, test := range tests {
+		c := newRespClient(t)
+
+		if _, err := c.conn.Write([]byte(test.command)); err != nil {
+			t.Fatalf("%s: unable to send the command: %s", test.name, err.Error())
+		}
+		if _, ok := c.read().(*respError); !ok {
+			t.Errorf("%s: want a protocol error", test.name)
+		}
+
+		c.conn.Close()
+	}
+}
+
+func TestRespBrpop(t *testing.T) {
+
+	defer removeQueue("resptest", "blocking")
+
+	c := newRespClient(t)
+	defer c.conn.Close()
+
+	c.do("LPUSH", "resptest:blocking", "ready")
+
+	want := []interface{}{"resptest:blocking", "ready"}
+	if got := c.do("BRPOP", "resptest:missing", "resptest:blocking", "1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("BRPOP ready: want %v, got %v", want, got)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		EnQueue("resptest", "blocking", "late")
+	}()
+
+	start := time.Now()
+	want = []interface{}{"resptest:blocking", "late"}
+	if got := c.do("BRPOP", "resptest:blocking", "5"); !reflect.DeepEqual(got, want) {
+		t.Errorf("BRPOP wait: want %v, got %v", want, got)
+	}
+
+	if time.Since(start) > 4*time.Second {
+		t.Errorf("BRPOP wait: want to return when the message arrives, waited %v", time.Since(start))
+	}
+
+	if got := c.do("BRPOP", "resptest:blocking", "0.1"); got != nil {
+		t.Errorf("BRPOP timeout: want nil, got %v", got)
+	}
+}
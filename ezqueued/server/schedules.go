@@ -0,0 +1,443 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/cron"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	u "github.com/coderagr/ezqueue-service/ezqueued/utilities"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//Schedules enqueue a message to a queue at each tick of a cron expression. They are saved in the logs directory
+//and ticks missed while the server was down are handled by the MissedTicks policy of the schedule
+
+//Policies for the ticks missed while the server was down
+const (
+	MissedTicksSkip = "skip" //send nothing for them
+	MissedTicksOnce = "once" //send one message for all of them. The default
+	MissedTicksAll  = "all"  //send one message for each of them, up to maxCatchUpTicks
+)
+
+const (
+	schedulesFileName     = "schedules.json"
+	schedulesTmpExtn      = ".tmp"
+	maxScheduleNameLength = 64
+
+	//maxCatchUpTicks is the most messages the all policy sends for the missed ticks, the latest ones are kept
+	maxCatchUpTicks = 100
+
+	//A tick that is due for longer than missedTickGrace was missed, a shorter wait is a tick on time
+	missedTickGrace = time.Minute
+)
+
+//ScheduleOptions are the settings of a new schedule
+type ScheduleOptions struct {
+	QueueName   string `json:"queuename"`   //existing queue of the app the messages are sent to
+	Cron        string `json:"cron"`        //five field cron expression or a macro, Ex: "*/15 * * * *" or "@daily"
+	Timezone    string `json:"timezone"`    //IANA time zone the expression is read in, Ex: "Europe/Berlin". UTC when empty
+	Payload     string `json:"payload"`     //body of the message sent at each tick
+	MissedTicks string `json:"missedticks"` //skip, once or all. once when empty
+}
+
+//Schedule is a schedule as it is saved in the schedules file
+type Schedule struct {
+	AppName string `json:"appname"`
+	Name    string `json:"name"`
+	ScheduleOptions
+	Paused    bool      `json:"paused,omitempty"`
+	CreatedAt time.Time `json:"createdat"`
+	LastTick  time.Time `json:"lasttick"` //the latest tick that was handled, the next one comes after it
+
+	NextTick time.Time `json:"-"` //set by ListSchedules, zero if the expression never matches again
+}
+
+//schedule is a saved schedule with its parsed expression
+type schedule struct {
+	Schedule
+	expr     *cron.Expression
+	location *time.Location
+}
+
+type scheduleStore struct {
+	mutex     sync.Mutex
+	schedules map[string]*schedule //by app name and schedule name
+}
+
+var schedules = &scheduleStore{schedules: make(map[string]*schedule)}
+
+//scheduleError returns an error for the schedule with the code
+func scheduleError(appName, name string, code int, msg string) error {
+	return &e.Error{AppName: appName, Name: name, ErrorCode: code, ErrorMessage: msg}
+}
+
+//newSchedule checks the settings of a schedule and parses its expression and time zone
+func newSchedule(s Schedule) (*schedule, error) {
+
+	expr, err := cron.Parse(s.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", s.Timezone)
+	}
+
+	switch s.MissedTicks {
+	case MissedTicksSkip, MissedTicksOnce, MissedTicksAll:
+	default:
+		return nil, fmt.Errorf("missed ticks must be %s, %s or %s", MissedTicksSkip, MissedTicksOnce, MissedTicksAll)
+	}
+
+	return &schedule{Schedule: s, expr: expr, location: location}, nil
+}
+
+//CreateSchedule adds a schedule that enqueues opts.Payload to opts.QueueName at each tick of opts.Cron, starting from now.
+//Schedule names are unique within an app
+func CreateSchedule(appName, name string, opts ScheduleOptions) error {
+
+	if len(strings.TrimSpace(name)) == 0 || len(name) > maxScheduleNameLength {
+		msg := fmt.Sprintf("schedule name must be 1 to %d bytes", maxScheduleNameLength)
+		return scheduleError(appName, name, e.INVALID_INPUT, msg)
+	}
+	if err := u.IsValidMessageInput(appName, opts.QueueName, opts.Payload); err != nil {
+		return scheduleError(appName, name, e.INVALID_INPUT, err.Error())
+	}
+
+	if len(opts.Timezone) == 0 {
+		opts.Timezone = "UTC"
+	}
+	if len(opts.MissedTicks) == 0 {
+		opts.MissedTicks = MissedTicksOnce
+	}
+
+	now := time.Now()
+	s, err := newSchedule(Schedule{AppName: appName, Name: name, ScheduleOptions: opts, CreatedAt: now, LastTick: now})
+	if err != nil {
+		logger.Debug("Invalid schedule", "app", appName, "schedule", name, "cron", opts.Cron, "error", err)
+		return scheduleError(appName, name, e.INVALID_INPUT, err.Error())
+	}
+	if s.expr.Next(now.In(s.location)).IsZero() {
+		return scheduleError(appName, name, e.INVALID_INPUT, fmt.Sprintf("cron expression %q never matches", opts.Cron))
+	}
+
+	if _, ok := queueInfo.Get(appName + opts.QueueName); !ok {
+		return scheduleError(appName, opts.QueueName, e.QUEUE_DOES_NOT_EXIST, e.ErrorQueueDoesNotExist)
+	}
+
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+
+	if _, ok := schedules.schedules[appName+name]; ok {
+		return scheduleError(appName, name, e.ALREADY_EXISTS, e.ErrorScheduleExists)
+	}
+
+	schedules.schedules[appName+name] = s
+	if err := schedules.save(); err != nil {
+		delete(schedules.schedules, appName+name)
+		logger.Error("Unable to save the schedules", "app", appName, "schedule", name, "error", err)
+		return scheduleError(appName, name, e.WAL_CONTROL_SAVE_FAILED, err.Error())
+	}
+
+	return nil
+}
+
+//ListSchedules returns the schedules of the app, or of every app when appName is empty, sorted by app and name
+func ListSchedules(appName string) []Schedule {
+
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+
+	list := []Schedule{}
+	for _, s := range schedules.schedules {
+		if len(appName) != 0 && s.AppName != appName {
+			continue
+		}
+
+		info := s.Schedule
+		info.NextTick = s.nextTick(time.Now())
+		list = append(list, info)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].AppName != list[j].AppName {
+			return list[i].AppName < list[j].AppName
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+//PauseSchedule stops sending the messages of the schedule. The ticks while it is paused are skipped
+func PauseSchedule(appName, name string) error {
+	return setSchedulePaused(appName, name, true)
+}
+
+//ResumeSchedule sends the messages of a paused schedule again from the next tick on
+func ResumeSchedule(appName, name string) error {
+	return setSchedulePaused(appName, name, false)
+}
+
+func setSchedulePaused(appName, name string, paused bool) error {
+
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+
+	s, ok := schedules.schedules[appName+name]
+	if !ok {
+		return scheduleError(appName, name, e.SCHEDULE_DOES_NOT_EXIST, e.ErrorScheduleDoesNotExist)
+	}
+	if s.Paused == paused {
+		return nil
+	}
+
+	s.Paused = paused
+	if !paused {
+		s.LastTick = time.Now()
+	}
+
+	if err := schedules.save(); err != nil {
+		logger.Error("Unable to save the schedules", "app", appName, "schedule", name, "error", err)
+		return scheduleError(appName, name, e.WAL_CONTROL_SAVE_FAILED, err.Error())
+	}
+
+	return nil
+}
+
+//DeleteSchedule removes the schedule
+func DeleteSchedule(appName, name string) error {
+
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+
+	s, ok := schedules.schedules[appName+name]
+	if !ok {
+		return scheduleError(appName, name, e.SCHEDULE_DOES_NOT_EXIST, e.ErrorScheduleDoesNotExist)
+	}
+
+	delete(schedules.schedules, appName+name)
+	if err := schedules.save(); err != nil {
+		schedules.schedules[appName+name] = s
+		logger.Error("Unable to save the schedules", "app", appName, "schedule", name, "error", err)
+		return scheduleError(appName, name, e.WAL_CONTROL_SAVE_FAILED, err.Error())
+	}
+
+	return nil
+}
+
+//deleteQueueSchedules removes the schedules that send to a queue that was deleted
+func deleteQueueSchedules(appName, queueName string) {
+
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+
+	removed := 0
+	for key, s := range schedules.schedules {
+		if s.AppName == appName && s.QueueName == queueName {
+			delete(schedules.schedules, key)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return
+	}
+
+	if err := schedules.save(); err != nil {
+		logger.Error("Unable to save the schedules", "app", appName, "queue", queueName, "error", err)
+	}
+	logger.Info("Removed the schedules of a deleted queue", "app", appName, "queue", queueName, "schedules", removed)
+}
+
+//nextTick returns the first tick after the last one that was handled and after now
+func (s *schedule) nextTick(now time.Time) time.Time {
+
+	from := s.LastTick
+	if now.After(from) {
+		from = now
+	}
+
+	return s.expr.Next(from.In(s.location))
+}
+
+//dueTicks returns the ticks after the last one that was handled up to now, at most the latest maxCatchUpTicks
+func (s *schedule) dueTicks(now time.Time) []time.Time {
+
+	var ticks []time.Time
+	for t := s.expr.Next(s.LastTick.In(s.location)); !t.IsZero() && !t.After(now); t = s.expr.Next(t) {
+		if len(ticks) == maxCatchUpTicks {
+			ticks = ticks[1:]
+		}
+		ticks = append(ticks, t)
+	}
+
+	return ticks
+}
+
+//sendTicks picks the ticks to send by the missed ticks policy
+func (s *schedule) sendTicks(ticks []time.Time, now time.Time) []time.Time {
+
+	switch s.MissedTicks {
+	case MissedTicksSkip:
+		for i, t := range ticks {
+			if now.Sub(t) < missedTickGrace {
+				return ticks[i:]
+			}
+		}
+		return nil
+
+	case MissedTicksOnce:
+		return ticks[len(ticks)-1:]
+	}
+
+	return ticks
+}
+
+/*
+	runSchedules sends the messages of the ticks that are due by now. A message has a deduplication id made from the
+	schedule and its tick, so a tick sent just before a crash is not sent again after the restart while its id is in the
+	dedup window. A tick that could not be sent, Ex: the wal append failed, is tried again on the next run
+*/
+func runSchedules(now time.Time) {
+
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+
+	changed := false
+
+	for _, s := range schedules.schedules {
+
+		if s.Paused {
+			continue
+		}
+
+		ticks := s.dueTicks(now)
+		if len(ticks) == 0 {
+			continue
+		}
+
+		lastTick, sent := s.LastTick, 0
+		for _, t := range s.sendTicks(ticks, now) {
+			opts := EnqueueOptions{DeduplicationId: "schedule:" + s.Name + ":" + strconv.FormatInt(t.Unix(), 10)}
+			if _, err := EnQueueWithOptions(context.Background(), s.AppName, s.QueueName, s.Payload, opts); err != nil {
+				logger.Warn("Unable to send a scheduled message", "app", s.AppName, "schedule", s.Name, "queue", s.QueueName, "tick", t, "error", err)
+				ticks = ticks[:0]
+				break
+			}
+			s.LastTick = t
+			sent++
+		}
+
+		//The skipped ticks are handled too
+		if len(ticks) != 0 {
+			s.LastTick = ticks[len(ticks)-1]
+		}
+		if !s.LastTick.Equal(lastTick) {
+			changed = true
+		}
+
+		if len(ticks) > 1 {
+			logger.Info("Handled missed schedule ticks", "app", s.AppName, "schedule", s.Name, "policy", s.MissedTicks, "sent", sent, "skipped", len(ticks)-sent)
+		}
+	}
+
+	if changed {
+		if err := schedules.save(); err != nil {
+			logger.Error("Unable to save the schedules", "error", err)
+		}
+	}
+}
+
+//schedulesFile is the schedules file in the logs directory
+type schedulesFile struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+//save writes the schedules to a new file that replaces the old one. The caller must hold the mutex
+func (store *scheduleStore) save() error {
+
+	file := schedulesFile{Schedules: []Schedule{}}
+	for _, s := range store.schedules {
+		file.Schedules = append(file.Schedules, s.Schedule)
+	}
+	sort.Slice(file.Schedules, func(i, j int) bool {
+		a, b := file.Schedules[i], file.Schedules[j]
+		return a.AppName+"/"+a.Name < b.AppName+"/"+b.Name
+	})
+
+	b, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	filePath := path.Join(wal.Config.Logspath, schedulesFileName)
+	f, err := wal.FS.OpenFile(filePath+schedulesTmpExtn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return wal.FS.Rename(filePath+schedulesTmpExtn, filePath)
+}
+
+//RecoverSchedules reads the schedules file in the logs directory. The ticks missed since the last run
+//are sent by the maintenance according to the policy of each schedule
+func RecoverSchedules() error {
+
+	store := map[string]*schedule{}
+
+	b, err := os.ReadFile(path.Join(wal.Config.Logspath, schedulesFileName))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("Unable to read the schedules file", "path", wal.Config.Logspath, "error", err)
+		return err
+	}
+
+	if err == nil {
+		var file schedulesFile
+		if err := json.Unmarshal(b, &file); err != nil {
+			logger.Error("Unable to read the schedules file", "path", wal.Config.Logspath, "error", err)
+			return err
+		}
+
+		for _, saved := range file.Schedules {
+			s, err := newSchedule(saved)
+			if err != nil {
+				logger.Error("Skipping a schedule that cannot be read", "app", saved.AppName, "schedule", saved.Name, "error", err)
+				continue
+			}
+			store[s.AppName+s.Name] = s
+		}
+	}
+
+	schedules.mutex.Lock()
+	schedules.schedules = store
+	schedules.mutex.Unlock()
+
+	if len(store) != 0 {
+		logger.Info("Recovered schedules", "schedules", len(store))
+	}
+
+	return nil
+}
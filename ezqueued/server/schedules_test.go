@@ -0,0 +1,136 @@
+package server
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	w "github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//drainQueue dequeues every message and counts them by body
+func drainQueue(appName, name string) map[string]int {
+
+	counts := make(map[string]int)
+	for {
+		msg, err := DeQueue(appName, name)
+		if err != nil {
+			return counts
+		}
+		counts[msg]++
+	}
+}
+
+func TestSchedules(t *testing.T) {
+
+	defer os.Remove(path.Join(w.Config.Logspath, schedulesFileName))
+	defer removeQueue("scheduletest", "ticks")
+
+	if err := Create("scheduletest", "ticks", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		opts ScheduleOptions
+		code int
+	}{
+		{"bad-cron", ScheduleOptions{QueueName: "ticks", Cron: "* * *", Payload: "x"}, e.INVALID_INPUT},
+		{"never", ScheduleOptions{QueueName: "ticks", Cron: "0 0 30 2 *", Payload: "x"}, e.INVALID_INPUT},
+		{"bad-zone", ScheduleOptions{QueueName: "ticks", Cron: "@daily", Timezone: "Mars/Olympus", Payload: "x"}, e.INVALID_INPUT},
+		{"bad-policy", ScheduleOptions{QueueName: "ticks", Cron: "@daily", Payload: "x", MissedTicks: "sometimes"}, e.INVALID_INPUT},
+		{"no-payload", ScheduleOptions{QueueName: "ticks", Cron: "@daily"}, e.INVALID_INPUT},
+		{"", ScheduleOptions{QueueName: "ticks", Cron: "@daily", Payload: "x"}, e.INVALID_INPUT},
+		{"no-queue", ScheduleOptions{QueueName: "missing", Cron: "@daily", Payload: "x"}, e.QUEUE_DOES_NOT_EXIST},
+	} {
+		if err := CreateSchedule("scheduletest", c.name, c.opts); !isQueueError(err, c.code) {
+			t.Errorf("CreateSchedule %q: want error code %d, got %v", c.name, c.code, err)
+		}
+	}
+
+	for _, policy := range []string{MissedTicksAll, MissedTicksOnce, MissedTicksSkip} {
+		if err := CreateSchedule("scheduletest", policy, ScheduleOptions{QueueName: "ticks", Cron: "0 * * * *", Payload: policy, MissedTicks: policy}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CreateSchedule("scheduletest", "all", ScheduleOptions{QueueName: "ticks", Cron: "@daily", Payload: "x"}); !isQueueError(err, e.ALREADY_EXISTS) {
+		t.Errorf("CreateSchedule of an existing name: want ALREADY_EXISTS, got %v", err)
+	}
+
+	//The server was down for the ticks at base-4h to base, half an hour ago
+	base := time.Now().UTC().Truncate(time.Hour)
+	setLastTick := func(lastTick time.Time) {
+		schedules.mutex.Lock()
+		for _, s := range schedules.schedules {
+			s.LastTick = lastTick
+		}
+		schedules.mutex.Unlock()
+	}
+	setLastTick(base.Add(-4*time.Hour - 30*time.Minute))
+
+	runSchedules(base.Add(30 * time.Minute))
+	if counts := drainQueue("scheduletest", "ticks"); counts["all"] != 5 || counts["once"] != 1 || counts["skip"] != 0 {
+		t.Errorf("runSchedules after missed ticks: want 5 all, 1 once and 0 skip messages, got %v", counts)
+	}
+
+	//Ticks sent before a crash are not sent again while their deduplication ids are remembered
+	setLastTick(base.Add(-4*time.Hour - 30*time.Minute))
+	runSchedules(base.Add(30 * time.Minute))
+	if counts := drainQueue("scheduletest", "ticks"); len(counts) != 0 {
+		t.Errorf("runSchedules of the same ticks again: want no messages, got %v", counts)
+	}
+
+	if err := PauseSchedule("scheduletest", "once"); err != nil {
+		t.Fatal(err)
+	}
+	runSchedules(base.Add(time.Hour + 20*time.Second))
+	if counts := drainQueue("scheduletest", "ticks"); counts["all"] != 1 || counts["once"] != 0 || counts["skip"] != 1 {
+		t.Errorf("runSchedules on time: want 1 all, 0 once from the paused schedule and 1 skip messages, got %v", counts)
+	}
+
+	//The schedules are read back after a restart
+	schedules.mutex.Lock()
+	schedules.schedules = make(map[string]*schedule)
+	schedules.mutex.Unlock()
+	if err := RecoverSchedules(); err != nil {
+		t.Fatal(err)
+	}
+
+	list := ListSchedules("scheduletest")
+	if len(list) != 3 || list[0].Name != "all" || list[1].Name != "once" || list[2].Name != "skip" {
+		t.Fatalf("ListSchedules after recovery: want all, once and skip, got %+v", list)
+	}
+	if !list[0].LastTick.Equal(base.Add(time.Hour)) || list[0].Cron != "0 * * * *" || list[0].Timezone != "UTC" || list[0].Payload != "all" {
+		t.Errorf("ListSchedules after recovery: want the saved settings and last tick %s, got %+v", base.Add(time.Hour), list[0])
+	}
+	if !list[1].Paused || !list[0].NextTick.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("ListSchedules after recovery: want once paused and the next tick at %s, got %+v", base.Add(2*time.Hour), list)
+	}
+
+	//A resumed schedule skips the ticks while it was paused
+	if err := ResumeSchedule("scheduletest", "once"); err != nil {
+		t.Fatal(err)
+	}
+	runSchedules(base.Add(2*time.Hour + 10*time.Second))
+	if counts := drainQueue("scheduletest", "ticks"); counts["all"] != 1 || counts["once"] != 1 || counts["skip"] != 1 {
+		t.Errorf("runSchedules after resume: want one message of each schedule, got %v", counts)
+	}
+
+	if err := DeleteSchedule("scheduletest", "skip"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteSchedule("scheduletest", "skip"); !isQueueError(err, e.SCHEDULE_DOES_NOT_EXIST) {
+		t.Errorf("DeleteSchedule of a deleted schedule: want SCHEDULE_DOES_NOT_EXIST, got %v", err)
+	}
+	if err := PauseSchedule("scheduletest", "skip"); !isQueueError(err, e.SCHEDULE_DOES_NOT_EXIST) {
+		t.Errorf("PauseSchedule of a deleted schedule: want SCHEDULE_DOES_NOT_EXIST, got %v", err)
+	}
+
+	//Deleting the queue deletes its schedules
+	removeQueue("scheduletest", "ticks")
+	if list := ListSchedules("scheduletest"); len(list) != 0 {
+		t.Errorf("ListSchedules after the queue was deleted: want none, got %+v", list)
+	}
+}
@@ -0,0 +1,1112 @@
+/*
+Copyright 2021 Aravind Rao
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/adminpb"
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+	"github.com/coderagr/ezqueue-service/ezqueued/queuepb"
+	"github.com/coderagr/ezqueue-service/ezqueued/tracing"
+	u "github.com/coderagr/ezqueue-service/ezqueued/utilities"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+	ezgrpc "github.com/coderagr/ezqueuegrpc"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+var queueInfo = NewQueueWalInfo()
+
+//Restore Error is invoked if restoration of stored queues or messages fail
+type RestoreError struct {
+	Message string
+}
+
+func (e *RestoreError) Error() string {
+	return fmt.Sprintf("%v", e.Message)
+}
+
+var port = ":8989"
+
+var keyStore *auth.KeyStore
+
+var logger = logging.Default()
+
+//Main runs the daemon. It serves gRPC on the port given as the first argument, :8989 by default, and the
+//listeners turned on in the config file, and runs until SIGINT or SIGTERM
+func Main() {
+
+	if err := loadServiceConfig(configPath); err != nil {
+		logger.Fatal("Unable to read the config file", "path", configPath, "error", err)
+	}
+
+	if err := configureLogging(); err != nil {
+		logger.Fatal("Invalid logging settings", "path", configPath, "error", err)
+	}
+
+	if err := configureTracing(); err != nil {
+		logger.Fatal("Invalid tracing settings", "path", configPath, "error", err)
+	}
+
+	if err := configureVisibility(); err != nil {
+		logger.Fatal("Invalid visibility settings", "path", configPath, "error", err)
+	}
+
+	//Libraries that use the standard logger write structured records too
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer(logging.LevelInfo))
+
+	if len(os.Args) == 1 {
+		logger.Info("Using default port", "port", port)
+	} else {
+		port = os.Args[1]
+	}
+
+	//Turn on api key authentication if a keys file is configured
+	if len(serviceConfig.KeysFile) != 0 {
+		var err error
+		keyStore, err = auth.NewKeyStore(serviceConfig.KeysFile)
+		if err != nil {
+			logger.Fatal("Unable to load the keys file", "path", serviceConfig.KeysFile, "error", err)
+		}
+
+		//Reload the keys file on SIGHUP
+		go func() {
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+
+			for range hup {
+				if err := keyStore.Reload(); err != nil {
+					logger.Error("Unable to reload the keys file", "path", serviceConfig.KeysFile, "error", err)
+				}
+			}
+		}()
+	}
+
+	server := newGrpcServer()
+
+	//Listen before recovery so health checks report NOT_SERVING while the queues are restored
+	listen, err := net.Listen("tcp", port)
+	if err != nil {
+		logger.Error("Unable to listen for gRPC", "port", port, "error", err)
+		return
+	}
+
+	go func() {
+		if err := server.Serve(listen); err != nil {
+			logger.Error("gRPC server stopped", "error", err)
+		}
+	}()
+
+	//Start the container probes if they are configured
+	if len(serviceConfig.HealthPort) != 0 {
+		go func() {
+			logger.Info("Serving health checks", "address", serviceConfig.HealthPort, "paths", "/healthz,/readyz")
+			if err := http.ListenAndServe(serviceConfig.HealthPort, NewHealthHandler()); err != nil {
+				logger.Error("Health check endpoint stopped", "error", err)
+			}
+		}()
+	}
+
+	if err := recoverService(); err != nil {
+		//Stay up so the health checks can report the failure
+		logger.Error("Error restoring queues", "error", err)
+		waitForShutdown(server)
+		return
+	}
+
+	go serviceHealth.watchStorage(context.Background())
+	go runMaintenance(context.Background())
+
+	//Start the metrics endpoint if it is configured
+	if len(serviceConfig.MetricsPort) != 0 {
+		go func() {
+			logger.Info("Serving metrics", "address", serviceConfig.MetricsPort, "path", "/metrics")
+			if err := http.ListenAndServe(serviceConfig.MetricsPort, NewMetricsHandler()); err != nil {
+				logger.Error("Metrics endpoint stopped", "error", err)
+			}
+		}()
+	}
+
+	//Start the REST api if it is configured
+	if len(serviceConfig.HttpPort) != 0 {
+		go func() {
+			logger.Info("Serving the REST api", "address", serviceConfig.HttpPort)
+			if err := http.ListenAndServe(serviceConfig.HttpPort, NewHttpHandler()); err != nil {
+				logger.Error("REST api stopped", "error", err)
+			}
+		}()
+	}
+
+	//Start the SQS compatible endpoint if it is configured
+	if len(serviceConfig.SqsPort) != 0 {
+		go func() {
+			logger.Info("Serving the SQS endpoint", "address", serviceConfig.SqsPort)
+			if err := http.ListenAndServe(serviceConfig.SqsPort, NewSqsHandler(serviceConfig.SqsAppName)); err != nil {
+				logger.Error("SQS endpoint stopped", "error", err)
+			}
+		}()
+	}
+
+	//Start the Redis protocol listener if it is configured
+	if len(serviceConfig.RespPort) != 0 {
+		go func() {
+			respListen, err := net.Listen("tcp", serviceConfig.RespPort)
+			if err != nil {
+				logger.Error("Unable to start the Redis protocol listener", "address", serviceConfig.RespPort, "error", err)
+				return
+			}
+
+			logger.Info("Serving the Redis protocol", "address", serviceConfig.RespPort)
+			if err := ServeResp(respListen); err != nil {
+				logger.Error("Redis protocol listener stopped", "error", err)
+			}
+		}()
+	}
+
+	//Start the STOMP listeners if they are configured
+	if len(serviceConfig.StompPort) != 0 {
+		go func() {
+			stompListen, err := net.Listen("tcp", serviceConfig.StompPort)
+			if err != nil {
+				logger.Error("Unable to start the STOMP listener", "address", serviceConfig.StompPort, "error", err)
+				return
+			}
+
+			logger.Info("Serving STOMP", "address", serviceConfig.StompPort)
+			if err := ServeStomp(stompListen); err != nil {
+				logger.Error("STOMP listener stopped", "error", err)
+			}
+		}()
+	}
+
+	if len(serviceConfig.StompWsPort) != 0 {
+		go func() {
+			logger.Info("Serving STOMP over WebSocket", "address", serviceConfig.StompWsPort)
+			if err := http.ListenAndServe(serviceConfig.StompWsPort, NewStompWebSocketHandler()); err != nil {
+				logger.Error("STOMP WebSocket listener stopped", "error", err)
+			}
+		}()
+	}
+
+	logger.Info("EzQueueService is ready", "port", port)
+	waitForShutdown(server)
+}
+
+//newGrpcServer makes the gRPC server with every service registered. Authentication is on when keyStore is set
+func newGrpcServer() *grpc.Server {
+
+	//Every call is counted and traced, including the ones authentication turns away.
+	//Calls other than health checks are turned away until the queues are recovered
+	unaryInterceptors := []grpc.UnaryServerInterceptor{tracingUnaryInterceptor, metricsUnaryInterceptor, loggingUnaryInterceptor, readinessUnaryInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{metricsStreamInterceptor}
+
+	if keyStore != nil {
+		unaryInterceptors = append(unaryInterceptors, keyStore.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, keyStore.StreamServerInterceptor())
+	}
+
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(unaryInterceptors...), grpc.ChainStreamInterceptor(streamInterceptors...))
+	var ezqueuedServer EzqueuedServer
+	ezgrpc.RegisterEzqueuedServer(server, ezqueuedServer)
+	queuepb.RegisterEzqueueQueuesServer(server, EzqueueQueuesServer{})
+	adminpb.RegisterEzqueueAdminServer(server, EzqueueAdminServer{})
+	healthpb.RegisterHealthServer(server, serviceHealth.grpcHealth)
+
+	reflection.Register(server)
+
+	return server
+}
+
+//recoverService restores the queues from the logs directory and marks the service ready, or not live if it failed
+func recoverService() error {
+
+	logger.Info("Restoring queues from storage")
+
+	recoveryStart := time.Now()
+	if err := RecoverQueues(); err != nil {
+		serviceHealth.recovered(err)
+		return err
+	}
+	if err := RecoverSchedules(); err != nil {
+		serviceHealth.recovered(err)
+		return err
+	}
+	recoveryDuration.Set(time.Since(recoveryStart).Seconds())
+	serviceHealth.recovered(nil)
+
+	return nil
+}
+
+//runMaintenance periodically saves the wal and control files, returns messages with an expired lease
+//to their queue, delivers scheduled messages, expires messages and runs the schedules until ctx is done
+func runMaintenance(ctx context.Context) {
+
+	flush := time.NewTicker(20 * time.Second)
+	defer flush.Stop()
+
+	requeue := time.NewTicker(time.Second)
+	defer requeue.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-flush.C:
+			logger.Debug("Saving files to disk")
+			flushQueues()
+			logger.Debug("Finished saving files to disk")
+
+		case <-requeue.C:
+			for _, walInfo := range queueInfo.Iter() {
+				walInfo.RequeueExpired(time.Now())
+				walInfo.DeliverScheduled(time.Now())
+			}
+			expireQueues(time.Now())
+			runSchedules(time.Now())
+		}
+	}
+}
+
+//expireQueues removes the messages whose retention period or time to live ended by now. They are moved to the
+//dead-letter queue of their queue if it has one, else dropped. Messages stay while their dead-letter queue is missing
+func expireQueues(now time.Time) {
+
+	for _, walInfo := range queueInfo.Iter() {
+		metaData := walInfo.Control().MetaData
+
+		var moveTo func(m *q.Message) error
+		if len(metaData.DeadLetterQueue) != 0 {
+			moveTo = func(m *q.Message) error {
+
+				dlq, ok := queueInfo.Get(metaData.AppName + metaData.DeadLetterQueue)
+				if !ok {
+					return &e.Error{AppName: metaData.AppName, Name: metaData.DeadLetterQueue, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+				}
+
+				opts := wal.MessageOptions{GroupId: m.GroupId}
+				if !dlq.Queue.FifoQueue {
+					opts.Priority = m.Priority
+				}
+
+				_, err := dlq.AppendWithOptions(m.Value, m.Attributes, opts)
+				return err
+			}
+		}
+
+		count, err := walInfo.ExpireMessages(now, moveTo)
+		if count != 0 {
+			messagesExpired.Add(float64(count), metaData.AppName, metaData.Name)
+		}
+		if err != nil {
+			logger.Warn("Unable to expire messages", "app", metaData.AppName, "queue", metaData.Name, "dead_letter_queue", metaData.DeadLetterQueue, "error", err)
+		}
+	}
+}
+
+//flushQueues syncs the wal files of every queue and saves the control files that changed
+func flushQueues() {
+
+	//The wal file first, so a saved control file does not point past what is on disk
+	for _, walInfo := range queueInfo.Iter() {
+		walInfo.FlushWalFile()
+		walInfo.FlushControlFile()
+	}
+}
+
+//waitForShutdown blocks until SIGINT or SIGTERM. It then reports NOT_SERVING, lets the gRPC calls
+//in progress finish and syncs the queue files
+func waitForShutdown(server *grpc.Server) {
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-stop
+	logger.Info("Shutting down", "signal", sig.String())
+
+	serviceHealth.shutdown()
+	server.GracefulStop()
+
+	flushQueues()
+
+	tracing.Shutdown()
+
+	logger.Info("EzQueueService stopped")
+}
+
+//QueueOptions are the settings of a new queue
+type QueueOptions struct {
+	DelaySeconds      uint16
+	VisibilityTimeout uint16
+	Priority          bool //hand out the messages with the highest priority first instead of in the order they were added
+
+	RetentionSeconds uint32 //messages expire this long after they were added, 0 to keep them until they are consumed
+	DeadLetterQueue  string //existing queue of the same app expired messages are moved to, empty to drop them
+}
+
+//EnqueueOptions are the settings of a message that is added to a queue
+type EnqueueOptions struct {
+	Priority uint8  //0 to queue.MaxPriority, only priority queues take a priority above 0
+	GroupId  string //messages of a group are received one at a time in order, other groups are received in parallel
+
+	//A message with a deduplication id that was sent within the dedup window is not added again,
+	//EnQueueWithOptions returns the id of the first message
+	DeduplicationId string
+
+	TtlSeconds uint32    //the message expires this long after it was added, or at the end of the queue's retention period if that is sooner
+	DeliverAt  time.Time //the message stays hidden until then, at most queue.MaxScheduleSeconds ahead. Zero to deliver it right away
+}
+
+//queueTimeouts checks the delay and visibility timeout of a create request before they are narrowed to uint16,
+//so a value above 65535 is refused instead of wrapping around to a small one
+func queueTimeouts(appName, name string, delaySeconds, visibilityTimeout uint32) (uint16, uint16, error) {
+
+	if delaySeconds > q.MaxDelaySeconds {
+		msg := fmt.Sprintf("delay must be at most %d seconds", q.MaxDelaySeconds)
+		return 0, 0, &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: msg}
+	}
+
+	if visibilityTimeout > uint32(maxVisibilityTimeout()) {
+		msg := fmt.Sprintf("visibility timeout must be at most %d seconds", maxVisibilityTimeout())
+		return 0, 0, &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: msg}
+	}
+
+	return uint16(delaySeconds), uint16(visibilityTimeout), nil
+}
+
+//Create creates a new queue in the system and saves is in leveldb
+func Create(appName, name string, delaySeconds, visibilityTimeout uint16) error {
+	return CreateQueue(appName, name, QueueOptions{DelaySeconds: delaySeconds, VisibilityTimeout: visibilityTimeout})
+}
+
+//CreateQueue is Create for a queue with options, Ex: a priority queue
+func CreateQueue(appName, name string, opts QueueOptions) error {
+
+	delaySeconds, visibilityTimeout := opts.DelaySeconds, opts.VisibilityTimeout
+
+	//Check for input data validity
+	verr := u.IsValidCreateQueueInput(appName, name, &delaySeconds, &visibilityTimeout, maxVisibilityTimeout())
+	if verr != nil {
+		logger.Debug("Invalid create request", "app", appName, "queue", name, "error", verr)
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: verr.Error()}
+	}
+
+	if err := validateExpiry(appName, name, opts); err != nil {
+		return err
+	}
+
+	//Hold the appname+QueName combo so two clients cannot create the same queue
+	if !queueInfo.Reserve(appName + name) {
+		logger.Debug("Queue already exists", "app", appName, "queue", name)
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.ALREADY_EXISTS, ErrorMessage: e.ErrorAppQuenameExists}
+	}
+
+	walInfo, err := wal.CreateQueue(wal.QueueMetaData{AppName: appName, Name: name, DelaySeconds: delaySeconds,
+		VisibilityTimeout: visibilityTimeout, Priority: opts.Priority, RetentionSeconds: opts.RetentionSeconds, DeadLetterQueue: opts.DeadLetterQueue})
+
+	if err != nil {
+		queueInfo.Release(appName + name)
+		logger.Error("Failed to create the wal files", "app", appName, "queue", name, "error", err)
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.WAL_FILE_FAILED_TO_CREATE, ErrorMessage: err.Error()}
+	}
+
+	queueInfo.Set(appName+name, walInfo)
+
+	return nil
+}
+
+//validateExpiry checks the retention period and the dead-letter queue of a new queue
+func validateExpiry(appName, name string, opts QueueOptions) error {
+
+	if opts.RetentionSeconds > q.MaxRetentionSeconds {
+		msg := fmt.Sprintf("retention period must be at most %d seconds", q.MaxRetentionSeconds)
+		logger.Debug("Invalid create request", "app", appName, "queue", name, "retention_seconds", opts.RetentionSeconds)
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: msg}
+	}
+
+	if len(opts.DeadLetterQueue) == 0 {
+		return nil
+	}
+
+	if opts.DeadLetterQueue == name {
+		logger.Debug("Invalid create request", "app", appName, "queue", name, "dead_letter_queue", opts.DeadLetterQueue)
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: "a queue cannot be its own dead-letter queue"}
+	}
+	if _, ok := queueInfo.Get(appName + opts.DeadLetterQueue); !ok {
+		msg := fmt.Sprintf("dead-letter queue %s does not exist", opts.DeadLetterQueue)
+		logger.Debug("Invalid create request", "app", appName, "queue", name, "dead_letter_queue", opts.DeadLetterQueue)
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: msg}
+	}
+
+	return nil
+}
+
+//EnQueue adds an items to the head and returns the message id
+func EnQueue(appName, name, msg string) (string, error) {
+	return EnQueueContext(context.Background(), appName, name, msg)
+}
+
+//EnQueueContext is EnQueue that stores the trace context of ctx with the message,
+//so the consumer that dequeues it can link its span to the producer
+func EnQueueContext(ctx context.Context, appName, name, msg string) (id string, err error) {
+	return EnQueueWithOptions(ctx, appName, name, msg, EnqueueOptions{})
+}
+
+//EnQueueWithOptions is EnQueueContext for a message with options, Ex: its priority
+func EnQueueWithOptions(ctx context.Context, appName, name, msg string, opts EnqueueOptions) (id string, err error) {
+
+	_, span := tracing.Start(ctx, "wal.append", tracing.KindInternal)
+	defer func() {
+		span.SetAttributes("app", appName, "queue", name, "message_id", id)
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	fullQueueName := appName + name
+
+	//Make sure input data is valid
+	if err := u.IsValidMessageInput(appName, name, msg); err != nil {
+		logger.Debug("Invalid message", "app", appName, "queue", name, "error", err)
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: err.Error()}
+	}
+
+	//Check if the queue exists
+	walInfo, ok := queueInfo.Get(fullQueueName)
+	if !ok {
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	//The queue type never changes, so it is read without the queue lock
+	if opts.Priority > q.MaxPriority || (opts.Priority != 0 && walInfo.Queue.FifoQueue) {
+		msg := fmt.Sprintf("priority must be 0 to %d on a priority queue and 0 on other queues", q.MaxPriority)
+		logger.Debug("Invalid message", "app", appName, "queue", name, "priority", opts.Priority)
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: msg}
+	}
+	if len(opts.GroupId) > q.MaxGroupIdLength || len(opts.DeduplicationId) > q.MaxGroupIdLength {
+		msg := fmt.Sprintf("group and deduplication ids must be at most %d bytes", q.MaxGroupIdLength)
+		logger.Debug("Invalid message", "app", appName, "queue", name, "group_id_length", len(opts.GroupId), "deduplication_id_length", len(opts.DeduplicationId))
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: msg}
+	}
+
+	if opts.TtlSeconds > q.MaxRetentionSeconds {
+		msg := fmt.Sprintf("time to live must be at most %d seconds", q.MaxRetentionSeconds)
+		logger.Debug("Invalid message", "app", appName, "queue", name, "ttl_seconds", opts.TtlSeconds)
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: msg}
+	}
+
+	if err := validateDeliverAt(walInfo, opts); err != nil {
+		logger.Debug("Invalid message", "app", appName, "queue", name, "deliver_at", opts.DeliverAt, "error", err)
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: err.Error()}
+	}
+
+	walOpts := wal.MessageOptions{Priority: opts.Priority, GroupId: opts.GroupId, DeduplicationId: opts.DeduplicationId, DeliverAt: opts.DeliverAt}
+	if opts.TtlSeconds != 0 {
+		walOpts.ExpiresAt = time.Now().Add(time.Duration(opts.TtlSeconds) * time.Second)
+	}
+
+	//Append to the WAL file
+	id, err = walInfo.AppendWithOptions(msg, traceAttributes(ctx), walOpts)
+	if err != nil {
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.WAL_FILE_APPEND_FAILED, ErrorMessage: err.Error()}
+	}
+
+	messagesEnqueued.Inc(appName, name)
+
+	return id, nil
+}
+
+//validateDeliverAt checks that a scheduled message is delivered within queue.MaxScheduleSeconds and before it expires
+func validateDeliverAt(walInfo *wal.QueueInfo, opts EnqueueOptions) error {
+
+	if opts.DeliverAt.IsZero() {
+		return nil
+	}
+
+	delay := time.Until(opts.DeliverAt)
+	if delay > q.MaxScheduleSeconds*time.Second {
+		return fmt.Errorf("delivery time must be at most %d seconds ahead", q.MaxScheduleSeconds)
+	}
+
+	//The retention period is read without the queue lock, it never changes
+	lifetime := time.Duration(opts.TtlSeconds) * time.Second
+	if retention := time.Duration(walInfo.WalControlInfo.MetaData.RetentionSeconds) * time.Second; retention != 0 && (lifetime == 0 || retention < lifetime) {
+		lifetime = retention
+	}
+	if lifetime != 0 && delay >= lifetime {
+		return fmt.Errorf("delivery time must be before the message expires in %s", lifetime)
+	}
+
+	return nil
+}
+
+//DeQueue removes the queue item at the tail
+func DeQueue(appName, name string) (value string, err error) {
+
+	m, err := DeQueueContext(context.Background(), appName, name)
+	if err != nil {
+		return "", err
+	}
+
+	return m.Value, nil
+}
+
+//DeQueueContext is DeQueue that returns the whole message, including the trace context stored with it
+func DeQueueContext(ctx context.Context, appName, name string) (m *q.Message, err error) {
+
+	//Long polls read an empty queue over and over, those reads are left out of the trace
+	_, span := tracing.Start(ctx, "wal.move_head", tracing.KindInternal)
+	defer func() {
+		if isQueueError(err, e.QUEUE_EMPTY) {
+			return
+		}
+		span.SetAttributes("app", appName, "queue", name)
+		if m != nil {
+			span.SetAttributes("message_id", m.Id())
+			span.AddLink(messageSpanContext(m.Attributes))
+		}
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	fullQueueName := appName + name
+
+	appQueue, ok := queueInfo.Get(fullQueueName)
+
+	//Check if the Queue exists
+	if !ok {
+		return nil, &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	//MoveHead returns QUEUE_EMPTY when the queue is empty
+	m, err = appQueue.MoveHead()
+
+	if err != nil {
+		return nil, err
+	}
+
+	messagesDequeued.Inc(appName, name)
+
+	//return the head
+	return m, nil
+}
+
+//DeQueueWait is DeQueueContext that waits up to wait for a message when the queue is empty
+func DeQueueWait(ctx context.Context, appName, name string, wait time.Duration) (m *q.Message, err error) {
+
+	err = waitForMessage(ctx, appName, name, wait, func() error {
+		m, err = DeQueueContext(ctx, appName, name)
+		return err
+	})
+
+	return m, err
+}
+
+//waitForMessage calls read until it finds a message, the wait runs out or ctx is done
+func waitForMessage(ctx context.Context, appName, name string, wait time.Duration, read func() error) error {
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		appQueue, ok := queueInfo.Get(appName + name)
+		if !ok {
+			return &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+		}
+
+		//Get the signal before checking the queue so an append in between is not missed
+		added := appQueue.MessageAdded()
+
+		err := read()
+		if qErr, ok := err.(*e.Error); !ok || qErr.ErrorCode != e.QUEUE_EMPTY || wait == 0 {
+			return err
+		}
+
+		select {
+		case <-added:
+		case <-timer.C:
+			return err
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+//Receive hands out the message at the head of the queue with a lease. The message is hidden from other
+//consumers for visibilityTimeout and comes back unless it is deleted with the receipt before then
+func Receive(appName, name string, visibilityTimeout time.Duration) (wal.ReceivedMessage, error) {
+	return ReceiveContext(context.Background(), appName, name, visibilityTimeout)
+}
+
+//ReceiveContext is Receive with a span in the trace of ctx that links to the producer of the message
+func ReceiveContext(ctx context.Context, appName, name string, visibilityTimeout time.Duration) (msg wal.ReceivedMessage, err error) {
+
+	_, span := tracing.Start(ctx, "wal.receive", tracing.KindInternal)
+	defer func() {
+		if isQueueError(err, e.QUEUE_EMPTY) {
+			return
+		}
+		span.SetAttributes("app", appName, "queue", name)
+		if err == nil {
+			span.SetAttributes("message_id", msg.Id, "receive_count", msg.ReceiveCount)
+			span.AddLink(messageSpanContext(msg.Attributes))
+		}
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	appQueue, ok := queueInfo.Get(appName + name)
+	if !ok {
+		return wal.ReceivedMessage{}, &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	if visibilityTimeout < 0 || visibilityTimeout > time.Duration(maxVisibilityTimeout())*time.Second {
+		return wal.ReceivedMessage{}, &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: e.ErrorInvalidInput}
+	}
+
+	msg, ok = appQueue.Receive(visibilityTimeout)
+	if !ok {
+		return msg, &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_EMPTY, ErrorMessage: e.ErrorQueueEmpty}
+	}
+
+	messagesReceived.Inc(appName, name)
+
+	return msg, nil
+}
+
+//ReceiveWait is Receive that waits up to wait for a message when the queue is empty
+func ReceiveWait(ctx context.Context, appName, name string, visibilityTimeout, wait time.Duration) (msg wal.ReceivedMessage, err error) {
+
+	err = waitForMessage(ctx, appName, name, wait, func() error {
+		msg, err = ReceiveContext(ctx, appName, name, visibilityTimeout)
+		return err
+	})
+
+	return msg, err
+}
+
+//DeleteMessage removes a received message from the queue for good
+func DeleteMessage(appName, name, receipt string) error {
+	return DeleteMessageContext(context.Background(), appName, name, receipt)
+}
+
+//DeleteMessageContext is DeleteMessage with a span in the trace of ctx
+func DeleteMessageContext(ctx context.Context, appName, name, receipt string) (err error) {
+
+	_, span := tracing.Start(ctx, "wal.delete", tracing.KindInternal)
+	defer func() {
+		span.SetAttributes("app", appName, "queue", name)
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	appQueue, ok := queueInfo.Get(appName + name)
+	if !ok {
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	if err := appQueue.DeleteMessage(receipt); err != nil {
+		if _, ok := err.(*e.Error); ok {
+			return err
+		}
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.WAL_FILE_APPEND_FAILED, ErrorMessage: err.Error()}
+	}
+
+	messagesAcked.Inc(appName, name)
+
+	return nil
+}
+
+//ChangeVisibility changes how long a received message stays hidden, counting from now
+func ChangeVisibility(appName, name, receipt string, visibilityTimeout time.Duration) error {
+
+	appQueue, ok := queueInfo.Get(appName + name)
+	if !ok {
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	if visibilityTimeout < 0 || visibilityTimeout > time.Duration(maxVisibilityTimeout())*time.Second {
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: e.ErrorInvalidInput}
+	}
+
+	return appQueue.ChangeVisibility(receipt, visibilityTimeout)
+}
+
+/*
+	ChangeVisibilityBatch is ChangeVisibility for many receipts of a queue. It returns the error of each change in the
+	order of changes, nil where it succeeded, so a stale receipt does not fail the rest of the batch.
+	err is only set when the queue does not exist
+*/
+func ChangeVisibilityBatch(appName, name string, changes []wal.VisibilityChange) (errs []error, err error) {
+
+	appQueue, ok := queueInfo.Get(appName + name)
+	if !ok {
+		return nil, &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	errs = make([]error, len(changes))
+	valid := make([]wal.VisibilityChange, 0, len(changes))
+	positions := make([]int, 0, len(changes))
+
+	for i, c := range changes {
+		if c.Visibility < 0 || c.Visibility > time.Duration(maxVisibilityTimeout())*time.Second {
+			errs[i] = &e.Error{AppName: appName, Name: name, ErrorCode: e.INVALID_INPUT, ErrorMessage: e.ErrorInvalidInput}
+			continue
+		}
+		valid = append(valid, c)
+		positions = append(positions, i)
+	}
+
+	for i, err := range appQueue.ChangeVisibilityBatch(valid) {
+		errs[positions[i]] = err
+	}
+
+	return errs, nil
+}
+
+//Purge deletes every message in the queue
+func Purge(appName, name string) error {
+
+	appQueue, ok := queueInfo.Get(appName + name)
+	if !ok {
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	if err := appQueue.Purge(); err != nil {
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.WAL_CONTROL_SAVE_FAILED, ErrorMessage: err.Error()}
+	}
+
+	return nil
+}
+
+//DeleteQueue removes the queue and its files
+func DeleteQueue(appName, name string) error {
+
+	appQueue, ok := queueInfo.Delete(appName + name)
+	if !ok {
+		return &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	if err := appQueue.Remove(); err != nil {
+		logger.Error("Unable to remove the queue files", "app", appName, "queue", name, "error", err)
+	}
+
+	deleteQueueMetrics(appName, name)
+	deleteQueueSchedules(appName, name)
+
+	return nil
+}
+
+//QueueStats is a point in time view of a queue
+type QueueStats struct {
+	MetaData wal.QueueMetaData
+	Visible  int //messages waiting to be received
+	InFlight int //messages received and not deleted yet
+	Delayed  int //messages scheduled for a later delivery
+}
+
+func GetQueueStats(appName, name string) (QueueStats, error) {
+
+	appQueue, ok := queueInfo.Get(appName + name)
+	if !ok {
+		return QueueStats{}, &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	visible, inFlight, delayed := appQueue.Counts()
+
+	return QueueStats{appQueue.Control().MetaData, visible, inFlight, delayed}, nil
+}
+
+func Peek(appName, name string) (value string, err error) {
+
+	fullQueueName := appName + name
+
+	appQueue, ok := queueInfo.Get(fullQueueName)
+
+	//Check if the Queue exists
+	if !ok {
+		return "", &e.Error{AppName: appName, Name: name, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	//Peek returns QUEUE_EMPTY when the queue is empty
+	msg, err := appQueue.Peek()
+
+	if err != nil {
+		return "", err
+	}
+
+	//return the head
+	return msg, nil
+}
+
+func RecoverQueues() error {
+
+	recoveryStart := time.Now()
+
+	files, err := os.ReadDir(wal.Config.Logspath)
+	if err != nil {
+		logger.Error("Unable to read the logs directory", "path", wal.Config.Logspath, "error", err)
+		return err
+	}
+
+	comRegex, cerr := regexp.Compile(".control$")
+	if cerr != nil {
+		return cerr
+	}
+
+	if len(files) == 0 {
+		logger.Info("No control files found. Nothing to recover")
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var statsMutex sync.Mutex
+	var stats []QueueRecovery
+
+	for _, file := range files {
+
+		if file.IsDir() {
+			continue
+		}
+
+		loc := comRegex.FindStringIndex(file.Name())
+		if loc == nil {
+			continue
+		}
+
+		filePath := path.Join(wal.Config.Logspath, file.Name())
+
+		wg.Add(1)
+		go func(filePath string) {
+
+			defer wg.Done()
+
+			queueStats, err := recoverQueue(filePath)
+			if err != nil {
+				logger.Error("Unable to recover queue", "app", queueStats.AppName, "queue", queueStats.QueueName, "path", filePath, "error", err)
+				queueStats.Error = err.Error()
+
+				//The control file is named after the registry key. Holding the key keeps Create from
+				//making a new queue over the files that were not recovered
+				queueInfo.Reserve(strings.TrimSuffix(path.Base(filePath), wal.ControlFileExtn))
+			}
+
+			statsMutex.Lock()
+			stats = append(stats, queueStats)
+			statsMutex.Unlock()
+
+		}(filePath)
+
+	}
+
+	//Wait for all the go routines to be finished
+	wg.Wait()
+
+	setRecoveryStats(recoveryStart, stats)
+
+	recoveryErr := &RecoveryError{}
+	for _, queueStats := range stats {
+		if len(queueStats.Error) != 0 {
+			recoveryErr.Failed = append(recoveryErr.Failed, queueStats)
+		}
+	}
+	if len(recoveryErr.Failed) != 0 {
+		return recoveryErr
+	}
+
+	return nil
+}
+
+//RecoveryError lists the queues RecoverQueues could not recover. The queues that were recovered are served
+type RecoveryError struct {
+	Failed []QueueRecovery
+}
+
+func (r *RecoveryError) Error() string {
+
+	failed := make([]string, 0, len(r.Failed))
+	for _, queueStats := range r.Failed {
+		failed = append(failed, queueStats.AppName+"/"+queueStats.QueueName+": "+queueStats.Error)
+	}
+	sort.Strings(failed)
+
+	return fmt.Sprintf("unable to recover %d queues: %s", len(r.Failed), strings.Join(failed, "; "))
+}
+
+//recoverQueue reads the control file and the wal files of a queue and adds the messages that are still live to a new queue
+func recoverQueue(filePath string) (QueueRecovery, error) {
+
+	stats := QueueRecovery{}
+
+	//Open the control file
+	w, ferr := os.ReadFile(filePath)
+	if ferr != nil {
+		return stats, ferr
+	}
+
+	//Read the contents of the control file into the structure
+	//The control file has the latest info just before the app was terminated
+	walControl := new(wal.WalControl)
+	if err := json.Unmarshal(w, walControl); err != nil {
+		return stats, fmt.Errorf("unable to read the control file %s: %v", path.Base(filePath), err)
+	}
+
+	stats.AppName, stats.QueueName = walControl.MetaData.AppName, walControl.MetaData.Name
+
+	//After a crash the wal can go on past the control file, or end before it
+	recovered, changes, err := wal.RecoverTail(wal.Config.Logspath, *walControl)
+	if err != nil {
+		return stats, err
+	}
+	if len(changes) != 0 {
+		logger.Warn("Control file does not match the end of the wal", "app", walControl.MetaData.AppName, "queue", walControl.MetaData.Name, "changes", changes)
+	}
+	*walControl = recovered
+
+	walInfo := new(wal.QueueInfo)
+	walInfo.WalControlInfo = walControl
+
+	wcInfo := walInfo.WalControlInfo
+	fullQueueName := walControl.MetaData.AppName + walControl.MetaData.Name
+
+	walInfo.Queue = walControl.MetaData.NewQueue()
+
+	//Open the walcontrol file
+	walCtrlFilePtr, cerr := wal.FS.OpenFile(filePath, os.O_RDWR, 0664)
+	if cerr != nil {
+		return stats, cerr
+	}
+	walInfo.WalControlFile = walCtrlFilePtr
+
+	//Messages are added once the whole wal is read, leaving out the ones with a delete record
+	var messages []*q.Message
+	deleted := make(map[string]bool)
+
+	//All WAL files but the first are read from lsn 0. Files before the head are read for their deduplication ids only
+	firstFileNum, startLsn := wcInfo.FirstFileNum(), wcInfo.HeadLsn
+	if firstFileNum != wcInfo.HeadLsnFileNum || wcInfo.DedupFileNum == wcInfo.HeadLsnFileNum {
+		startLsn = 0
+	}
+	headFileNum, headLsn := wcInfo.HeadLsnFileNum, wcInfo.HeadLsn
+
+	//Set again by RecoverDedupId for the ids that are still in their window
+	wcInfo.DedupFileNum = 0
+
+	for walFileNum := firstFileNum; walFileNum <= wcInfo.TailLsnFileNum; walFileNum++ {
+
+		walFilePath := path.Join(wal.Config.Logspath, walInfo.LogFileName(walFileNum))
+
+		//Dedup ids are lost with a file before the head that was removed by hand, the messages are not
+		if _, err := os.Stat(walFilePath); walFileNum < headFileNum && os.IsNotExist(err) {
+			logger.Warn("Wal file with deduplication ids is missing", "app", wcInfo.MetaData.AppName, "queue", wcInfo.MetaData.Name, "path", walFilePath)
+			startLsn = 0
+			continue
+		}
+
+		logger.Debug("Reading messages", "app", wcInfo.MetaData.AppName, "queue", wcInfo.MetaData.Name, "path", walFilePath)
+
+		read, err := wal.ReadItems(walFilePath, startLsn, func(item wal.WalItem) bool {
+
+			stats.Records++
+
+			switch item.ItemType {
+			case wal.ENQUEUE, wal.ENQUEUE_ATTRS, wal.ENQUEUE_OPTIONS:
+				body, attributes, derr := wal.DecodeMessage(item)
+				if derr != nil {
+					logger.Error("Skipping a message that cannot be read", "app", wcInfo.MetaData.AppName, "queue", wcInfo.MetaData.Name, "error", derr)
+					return true
+				}
+				opts, derr := wal.DecodeOptions(item)
+				if derr != nil {
+					logger.Error("Skipping a message that cannot be read", "app", wcInfo.MetaData.AppName, "queue", wcInfo.MetaData.Name, "error", derr)
+					return true
+				}
+				if len(opts.DeduplicationId) != 0 {
+					walInfo.RecoverDedupId(opts.DeduplicationId, item.Id(), item.WalFileNum, opts.EnqueuedAt)
+				}
+
+				//Messages before the head were consumed
+				if item.WalFileNum < headFileNum || (item.WalFileNum == headFileNum && item.Lsn < headLsn) {
+					return true
+				}
+				messages = append(messages, &q.Message{Value: body, Attributes: attributes, WalFileNum: item.WalFileNum, Lsn: item.Lsn, Priority: opts.Priority,
+					GroupId: opts.GroupId, EnqueuedAt: opts.EnqueuedAt, ExpiresAt: opts.ExpiresAt, DeliverAt: opts.DeliverAt})
+
+			case wal.DELETE, wal.EXPIRE:
+				if id, ok := wal.DeletedId(item); ok {
+					deleted[id] = true
+				}
+			}
+
+			return true
+		})
+
+		stats.BytesRead += read
+		if err != nil {
+			return stats, err
+		}
+
+		startLsn = 0
+	}
+
+	//New items are appended to the tail file
+	wf, werr := wal.FS.OpenFile(path.Join(wal.Config.Logspath, walInfo.LogFileName(wcInfo.TailLsnFileNum)), os.O_APPEND|os.O_RDWR, 0664)
+	if werr != nil {
+		return stats, werr
+	}
+	walInfo.WalFile = wf
+
+	//Add the messages to the queue in the order they were written.
+	//The wal only keeps the enqueue time of some messages, the ages of the others start over at recovery
+	recoveredAt := time.Now()
+	for _, m := range messages {
+		if !deleted[m.Id()] {
+			if m.EnqueuedAt.IsZero() {
+				m.EnqueuedAt = recoveredAt
+			}
+			walInfo.RecoverMessage(m)
+			stats.Messages++
+		}
+	}
+
+	//The queue is only served once it is complete
+	queueInfo.Set(fullQueueName, walInfo)
+
+	logger.Info("Recovered queue", "app", wcInfo.MetaData.AppName, "queue", wcInfo.MetaData.Name, "messages", stats.Messages)
+
+	return stats, nil
+}
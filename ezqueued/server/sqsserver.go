@@ -0,0 +1,949 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+/*
+	Amazon SQS compatible endpoint so services that use the AWS SDK can run against ezqueued in CI.
+	Both the JSON protocol (X-Amz-Target header) and the older query protocol (Action parameter) are served.
+
+	Queue urls have the form http://{host}/{app}/{queue}. CreateQueue puts new queues under the configured
+	sqs app name, GetQueueUrl looks in QueueOwnerAWSAccountId when it is set.
+
+	MessageGroupId of SendMessage is kept with the message: messages of a group are received one at a time in order.
+	A MessageDeduplicationId that was sent within the dedup window returns the first message instead of adding it again.
+	The MessageRetentionPeriod attribute of CreateQueue sets the retention period, expired messages are dropped.
+	Per message DelaySeconds schedules the message for delivery that many seconds later.
+	The DelaySeconds attribute of CreateQueue is kept with the queue and must be at most 30 seconds, it does not delay messages yet.
+	Not supported: message attributes and content based deduplication.
+	When authentication is on, the AWS access key id is used as the api key. Signatures are not checked
+*/
+
+const (
+	sqsXmlns           = "http://queue.amazonaws.com/doc/2012-11-05/"
+	sqsMaxBatch        = 10
+	sqsMaxWaitSeconds  = 20
+	sqsMaxDelaySeconds = 900
+	sqsJsonTarget      = "AmazonSQS."
+)
+
+var sqsQueueNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,80}(\.fifo)?$`)
+
+//sqsRequest has the parameters of every supported action. JSON requests decode straight into it,
+//query requests are mapped onto it by decodeQueryRequest
+type sqsRequest struct {
+	QueueName                   string
+	QueueUrl                    string
+	QueueOwnerAWSAccountId      string
+	Attributes                  map[string]string
+	AttributeNames              []string
+	MessageSystemAttributeNames []string
+	MessageBody                 string
+	MessageGroupId              string
+	MessageDeduplicationId      string
+	DelaySeconds                *int
+	MaxNumberOfMessages         *int
+	WaitTimeSeconds             *int
+	VisibilityTimeout           *int
+	ReceiptHandle               string
+	Entries                     []sqsBatchEntry
+}
+
+type sqsBatchEntry struct {
+	Id                     string
+	MessageBody            string
+	MessageGroupId         string
+	MessageDeduplicationId string
+	DelaySeconds           *int
+	ReceiptHandle          string
+	VisibilityTimeout      *int
+}
+
+//sqsAttributes is a JSON object in the JSON protocol and a list of Attribute elements in the query protocol
+type sqsAttributes map[string]string
+
+func (a sqsAttributes) sortedNames() []string {
+
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (a sqsAttributes) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+
+	for _, name := range a.sortedNames() {
+		attr := struct {
+			Name  string
+			Value string
+		}{name, a[name]}
+
+		if err := enc.EncodeElement(attr, start); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type sqsQueueUrlResult struct {
+	QueueUrl string
+}
+
+type sqsSendMessageResult struct {
+	MessageId        string
+	MD5OfMessageBody string
+}
+
+type sqsBatchResultEntry struct {
+	Id               string
+	MessageId        string `json:",omitempty" xml:",omitempty"`
+	MD5OfMessageBody string `json:",omitempty" xml:",omitempty"`
+}
+
+type sqsBatchErrorEntry struct {
+	Id          string
+	SenderFault bool
+	Code        string
+	Message     string
+}
+
+type sqsSendMessageBatchResult struct {
+	Successful []sqsBatchResultEntry `xml:"SendMessageBatchResultEntry"`
+	Failed     []sqsBatchErrorEntry  `xml:"BatchResultErrorEntry"`
+}
+
+type sqsDeleteMessageBatchResult struct {
+	Successful []sqsBatchResultEntry `xml:"DeleteMessageBatchResultEntry"`
+	Failed     []sqsBatchErrorEntry  `xml:"BatchResultErrorEntry"`
+}
+
+type sqsChangeMessageVisibilityBatchResult struct {
+	Successful []sqsBatchResultEntry `xml:"ChangeMessageVisibilityBatchResultEntry"`
+	Failed     []sqsBatchErrorEntry  `xml:"BatchResultErrorEntry"`
+}
+
+type sqsMessage struct {
+	MessageId     string
+	ReceiptHandle string
+	MD5OfBody     string
+	Body          string
+	Attributes    sqsAttributes `json:",omitempty" xml:"Attribute,omitempty"`
+}
+
+type sqsReceiveMessageResult struct {
+	Messages []sqsMessage `xml:"Message"`
+}
+
+type sqsGetQueueAttributesResult struct {
+	Attributes sqsAttributes `xml:"Attribute"`
+}
+
+//sqsError is returned to the client in the format of the protocol it used
+type sqsError struct {
+	Code       string //JSON protocol error type, Ex: QueueDoesNotExist
+	QueryCode  string //query protocol error code, Ex: AWS.SimpleQueueService.NonExistentQueue
+	Message    string
+	HttpStatus int
+}
+
+func (s *sqsError) Error() string {
+	return fmt.Sprintf("%v: %v", s.Code, s.Message)
+}
+
+func newSqsError(code, queryCode, message string) *sqsError {
+	return &sqsError{code, queryCode, message, http.StatusBadRequest}
+}
+
+func invalidParameter(format string, a ...interface{}) *sqsError {
+	return newSqsError("InvalidParameterValue", "InvalidParameterValue", fmt.Sprintf(format, a...))
+}
+
+func missingParameter(name string) *sqsError {
+	return newSqsError("MissingParameter", "MissingParameter", "The request must contain the parameter "+name)
+}
+
+//toSqsError maps the errors package codes onto SQS errors
+func toSqsError(err error) *sqsError {
+
+	if sErr, ok := err.(*sqsError); ok {
+		return sErr
+	}
+
+	qErr, ok := err.(*e.Error)
+	if !ok {
+		return &sqsError{"InternalError", "InternalError", err.Error(), http.StatusInternalServerError}
+	}
+
+	switch qErr.ErrorCode {
+	case e.QUEUE_DOES_NOT_EXIST:
+		return newSqsError("QueueDoesNotExist", "AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist.")
+	case e.ALREADY_EXISTS:
+		return newSqsError("QueueNameExists", "QueueAlreadyExists", qErr.ErrorMessage)
+	case e.RECEIPT_INVALID, e.RECEIPT_STALE:
+		return newSqsError("ReceiptHandleIsInvalid", "ReceiptHandleIsInvalid", qErr.ErrorMessage)
+	case e.INVALID_INPUT:
+		return invalidParameter("%s", qErr.ErrorMessage)
+	}
+
+	return &sqsError{"InternalError", "InternalError", qErr.ErrorMessage, http.StatusInternalServerError}
+}
+
+type sqsHandler struct {
+	appName string //app new queues are created under
+}
+
+//NewSqsHandler returns the handler for the SQS compatible endpoint
+func NewSqsHandler(appName string) http.Handler {
+	return sqsHandler{appName}
+}
+
+type sqsAction func(r *http.Request, req *sqsRequest) (interface{}, error)
+
+func (h sqsHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	requestId := uuid.NewString()
+	jsonProtocol := len(r.Header.Get("X-Amz-Target")) != 0
+
+	r = r.WithContext(logging.NewContext(r.Context(), logger.With("request_id", requestId)))
+
+	req := &sqsRequest{}
+	action := ""
+
+	if jsonProtocol {
+		action = strings.TrimPrefix(r.Header.Get("X-Amz-Target"), sqsJsonTarget)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			h.writeError(rw, true, requestId, newSqsError("InvalidRequest", "InvalidRequest", err.Error()))
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			h.writeError(rw, false, requestId, newSqsError("InvalidRequest", "InvalidRequest", err.Error()))
+			return
+		}
+		action = r.Form.Get("Action")
+		decodeQueryRequest(r.Form, req)
+	}
+
+	//The query protocol can send the request to the queue url instead of passing QueueUrl
+	if len(req.QueueUrl) == 0 && strings.Count(strings.Trim(r.URL.Path, "/"), "/") == 1 {
+		req.QueueUrl = r.URL.Path
+	}
+
+	actions := map[string]struct {
+		perm   string
+		handle sqsAction
+	}{
+		"CreateQueue":                  {auth.PermCreate, h.createQueue},
+		"GetQueueUrl":                  {"", h.getQueueUrl},
+		"SendMessage":                  {auth.PermEnqueue, h.sendMessage},
+		"SendMessageBatch":             {auth.PermEnqueue, h.sendMessageBatch},
+		"ReceiveMessage":               {auth.PermDequeue, h.receiveMessage},
+		"DeleteMessage":                {auth.PermDequeue, h.deleteMessage},
+		"DeleteMessageBatch":           {auth.PermDequeue, h.deleteMessageBatch},
+		"ChangeMessageVisibility":      {auth.PermDequeue, h.changeMessageVisibility},
+		"ChangeMessageVisibilityBatch": {auth.PermDequeue, h.changeMessageVisibilityBatch},
+		"GetQueueAttributes":           {"", h.getQueueAttributes},
+		"PurgeQueue":                   {auth.PermAdmin, h.purgeQueue},
+		"DeleteQueue":                  {auth.PermAdmin, h.deleteQueue},
+	}
+
+	a, ok := actions[action]
+	if !ok {
+		h.writeError(rw, jsonProtocol, requestId, newSqsError("InvalidAction", "InvalidAction", "The action "+action+" is not valid for this endpoint."))
+		return
+	}
+
+	r, span := startHttpSpan(r, "SQS "+action)
+	span.SetAttributes("rpc.system", "aws-api", "rpc.method", action)
+	defer span.Finish()
+
+	r, authErr := h.authorize(r, req, a.perm)
+	if authErr != nil {
+		span.SetErrorMessage(authErr.Message)
+		h.writeError(rw, jsonProtocol, requestId, authErr)
+		return
+	}
+
+	result, err := a.handle(r, req)
+	if err != nil {
+		span.SetError(err)
+		h.writeError(rw, jsonProtocol, requestId, toSqsError(err))
+		return
+	}
+
+	h.writeResult(rw, jsonProtocol, requestId, action, result)
+}
+
+//authorize uses the AWS access key id from the signature as the api key when authentication is on
+func (h sqsHandler) authorize(r *http.Request, req *sqsRequest, perm string) (*http.Request, *sqsError) {
+
+	if keyStore == nil {
+		return r, nil
+	}
+
+	accessKey := ""
+	if i := strings.Index(r.Header.Get("Authorization"), "Credential="); i >= 0 {
+		accessKey = strings.SplitN(r.Header.Get("Authorization")[i+len("Credential="):], "/", 2)[0]
+	}
+
+	id, ok := keyStore.Lookup(accessKey)
+	if !ok {
+		logging.FromContext(r.Context()).Warn("Rejected sqs request", "error", "unknown access key", "remote", r.RemoteAddr)
+		return r, &sqsError{"InvalidClientTokenId", "InvalidClientTokenId", "The security token included in the request is invalid.", http.StatusForbidden}
+	}
+
+	appName := h.appName
+	if len(req.QueueUrl) != 0 {
+		appName, _, _ = parseQueueUrl(req.QueueUrl)
+	} else if len(req.QueueOwnerAWSAccountId) != 0 {
+		appName = req.QueueOwnerAWSAccountId
+	}
+
+	allowed := id.CanAccessApp(appName)
+	if len(perm) != 0 {
+		allowed = allowed && id.HasPermission(perm)
+	}
+
+	if !allowed {
+		logging.FromContext(r.Context()).Warn("Denied sqs request", "caller", id.Id, "app", appName)
+		return r, &sqsError{"AccessDenied", "AccessDenied", "Access to the resource is denied.", http.StatusForbidden}
+	}
+
+	return r.WithContext(auth.NewContext(r.Context(), id)), nil
+}
+
+func (h sqsHandler) queueUrl(r *http.Request, appName, queueName string) string {
+	return "http://" + r.Host + "/" + appName + "/" + queueName
+}
+
+//parseQueueUrl returns the app and queue names from the last two path segments of a queue url
+func parseQueueUrl(queueUrl string) (string, string, error) {
+
+	u, err := url.Parse(queueUrl)
+	if err != nil {
+		return "", "", invalidParameter("Value %s for parameter QueueUrl is invalid.", queueUrl)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || len(parts[len(parts)-2]) == 0 || len(parts[len(parts)-1]) == 0 {
+		return "", "", invalidParameter("Value %s for parameter QueueUrl is invalid.", queueUrl)
+	}
+
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+func (h sqsHandler) queueFromRequest(req *sqsRequest) (string, string, error) {
+
+	if len(req.QueueUrl) == 0 {
+		return "", "", missingParameter("QueueUrl")
+	}
+
+	return parseQueueUrl(req.QueueUrl)
+}
+
+//intAttribute reads a numeric queue attribute that must be between 0 and max
+func intAttribute(attributes map[string]string, name string, max int) (int, error) {
+
+	v, ok := attributes[name]
+	if !ok {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 || i > max {
+		return 0, invalidParameter("Invalid value for the parameter %s.", name)
+	}
+
+	return i, nil
+}
+
+func (h sqsHandler) createQueue(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	if !sqsQueueNameRegex.MatchString(req.QueueName) {
+		return nil, invalidParameter("Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length")
+	}
+
+	delaySeconds, err := intAttribute(req.Attributes, "DelaySeconds", q.MaxDelaySeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	visibilityTimeout, err := intAttribute(req.Attributes, "VisibilityTimeout", maxVisibilityTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := intAttribute(req.Attributes, "MessageRetentionPeriod", q.MaxRetentionSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	//CreateQueue succeeds for a queue that already exists
+	err = CreateQueue(h.appName, req.QueueName, QueueOptions{DelaySeconds: uint16(delaySeconds), VisibilityTimeout: uint16(visibilityTimeout),
+		RetentionSeconds: uint32(retention)})
+	if qErr, ok := err.(*e.Error); err != nil && (!ok || qErr.ErrorCode != e.ALREADY_EXISTS) {
+		return nil, err
+	}
+
+	if err == nil {
+		logging.FromContext(r.Context()).Info("Created queue", "caller", caller(r.Context()), "app", h.appName, "queue", req.QueueName)
+	}
+
+	return sqsQueueUrlResult{h.queueUrl(r, h.appName, req.QueueName)}, nil
+}
+
+func (h sqsHandler) getQueueUrl(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName := h.appName
+	if len(req.QueueOwnerAWSAccountId) != 0 {
+		appName = req.QueueOwnerAWSAccountId
+	}
+
+	if _, ok := queueInfo.Get(appName + req.QueueName); !ok {
+		return nil, &e.Error{AppName: appName, Name: req.QueueName, ErrorCode: e.QUEUE_DOES_NOT_EXIST, ErrorMessage: e.ErrorQueueDoesNotExist}
+	}
+
+	return sqsQueueUrlResult{h.queueUrl(r, appName, req.QueueName)}, nil
+}
+
+func md5Hex(s string) string {
+
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h sqsHandler) send(ctx context.Context, appName, queueName, body, groupId, deduplicationId string, delaySeconds *int) (sqsSendMessageResult, error) {
+
+	if len(body) == 0 {
+		return sqsSendMessageResult{}, missingParameter("MessageBody")
+	}
+
+	opts := EnqueueOptions{GroupId: groupId, DeduplicationId: deduplicationId}
+	if delaySeconds != nil && *delaySeconds != 0 {
+		if *delaySeconds < 0 || *delaySeconds > sqsMaxDelaySeconds {
+			return sqsSendMessageResult{}, invalidParameter("Value %d for parameter DelaySeconds is invalid.", *delaySeconds)
+		}
+		opts.DeliverAt = time.Now().Add(time.Duration(*delaySeconds) * time.Second)
+	}
+
+	id, err := EnQueueWithOptions(ctx, appName, queueName, body, opts)
+	if err != nil {
+		return sqsSendMessageResult{}, err
+	}
+
+	return sqsSendMessageResult{id, md5Hex(body)}, nil
+}
+
+func (h sqsHandler) sendMessage(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.send(r.Context(), appName, queueName, req.MessageBody, req.MessageGroupId, req.MessageDeduplicationId, req.DelaySeconds)
+}
+
+//checkBatch validates the entry count and ids of a batch request
+func checkBatch(entries []sqsBatchEntry) error {
+
+	if len(entries) == 0 {
+		return newSqsError("EmptyBatchRequest", "AWS.SimpleQueueService.EmptyBatchRequest", "There should be at least one entry in the request.")
+	}
+
+	if len(entries) > sqsMaxBatch {
+		return newSqsError("TooManyEntriesInBatchRequest", "AWS.SimpleQueueService.TooManyEntriesInBatchRequest", "Maximum number of entries per request are 10.")
+	}
+
+	ids := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if ids[entry.Id] {
+			return newSqsError("BatchEntryIdsNotDistinct", "AWS.SimpleQueueService.BatchEntryIdsNotDistinct", "Id "+entry.Id+" repeated.")
+		}
+		ids[entry.Id] = true
+	}
+
+	return nil
+}
+
+func batchError(id string, err error) sqsBatchErrorEntry {
+
+	sErr := toSqsError(err)
+	return sqsBatchErrorEntry{id, sErr.HttpStatus < http.StatusInternalServerError, sErr.Code, sErr.Message}
+}
+
+func (h sqsHandler) sendMessageBatch(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBatch(req.Entries); err != nil {
+		return nil, err
+	}
+
+	result := sqsSendMessageBatchResult{Successful: []sqsBatchResultEntry{}, Failed: []sqsBatchErrorEntry{}}
+
+	for _, entry := range req.Entries {
+		sent, err := h.send(r.Context(), appName, queueName, entry.MessageBody, entry.MessageGroupId, entry.MessageDeduplicationId, entry.DelaySeconds)
+
+		//A missing queue fails the whole request rather than every entry
+		if qErr, ok := err.(*e.Error); ok && qErr.ErrorCode == e.QUEUE_DOES_NOT_EXIST {
+			return nil, err
+		}
+
+		if err != nil {
+			result.Failed = append(result.Failed, batchError(entry.Id, err))
+			continue
+		}
+
+		result.Successful = append(result.Successful, sqsBatchResultEntry{entry.Id, sent.MessageId, sent.MD5OfMessageBody})
+	}
+
+	return result, nil
+}
+
+func (h sqsHandler) receiveMessage(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := GetQueueStats(appName, queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	maxMessages := 1
+	if req.MaxNumberOfMessages != nil {
+		maxMessages = *req.MaxNumberOfMessages
+	}
+	if maxMessages < 1 || maxMessages > sqsMaxBatch {
+		return nil, invalidParameter("Value %d for parameter MaxNumberOfMessages is invalid. Must be between 1 and 10.", maxMessages)
+	}
+
+	wait := 0
+	if req.WaitTimeSeconds != nil {
+		wait = *req.WaitTimeSeconds
+	}
+	if wait < 0 || wait > sqsMaxWaitSeconds {
+		return nil, invalidParameter("Value %d for parameter WaitTimeSeconds is invalid. Must be between 0 and 20.", wait)
+	}
+
+	visibility := int(stats.MetaData.VisibilityTimeout)
+	if visibility == 0 {
+		visibility = q.DefaultVisibilityTimeout
+	}
+	if req.VisibilityTimeout != nil {
+		visibility = *req.VisibilityTimeout
+	}
+	if visibility < 0 || visibility > maxVisibilityTimeout() {
+		return nil, invalidParameter("Value %d for parameter VisibilityTimeout is invalid.", visibility)
+	}
+
+	withReceiveCount := false
+	for _, name := range append(req.AttributeNames, req.MessageSystemAttributeNames...) {
+		if name == "All" || name == "ApproximateReceiveCount" {
+			withReceiveCount = true
+		}
+	}
+
+	result := sqsReceiveMessageResult{Messages: []sqsMessage{}}
+
+	//Only the first message waits, the rest are taken if they are already there
+	for len(result.Messages) < maxMessages {
+
+		waitFor := time.Duration(0)
+		if len(result.Messages) == 0 {
+			waitFor = time.Duration(wait) * time.Second
+		}
+
+		received, err := ReceiveWait(r.Context(), appName, queueName, time.Duration(visibility)*time.Second, waitFor)
+		if qErr, ok := err.(*e.Error); ok && qErr.ErrorCode == e.QUEUE_EMPTY {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		m := sqsMessage{MessageId: received.Id, ReceiptHandle: received.Receipt, MD5OfBody: md5Hex(received.Body), Body: received.Body}
+		if withReceiveCount {
+			m.Attributes = sqsAttributes{"ApproximateReceiveCount": strconv.FormatUint(uint64(received.ReceiveCount), 10)}
+		}
+
+		result.Messages = append(result.Messages, m)
+	}
+
+	return result, nil
+}
+
+func (h sqsHandler) deleteMessage(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.ReceiptHandle) == 0 {
+		return nil, missingParameter("ReceiptHandle")
+	}
+
+	return nil, DeleteMessageContext(r.Context(), appName, queueName, req.ReceiptHandle)
+}
+
+func (h sqsHandler) deleteMessageBatch(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBatch(req.Entries); err != nil {
+		return nil, err
+	}
+
+	result := sqsDeleteMessageBatchResult{Successful: []sqsBatchResultEntry{}, Failed: []sqsBatchErrorEntry{}}
+
+	for _, entry := range req.Entries {
+		err := DeleteMessageContext(r.Context(), appName, queueName, entry.ReceiptHandle)
+
+		if qErr, ok := err.(*e.Error); ok && qErr.ErrorCode == e.QUEUE_DOES_NOT_EXIST {
+			return nil, err
+		}
+
+		if err != nil {
+			result.Failed = append(result.Failed, batchError(entry.Id, err))
+			continue
+		}
+
+		result.Successful = append(result.Successful, sqsBatchResultEntry{Id: entry.Id})
+	}
+
+	return result, nil
+}
+
+func (h sqsHandler) changeMessageVisibility(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.ReceiptHandle) == 0 {
+		return nil, missingParameter("ReceiptHandle")
+	}
+
+	if req.VisibilityTimeout == nil {
+		return nil, missingParameter("VisibilityTimeout")
+	}
+
+	if *req.VisibilityTimeout < 0 || *req.VisibilityTimeout > maxVisibilityTimeout() {
+		return nil, invalidParameter("Value %d for parameter VisibilityTimeout is invalid.", *req.VisibilityTimeout)
+	}
+
+	return nil, ChangeVisibility(appName, queueName, req.ReceiptHandle, time.Duration(*req.VisibilityTimeout)*time.Second)
+}
+
+func (h sqsHandler) changeMessageVisibilityBatch(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBatch(req.Entries); err != nil {
+		return nil, err
+	}
+
+	result := sqsChangeMessageVisibilityBatchResult{Successful: []sqsBatchResultEntry{}, Failed: []sqsBatchErrorEntry{}}
+
+	//Entries with a bad visibility timeout fail on their own, the others are changed under one lock of the queue
+	changes := make([]wal.VisibilityChange, 0, len(req.Entries))
+	ids := make([]string, 0, len(req.Entries))
+	for _, entry := range req.Entries {
+		switch {
+		case entry.VisibilityTimeout == nil:
+			result.Failed = append(result.Failed, batchError(entry.Id, missingParameter("VisibilityTimeout")))
+		case *entry.VisibilityTimeout < 0 || *entry.VisibilityTimeout > maxVisibilityTimeout():
+			result.Failed = append(result.Failed, batchError(entry.Id, invalidParameter("Value %d for parameter VisibilityTimeout is invalid.", *entry.VisibilityTimeout)))
+		default:
+			changes = append(changes, wal.VisibilityChange{Receipt: entry.ReceiptHandle, Visibility: time.Duration(*entry.VisibilityTimeout) * time.Second})
+			ids = append(ids, entry.Id)
+		}
+	}
+
+	errs, err := ChangeVisibilityBatch(appName, queueName, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			result.Failed = append(result.Failed, batchError(ids[i], err))
+			continue
+		}
+		result.Successful = append(result.Successful, sqsBatchResultEntry{Id: ids[i]})
+	}
+
+	return result, nil
+}
+
+func (h sqsHandler) getQueueAttributes(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := GetQueueStats(appName, queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	visibility := int(stats.MetaData.VisibilityTimeout)
+	if visibility == 0 {
+		visibility = q.DefaultVisibilityTimeout
+	}
+
+	all := sqsAttributes{
+		"ApproximateNumberOfMessages":           strconv.Itoa(stats.Visible),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(stats.InFlight),
+		"ApproximateNumberOfMessagesDelayed":    "0",
+		"DelaySeconds":                          strconv.Itoa(int(stats.MetaData.DelaySeconds)),
+		"VisibilityTimeout":                     strconv.Itoa(visibility),
+		"MaximumMessageSize":                    strconv.Itoa(q.MaxMessageSize * 1024),
+		"ReceiveMessageWaitTimeSeconds":         "0",
+		"QueueArn":                              "arn:aws:sqs:local:" + appName + ":" + queueName,
+	}
+	if stats.MetaData.RetentionSeconds != 0 {
+		all["MessageRetentionPeriod"] = strconv.FormatUint(uint64(stats.MetaData.RetentionSeconds), 10)
+	}
+
+	attributes := sqsAttributes{}
+	for _, name := range req.AttributeNames {
+		if name == "All" {
+			attributes = all
+			break
+		}
+
+		if v, ok := all[name]; ok {
+			attributes[name] = v
+		}
+	}
+
+	return sqsGetQueueAttributesResult{attributes}, nil
+}
+
+func (h sqsHandler) purgeQueue(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, Purge(appName, queueName)
+}
+
+func (h sqsHandler) deleteQueue(r *http.Request, req *sqsRequest) (interface{}, error) {
+
+	appName, queueName, err := h.queueFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DeleteQueue(appName, queueName); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(r.Context()).Info("Deleted queue", "caller", caller(r.Context()), "app", appName, "queue", queueName)
+
+	return nil, nil
+}
+
+func (h sqsHandler) writeResult(rw http.ResponseWriter, jsonProtocol bool, requestId, action string, result interface{}) {
+
+	rw.Header().Set("x-amzn-RequestId", requestId)
+
+	if jsonProtocol {
+		if result == nil {
+			result = struct{}{}
+		}
+
+		rw.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if err := json.NewEncoder(rw).Encode(result); err != nil {
+			logger.Warn("Unable to write the sqs response", "request_id", requestId, "error", err)
+		}
+		return
+	}
+
+	//<ActionResponse><ActionResult>...</ActionResult><ResponseMetadata>...</ResponseMetadata></ActionResponse>
+	type responseMetadata struct {
+		RequestId string
+	}
+
+	rw.Header().Set("Content-Type", "text/xml")
+	rw.Write([]byte(xml.Header))
+
+	enc := xml.NewEncoder(rw)
+	start := xml.StartElement{Name: xml.Name{Local: action + "Response"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: sqsXmlns}}}
+
+	err := enc.EncodeToken(start)
+	if err == nil && result != nil {
+		err = enc.EncodeElement(result, xml.StartElement{Name: xml.Name{Local: action + "Result"}})
+	}
+	if err == nil {
+		err = enc.EncodeElement(responseMetadata{requestId}, xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}})
+	}
+	if err == nil {
+		err = enc.EncodeToken(start.End())
+	}
+	if err == nil {
+		err = enc.Flush()
+	}
+
+	if err != nil {
+		logger.Warn("Unable to write the sqs response", "request_id", requestId, "error", err)
+	}
+}
+
+func (h sqsHandler) writeError(rw http.ResponseWriter, jsonProtocol bool, requestId string, sErr *sqsError) {
+
+	rw.Header().Set("x-amzn-RequestId", requestId)
+
+	if jsonProtocol {
+		rw.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		rw.Header().Set("x-amzn-query-error", sErr.QueryCode+";Sender")
+		rw.WriteHeader(sErr.HttpStatus)
+
+		json.NewEncoder(rw).Encode(struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}{"com.amazonaws.sqs#" + sErr.Code, sErr.Message})
+		return
+	}
+
+	type errorBody struct {
+		Type    string
+		Code    string
+		Message string
+	}
+
+	response := struct {
+		XMLName   xml.Name `xml:"ErrorResponse"`
+		Xmlns     string   `xml:"xmlns,attr"`
+		Error     errorBody
+		RequestId string
+	}{Xmlns: sqsXmlns, Error: errorBody{"Sender", sErr.QueryCode, sErr.Message}, RequestId: requestId}
+
+	rw.Header().Set("Content-Type", "text/xml")
+	rw.WriteHeader(sErr.HttpStatus)
+	rw.Write([]byte(xml.Header))
+	xml.NewEncoder(rw).Encode(response)
+}
+
+//decodeQueryRequest maps the flattened query protocol parameters onto the request,
+//Ex: Attribute.1.Name, AttributeName.1, SendMessageBatchRequestEntry.1.MessageBody
+func decodeQueryRequest(form url.Values, req *sqsRequest) {
+
+	optionalInt := func(v string) *int {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil
+		}
+		return &i
+	}
+
+	req.QueueName = form.Get("QueueName")
+	req.QueueUrl = form.Get("QueueUrl")
+	req.QueueOwnerAWSAccountId = form.Get("QueueOwnerAWSAccountId")
+	req.MessageBody = form.Get("MessageBody")
+	req.MessageGroupId = form.Get("MessageGroupId")
+	req.MessageDeduplicationId = form.Get("MessageDeduplicationId")
+	req.ReceiptHandle = form.Get("ReceiptHandle")
+	req.DelaySeconds = optionalInt(form.Get("DelaySeconds"))
+	req.MaxNumberOfMessages = optionalInt(form.Get("MaxNumberOfMessages"))
+	req.WaitTimeSeconds = optionalInt(form.Get("WaitTimeSeconds"))
+	req.VisibilityTimeout = optionalInt(form.Get("VisibilityTimeout"))
+
+	entries := map[int]*sqsBatchEntry{}
+	req.Attributes = map[string]string{}
+
+	for n := 1; ; n++ {
+		name := form.Get(fmt.Sprintf("Attribute.%d.Name", n))
+		if len(name) == 0 {
+			break
+		}
+		req.Attributes[name] = form.Get(fmt.Sprintf("Attribute.%d.Value", n))
+	}
+
+	for key, values := range form {
+		parts := strings.Split(key, ".")
+
+		switch {
+		case len(parts) == 2 && parts[0] == "AttributeName":
+			req.AttributeNames = append(req.AttributeNames, values[0])
+
+		case len(parts) == 2 && parts[0] == "MessageSystemAttributeName":
+			req.MessageSystemAttributeNames = append(req.MessageSystemAttributeNames, values[0])
+
+		case len(parts) == 3 && strings.HasSuffix(parts[0], "BatchRequestEntry"):
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				continue
+			}
+
+			if entries[n] == nil {
+				entries[n] = &sqsBatchEntry{}
+			}
+
+			switch parts[2] {
+			case "Id":
+				entries[n].Id = values[0]
+			case "MessageBody":
+				entries[n].MessageBody = values[0]
+			case "MessageGroupId":
+				entries[n].MessageGroupId = values[0]
+			case "MessageDeduplicationId":
+				entries[n].MessageDeduplicationId = values[0]
+			case "ReceiptHandle":
+				entries[n].ReceiptHandle = values[0]
+			case "DelaySeconds":
+				entries[n].DelaySeconds = optionalInt(values[0])
+			case "VisibilityTimeout":
+				entries[n].VisibilityTimeout = optionalInt(values[0])
+			}
+		}
+	}
+
+	for n := 1; n <= len(entries); n++ {
+		if entry, ok := entries[n]; ok {
+			req.Entries = append(req.Entries, *entry)
+		}
+	}
+}
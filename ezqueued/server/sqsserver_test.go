@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func sqsJsonRequest(t *testing.T, action string, params interface{}) (int, map[string]interface{}) {
+
+	body, _ := json.Marshal(params)
+
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:9324/", strings.NewReader(string(body)))
+	r.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	r.Header.Set("Content-Type", "application/x-amz-json-1.0")
+
+	rw := httptest.NewRecorder()
+	NewSqsHandler("sqstest").ServeHTTP(rw, r)
+
+	resp := map[string]interface{}{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: want a JSON body, got %q", action, rw.Body.String())
+	}
+
+	return rw.Code, resp
+}
+
+func sqsQueryRequest(form url.Values) (int, string) {
+
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:9324/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rw := httptest.NewRecorder()
+	NewSqsHandler("sqstest").ServeHTTP(rw, r)
+
+	return rw.Code, rw.Body.String()
+}
+
+func TestSqsJsonProtocol(t *testing.T) {
+
+	defer removeQueue("sqstest", "orders")
+
+	_, resp := sqsJsonRequest(t, "CreateQueue", map[string]interface{}{"QueueName": "orders"})
+	queueUrl, _ := resp["QueueUrl"].(string)
+	if queueUrl != "http://localhost:9324/sqstest/orders" {
+		t.Fatalf("CreateQueue: want the queue url, got %v", resp)
+	}
+
+	if _, resp := sqsJsonRequest(t, "GetQueueUrl", map[string]interface{}{"QueueName": "orders"}); resp["QueueUrl"] != queueUrl {
+		t.Errorf("GetQueueUrl: want %s, got %v", queueUrl, resp)
+	}
+
+	_, resp = sqsJsonRequest(t, "SendMessage", map[string]interface{}{"QueueUrl": queueUrl, "MessageBody": "hello"})
+	if resp["MD5OfMessageBody"] != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("SendMessage: want the md5 of the body, got %v", resp)
+	}
+
+	sqsJsonRequest(t, "SendMessageBatch", map[string]interface{}{"QueueUrl": queueUrl, "Entries": []map[string]interface{}{
+		{"Id": "a", "MessageBody": "one"}, {"Id": "b", "MessageBody": "two"}}})
+
+	_, resp = sqsJsonRequest(t, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl, "MaxNumberOfMessages": 2,
+		"VisibilityTimeout": 60, "AttributeNames": []string{"All"}})
+	messages, _ := resp["Messages"].([]interface{})
+	if len(messages) != 2 {
+		t.Fatalf("ReceiveMessage: want 2 messages, got %v", resp)
+	}
+
+	first := messages[0].(map[string]interface{})
+	if first["Body"] != "hello" || first["Attributes"].(map[string]interface{})["ApproximateReceiveCount"] != "1" {
+		t.Errorf("ReceiveMessage: want hello received once, got %v", first)
+	}
+
+	_, resp = sqsJsonRequest(t, "GetQueueAttributes", map[string]interface{}{"QueueUrl": queueUrl, "AttributeNames": []string{"All"}})
+	attributes := resp["Attributes"].(map[string]interface{})
+	if attributes["ApproximateNumberOfMessages"] != "1" || attributes["ApproximateNumberOfMessagesNotVisible"] != "2" {
+		t.Errorf("GetQueueAttributes: want 1 visible and 2 in flight, got %v", attributes)
+	}
+
+	if code, _ := sqsJsonRequest(t, "DeleteMessage", map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": first["ReceiptHandle"]}); code != http.StatusOK {
+		t.Errorf("DeleteMessage: want %d, got %d", http.StatusOK, code)
+	}
+
+	code, resp := sqsJsonRequest(t, "DeleteMessage", map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": first["ReceiptHandle"]})
+	if code != http.StatusBadRequest || resp["__type"] != "com.amazonaws.sqs#ReceiptHandleIsInvalid" {
+		t.Errorf("DeleteMessage twice: want ReceiptHandleIsInvalid, got %d %v", code, resp)
+	}
+
+	//A zero visibility timeout makes the message visible again straight away
+	second := messages[1].(map[string]interface{})
+	sqsJsonRequest(t, "ChangeMessageVisibility", map[string]interface{}{"QueueUrl": queueUrl, "ReceiptHandle": second["ReceiptHandle"], "VisibilityTimeout": 0})
+
+	_, resp = sqsJsonRequest(t, "ReceiveMessage", map[string]interface{}{"QueueUrl": queueUrl})
+	messages, _ = resp["Messages"].([]interface{})
+	if len(messages) != 1 || messages[0].(map[string]interface{})["Body"] != "one" {
+		t.Fatalf("ReceiveMessage after ChangeMessageVisibility: want one, got %v", resp)
+	}
+
+	//The receipt of the first receive of one is stale now, only that entry fails
+	_, resp = sqsJsonRequest(t, "ChangeMessageVisibilityBatch", map[string]interface{}{"QueueUrl": queueUrl, "Entries": []map[string]interface{}{
+		{"Id": "stale", "ReceiptHandle": second["ReceiptHandle"], "VisibilityTimeout": 60},
+		{"Id": "current", "ReceiptHandle": messages[0].(map[string]interface{})["ReceiptHandle"], "VisibilityTimeout": 60}}})
+	successful, _ := resp["Successful"].([]interface{})
+	failed, _ := resp["Failed"].([]interface{})
+	if len(successful) != 1 || successful[0].(map[string]interface{})["Id"] != "current" ||
+		len(failed) != 1 || failed[0].(map[string]interface{})["Code"] != "ReceiptHandleIsInvalid" {
+		t.Errorf("ChangeMessageVisibilityBatch: want current changed and stale failed, got %v", resp)
+	}
+
+	sqsJsonRequest(t, "PurgeQueue", map[string]interface{}{"QueueUrl": queueUrl})
+
+	_, resp = sqsJsonRequest(t, "GetQueueAttributes", map[string]interface{}{"QueueUrl": queueUrl, "AttributeNames": []string{"ApproximateNumberOfMessages"}})
+	if attributes := resp["Attributes"].(map[string]interface{}); attributes["ApproximateNumberOfMessages"] != "0" || len(attributes) != 1 {
+		t.Errorf("GetQueueAttributes after PurgeQueue: want only 0 messages, got %v", attributes)
+	}
+
+	sqsJsonRequest(t, "DeleteQueue", map[string]interface{}{"QueueUrl": queueUrl})
+
+	code, resp = sqsJsonRequest(t, "SendMessage", map[string]interface{}{"QueueUrl": queueUrl, "MessageBody": "hello"})
+	if code != http.StatusBadRequest || resp["__type"] != "com.amazonaws.sqs#QueueDoesNotExist" {
+		t.Errorf("SendMessage after DeleteQueue: want QueueDoesNotExist, got %d %v", code, resp)
+	}
+}
+
+func TestSqsQueryProtocol(t *testing.T) {
+
+	defer removeQueue("sqstest", "legacy")
+
+	_, body := sqsQueryRequest(url.Values{"Action": {"CreateQueue"}, "QueueName": {"legacy"},
+		"Attribute.1.Name": {"VisibilityTimeout"}, "Attribute.1.Value": {"20"}})
+	if !strings.Contains(body, "<CreateQueueResult><QueueUrl>http://localhost:9324/sqstest/legacy</QueueUrl></CreateQueueResult>") {
+		t.Fatalf("CreateQueue: want the queue url, got %s", body)
+	}
+
+	queueUrl := "http://localhost:9324/sqstest/legacy"
+
+	sqsQueryRequest(url.Values{"Action": {"SendMessageBatch"}, "QueueUrl": {queueUrl},
+		"SendMessageBatchRequestEntry.1.Id": {"a"}, "SendMessageBatchRequestEntry.1.MessageBody": {"query message"}})
+
+	_, body = sqsQueryRequest(url.Values{"Action": {"ReceiveMessage"}, "QueueUrl": {queueUrl}, "AttributeName.1": {"All"}})
+	if !strings.Contains(body, "<Body>query message</Body>") ||
+		!strings.Contains(body, "<Attribute><Name>ApproximateReceiveCount</Name><Value>1</Value></Attribute>") {
+		t.Errorf("ReceiveMessage: want the message with its receive count, got %s", body)
+	}
+
+	code, body := sqsQueryRequest(url.Values{"Action": {"GetQueueAttributes"}, "QueueUrl": {"http://localhost:9324/sqstest/missing"}})
+	if code != http.StatusBadRequest || !strings.Contains(body, "<Code>AWS.SimpleQueueService.NonExistentQueue</Code>") {
+		t.Errorf("GetQueueAttributes on a missing queue: want NonExistentQueue, got %d %s", code, body)
+	}
+
+	//A queue delay above the maximum is refused instead of being dropped
+	code, body = sqsQueryRequest(url.Values{"Action": {"CreateQueue"}, "QueueName": {"delayed"},
+		"Attribute.1.Name": {"DelaySeconds"}, "Attribute.1.Value": {"60"}})
+	if code != http.StatusBadRequest || !strings.Contains(body, "<Code>InvalidParameterValue</Code>") {
+		t.Errorf("CreateQueue with a delay of 60 seconds: want InvalidParameterValue, got %d %s", code, body)
+	}
+	if _, ok := queueInfo.Get("sqstestdelayed"); ok {
+		removeQueue("sqstest", "delayed")
+		t.Errorf("CreateQueue with a delay of 60 seconds: want no queue, got one")
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	"github.com/coderagr/ezqueue-service/ezqueued/client"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//Start runs ezqueue in the process, for the integration tests of services that use it.
+//It serves gRPC only and does not read /etc/ezqueue. The queues live in package level state,
+//so one server runs in a process at a time
+
+//ErrAlreadyRunning is returned by Start while another server started by it is running
+var ErrAlreadyRunning = errors.New("an ezqueue server is already running in this process")
+
+//Options for Start. The zero value serves a new temporary directory on a free port of 127.0.0.1
+type Options struct {
+	Dir      string //logs directory. Queues already in it are recovered. When empty Start makes a temporary one that Stop removes
+	Addr     string //gRPC address. 127.0.0.1:0 when empty, see Server.Addr for the port
+	KeysFile string //api keys file. Authentication is off when empty
+	ApiKey   string //key Server.Client sends
+}
+
+//Server is a running instance made by Start
+type Server struct {
+	dir     string
+	tempDir bool
+	addr    string
+
+	grpc        *grpc.Server
+	client      *client.Client
+	cancel      context.CancelFunc
+	maintenance sync.WaitGroup
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+
+	saved savedState
+}
+
+//savedState is the package state a Server replaces, put back by Stop
+type savedState struct {
+	logspath      string
+	queueInfo     *ProtQueueInfoMap
+	serviceHealth *healthState
+	keyStore      *auth.KeyStore
+	schedules     *scheduleStore
+}
+
+var instance struct {
+	sync.Mutex
+	running bool
+}
+
+//Start recovers the queues in opts.Dir and serves gRPC on opts.Addr until Stop is called or ctx is done
+func Start(ctx context.Context, opts Options) (*Server, error) {
+
+	instance.Lock()
+	defer instance.Unlock()
+
+	if instance.running {
+		return nil, ErrAlreadyRunning
+	}
+
+	s := &Server{dir: opts.Dir, addr: opts.Addr, stopped: make(chan struct{})}
+
+	if len(s.dir) == 0 {
+		dir, err := os.MkdirTemp("", "ezqueue-")
+		if err != nil {
+			return nil, err
+		}
+		s.dir, s.tempDir = dir, true
+	}
+	if len(s.addr) == 0 {
+		s.addr = "127.0.0.1:0"
+	}
+
+	var ks *auth.KeyStore
+	if len(opts.KeysFile) != 0 {
+		var err error
+		if ks, err = auth.NewKeyStore(opts.KeysFile); err != nil {
+			s.removeTempDir()
+			return nil, err
+		}
+	}
+
+	listen, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.removeTempDir()
+		return nil, err
+	}
+	s.addr = listen.Addr().String()
+
+	s.saved = savedState{wal.Config.Logspath, queueInfo, serviceHealth, keyStore, schedules}
+	wal.Config.Logspath, queueInfo, serviceHealth, keyStore = s.dir, NewQueueWalInfo(), newHealthState(), ks
+	schedules = &scheduleStore{schedules: make(map[string]*schedule)}
+
+	s.grpc = newGrpcServer()
+
+	if err := recoverService(); err != nil {
+		listen.Close()
+		s.closeQueues()
+		s.restore()
+		return nil, err
+	}
+
+	go s.grpc.Serve(listen)
+
+	var maintenanceCtx context.Context
+	maintenanceCtx, s.cancel = context.WithCancel(context.Background())
+	s.maintenance.Add(2)
+	go func() {
+		defer s.maintenance.Done()
+		runMaintenance(maintenanceCtx)
+	}()
+	go func() {
+		defer s.maintenance.Done()
+		serviceHealth.watchStorage(maintenanceCtx)
+	}()
+
+	//Dial does not wait for the connection, so it only fails on bad options
+	if s.client, err = client.Dial(s.addr, client.Options{ApiKey: opts.ApiKey}); err != nil {
+		s.shutdown()
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Stop()
+		case <-s.stopped:
+		}
+	}()
+
+	instance.running = true
+	logger.Info("Started an in process server", "address", s.addr, "path", s.dir)
+
+	return s, nil
+}
+
+//Addr is the address the gRPC services are served on, Ex: 127.0.0.1:41234
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+//Dir is the logs directory of the queues
+func (s *Server) Dir() string {
+	return s.dir
+}
+
+//Client is connected to the server with Options.ApiKey. Stop closes it
+func (s *Server) Client() *client.Client {
+	return s.client
+}
+
+//Stop lets the calls in progress finish, closes the queue files and lets another server start.
+//The queues stay in Dir unless it is a temporary directory
+func (s *Server) Stop() {
+
+	s.stopOnce.Do(func() {
+
+		s.client.Close()
+		s.shutdown()
+		close(s.stopped)
+
+		instance.Lock()
+		instance.running = false
+		instance.Unlock()
+
+		logger.Info("Stopped the in process server", "address", s.addr)
+	})
+}
+
+//shutdown stops serving and the maintenance, closes the queues and puts back the package state
+func (s *Server) shutdown() {
+
+	serviceHealth.shutdown()
+	s.grpc.GracefulStop()
+
+	s.cancel()
+	s.maintenance.Wait()
+
+	s.closeQueues()
+	s.restore()
+}
+
+func (s *Server) closeQueues() {
+
+	for _, walInfo := range queueInfo.Iter() {
+		if err := walInfo.Close(); err != nil {
+			logger.Error("Unable to close the queue files", "path", walInfo.ControlFilePath(), "error", err)
+		}
+	}
+}
+
+func (s *Server) restore() {
+
+	wal.Config.Logspath, queueInfo, serviceHealth, keyStore = s.saved.logspath, s.saved.queueInfo, s.saved.serviceHealth, s.saved.keyStore
+	schedules = s.saved.schedules
+	s.removeTempDir()
+}
+
+func (s *Server) removeTempDir() {
+
+	if s.tempDir {
+		os.RemoveAll(s.dir)
+	}
+}
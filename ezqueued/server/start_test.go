@@ -0,0 +1,91 @@
+package server_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/client"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/server"
+)
+
+func TestStart(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := server.Start(ctx, server.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := server.Start(ctx, server.Options{}); err != server.ErrAlreadyRunning {
+		t.Errorf("Start while running: want ErrAlreadyRunning, got %v", err)
+	}
+
+	c := s.Client()
+	if err := c.Create(ctx, "starttest", "queue", 0, 30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendBatch(ctx, "starttest", "queue", []string{"first", "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := c.Receive(ctx, "starttest", "queue", client.ReceiveOptions{})
+	if err != nil || len(messages) != 1 || messages[0].Body != "first" {
+		t.Fatalf("Receive: want first, got %v %v", messages, err)
+	}
+	if err := c.Delete(ctx, "starttest", "queue", messages[0].Receipt); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Stop()
+
+	//The queue is recovered from the directory by the next server
+	s, err = server.Start(ctx, server.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	messages, err = s.Client().Receive(ctx, "starttest", "queue", client.ReceiveOptions{MaxMessages: 10})
+	if err != nil || len(messages) != 1 || messages[0].Body != "second" {
+		t.Errorf("Receive after a restart: want second, got %v %v", messages, err)
+	}
+
+	if err := s.Client().Create(ctx, "starttest", "queue", 0, 30); !client.IsCode(err, e.ALREADY_EXISTS) {
+		t.Errorf("Create of a recovered queue: want ALREADY_EXISTS, got %v", err)
+	}
+}
+
+func TestStartTempDir(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s, err := server.Start(ctx, server.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Client().Create(ctx, "starttest", "queue", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	//Cancelling ctx stops the server and removes its temporary directory
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(s.Dir()); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Start: want the temporary directory removed after ctx is done")
+		}
+	}
+
+	s, err = server.Start(context.Background(), server.Options{})
+	if err != nil {
+		t.Fatalf("Start after a stop: %v", err)
+	}
+	s.Stop()
+}
@@ -0,0 +1,874 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/auth"
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+	"github.com/coderagr/ezqueue-service/ezqueued/tracing"
+)
+
+/*
+	STOMP listener for browser and scripting clients, served over TCP and WebSocket. Destinations have
+	the form /queue/app/name. SEND enqueues the body, with the priority header setting its priority in a
+	priority queue, the group-id header its group, the deduplication-id header its deduplication id,
+	the ttl header its time to live in seconds and the deliver-at header the RFC 3339 time it becomes
+	visible at. SUBSCRIBE with ack:auto removes messages as they are
+	delivered. With ack:client or ack:client-individual every message is delivered with a lease and stays
+	in the wal until it is acknowledged: ACK deletes it and NACK makes it visible again right away.
+	Messages that are still unacknowledged when the connection closes are made visible again as well.
+
+	Versions 1.1 and 1.2 are supported. Transactions and heart beats are not
+*/
+
+const (
+	stompMaxHeaderBytes  = 64 * 1024
+	stompDefaultPrefetch = 10               //leased messages a subscription holds at once unless prefetch-count says otherwise
+	stompMaxPrefetch     = 1000             //upper limit for prefetch-count
+	stompPollWait        = 20 * time.Second //how long a subscription waits on an empty queue before checking again
+	stompLeaseCheck      = 1 * time.Second  //how often expired leases are given back to their subscription
+	stompQueuePrefix     = "/queue/"
+	stompServerName      = "ezqueued"
+	stompAckAuto         = "auto"
+	stompAckClient       = "client"
+	stompAckIndividual   = "client-individual"
+)
+
+//stompWebSocketProtocols are the subprotocols STOMP clients offer in the WebSocket handshake
+var stompWebSocketProtocols = []string{"v12.stomp", "v11.stomp"}
+
+//stompError is sent to the client in an ERROR frame, after which the connection is closed
+type stompError struct {
+	Message string
+	Detail  string
+}
+
+func (s *stompError) Error() string {
+	return s.Message
+}
+
+func stompErrorf(format string, a ...interface{}) *stompError {
+	return &stompError{Message: fmt.Sprintf(format, a...)}
+}
+
+type stompHeader struct {
+	Name  string
+	Value string
+}
+
+type stompFrame struct {
+	Command string
+	Headers []stompHeader
+	Body    []byte
+}
+
+//Header returns the first value of a header, repeated headers after the first one are ignored
+func (f *stompFrame) Header(name string) string {
+
+	for _, h := range f.Headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+
+	return ""
+}
+
+func (f *stompFrame) hasHeader(name string) bool {
+
+	for _, h := range f.Headers {
+		if h.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+//CONNECT and CONNECTED frames are sent before the version is agreed, so their headers are never escaped
+func (f *stompFrame) escapesHeaders() bool {
+	return f.Command != "CONNECT" && f.Command != "STOMP" && f.Command != "CONNECTED"
+}
+
+var stompEscaper = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+
+func stompUnescape(s string) (string, error) {
+
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", stompErrorf("Undefined escape sequence in header %q", s)
+		}
+
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		case 'c':
+			b.WriteByte(':')
+		default:
+			return "", stompErrorf("Undefined escape sequence in header %q", s)
+		}
+	}
+
+	return b.String(), nil
+}
+
+//bytes encodes the frame for the wire
+func (f *stompFrame) bytes() []byte {
+
+	var b bytes.Buffer
+
+	b.WriteString(f.Command + "\n")
+	for _, h := range f.Headers {
+		if f.escapesHeaders() {
+			b.WriteString(stompEscaper.Replace(h.Name) + ":" + stompEscaper.Replace(h.Value) + "\n")
+		} else {
+			b.WriteString(h.Name + ":" + h.Value + "\n")
+		}
+	}
+	b.WriteString("\n")
+	b.Write(f.Body)
+	b.WriteByte(0)
+
+	return b.Bytes()
+}
+
+func readStompLine(r *bufio.Reader) (string, error) {
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+//readStompFrame reads the next frame, skipping the bare end of lines clients send as heart beats
+func readStompFrame(r *bufio.Reader) (*stompFrame, error) {
+
+	var line string
+	for len(line) == 0 {
+		var err error
+		if line, err = readStompLine(r); err != nil {
+			return nil, err
+		}
+	}
+
+	frame := &stompFrame{Command: line}
+
+	headerBytes := 0
+	for {
+		line, err := readStompLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 {
+			break
+		}
+
+		headerBytes += len(line)
+		if headerBytes > stompMaxHeaderBytes {
+			return nil, stompErrorf("Headers are larger than %d bytes", stompMaxHeaderBytes)
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, stompErrorf("Malformed header %q", line)
+		}
+
+		name, value := line[:i], line[i+1:]
+		if frame.escapesHeaders() {
+			if name, err = stompUnescape(name); err != nil {
+				return nil, err
+			}
+			if value, err = stompUnescape(value); err != nil {
+				return nil, err
+			}
+		}
+
+		frame.Headers = append(frame.Headers, stompHeader{name, value})
+	}
+
+	maxBody := q.MaxMessageSize * 1024
+
+	//With a content-length the body may contain NUL bytes, without one it ends at the first NUL
+	if frame.hasHeader("content-length") {
+		size, err := strconv.Atoi(frame.Header("content-length"))
+		if err != nil || size < 0 {
+			return nil, stompErrorf("Invalid content-length %q", frame.Header("content-length"))
+		}
+		if size > maxBody {
+			return nil, stompErrorf("Frame body is larger than %d bytes", maxBody)
+		}
+
+		frame.Body = make([]byte, size+1)
+		if _, err := io.ReadFull(r, frame.Body); err != nil {
+			return nil, err
+		}
+		if frame.Body[size] != 0 {
+			return nil, stompErrorf("Frame body is not followed by a NUL byte")
+		}
+		frame.Body = frame.Body[:size]
+
+		return frame, nil
+	}
+
+	for {
+		chunk, err := r.ReadSlice(0)
+		frame.Body = append(frame.Body, chunk...)
+		if err == nil {
+			break
+		} else if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+
+		if len(frame.Body) > maxBody {
+			return nil, stompErrorf("Frame body is larger than %d bytes", maxBody)
+		}
+	}
+	frame.Body = frame.Body[:len(frame.Body)-1]
+
+	return frame, nil
+}
+
+type stompSubscription struct {
+	id          string
+	ack         string
+	destination string
+	appName     string
+	queueName   string
+	visibility  time.Duration
+	credits     chan struct{} //one token for every leased message the subscription may still hand out
+	cancel      context.CancelFunc
+}
+
+func (s *stompSubscription) leased() bool {
+	return s.ack != stompAckAuto
+}
+
+//stompDelivery is a leased message waiting for the client to ACK or NACK it
+type stompDelivery struct {
+	sub      *stompSubscription
+	receipt  string
+	seq      uint64
+	deadline time.Time
+}
+
+type stompConn struct {
+	transport  io.ReadWriteCloser
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	remote     string
+
+	version   string
+	connected bool
+	identity  *auth.Identity //authenticated client, nil when authentication is off
+
+	mutex         sync.Mutex //guards subscriptions, pending and seq
+	subscriptions map[string]*stompSubscription
+	pending       map[string]*stompDelivery //by ack id
+	seq           uint64
+
+	deliverers sync.WaitGroup
+}
+
+//ServeStomp accepts STOMP connections until the listener is closed
+func ServeStomp(listen net.Listener) error {
+
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			return err
+		}
+
+		go serveStompConn(conn, conn.RemoteAddr().String())
+	}
+}
+
+//NewStompWebSocketHandler returns the handler that serves STOMP over WebSocket
+func NewStompWebSocketHandler() http.Handler {
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+
+		ws, err := upgradeWebSocket(rw, r, stompWebSocketProtocols)
+		if err != nil {
+			logger.Warn("Rejected websocket", "remote", r.RemoteAddr, "error", err)
+			return
+		}
+
+		serveStompConn(ws, r.RemoteAddr)
+	})
+}
+
+func serveStompConn(transport io.ReadWriteCloser, remote string) {
+
+	c := &stompConn{
+		transport:     transport,
+		reader:        bufio.NewReader(transport),
+		remote:        remote,
+		subscriptions: map[string]*stompSubscription{},
+		pending:       map[string]*stompDelivery{},
+	}
+
+	defer c.close()
+
+	for {
+		frame, err := readStompFrame(c.reader)
+		if err != nil {
+			if sErr, ok := err.(*stompError); ok {
+				c.sendError(sErr, "")
+			}
+			return
+		}
+
+		quit, err := c.handle(frame)
+		if err != nil {
+			sErr, ok := err.(*stompError)
+			if !ok {
+				sErr = toStompError(err)
+			}
+			c.sendError(sErr, frame.Header("receipt"))
+			return
+		}
+
+		if quit {
+			return
+		}
+	}
+}
+
+//close stops the subscriptions and makes the messages the client did not acknowledge visible again
+func (c *stompConn) close() {
+
+	c.mutex.Lock()
+	for _, sub := range c.subscriptions {
+		sub.cancel()
+	}
+	c.mutex.Unlock()
+
+	c.transport.Close()
+	c.deliverers.Wait()
+
+	for _, d := range c.pending {
+		if err := ChangeVisibility(d.sub.appName, d.sub.queueName, d.receipt, 0); err != nil {
+			logger.Warn("Unable to release message", "app", d.sub.appName, "queue", d.sub.queueName, "receipt", d.receipt, "remote", c.remote, "error", err)
+		}
+	}
+}
+
+func (c *stompConn) send(frame *stompFrame) error {
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	_, err := c.transport.Write(frame.bytes())
+	return err
+}
+
+func (c *stompConn) sendError(err *stompError, receipt string) {
+
+	frame := &stompFrame{Command: "ERROR", Headers: []stompHeader{{"message", err.Message}}}
+	if len(receipt) != 0 {
+		frame.Headers = append(frame.Headers, stompHeader{"receipt-id", receipt})
+	}
+
+	if len(err.Detail) != 0 {
+		frame.Headers = append(frame.Headers, stompHeader{"content-type", "text/plain"})
+		frame.Body = []byte(err.Detail)
+	}
+
+	c.send(frame)
+}
+
+//toStompError turns queue errors into ERROR frames
+func toStompError(err error) *stompError {
+
+	if qErr, ok := err.(*e.Error); ok {
+		return &stompError{Message: e.CodeNames[qErr.ErrorCode], Detail: qErr.ErrorMessage}
+	}
+
+	return &stompError{Message: err.Error()}
+}
+
+//handle runs one client frame and reports if the connection should be closed
+func (c *stompConn) handle(frame *stompFrame) (bool, error) {
+
+	if !c.connected && frame.Command != "CONNECT" && frame.Command != "STOMP" {
+		return false, stompErrorf("Expected a CONNECT frame, got %s", frame.Command)
+	}
+
+	var err error
+
+	switch frame.Command {
+	case "CONNECT", "STOMP":
+		//The CONNECTED frame is the reply, CONNECT never asks for a receipt
+		return false, c.connect(frame)
+
+	case "SEND":
+		err = c.sendMessage(frame)
+
+	case "SUBSCRIBE":
+		err = c.subscribe(frame)
+
+	case "UNSUBSCRIBE":
+		err = c.unsubscribe(frame)
+
+	case "ACK":
+		err = c.ack(frame, false)
+
+	case "NACK":
+		err = c.ack(frame, true)
+
+	case "BEGIN", "COMMIT", "ABORT":
+		err = stompErrorf("Transactions are not supported")
+
+	case "DISCONNECT":
+		c.sendReceipt(frame)
+		return true, nil
+
+	default:
+		err = stompErrorf("Unknown command %s", frame.Command)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	c.sendReceipt(frame)
+
+	return false, nil
+}
+
+func (c *stompConn) sendReceipt(frame *stompFrame) {
+
+	if receipt := frame.Header("receipt"); len(receipt) != 0 {
+		c.send(&stompFrame{Command: "RECEIPT", Headers: []stompHeader{{"receipt-id", receipt}}})
+	}
+}
+
+func (c *stompConn) connect(frame *stompFrame) error {
+
+	if c.connected {
+		return stompErrorf("Already connected")
+	}
+
+	//Clients that send no accept-version speak 1.0, which is not supported
+	for _, v := range strings.Split(frame.Header("accept-version"), ",") {
+		if v = strings.TrimSpace(v); (v == "1.2" || v == "1.1") && v > c.version {
+			c.version = v
+		}
+	}
+
+	if len(c.version) == 0 {
+		return &stompError{Message: "Supported protocol versions are 1.1 and 1.2", Detail: "Send accept-version:1.2 in the CONNECT frame"}
+	}
+
+	//The api key goes in passcode, or in login for clients that only send one credential
+	if keyStore != nil {
+		key := frame.Header("passcode")
+		if len(key) == 0 {
+			key = frame.Header("login")
+		}
+
+		id, ok := keyStore.Lookup(key)
+		if !ok {
+			logger.Warn("Rejected stomp client", "remote", c.remote, "error", "invalid api key")
+			return stompErrorf("Access refused: invalid api key")
+		}
+		c.identity = id
+	}
+
+	c.connected = true
+
+	return c.send(&stompFrame{Command: "CONNECTED", Headers: []stompHeader{
+		{"version", c.version},
+		{"server", stompServerName},
+		{"heart-beat", "0,0"},
+	}})
+}
+
+//queueFromDestination splits /queue/app/name and checks the client can use the queue
+func (c *stompConn) queueFromDestination(destination, perm string) (string, string, error) {
+
+	parts := strings.Split(strings.TrimPrefix(destination, stompQueuePrefix), "/")
+	if !strings.HasPrefix(destination, stompQueuePrefix) || len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", stompErrorf("Destination %q must have the form /queue/app/name", destination)
+	}
+
+	if c.identity != nil {
+		if err := c.identity.Authorize(parts[0], perm); err != nil {
+			return "", "", stompErrorf("Access refused to %s", destination)
+		}
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func (c *stompConn) sendMessage(frame *stompFrame) error {
+
+	if frame.hasHeader("transaction") {
+		return stompErrorf("Transactions are not supported")
+	}
+
+	appName, queueName, err := c.queueFromDestination(frame.Header("destination"), auth.PermEnqueue)
+	if err != nil {
+		return err
+	}
+
+	//The producer can pass its trace context in the traceparent and tracestate headers
+	ctx := remoteContext(context.Background(), frame.Header(tracing.TraceParentKey), frame.Header(tracing.TraceStateKey))
+
+	ctx, span := tracing.Start(ctx, "STOMP SEND", tracing.KindServer)
+	span.SetAttributes("messaging.system", "stomp", "messaging.destination", frame.Header("destination"))
+	defer span.Finish()
+
+	opts := EnqueueOptions{}
+	if frame.hasHeader("priority") {
+		priority, perr := strconv.ParseUint(frame.Header("priority"), 10, 8)
+		if perr != nil {
+			return stompErrorf("Invalid priority header %q", frame.Header("priority"))
+		}
+		opts.Priority = uint8(priority)
+	}
+	if frame.hasHeader("ttl") {
+		ttl, perr := strconv.ParseUint(frame.Header("ttl"), 10, 32)
+		if perr != nil {
+			return stompErrorf("Invalid ttl header %q", frame.Header("ttl"))
+		}
+		opts.TtlSeconds = uint32(ttl)
+	}
+	if frame.hasHeader("deliver-at") {
+		deliverAt, perr := time.Parse(time.RFC3339, frame.Header("deliver-at"))
+		if perr != nil {
+			return stompErrorf("Invalid deliver-at header %q", frame.Header("deliver-at"))
+		}
+		opts.DeliverAt = deliverAt
+	}
+	opts.GroupId, opts.DeduplicationId = frame.Header("group-id"), frame.Header("deduplication-id")
+
+	_, err = EnQueueWithOptions(ctx, appName, queueName, string(frame.Body), opts)
+	span.SetError(err)
+
+	return err
+}
+
+//appendTraceHeaders adds the trace context stored with a message to a MESSAGE frame
+func appendTraceHeaders(headers []stompHeader, attributes map[string]string) []stompHeader {
+
+	for _, key := range []string{tracing.TraceParentKey, tracing.TraceStateKey} {
+		if value, ok := attributes[key]; ok {
+			headers = append(headers, stompHeader{key, value})
+		}
+	}
+
+	return headers
+}
+
+func (c *stompConn) subscribe(frame *stompFrame) error {
+
+	id := frame.Header("id")
+	if len(id) == 0 {
+		return stompErrorf("SUBSCRIBE requires an id header")
+	}
+
+	ack := frame.Header("ack")
+	if len(ack) == 0 {
+		ack = stompAckAuto
+	}
+	if ack != stompAckAuto && ack != stompAckClient && ack != stompAckIndividual {
+		return stompErrorf("Unknown ack mode %q", ack)
+	}
+
+	destination := frame.Header("destination")
+	appName, queueName, err := c.queueFromDestination(destination, auth.PermDequeue)
+	if err != nil {
+		return err
+	}
+
+	stats, err := GetQueueStats(appName, queueName)
+	if err != nil {
+		return err
+	}
+
+	prefetch := stompDefaultPrefetch
+	if p := frame.Header("prefetch-count"); len(p) != 0 {
+		if prefetch, err = strconv.Atoi(p); err != nil || prefetch < 1 || prefetch > stompMaxPrefetch {
+			return stompErrorf("prefetch-count must be between 1 and %d", stompMaxPrefetch)
+		}
+	}
+
+	//Leases last for the queue's visibility timeout unless the subscription asks for another one
+	visibility := int(stats.MetaData.VisibilityTimeout)
+	if visibility == 0 {
+		visibility = q.DefaultVisibilityTimeout
+	}
+	if v := frame.Header("visibility-timeout"); len(v) != 0 {
+		if visibility, err = strconv.Atoi(v); err != nil || visibility < 1 || visibility > maxVisibilityTimeout() {
+			return stompErrorf("visibility-timeout must be between 1 and %d seconds", maxVisibilityTimeout())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sub := &stompSubscription{
+		id:          id,
+		ack:         ack,
+		destination: destination,
+		appName:     appName,
+		queueName:   queueName,
+		visibility:  time.Duration(visibility) * time.Second,
+		credits:     make(chan struct{}, prefetch),
+		cancel:      cancel,
+	}
+
+	for i := 0; i < prefetch; i++ {
+		sub.credits <- struct{}{}
+	}
+
+	c.mutex.Lock()
+	if _, ok := c.subscriptions[id]; ok {
+		c.mutex.Unlock()
+		cancel()
+		return stompErrorf("Subscription %s already exists", id)
+	}
+	c.subscriptions[id] = sub
+	c.mutex.Unlock()
+
+	c.deliverers.Add(1)
+	go c.deliver(ctx, sub)
+
+	return nil
+}
+
+func (c *stompConn) unsubscribe(frame *stompFrame) error {
+
+	id := frame.Header("id")
+
+	c.mutex.Lock()
+	sub, ok := c.subscriptions[id]
+	delete(c.subscriptions, id)
+	c.mutex.Unlock()
+
+	if !ok {
+		return stompErrorf("Subscription %q does not exist", id)
+	}
+
+	//Messages already delivered can still be acknowledged, the rest are released when the connection closes
+	sub.cancel()
+
+	return nil
+}
+
+//deliver sends messages from the queue to the subscription until it is cancelled
+func (c *stompConn) deliver(ctx context.Context, sub *stompSubscription) {
+
+	defer c.deliverers.Done()
+
+	leaseCheck := time.NewTicker(stompLeaseCheck)
+	defer leaseCheck.Stop()
+
+	for {
+		if sub.leased() {
+			//Wait until the client has room for another message
+			select {
+			case <-sub.credits:
+			case <-leaseCheck.C:
+				c.dropExpired(sub, time.Now())
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		frame, err := c.nextMessage(ctx, sub)
+
+		if isQueueError(err, e.QUEUE_DOES_NOT_EXIST) {
+			//The queue was deleted under the subscription
+			c.sendError(&stompError{Message: e.CodeNames[e.QUEUE_DOES_NOT_EXIST], Detail: sub.destination + " was deleted"}, "")
+			c.transport.Close()
+			return
+		}
+
+		if err != nil {
+			if sub.leased() {
+				sub.credits <- struct{}{}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if !isQueueError(err, e.QUEUE_EMPTY) {
+				logger.Error("Unable to read from the queue", "app", sub.appName, "queue", sub.queueName, "remote", c.remote, "error", err)
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+			}
+			continue
+		}
+
+		if err := c.send(frame); err != nil {
+			return
+		}
+	}
+}
+
+//nextMessage waits for a message and builds the MESSAGE frame for it. Leased messages are added to pending
+func (c *stompConn) nextMessage(ctx context.Context, sub *stompSubscription) (*stompFrame, error) {
+
+	frame := &stompFrame{Command: "MESSAGE", Headers: []stompHeader{
+		{"subscription", sub.id},
+		{"destination", sub.destination},
+	}}
+
+	if !sub.leased() {
+		m, err := DeQueueWait(ctx, sub.appName, sub.queueName, stompPollWait)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mutex.Lock()
+		c.seq++
+		id := strconv.FormatUint(c.seq, 10)
+		c.mutex.Unlock()
+
+		frame.Headers = append(frame.Headers, stompHeader{"message-id", id})
+		if len(m.GroupId) != 0 {
+			frame.Headers = append(frame.Headers, stompHeader{"group-id", m.GroupId})
+		}
+		frame.Headers = appendTraceHeaders(frame.Headers, m.Attributes)
+		frame.Body = []byte(m.Value)
+
+		return frame, nil
+	}
+
+	msg, err := ReceiveWait(ctx, sub.appName, sub.queueName, sub.visibility, stompPollWait)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.seq++
+	c.pending[msg.Receipt] = &stompDelivery{sub: sub, receipt: msg.Receipt, seq: c.seq, deadline: msg.Deadline}
+	c.mutex.Unlock()
+
+	//1.1 clients acknowledge with message-id, 1.2 clients with the ack header
+	messageId := msg.Id
+	if c.version == "1.1" {
+		messageId = msg.Receipt
+	}
+
+	frame.Headers = append(frame.Headers,
+		stompHeader{"message-id", messageId},
+		stompHeader{"ack", msg.Receipt},
+		stompHeader{"redelivered", strconv.FormatBool(msg.ReceiveCount > 1)})
+	if len(msg.GroupId) != 0 {
+		frame.Headers = append(frame.Headers, stompHeader{"group-id", msg.GroupId})
+	}
+	frame.Headers = appendTraceHeaders(frame.Headers, msg.Attributes)
+	frame.Body = []byte(msg.Body)
+
+	return frame, nil
+}
+
+//dropExpired forgets deliveries whose lease ran out. The reaper has made them visible again,
+//so the subscription gets their credit back
+func (c *stompConn) dropExpired(sub *stompSubscription, now time.Time) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id, d := range c.pending {
+		if d.sub == sub && now.After(d.deadline) {
+			delete(c.pending, id)
+
+			select {
+			case sub.credits <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+//ack deletes acknowledged messages, or makes them visible again for a NACK. In client mode the frame
+//covers every message of the subscription delivered up to the acknowledged one
+func (c *stompConn) ack(frame *stompFrame, nack bool) error {
+
+	id := frame.Header("id")
+	if c.version == "1.1" {
+		id = frame.Header("message-id")
+	}
+	if len(id) == 0 {
+		return stompErrorf("%s requires an id header", frame.Command)
+	}
+
+	if frame.hasHeader("transaction") {
+		return stompErrorf("Transactions are not supported")
+	}
+
+	c.mutex.Lock()
+	var done []*stompDelivery
+	if d, ok := c.pending[id]; ok {
+		for pid, p := range c.pending {
+			if p == d || (d.sub.ack == stompAckClient && p.sub == d.sub && p.seq < d.seq) {
+				done = append(done, p)
+				delete(c.pending, pid)
+			}
+		}
+	}
+	c.mutex.Unlock()
+
+	//An unknown id most likely belongs to a lease that expired, the message has already gone back to the queue
+	if len(done) == 0 {
+		logger.Debug("Ignoring acknowledgement for a message that is not pending", "command", frame.Command, "receipt", id, "remote", c.remote)
+		return nil
+	}
+
+	for _, d := range done {
+		var err error
+		if nack {
+			err = ChangeVisibility(d.sub.appName, d.sub.queueName, d.receipt, 0)
+		} else {
+			err = DeleteMessage(d.sub.appName, d.sub.queueName, d.receipt)
+		}
+
+		if err != nil {
+			logger.Warn("Unable to acknowledge message", "command", frame.Command, "app", d.sub.appName, "queue", d.sub.queueName, "receipt", d.receipt, "remote", c.remote, "error", err)
+		}
+
+		select {
+		case d.sub.credits <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
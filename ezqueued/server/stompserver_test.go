@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type stompClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newStompClient(t *testing.T) *stompClient {
+
+	server, client := net.Pipe()
+	go serveStompConn(server, "pipe")
+
+	c := &stompClient{t, client, bufio.NewReader(client)}
+
+	if frame := c.do("CONNECT", "accept-version:1.1,1.2", "host:localhost"); frame.Command != "CONNECTED" || frame.Header("version") != "1.2" {
+		t.Fatalf("CONNECT: want CONNECTED version 1.2, got %s %v", frame.Command, frame.Headers)
+	}
+
+	return c
+}
+
+func (c *stompClient) send(command string, body string, headers ...string) {
+
+	frame := &stompFrame{Command: command, Body: []byte(body)}
+	for _, h := range headers {
+		i := strings.Index(h, ":")
+		frame.Headers = append(frame.Headers, stompHeader{h[:i], h[i+1:]})
+	}
+
+	if _, err := c.conn.Write(frame.bytes()); err != nil {
+		c.t.Fatalf("Unable to send %s: %s", command, err.Error())
+	}
+}
+
+func (c *stompClient) read() *stompFrame {
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	frame, err := readStompFrame(c.reader)
+	if err != nil {
+		c.t.Fatalf("Unable to read a frame: %s", err.Error())
+	}
+
+	return frame
+}
+
+//do sends a frame without a body and returns the next frame from the server
+func (c *stompClient) do(command string, headers ...string) *stompFrame {
+
+	c.send(command, "", headers...)
+	return c.read()
+}
+
+func TestStompClientIndividualAck(t *testing.T) {
+
+	Create("stomptest", "jobs", 0, 0)
+	defer removeQueue("stomptest", "jobs")
+
+	c := newStompClient(t)
+	defer c.conn.Close()
+
+	c.send("SEND", "one", "destination:/queue/stomptest/jobs", "receipt:r1")
+	if frame := c.read(); frame.Command != "RECEIPT" || frame.Header("receipt-id") != "r1" {
+		t.Fatalf("SEND: want RECEIPT r1, got %s %v", frame.Command, frame.Headers)
+	}
+	c.send("SEND", "two", "destination:/queue/stomptest/jobs")
+
+	msg := c.do("SUBSCRIBE", "id:0", "destination:/queue/stomptest/jobs", "ack:client-individual", "prefetch-count:1")
+	if msg.Command != "MESSAGE" || string(msg.Body) != "one" || len(msg.Header("ack")) == 0 {
+		t.Fatalf("SUBSCRIBE: want MESSAGE one with an ack header, got %s %v %q", msg.Command, msg.Headers, msg.Body)
+	}
+
+	if stats, _ := GetQueueStats("stomptest", "jobs"); stats.InFlight != 1 || stats.Visible != 1 {
+		t.Errorf("Leased: want 1 visible and 1 in flight, got %+v", stats)
+	}
+
+	//NACK puts the message back at the head, so it is delivered again
+	msg = c.do("NACK", "id:"+msg.Header("ack"))
+	if string(msg.Body) != "one" || msg.Header("redelivered") != "true" {
+		t.Errorf("NACK: want one redelivered, got %v %q", msg.Headers, msg.Body)
+	}
+
+	msg = c.do("ACK", "id:"+msg.Header("ack"))
+	if string(msg.Body) != "two" {
+		t.Errorf("ACK: want two next, got %q", msg.Body)
+	}
+
+	if frame := c.do("ACK", "id:"+msg.Header("ack"), "receipt:r2"); frame.Command != "RECEIPT" {
+		t.Errorf("ACK: want RECEIPT, got %s", frame.Command)
+	}
+
+	if stats, _ := GetQueueStats("stomptest", "jobs"); stats.InFlight != 0 || stats.Visible != 0 {
+		t.Errorf("Acknowledged: want an empty queue, got %+v", stats)
+	}
+
+	if frame := c.do("DISCONNECT", "receipt:bye"); frame.Command != "RECEIPT" || frame.Header("receipt-id") != "bye" {
+		t.Errorf("DISCONNECT: want RECEIPT bye, got %s %v", frame.Command, frame.Headers)
+	}
+}
+
+func TestStompCloseReleasesLeases(t *testing.T) {
+
+	Create("stomptest", "release", 0, 0)
+	defer removeQueue("stomptest", "release")
+
+	EnQueue("stomptest", "release", "held")
+
+	c := newStompClient(t)
+
+	if msg := c.do("SUBSCRIBE", "id:0", "destination:/queue/stomptest/release", "ack:client"); string(msg.Body) != "held" {
+		t.Fatalf("SUBSCRIBE: want held, got %q", msg.Body)
+	}
+
+	c.conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats, _ := GetQueueStats("stomptest", "release")
+		if stats.Visible == 1 && stats.InFlight == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Closed connection: want the message visible again, got %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStompAutoAckAndErrors(t *testing.T) {
+
+	Create("stomptest", "auto", 0, 0)
+	defer removeQueue("stomptest", "auto")
+
+	EnQueue("stomptest", "auto", "gone")
+
+	c := newStompClient(t)
+	defer c.conn.Close()
+
+	if msg := c.do("SUBSCRIBE", "id:0", "destination:/queue/stomptest/auto"); string(msg.Body) != "gone" {
+		t.Fatalf("SUBSCRIBE: want gone, got %q", msg.Body)
+	}
+
+	if stats, _ := GetQueueStats("stomptest", "auto"); stats.InFlight != 0 || stats.Visible != 0 {
+		t.Errorf("Auto ack: want the message removed, got %+v", stats)
+	}
+
+	if frame := c.do("SEND", "destination:/topic/news"); frame.Command != "ERROR" {
+		t.Errorf("SEND to a topic: want ERROR, got %s", frame.Command)
+	}
+}
+
+func TestStompWebSocket(t *testing.T) {
+
+	server := httptest.NewServer(NewStompWebSocketHandler())
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /stomp HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: v10.stomp, v12.stomp\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The accept value for this key comes from RFC 6455
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" ||
+		resp.Header.Get("Sec-WebSocket-Protocol") != "v12.stomp" {
+		t.Fatalf("Handshake: got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	//Client frames are masked
+	payload := (&stompFrame{Command: "CONNECT", Headers: []stompHeader{{"accept-version", "1.2"}}}).bytes()
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x81, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatal(err)
+	}
+
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(reader, ext)
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		t.Fatal(err)
+	}
+
+	if header[0] != 0x81 || !bytes.HasPrefix(body, []byte("CONNECTED\n")) {
+		t.Errorf("CONNECT over websocket: want a CONNECTED text message, got %x %q", header[0], body)
+	}
+}
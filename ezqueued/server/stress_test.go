@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/wal"
+)
+
+//TestConcurrentQueueAccess runs producers and consumers on one queue while the maintenance work and other
+//queues come and go. Run it with -race
+func TestConcurrentQueueAccess(t *testing.T) {
+
+	const appName, queueName = "stress", "queue"
+	const producers, consumers, perProducer = 4, 4, 150
+
+	logsPath, queues := wal.Config.Logspath, queueInfo
+	wal.Config.Logspath, queueInfo = t.TempDir(), NewQueueWalInfo()
+	defer func() {
+		closeQueues()
+		wal.Config.Logspath, queueInfo = logsPath, queues
+	}()
+
+	//Creates of the same name at once, one of them wins
+	var created int32
+	var creates sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		creates.Add(1)
+		go func() {
+			defer creates.Done()
+			if err := Create(appName, queueName, 0, 0); err == nil {
+				atomic.AddInt32(&created, 1)
+			} else if !isQueueError(err, e.ALREADY_EXISTS) {
+				t.Errorf("Create: want ALREADY_EXISTS for the losers, got %v", err)
+			}
+		}()
+	}
+	creates.Wait()
+	if created != 1 {
+		t.Fatalf("Create of the same queue at once: want 1 to succeed, got %d", created)
+	}
+
+	done := make(chan struct{})
+	var background sync.WaitGroup
+
+	//Maintenance and readers of every queue
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			flushQueues()
+			for _, walInfo := range queueInfo.Iter() {
+				walInfo.RequeueExpired(time.Now())
+				walInfo.Stats()
+			}
+			GetQueueStats(appName, queueName)
+			Peek(appName, queueName)
+		}
+	}()
+
+	//Queues created and deleted while the others are used
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			name := fmt.Sprintf("churn%d", i%3)
+			Create(appName, name, 0, 0)
+			EnQueue(appName, name, "churn")
+			DeleteQueue(appName, name)
+		}
+	}()
+
+	var producing sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		producing.Add(1)
+		go func(p int) {
+			defer producing.Done()
+			for i := 0; i < perProducer; i++ {
+				if _, err := EnQueue(appName, queueName, fmt.Sprintf("%d-%d", p, i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+
+	//Consumers take messages with DeQueue and with leases until all of them are consumed
+	var mutex sync.Mutex
+	consumed := make(map[string]int)
+	var remaining int32 = producers * perProducer
+
+	var consuming sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		consuming.Add(1)
+		go func(c int) {
+			defer consuming.Done()
+
+			deadline := time.Now().Add(30 * time.Second)
+			for i := 0; atomic.LoadInt32(&remaining) > 0 && time.Now().Before(deadline); i++ {
+
+				var body string
+				if (c+i)%2 == 0 {
+					value, err := DeQueue(appName, queueName)
+					if isQueueError(err, e.QUEUE_EMPTY) {
+						time.Sleep(time.Millisecond)
+						continue
+					} else if err != nil {
+						t.Error(err)
+						return
+					}
+					body = value
+				} else {
+					m, err := Receive(appName, queueName, time.Minute)
+					if isQueueError(err, e.QUEUE_EMPTY) {
+						time.Sleep(time.Millisecond)
+						continue
+					} else if err != nil {
+						t.Error(err)
+						return
+					}
+					if err := DeleteMessage(appName, queueName, m.Receipt); err != nil {
+						t.Error(err)
+						return
+					}
+					body = m.Body
+				}
+
+				mutex.Lock()
+				consumed[body]++
+				mutex.Unlock()
+				atomic.AddInt32(&remaining, -1)
+			}
+		}(c)
+	}
+
+	producing.Wait()
+	consuming.Wait()
+	close(done)
+	background.Wait()
+
+	if len(consumed) != producers*perProducer {
+		t.Errorf("Consumers: want %d messages, got %d", producers*perProducer, len(consumed))
+	}
+	for body, n := range consumed {
+		if n != 1 {
+			t.Errorf("Consumers: want %s once, got it %d times", body, n)
+		}
+	}
+	if stats, err := GetQueueStats(appName, queueName); err != nil || stats.Visible != 0 || stats.InFlight != 0 {
+		t.Errorf("GetQueueStats: want an empty queue, got %+v %v", stats, err)
+	}
+}
+
+//TestConcurrentMessageGroups has consumers receive grouped messages in parallel. Each group must be handed
+//out in order and never to two consumers at once
+func TestConcurrentMessageGroups(t *testing.T) {
+
+	const appName, queueName = "stress", "groups"
+	const groups, perGroup, consumers = 6, 50, 4
+
+	logsPath, queues := wal.Config.Logspath, queueInfo
+	wal.Config.Logspath, queueInfo = t.TempDir(), NewQueueWalInfo()
+	defer func() {
+		closeQueues()
+		wal.Config.Logspath, queueInfo = logsPath, queues
+	}()
+
+	if err := Create(appName, queueName, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < perGroup; i++ {
+		for g := 0; g < groups; g++ {
+			opts := EnqueueOptions{GroupId: fmt.Sprintf("group%d", g)}
+			if _, err := EnQueueWithOptions(context.Background(), appName, queueName, fmt.Sprintf("%d", i), opts); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var mutex sync.Mutex
+	busy := make(map[string]bool)
+	next := make(map[string]int)
+	var remaining int32 = groups * perGroup
+
+	var consuming sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		consuming.Add(1)
+		go func() {
+			defer consuming.Done()
+
+			deadline := time.Now().Add(30 * time.Second)
+			for atomic.LoadInt32(&remaining) > 0 && time.Now().Before(deadline) {
+
+				m, err := Receive(appName, queueName, time.Minute)
+				if isQueueError(err, e.QUEUE_EMPTY) {
+					time.Sleep(time.Millisecond)
+					continue
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+
+				mutex.Lock()
+				if busy[m.GroupId] {
+					t.Errorf("Receive: %s of %s handed out while the group was in flight", m.Body, m.GroupId)
+				}
+				if m.Body != fmt.Sprintf("%d", next[m.GroupId]) {
+					t.Errorf("Receive: want %d of %s, got %s", next[m.GroupId], m.GroupId, m.Body)
+				}
+				busy[m.GroupId] = true
+				next[m.GroupId]++
+				mutex.Unlock()
+
+				//The group is marked free before the delete, so a consumer may get its next message right after
+				mutex.Lock()
+				busy[m.GroupId] = false
+				mutex.Unlock()
+				if err := DeleteMessage(appName, queueName, m.Receipt); err != nil {
+					t.Error(err)
+					return
+				}
+				atomic.AddInt32(&remaining, -1)
+			}
+		}()
+	}
+	consuming.Wait()
+
+	for g := 0; g < groups; g++ {
+		if n := next[fmt.Sprintf("group%d", g)]; n != perGroup {
+			t.Errorf("Consumers: want %d messages of group%d, got %d", perGroup, g, n)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/tracing"
+)
+
+//Spans for calls on every protocol. The trace context of the producer is stored with each message
+//under the traceparent and tracestate attributes and handed back to the consumer with the message
+
+//traceAttributes returns the message attributes that carry the trace context of ctx, nil if there is none
+func traceAttributes(ctx context.Context) map[string]string {
+
+	sc := tracing.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+
+	attributes := map[string]string{tracing.TraceParentKey: sc.TraceParent()}
+	if len(sc.TraceState) != 0 {
+		attributes[tracing.TraceStateKey] = sc.TraceState
+	}
+
+	return attributes
+}
+
+//messageSpanContext returns the trace context stored with a message. It is not valid if the producer did not send one
+func messageSpanContext(attributes map[string]string) tracing.SpanContext {
+
+	sc, _ := tracing.ParseTraceParent(attributes[tracing.TraceParentKey])
+	sc.TraceState = attributes[tracing.TraceStateKey]
+
+	return sc
+}
+
+//remoteContext returns ctx with the trace context sent by the caller, if it sent a valid one
+func remoteContext(ctx context.Context, traceParent, traceState string) context.Context {
+
+	sc, ok := tracing.ParseTraceParent(traceParent)
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = traceState
+
+	return tracing.ContextWithRemote(ctx, sc)
+}
+
+//tracingUnaryInterceptor starts a server span for every call, as a child of the traceparent in the metadata
+func tracingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if traceParent := md.Get(tracing.TraceParentKey); len(traceParent) != 0 {
+			traceState := md.Get(tracing.TraceStateKey)
+			ctx = remoteContext(ctx, traceParent[0], strings.Join(traceState, ","))
+		}
+	}
+
+	ctx, span := tracing.Start(ctx, strings.TrimPrefix(info.FullMethod, "/"), tracing.KindServer)
+	span.SetAttributes("rpc.system", "grpc", "rpc.method", info.FullMethod)
+
+	resp, err := handler(ctx, req)
+
+	span.SetAttributes("rpc.grpc.status_code", int(status.Code(err)))
+	span.SetError(err)
+	span.Finish()
+
+	return resp, err
+}
+
+//startHttpSpan starts a server span for a request, as a child of its traceparent header
+func startHttpSpan(r *http.Request, name string) (*http.Request, *tracing.Span) {
+
+	ctx := remoteContext(r.Context(), r.Header.Get(tracing.TraceParentKey), r.Header.Get(tracing.TraceStateKey))
+
+	ctx, span := tracing.Start(ctx, name, tracing.KindServer)
+	span.SetAttributes("http.method", r.Method, "http.target", r.URL.Path)
+
+	return r.WithContext(ctx), span
+}
+
+//statusWriter keeps the status code of a response for the span of the request
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+//finishHttpSpan records the response status and ends the span
+func finishHttpSpan(span *tracing.Span, rw *statusWriter) {
+
+	span.SetAttributes("http.status_code", rw.status)
+	if rw.status >= http.StatusInternalServerError {
+		span.SetErrorMessage(http.StatusText(rw.status))
+	}
+	span.Finish()
+}
+
+//setTraceHeaders returns the trace context stored with a message in the response headers
+func setTraceHeaders(header http.Header, attributes map[string]string) {
+
+	if traceParent, ok := attributes[tracing.TraceParentKey]; ok {
+		header.Set(tracing.TraceParentKey, traceParent)
+	}
+	if traceState, ok := attributes[tracing.TraceStateKey]; ok {
+		header.Set(tracing.TraceStateKey, traceState)
+	}
+}
+
+//configureTracing starts the exporter chosen in the config file
+func configureTracing() error {
+
+	c := serviceConfig.Tracing
+
+	if c.Exporter == tracing.ExporterFile && len(c.File) == 0 {
+		return &ConfigError{"the file trace exporter needs a file"}
+	}
+
+	return tracing.Configure(tracing.Options{Exporter: c.Exporter, Endpoint: c.Endpoint, File: c.File, ServiceName: c.ServiceName})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/tracing"
+)
+
+func doTraceRequest(method, url, body string, header http.Header) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+
+	rw := httptest.NewRecorder()
+	NewHttpHandler().ServeHTTP(rw, r)
+
+	return rw
+}
+
+func TestTraceContextStoredWithMessage(t *testing.T) {
+
+	defer removeQueue("tracetest", "queue-1")
+
+	const producer = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	base := "/v1/apps/tracetest/queues/queue-1"
+	doRequest(t, http.MethodPut, base, "", "")
+
+	//Enqueue over REST with the producer's trace context and a plain message without one
+	header := http.Header{}
+	header.Set(tracing.TraceParentKey, producer)
+	header.Set(tracing.TraceStateKey, "vendor=1")
+
+	rw := doTraceRequest(http.MethodPost, base+"/messages", "traced", header)
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("Enqueue: want %d, got %d", http.StatusCreated, rw.Code)
+	}
+	EnQueue("tracetest", "queue-1", "untraced")
+
+	//The stored context survives a restart
+	walInfo, _ := queueInfo.Delete("tracetestqueue-1")
+	walInfo.WalFile.Close()
+	walInfo.WalControlFile.Close()
+
+	if err := RecoverQueues(); err != nil {
+		t.Fatal(err)
+	}
+
+	rw = doTraceRequest(http.MethodGet, base+"/messages?visibility=30", "", nil)
+	if got := rw.Header().Get(tracing.TraceParentKey); got != producer {
+		t.Errorf("Receive: want traceparent %s, got %q", producer, got)
+	}
+	if got := rw.Header().Get(tracing.TraceStateKey); got != "vendor=1" {
+		t.Errorf("Receive: want tracestate vendor=1, got %q", got)
+	}
+
+	m, err := DeQueueContext(context.Background(), "tracetest", "queue-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Value != "untraced" || m.Attributes != nil {
+		t.Errorf("DeQueue: want untraced without attributes, got %q %v", m.Value, m.Attributes)
+	}
+
+	//The trace context is carried over when the server span is not recorded
+	ctx := tracing.ContextWithRemote(context.Background(), messageSpanContext(map[string]string{tracing.TraceParentKey: producer}))
+	EnQueueContext(ctx, "tracetest", "queue-1", "from grpc")
+
+	m, _ = DeQueueWait(ctx, "tracetest", "queue-1", time.Second)
+	if m == nil || m.Attributes[tracing.TraceParentKey] != producer {
+		t.Errorf("DeQueueWait: want traceparent %s, got %+v", producer, m)
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//Server side of RFC 6455, enough to carry a text protocol such as STOMP over WebSocket
+
+const websocketGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+//wsMaxControlPayload is the largest payload a control frame may carry
+const wsMaxControlPayload = 125
+
+var errWebSocketHandshake = errors.New("not a websocket handshake")
+
+//wsConn reads the payload of incoming data frames as one byte stream and sends every Write as one message
+type wsConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+
+	remaining uint64  //bytes left in the current data frame
+	mask      [4]byte //mask key of the current data frame
+	masked    bool
+	offset    int //position in the mask key
+	closed    bool
+}
+
+//upgradeWebSocket completes the opening handshake and takes over the connection.
+//protocols lists the subprotocols the server speaks, the first one the client also offers is selected
+func upgradeWebSocket(rw http.ResponseWriter, r *http.Request, protocols []string) (*wsConn, error) {
+
+	if r.Method != http.MethodGet || !headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") || r.Header.Get("Sec-WebSocket-Version") != "13" {
+
+		rw.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(rw, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errWebSocketHandshake
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if len(key) == 0 {
+		http.Error(rw, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errWebSocketHandshake
+	}
+
+	protocol := ""
+	for _, p := range protocols {
+		if headerHasToken(r.Header, "Sec-WebSocket-Protocol", p) {
+			protocol = p
+			break
+		}
+	}
+
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		http.Error(rw, "websocket is not supported on this connection", http.StatusInternalServerError)
+		return nil, errWebSocketHandshake
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGuid))
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n"
+	if len(protocol) != 0 {
+		response += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	response += "\r\n"
+
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, reader: buf.Reader}, nil
+}
+
+//headerHasToken checks a comma separated header for a token, ignoring case
+func headerHasToken(header http.Header, name, token string) bool {
+
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//Read returns the payload of data frames. Control frames are answered as they arrive
+func (w *wsConn) Read(p []byte) (int, error) {
+
+	for w.remaining == 0 {
+		if w.closed {
+			return 0, io.EOF
+		}
+
+		if err := w.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(p)) > w.remaining {
+		p = p[:w.remaining]
+	}
+
+	n, err := w.reader.Read(p)
+	if w.masked {
+		for i := 0; i < n; i++ {
+			p[i] ^= w.mask[w.offset%4]
+			w.offset++
+		}
+	}
+	w.remaining -= uint64(n)
+
+	return n, err
+}
+
+//nextFrame reads frame headers until a data frame with a payload starts
+func (w *wsConn) nextFrame() error {
+
+	var header [2]byte
+	if _, err := io.ReadFull(w.reader, header[:]); err != nil {
+		return err
+	}
+
+	opcode := header[0] & 0x0F
+	w.masked = header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(w.reader, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(w.reader, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if w.masked {
+		if _, err := io.ReadFull(w.reader, w.mask[:]); err != nil {
+			return err
+		}
+	}
+	w.offset = 0
+
+	switch opcode {
+	case wsOpContinuation, wsOpText, wsOpBinary:
+		w.remaining = length
+		return nil
+	}
+
+	//Control frames are small and handled here
+	if length > wsMaxControlPayload {
+		return errors.New("websocket control frame is too large")
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(w.reader, payload); err != nil {
+		return err
+	}
+	if w.masked {
+		for i := range payload {
+			payload[i] ^= w.mask[i%4]
+		}
+	}
+
+	switch opcode {
+	case wsOpPing:
+		return w.writeFrame(wsOpPong, payload)
+	case wsOpClose:
+		w.closed = true
+		//Echo the status code back to finish the closing handshake
+		if len(payload) > 2 {
+			payload = payload[:2]
+		}
+		w.writeFrame(wsOpClose, payload)
+	}
+
+	return nil
+}
+
+//Write sends p as one message. Text that is not valid UTF-8 goes out as a binary message
+func (w *wsConn) Write(p []byte) (int, error) {
+
+	opcode := byte(wsOpText)
+	if !utf8.Valid(p) {
+		opcode = wsOpBinary
+	}
+
+	if err := w.writeFrame(opcode, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *wsConn) writeFrame(opcode byte, payload []byte) error {
+
+	//Server frames are never masked
+	header := []byte{0x80 | opcode, 0}
+
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+
+	_, err := w.conn.Write(append(header, payload...))
+	return err
+}
+
+//Close sends a normal closure frame and closes the connection
+func (w *wsConn) Close() error {
+
+	w.writeFrame(wsOpClose, []byte{0x03, 0xE8})
+
+	return w.conn.Close()
+}
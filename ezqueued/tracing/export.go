@@ -0,0 +1,346 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
+)
+
+//Exporters
+const (
+	ExporterOtlp = "otlp" //OTLP/HTTP with the JSON encoding, Ex: to an OpenTelemetry collector
+	ExporterFile = "file" //one OTLP JSON request per line, readable by the collector's otlpjsonfile receiver
+)
+
+const (
+	maxQueuedSpans = 2048
+	maxBatchSize   = 512
+	exportInterval = 5 * time.Second
+	exportTimeout  = 10 * time.Second
+)
+
+type Options struct {
+	Exporter    string //ExporterOtlp or ExporterFile, tracing is off when empty
+	Endpoint    string //OTLP/HTTP base url, Ex: http://localhost:4318. /v1/traces is added to it
+	File        string //path of the file exporter
+	ServiceName string
+}
+
+//Exporter sends a batch of finished spans somewhere
+type Exporter interface {
+	Export(spans []*Span) error
+	Close() error
+}
+
+//Configure turns tracing on with the exporter in the options, or off when no exporter is set.
+//Spans already queued for the previous exporter are flushed first
+func Configure(o Options) error {
+
+	var exporter Exporter
+
+	switch o.Exporter {
+	case "":
+	case ExporterOtlp:
+		if len(o.Endpoint) == 0 {
+			return fmt.Errorf("the otlp exporter needs an endpoint")
+		}
+		exporter = &otlpExporter{
+			url:     strings.TrimSuffix(o.Endpoint, "/") + "/v1/traces",
+			client:  &http.Client{Timeout: exportTimeout},
+			service: o.ServiceName,
+		}
+	case ExporterFile:
+		f, err := os.OpenFile(o.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		exporter = &fileExporter{file: f, service: o.ServiceName}
+	default:
+		return fmt.Errorf("unknown trace exporter %q, want %s or %s", o.Exporter, ExporterOtlp, ExporterFile)
+	}
+
+	var p *batchProcessor
+	if exporter != nil {
+		p = newBatchProcessor(exporter)
+	}
+
+	tracer.mutex.Lock()
+	old := tracer.processor
+	tracer.processor = p
+	tracer.mutex.Unlock()
+
+	if old != nil {
+		old.shutdown()
+	}
+
+	return nil
+}
+
+//Shutdown flushes the queued spans and turns tracing off
+func Shutdown() {
+	Configure(Options{})
+}
+
+//batchProcessor queues finished spans and exports them in batches from its own go routine,
+//so a slow exporter never holds up a request. Spans are dropped when the queue is full
+type batchProcessor struct {
+	exporter Exporter
+	spans    chan *Span
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newBatchProcessor(exporter Exporter) *batchProcessor {
+
+	p := &batchProcessor{exporter: exporter, spans: make(chan *Span, maxQueuedSpans), done: make(chan struct{})}
+	go p.run()
+
+	return p
+}
+
+func (p *batchProcessor) add(s *Span) {
+
+	select {
+	case p.spans <- s:
+	default:
+	}
+}
+
+func (p *batchProcessor) run() {
+
+	defer close(p.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.exporter.Export(batch); err != nil {
+			logging.Default().Warn("Unable to export spans", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s, ok := <-p.spans:
+			if !ok {
+				export()
+				p.exporter.Close()
+				return
+			}
+
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSize {
+				export()
+			}
+
+		case <-ticker.C:
+			export()
+		}
+	}
+}
+
+func (p *batchProcessor) shutdown() {
+
+	p.once.Do(func() { close(p.spans) })
+	<-p.done
+}
+
+type fileExporter struct {
+	file    *os.File
+	service string
+}
+
+func (f *fileExporter) Export(spans []*Span) error {
+
+	b, err := json.Marshal(otlpRequest(f.service, spans))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.file.Write(append(b, '\n'))
+	return err
+}
+
+func (f *fileExporter) Close() error {
+	return f.file.Close()
+}
+
+type otlpExporter struct {
+	url     string
+	client  *http.Client
+	service string
+}
+
+func (o *otlpExporter) Export(spans []*Span) error {
+
+	b, err := json.Marshal(otlpRequest(o.service, spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.Post(o.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", o.url, resp.Status)
+	}
+
+	return nil
+}
+
+func (o *otlpExporter) Close() error {
+	return nil
+}
+
+//OTLP JSON encoding of ExportTraceServiceRequest. Ids are hex strings and times are nanoseconds in strings
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpLink struct {
+	TraceId    string `json:"traceId"`
+	SpanId     string `json:"spanId"`
+	TraceState string `json:"traceState,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` //0 unset, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func otlpValue(v interface{}) otlpAnyValue {
+
+	var i int64
+	switch v := v.(type) {
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	case int:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint64:
+		i = int64(v)
+	case uint32:
+		i = int64(v)
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+
+	s := strconv.FormatInt(i, 10)
+	return otlpAnyValue{IntValue: &s}
+}
+
+func otlpRequest(service string, spans []*Span) otlpTraces {
+
+	if len(service) == 0 {
+		service = "ezqueued"
+	}
+
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mutex.Lock()
+
+		span := otlpSpan{
+			TraceId:           s.Context.TraceID.String(),
+			SpanId:            s.Context.SpanID.String(),
+			TraceState:        s.Context.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+
+		if s.Parent.IsValid() {
+			span.ParentSpanId = s.Parent.SpanID.String()
+		}
+
+		for _, a := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpKeyValue{a.Key, otlpValue(a.Value)})
+		}
+
+		for _, l := range s.Links {
+			span.Links = append(span.Links, otlpLink{l.TraceID.String(), l.SpanID.String(), l.TraceState})
+		}
+
+		if s.StatusError {
+			span.Status = otlpStatus{Code: 2, Message: s.StatusMessage}
+		}
+
+		s.mutex.Unlock()
+
+		out = append(out, span)
+	}
+
+	return otlpTraces{[]otlpResourceSpans{{
+		Resource:   otlpResource{[]otlpKeyValue{{"service.name", otlpValue(service)}}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{"github.com/coderagr/ezqueue-service/ezqueued"}, Spans: out}},
+	}}}
+}
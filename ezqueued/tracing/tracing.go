@@ -0,0 +1,266 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Spans in the OpenTelemetry data model with W3C trace context propagation.
+//Tracing is off until Configure installs an exporter. While it is off spans are not recorded,
+//but the trace context of the caller still flows through so it can be stored with messages
+
+//Metadata keys, http headers and message attributes that carry the trace context
+const (
+	TraceParentKey = "traceparent"
+	TraceStateKey  = "tracestate"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+const flagSampled = 0x01
+
+//SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+//TraceParent formats the span context as a W3C traceparent header
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+//ParseTraceParent reads a W3C traceparent header. ok is false if the header is not valid
+func ParseTraceParent(traceParent string) (sc SpanContext, ok bool) {
+
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, false
+	}
+	sc.Flags = flags[0]
+
+	return sc, sc.IsValid()
+}
+
+//Span kinds
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+	KindProducer = 4
+	KindConsumer = 5
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{} //string, bool, int, int64, uint64 or float64
+}
+
+//Span is one timed operation. A span that is not recorded only carries its context
+type Span struct {
+	mutex sync.Mutex
+
+	Name          string
+	Kind          int
+	Context       SpanContext
+	Parent        SpanContext
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Links         []SpanContext
+	StatusError   bool
+	StatusMessage string
+
+	recording bool
+	ended     bool
+}
+
+//IsRecording reports if the span will be exported, callers can skip building attributes when it is not
+func (s *Span) IsRecording() bool {
+	return s != nil && s.recording
+}
+
+//SetAttributes adds key value pairs to the span
+func (s *Span) SetAttributes(kv ...interface{}) {
+
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i+1 < len(kv); i += 2 {
+		s.Attributes = append(s.Attributes, Attribute{fmt.Sprint(kv[i]), kv[i+1]})
+	}
+}
+
+//AddLink links the span to another one, Ex: a dequeue to the enqueue that produced the message
+func (s *Span) AddLink(sc SpanContext) {
+
+	if !s.IsRecording() || !sc.IsValid() {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Links = append(s.Links, sc)
+}
+
+//SetError marks the span as failed, nothing is done if err is nil
+func (s *Span) SetError(err error) {
+
+	if err != nil {
+		s.SetErrorMessage(err.Error())
+	}
+}
+
+//SetErrorMessage marks the span as failed with a description of the failure
+func (s *Span) SetErrorMessage(message string) {
+
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.StatusError = true
+	s.StatusMessage = message
+}
+
+//Finish ends the span and hands it to the exporter
+func (s *Span) Finish() {
+
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mutex.Unlock()
+
+	//Hold the lock while adding so Configure cannot close the processor under it
+	tracer.mutex.RLock()
+	defer tracer.mutex.RUnlock()
+
+	if tracer.processor != nil {
+		tracer.processor.add(s)
+	}
+}
+
+type tracerState struct {
+	mutex     sync.RWMutex
+	processor *batchProcessor
+}
+
+var tracer tracerState
+
+//Enabled reports if spans are being recorded
+func Enabled() bool {
+
+	tracer.mutex.RLock()
+	defer tracer.mutex.RUnlock()
+
+	return tracer.processor != nil
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+//ContextWithRemote returns a context whose spans are children of a span in another process
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+
+	if !sc.IsValid() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+//SpanFromContext returns the current span, nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+//SpanContextFromContext returns the context of the current span, or the remote parent when no span was started
+func SpanContextFromContext(ctx context.Context) SpanContext {
+
+	if s := SpanFromContext(ctx); s != nil {
+		return s.Context
+	}
+
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+//Start begins a span as a child of the span in the context. The returned context carries the new span
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+
+	parent := SpanContextFromContext(ctx)
+
+	s := &Span{Name: name, Kind: kind, Parent: parent, Start: time.Now()}
+
+	//A parent that was not sampled keeps its children out of the trace as well
+	s.recording = Enabled() && (!parent.IsValid() || parent.IsSampled())
+
+	if !s.recording {
+		//Pass the parent context along unchanged so it can still be propagated
+		s.Context = parent
+		return context.WithValue(ctx, spanKey{}, s), s
+	}
+
+	if parent.IsValid() {
+		s.Context.TraceID = parent.TraceID
+		s.Context.TraceState = parent.TraceState
+	} else {
+		rand.Read(s.Context.TraceID[:])
+	}
+	rand.Read(s.Context.SpanID[:])
+	s.Context.Flags = flagSampled
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, ok := ParseTraceParent(valid)
+	if !ok {
+		t.Fatalf("Want %s to parse", valid)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.IsSampled() {
+		t.Errorf("Parsed %s into %+v", valid, sc)
+	}
+	if sc.TraceParent() != valid {
+		t.Errorf("Want %s back, got %s", valid, sc.TraceParent())
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceParent(invalid); ok {
+			t.Errorf("Want %q to be rejected", invalid)
+		}
+	}
+
+	//Later versions can add fields after the flags
+	if _, ok := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Errorf("Want a later version with more fields to parse")
+	}
+}
+
+func TestDisabledSpansKeepTheParent(t *testing.T) {
+
+	parent, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, span := Start(ContextWithRemote(context.Background(), parent), "test", KindServer)
+	defer span.Finish()
+
+	if span.IsRecording() {
+		t.Errorf("Want spans to be off until an exporter is configured")
+	}
+	if SpanContextFromContext(ctx) != parent {
+		t.Errorf("Want the parent context to pass through, got %+v", SpanContextFromContext(ctx))
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+
+	file := path.Join(t.TempDir(), "spans.json")
+	if err := Configure(Options{Exporter: ExporterFile, File: file, ServiceName: "tracing-test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	parent, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	producer, _ := ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	ctx, server := Start(ContextWithRemote(context.Background(), parent), "Ezqueued/Dequeue", KindServer)
+	_, child := Start(ctx, "wal.move_head", KindInternal)
+	child.SetAttributes("queue", "q1", "lsn", uint64(48))
+	child.AddLink(producer)
+	child.Finish()
+	server.Finish()
+
+	//Shutdown flushes the spans to the file
+	Shutdown()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []otlpSpan
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		req := otlpTraces{}
+		if err := json.Unmarshal(lines.Bytes(), &req); err != nil {
+			t.Fatalf("Want a JSON request per line, got %q", lines.Text())
+		}
+		for _, rs := range req.ResourceSpans {
+			if v := rs.Resource.Attributes[0].Value.StringValue; v == nil || *v != "tracing-test" {
+				t.Errorf("Want service.name tracing-test, got %+v", rs.Resource.Attributes)
+			}
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+
+	if len(spans) != 2 {
+		t.Fatalf("Want 2 spans, got %d", len(spans))
+	}
+
+	c, s := spans[0], spans[1]
+	if s.TraceId != parent.TraceID.String() || s.ParentSpanId != parent.SpanID.String() || s.Kind != KindServer {
+		t.Errorf("Server span is not a child of the remote parent: %+v", s)
+	}
+	if c.TraceId != s.TraceId || c.ParentSpanId != s.SpanId {
+		t.Errorf("Internal span is not a child of the server span: %+v", c)
+	}
+	if len(c.Links) != 1 || c.Links[0].TraceId != producer.TraceID.String() || c.Links[0].SpanId != producer.SpanID.String() {
+		t.Errorf("Want a link to the producer, got %+v", c.Links)
+	}
+	if len(c.Attributes) != 2 || c.Attributes[1].Value.IntValue == nil || *c.Attributes[1].Value.IntValue != "48" {
+		t.Errorf("Want the lsn as an int attribute, got %+v", c.Attributes)
+	}
+}
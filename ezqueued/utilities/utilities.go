@@ -3,20 +3,23 @@ package utilities
 import (
 	"fmt"
 	"strings"
+
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
 )
 
-func IsValidCreateQueueInput(appName, name string, delaySeconds *uint16, visibilityTimeout *uint16) error {
+//IsValidCreateQueueInput checks the settings of a new queue. A visibility timeout above maxVisibilityTimeout seconds is rejected
+func IsValidCreateQueueInput(appName, name string, delaySeconds *uint16, visibilityTimeout *uint16, maxVisibilityTimeout int) error {
 
 	if len(strings.TrimSpace(appName)) == 0 || len(strings.TrimSpace(name)) == 0 {
 		return &InvalidInputError{appName, name, "One more inputs were empty"}
 	}
 
-	if *delaySeconds > 30 {
+	if *delaySeconds > q.MaxDelaySeconds {
 		*delaySeconds = 0
 	}
 
-	if *visibilityTimeout > 30 {
-		*visibilityTimeout = 0
+	if int(*visibilityTimeout) > maxVisibilityTimeout {
+		return &InvalidInputError{appName, name, fmt.Sprintf("visibility timeout must be at most %d seconds", maxVisibilityTimeout)}
 	}
 
 	return nil
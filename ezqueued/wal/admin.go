@@ -0,0 +1,260 @@
+package wal
+
+import (
+	"os"
+	"path"
+	"strconv"
+)
+
+//Operator views of a queue and its wal files
+
+//Control returns a copy of the control info of the queue
+func (w *QueueInfo) Control() WalControl {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	return *w.WalControlInfo
+}
+
+//SetPaused pauses or resumes the queue. A paused queue keeps taking messages but hands none out.
+//The setting is saved in the control file so it lasts through a restart
+func (w *QueueInfo) SetPaused(paused bool) error {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	w.WalControlInfo.Paused = paused
+
+	//Wake up the readers that waited while the queue was paused
+	if !paused && w.appendSignal != nil {
+		close(w.appendSignal)
+		w.appendSignal = nil
+	}
+
+	return w.saveControlFile()
+}
+
+//Flush syncs the wal file and saves the control file
+func (w *QueueInfo) Flush() error {
+
+	if err := w.FlushWalFile(); err != nil {
+		return err
+	}
+
+	return w.FlushControlFile()
+}
+
+//SegmentInfo describes one wal file of a queue
+type SegmentInfo struct {
+	FileNum uint64
+	Name    string
+	Size    int64
+	Live    bool //read by recovery, it holds the head, a later item or a deduplication id still in its window
+	Missing bool //the file is not in the logs directory
+}
+
+//Segments lists the wal files of the queue from the first to the tail
+func (w *QueueInfo) Segments() []SegmentInfo {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	return w.segments(1)
+}
+
+//segments lists the wal files from firstFileNum on. The caller must hold the queue lock
+func (w *QueueInfo) segments(firstFileNum uint64) []SegmentInfo {
+
+	var segments []SegmentInfo
+
+	for walFileNum := firstFileNum; walFileNum <= w.WalControlInfo.TailLsnFileNum; walFileNum++ {
+		s := SegmentInfo{FileNum: walFileNum, Name: w.LogFileName(walFileNum), Live: walFileNum >= w.WalControlInfo.FirstFileNum()}
+
+		fileInfo, err := os.Stat(path.Join(Config.Logspath, s.Name))
+		if err != nil {
+			s.Missing = true
+		} else {
+			s.Size = fileInfo.Size()
+		}
+
+		segments = append(segments, s)
+	}
+
+	return segments
+}
+
+//CollectSegments deletes the wal files before the head, except the ones with deduplication ids still in their window.
+//Nothing in them is read again, not even by recovery.
+//It returns the files that were removed
+func (w *QueueInfo) CollectSegments() ([]SegmentInfo, error) {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	//Recovery reads from the head in the control file, so it is saved before the files before it go
+	if w.controlChanged {
+		if err := w.WalFile.Sync(); err != nil {
+			return nil, err
+		}
+		if err := w.flushControl(); err != nil {
+			return nil, err
+		}
+	}
+
+	var removed []SegmentInfo
+
+	for _, s := range w.segments(1) {
+		if s.Live || s.Missing {
+			continue
+		}
+
+		if err := FS.Remove(path.Join(Config.Logspath, s.Name)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+
+		removed = append(removed, s)
+	}
+
+	if len(removed) != 0 {
+		w.log().Info("Removed wal files before the head", "files", len(removed), "head_file", w.WalControlInfo.HeadLsnFileNum)
+	}
+
+	return removed, nil
+}
+
+//Record is a wal item as it is shown to an operator
+type Record struct {
+	WalItem
+	Body       string            //message body of enqueue items
+	Attributes map[string]string //message attributes of enqueue items
+	Id         string            //id of the message an enqueue item adds or a delete item removes
+	State      string            //visible, in_flight, scheduled or removed for enqueue items
+	Priority   uint8             //priority of enqueue items
+	GroupId    string            //group of enqueue items
+}
+
+//Message states of Record
+const (
+	StateVisible   = "visible"
+	StateInFlight  = "in_flight"
+	StateRemoved   = "removed"
+	StateScheduled = "scheduled"
+)
+
+//TypeName returns the name of a wal item type
+func TypeName(t WalType) string {
+
+	switch t {
+	case ENQUEUE:
+		return "ENQUEUE"
+	case DEQUEUE:
+		return "DEQUEUE"
+	case DELETE:
+		return "DELETE"
+	case ENQUEUE_ATTRS:
+		return "ENQUEUE_ATTRS"
+	case ENQUEUE_OPTIONS:
+		return "ENQUEUE_OPTIONS"
+	case EXPIRE:
+		return "EXPIRE"
+	}
+
+	return strconv.FormatUint(uint64(t), 10)
+}
+
+//Browse returns up to limit wal items from the start position up to and including the end position,
+//without taking anything from the queue. An end of 0,0 reads to the tail. next is the position after
+//the last item returned, 0,0 when the end was reached
+func (w *QueueInfo) Browse(startFileNum, startLsn, endFileNum, endLsn uint64, limit int) (records []Record, nextFileNum, nextLsn uint64, err error) {
+
+	//Take a snapshot of where the wal ends and which messages are still live, then read the files without the lock
+	w.queueAccessMutex.Lock()
+	tailFileNum, tailNextLsn := w.WalControlInfo.TailLsnFileNum, w.WalControlInfo.NextLsn
+	states := make(map[string]string)
+	for i := uint64(0); i < w.Queue.Count; i++ {
+		states[w.Queue.At(i).Id()] = StateVisible
+	}
+	for id := range w.inFlight {
+		states[id] = StateInFlight
+	}
+	for _, m := range w.timers.due {
+		states[m.Id()] = StateScheduled
+	}
+	w.queueAccessMutex.Unlock()
+
+	if endFileNum == 0 && endLsn == 0 {
+		endFileNum, endLsn = tailFileNum, tailNextLsn
+	}
+	if startFileNum == 0 {
+		startFileNum = 1
+	}
+
+	for walFileNum := startFileNum; walFileNum <= endFileNum && walFileNum <= tailFileNum; walFileNum++ {
+
+		lsn := uint64(0)
+		if walFileNum == startFileNum {
+			lsn = startLsn
+		}
+
+		filePath := path.Join(Config.Logspath, w.LogFileName(walFileNum))
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			//The file was removed by CollectSegments
+			continue
+		}
+
+		full := false
+		_, err := ReadItems(filePath, lsn, func(item WalItem) bool {
+
+			//Items appended after the snapshot are left for the next call
+			if walFileNum == tailFileNum && item.Lsn >= tailNextLsn {
+				return false
+			}
+			if walFileNum == endFileNum && item.Lsn > endLsn {
+				return false
+			}
+
+			if len(records) == limit {
+				full = true
+				nextFileNum, nextLsn = walFileNum, item.Lsn
+				return false
+			}
+
+			records = append(records, newRecord(item, states))
+			return true
+		})
+		if err != nil {
+			return records, 0, 0, err
+		}
+
+		if full {
+			return records, nextFileNum, nextLsn, nil
+		}
+	}
+
+	return records, 0, 0, nil
+}
+
+func newRecord(item WalItem, states map[string]string) Record {
+
+	r := Record{WalItem: item}
+
+	switch item.ItemType {
+	case ENQUEUE, ENQUEUE_ATTRS, ENQUEUE_OPTIONS:
+		r.Body, r.Attributes, _ = DecodeMessage(item)
+		if opts, err := DecodeOptions(item); err == nil {
+			r.Priority, r.GroupId = opts.Priority, opts.GroupId
+		}
+		r.Id = item.Id()
+
+		r.State = states[r.Id]
+		if len(r.State) == 0 {
+			r.State = StateRemoved
+		}
+
+	case DELETE, EXPIRE:
+		r.Id, _ = DeletedId(item)
+	}
+
+	return r
+}
@@ -0,0 +1,432 @@
+package wal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Offline checks of a queue's control file against its wal files, for when the daemon is not running.
+//The files are read from a directory given by the caller, not from Config
+
+//ReadControl reads a control file
+func ReadControl(filePath string) (WalControl, error) {
+
+	var c WalControl
+
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+//WriteControl replaces a control file. The new content is written to a temporary file that is renamed over it
+func WriteControl(filePath string, c WalControl) error {
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return err
+	}
+
+	tmp := filePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0664); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filePath)
+}
+
+//ControlFiles returns the names of the control files in dir
+func ControlFiles(dir string) ([]string, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ControlFileExtn) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+//segmentNumbers returns the numbers of the wal files of a queue found in dir, lowest first
+func segmentNumbers(dir, appName, queueName string) ([]uint64, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := appName + queueName + "-"
+
+	var nums []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, Logsextn) {
+			continue
+		}
+
+		num, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), Logsextn), 10, 64)
+		if err != nil || num == 0 {
+			continue
+		}
+		nums = append(nums, num)
+	}
+
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	return nums, nil
+}
+
+//SegmentScan is what a read of one wal file found
+type SegmentScan struct {
+	FileNum  uint64
+	Name     string
+	Missing  bool
+	Size     int64 //bytes in the file
+	End      int64 //offset after the last whole item. Bytes past it are a partial item
+	Items    int
+	Enqueues int
+	Deletes  int //DELETE and EXPIRE items
+}
+
+//ScanSegment reads every item of a wal file and calls fn with it. It returns the problems found:
+//items whose lsn is not their offset, items from another file and items that cannot be decoded
+func ScanSegment(filePath string, fileNum uint64, fn func(item WalItem)) (SegmentScan, []string, error) {
+
+	s := SegmentScan{FileNum: fileNum, Name: path.Base(filePath)}
+
+	fileInfo, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		s.Missing = true
+		return s, nil, nil
+	} else if err != nil {
+		return s, nil, err
+	}
+	s.Size = fileInfo.Size()
+
+	var problems []string
+	problem := func(lsn uint64, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s lsn %d: ", s.Name, lsn)+fmt.Sprintf(format, args...))
+	}
+
+	offset := uint64(0)
+	read, err := ReadItems(filePath, 0, func(item WalItem) bool {
+
+		s.Items++
+
+		if item.Lsn != offset {
+			problem(item.Lsn, "item is at offset %d", offset)
+		}
+		if item.WalFileNum != fileNum {
+			problem(item.Lsn, "item belongs to wal file %d", item.WalFileNum)
+		}
+
+		switch item.ItemType {
+		case ENQUEUE, ENQUEUE_ATTRS, ENQUEUE_OPTIONS:
+			s.Enqueues++
+			if _, _, err := DecodeMessage(item); err != nil {
+				problem(item.Lsn, "unable to decode the message: %s", err.Error())
+			} else if _, err := DecodeOptions(item); err != nil {
+				problem(item.Lsn, "unable to decode the message options: %s", err.Error())
+			}
+		case DELETE, EXPIRE:
+			s.Deletes++
+			if _, ok := DeletedId(item); !ok {
+				problem(item.Lsn, "%s item has %d bytes, want 16", TypeName(item.ItemType), len(item.Data))
+			}
+		case DEQUEUE:
+		default:
+			problem(item.Lsn, "unknown item type %d", item.ItemType)
+		}
+
+		if fn != nil {
+			fn(item)
+		}
+
+		offset += Sizes.GetWalItemPrefixSize() + item.Size
+		return true
+	})
+	s.End = read
+	if err != nil {
+		return s, problems, err
+	}
+
+	if s.End < s.Size {
+		problems = append(problems, fmt.Sprintf("%s: %d bytes after the last whole item at offset %d", s.Name, s.Size-s.End, s.End))
+	}
+
+	return s, problems, nil
+}
+
+//QueueCheck is the result of checking a queue's control file against its wal files
+type QueueCheck struct {
+	Control  WalControl
+	Segments []SegmentScan
+	Messages int //messages recovery would restore
+	Problems []string
+
+	head     position //oldest live message found in the wal, or the end of the tail file
+	lastLsn  uint64   //lsn of the last enqueue item
+	enqueued bool
+}
+
+type position struct {
+	fileNum uint64
+	lsn     uint64
+}
+
+//scanQueue reads the wal files of a queue from the start position to the last file in dir.
+//Messages are live from the start position on unless a delete item removes them
+func scanQueue(dir string, c WalControl, start position) (QueueCheck, error) {
+
+	check := QueueCheck{Control: c}
+
+	nums, err := segmentNumbers(dir, c.MetaData.AppName, c.MetaData.Name)
+	if err != nil {
+		return check, err
+	}
+
+	first, last := uint64(1), c.TailLsnFileNum
+	if len(nums) != 0 {
+		first = nums[0]
+		if nums[len(nums)-1] > last {
+			last = nums[len(nums)-1]
+		}
+	}
+	if start.fileNum != 0 && start.fileNum < first {
+		first = start.fileNum
+	}
+	if last < first {
+		last = first
+	}
+
+	var live []position
+	deleted := make(map[string]bool)
+
+	for fileNum := first; fileNum <= last; fileNum++ {
+
+		filePath := path.Join(dir, SegmentName(c.MetaData.AppName, c.MetaData.Name, fileNum))
+
+		s, problems, err := ScanSegment(filePath, fileNum, func(item WalItem) {
+
+			switch item.ItemType {
+			case ENQUEUE, ENQUEUE_ATTRS, ENQUEUE_OPTIONS:
+				check.lastLsn, check.enqueued = item.Lsn, true
+				if fileNum > start.fileNum || (fileNum == start.fileNum && item.Lsn >= start.lsn) {
+					live = append(live, position{fileNum, item.Lsn})
+				}
+			case DELETE, EXPIRE:
+				if id, ok := DeletedId(item); ok {
+					deleted[id] = true
+				}
+			}
+		})
+		if err != nil {
+			return check, err
+		}
+
+		check.Segments = append(check.Segments, s)
+		check.Problems = append(check.Problems, problems...)
+	}
+
+	for _, p := range live {
+		if deleted[WalItem{WalFileNum: p.fileNum, Lsn: p.lsn}.Id()] {
+			continue
+		}
+		if check.Messages == 0 {
+			check.head = p
+		}
+		check.Messages++
+	}
+
+	tail := check.Segments[len(check.Segments)-1]
+	if check.Messages == 0 {
+		check.head = position{tail.FileNum, uint64(tail.End)}
+	}
+
+	return check, nil
+}
+
+//segment returns the scan of a wal file
+func (check *QueueCheck) segment(fileNum uint64) (SegmentScan, bool) {
+
+	for _, s := range check.Segments {
+		if s.FileNum == fileNum {
+			return s, true
+		}
+	}
+
+	return SegmentScan{}, false
+}
+
+//CheckQueue compares a control file with the wal files of the queue in dir
+func CheckQueue(dir string, c WalControl) (QueueCheck, error) {
+
+	check, err := scanQueue(dir, c, position{c.HeadLsnFileNum, c.HeadLsn})
+	if err != nil {
+		return check, err
+	}
+
+	problem := func(format string, args ...interface{}) {
+		check.Problems = append(check.Problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, s := range check.Segments {
+		switch {
+		case s.Missing && s.FileNum >= c.HeadLsnFileNum && s.FileNum <= c.TailLsnFileNum:
+			problem("%s is missing. Recovery reads every wal file from the head to the tail", s.Name)
+		case !s.Missing && s.FileNum > c.TailLsnFileNum:
+			problem("%s is past the tail wal file %d in the control file. Recovery does not read it", s.Name, c.TailLsnFileNum)
+		}
+	}
+
+	if c.HeadLsnFileNum > c.TailLsnFileNum {
+		problem("head wal file %d is past the tail wal file %d", c.HeadLsnFileNum, c.TailLsnFileNum)
+	}
+
+	if tail, ok := check.segment(c.TailLsnFileNum); ok && !tail.Missing {
+		switch {
+		case c.NextLsn < uint64(tail.End):
+			problem("nextlsn %d is before the end of %s at %d. The control file was not saved after the last append", c.NextLsn, tail.Name, tail.End)
+		case c.NextLsn > uint64(tail.End):
+			problem("nextlsn %d is past the end of %s at %d", c.NextLsn, tail.Name, tail.End)
+		}
+	}
+
+	if check.head != (position{c.HeadLsnFileNum, c.HeadLsn}) {
+		if check.Messages == 0 {
+			problem("head is at wal file %d lsn %d, want the end of the wal at wal file %d lsn %d as no message is live", c.HeadLsnFileNum, c.HeadLsn, check.head.fileNum, check.head.lsn)
+		} else {
+			problem("head is at wal file %d lsn %d, but the oldest live message is at wal file %d lsn %d", c.HeadLsnFileNum, c.HeadLsn, check.head.fileNum, check.head.lsn)
+		}
+	}
+
+	if check.enqueued && c.TailLsn != check.lastLsn {
+		problem("taillsn %d is not the lsn %d of the last enqueue item", c.TailLsn, check.lastLsn)
+	}
+
+	return check, nil
+}
+
+//RepairQueue rebuilds the control info of a queue from its wal files in dir, and returns it with what was changed.
+//The head is kept when it is at an item of an existing wal file, otherwise the wal is read from its first file and
+//messages that were already consumed may be delivered again. A partial item at the end of the tail file is cut off
+//unless dryRun is set. The caller saves the returned control info
+func RepairQueue(dir string, c WalControl, dryRun bool) (WalControl, []string, error) {
+
+	var changes []string
+	change := func(format string, args ...interface{}) {
+		changes = append(changes, fmt.Sprintf(format, args...))
+	}
+
+	nums, err := segmentNumbers(dir, c.MetaData.AppName, c.MetaData.Name)
+	if err != nil {
+		return c, nil, err
+	}
+
+	//The tail is the last wal file there is
+	repaired := c
+	if len(nums) == 0 {
+		repaired.TailLsnFileNum = 1
+	} else {
+		repaired.TailLsnFileNum = nums[len(nums)-1]
+	}
+
+	tailPath := path.Join(dir, SegmentName(c.MetaData.AppName, c.MetaData.Name, repaired.TailLsnFileNum))
+	if _, err := os.Stat(tailPath); os.IsNotExist(err) {
+		change("created the empty tail file %s", path.Base(tailPath))
+		if !dryRun {
+			if err := os.WriteFile(tailPath, nil, 0664); err != nil {
+				return c, changes, err
+			}
+		}
+	}
+
+	tail, _, err := ScanSegment(tailPath, repaired.TailLsnFileNum, nil)
+	if err != nil {
+		return c, changes, err
+	}
+	if tail.End < tail.Size {
+		change("cut off %d bytes of a partial item at the end of %s", tail.Size-tail.End, tail.Name)
+		if !dryRun {
+			if err := os.Truncate(tailPath, tail.End); err != nil {
+				return c, changes, err
+			}
+		}
+	}
+
+	//Keep the head if it is at an item, or at the end, of a wal file that exists
+	start := position{c.HeadLsnFileNum, c.HeadLsn}
+	if !headIsValid(dir, c) {
+		first := repaired.TailLsnFileNum
+		if len(nums) != 0 {
+			first = nums[0]
+		}
+		start = position{first, 0}
+		change("head at wal file %d lsn %d is not at an item, read the wal from wal file %d", c.HeadLsnFileNum, c.HeadLsn, first)
+	}
+
+	check, err := scanQueue(dir, repaired, start)
+	if err != nil {
+		return c, changes, err
+	}
+
+	repaired.NextLsn = uint64(tail.End)
+	repaired.HeadLsnFileNum, repaired.HeadLsn = check.head.fileNum, check.head.lsn
+	if check.enqueued {
+		repaired.TailLsn = check.lastLsn
+	}
+
+	for _, p := range check.Problems {
+		if !strings.Contains(p, "after the last whole item") {
+			change("not repaired: %s", p)
+		}
+	}
+
+	field := func(name string, was, is uint64) {
+		if was != is {
+			change("%s %d -> %d", name, was, is)
+		}
+	}
+	field("headlsnfilenum", c.HeadLsnFileNum, repaired.HeadLsnFileNum)
+	field("headlsn", c.HeadLsn, repaired.HeadLsn)
+	field("taillsnfilenum", c.TailLsnFileNum, repaired.TailLsnFileNum)
+	field("taillsn", c.TailLsn, repaired.TailLsn)
+	field("nextlsn", c.NextLsn, repaired.NextLsn)
+
+	return repaired, changes, nil
+}
+
+//headIsValid reports if the head of the control info is at the start or the end of an item in an existing wal file
+func headIsValid(dir string, c WalControl) bool {
+
+	filePath := path.Join(dir, SegmentName(c.MetaData.AppName, c.MetaData.Name, c.HeadLsnFileNum))
+
+	valid := c.HeadLsn == 0
+	s, _, err := ScanSegment(filePath, c.HeadLsnFileNum, func(item WalItem) {
+		if item.Lsn == c.HeadLsn {
+			valid = true
+		}
+	})
+	if err != nil || s.Missing {
+		return false
+	}
+
+	return valid || c.HeadLsn == uint64(s.End)
+}
@@ -0,0 +1,169 @@
+package wal
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+//checkSetup creates a queue in its own logs directory with three messages, the first of them dequeued
+func checkSetup(t *testing.T) (string, string) {
+
+	tempLogsPath(t)
+
+	walInfo, err := Create("CheckApp", "CheckQueue", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer walInfo.Close()
+
+	for _, m := range []string{"first", "second", "third"} {
+		if _, err := walInfo.Append(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := walInfo.MoveHead(); err != nil {
+		t.Fatal(err)
+	}
+
+	return Config.Logspath, path.Join(Config.Logspath, "CheckAppCheckQueue"+ControlFileExtn)
+}
+
+func TestCheckQueue(t *testing.T) {
+
+	dir, controlPath := checkSetup(t)
+
+	c, err := ReadControl(controlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := CheckQueue(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Problems) != 0 || check.Messages != 2 {
+		t.Fatalf("CheckQueue: want 2 messages and no problems, got %d %q", check.Messages, check.Problems)
+	}
+
+	//A control file that was not saved after the last append
+	stale := c
+	stale.NextLsn, stale.TailLsn = 0, 0
+	if check, _ := CheckQueue(dir, stale); len(check.Problems) != 2 {
+		t.Errorf("CheckQueue with a stale control file: want problems with nextlsn and taillsn, got %q", check.Problems)
+	}
+
+	moved := c
+	moved.HeadLsn = 5
+	if check, _ := CheckQueue(dir, moved); len(check.Problems) != 1 {
+		t.Errorf("CheckQueue with the head inside an item: want 1 problem, got %q", check.Problems)
+	}
+}
+
+func TestRepairQueue(t *testing.T) {
+
+	dir, controlPath := checkSetup(t)
+
+	c, err := ReadControl(controlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A torn append and a control file from before it
+	walPath := path.Join(dir, SegmentName("CheckApp", "CheckQueue", 1))
+	f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("partial"))
+	f.Close()
+
+	broken := c
+	broken.NextLsn, broken.TailLsn = 0, 0
+
+	repaired, changes, err := RepairQueue(dir, broken, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo, _ := os.Stat(walPath); fileInfo.Size() != int64(c.NextLsn)+7 {
+		t.Errorf("RepairQueue dry run: want the wal file left alone, got %d bytes", fileInfo.Size())
+	}
+	if len(changes) != 3 {
+		t.Errorf("RepairQueue: want the partial item, nextlsn and taillsn changed, got %q", changes)
+	}
+
+	if repaired, _, err = RepairQueue(dir, broken, false); err != nil {
+		t.Fatal(err)
+	}
+	if repaired != c {
+		t.Errorf("RepairQueue: want %+v, got %+v", c, repaired)
+	}
+	if check, _ := CheckQueue(dir, repaired); len(check.Problems) != 0 || check.Messages != 2 {
+		t.Errorf("CheckQueue after repair: want 2 messages and no problems, got %d %q", check.Messages, check.Problems)
+	}
+
+	//A head that is not at an item reads the wal from the start. The dequeued message has a delete item,
+	//so the head goes back to the oldest message that is still live
+	broken = c
+	broken.HeadLsn = 5
+	if repaired, _, err = RepairQueue(dir, broken, false); err != nil {
+		t.Fatal(err)
+	}
+	if repaired.HeadLsnFileNum != 1 || repaired.HeadLsn != c.HeadLsn {
+		t.Errorf("RepairQueue with a bad head: want the head at lsn %d, got %d %d", c.HeadLsn, repaired.HeadLsnFileNum, repaired.HeadLsn)
+	}
+
+	if err := WriteControl(controlPath, repaired); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = ReadControl(controlPath); err != nil || c != repaired {
+		t.Errorf("WriteControl: want %+v, got %+v %v", repaired, c, err)
+	}
+}
+
+func TestRecoverTail(t *testing.T) {
+
+	dir, controlPath := checkSetup(t)
+
+	c, err := ReadControl(controlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A torn append after one the control file does not know of
+	walPath := path.Join(dir, SegmentName("CheckApp", "CheckQueue", 1))
+	f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("partial item"))
+	f.Close()
+
+	stale := c
+	stale.NextLsn, stale.TailLsn = 0, 0
+	recovered, changes, err := RecoverTail(dir, stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered != c || len(changes) != 2 {
+		t.Errorf("RecoverTail of a stale control file: want %+v, got %+v %q", c, recovered, changes)
+	}
+	if fileInfo, _ := os.Stat(walPath); fileInfo.Size() != int64(c.NextLsn) {
+		t.Errorf("RecoverTail: want the partial item cut off at %d, got size %d", c.NextLsn, fileInfo.Size())
+	}
+
+	//Items lost in a power failure leave the control info past the end of the wal
+	ahead := c
+	ahead.NextLsn, ahead.HeadLsn = c.NextLsn+1000, c.NextLsn+1000
+	if recovered, _, _ := RecoverTail(dir, ahead); recovered.NextLsn != c.NextLsn || recovered.HeadLsn != c.NextLsn {
+		t.Errorf("RecoverTail of a control file past the wal: want nextlsn and head at %d, got %+v", c.NextLsn, recovered)
+	}
+
+	//A wal file started before the control file was saved
+	if err := os.WriteFile(path.Join(dir, SegmentName("CheckApp", "CheckQueue", 2)), nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+	if recovered, _, _ := RecoverTail(dir, c); recovered.TailLsnFileNum != 2 || recovered.NextLsn != 0 || recovered.HeadLsn != c.HeadLsn {
+		t.Errorf("RecoverTail with a new wal file: want the tail at wal file 2 lsn 0 and the head kept, got %+v", recovered)
+	}
+}
@@ -0,0 +1,100 @@
+package wal
+
+import (
+	"time"
+)
+
+//DefaultDedupWindow is how long a deduplication id is remembered when the config does not set it
+const DefaultDedupWindow = 5 * time.Minute
+
+//DedupWindow returns how long a deduplication id is remembered after its message was appended
+func DedupWindow() time.Duration {
+
+	if Config.DedupWindowSeconds > 0 {
+		return time.Duration(Config.DedupWindowSeconds) * time.Second
+	}
+
+	return DefaultDedupWindow
+}
+
+//dedupEntry is a deduplication id that was appended within the window
+type dedupEntry struct {
+	id         string
+	messageId  string //id of the message that was appended with it
+	walFileNum uint64 //wal file that holds the message
+	expires    time.Time
+}
+
+//dedupIndex maps the deduplication ids of a queue to the messages they added.
+//Entries are kept in wal order, so the ones that expire first are at the front
+type dedupIndex struct {
+	ids     map[string]*dedupEntry
+	entries []*dedupEntry
+}
+
+//expire forgets the ids whose window ended by now
+func (d *dedupIndex) expire(now time.Time) {
+
+	n := 0
+	for n < len(d.entries) && !d.entries[n].expires.After(now) {
+		e := d.entries[n]
+		if d.ids[e.id] == e {
+			delete(d.ids, e.id)
+		}
+		d.entries[n] = nil
+		n++
+	}
+
+	d.entries = d.entries[n:]
+	if len(d.entries) == 0 {
+		d.entries = nil
+	}
+}
+
+//lookup returns the id of the message that was appended with the deduplication id within the window
+func (d *dedupIndex) lookup(id string, now time.Time) (string, bool) {
+
+	e, ok := d.ids[id]
+	if !ok || !e.expires.After(now) {
+		return "", false
+	}
+
+	return e.messageId, true
+}
+
+func (d *dedupIndex) add(e *dedupEntry) {
+
+	if d.ids == nil {
+		d.ids = make(map[string]*dedupEntry)
+	}
+
+	d.ids[e.id] = e
+	d.entries = append(d.entries, e)
+}
+
+//firstFileNum returns the first wal file that holds a message of an id in the index, 0 if there are none.
+//Recovery reads the wal from there to rebuild the index
+func (d *dedupIndex) firstFileNum() uint64 {
+
+	if len(d.entries) == 0 {
+		return 0
+	}
+
+	return d.entries[0].walFileNum
+}
+
+//RecoverDedupId adds a deduplication id read back from the wal to the index, unless its window has ended.
+//enqueuedAt is when its message was appended
+func (w *QueueInfo) RecoverDedupId(id, messageId string, walFileNum uint64, enqueuedAt time.Time) {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	expires := enqueuedAt.Add(DedupWindow())
+	if !expires.After(time.Now()) {
+		return
+	}
+
+	w.dedup.add(&dedupEntry{id: id, messageId: messageId, walFileNum: walFileNum, expires: expires})
+	w.WalControlInfo.DedupFileNum = w.dedup.firstFileNum()
+}
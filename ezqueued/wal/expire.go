@@ -0,0 +1,68 @@
+package wal
+
+import (
+	"time"
+
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+//noteExpiry makes ExpireMessages look at the queue once a waiting message that expires at t is due.
+//The caller must hold the queue lock
+func (w *QueueInfo) noteExpiry(t time.Time) {
+
+	if !t.IsZero() && (w.nextExpiry.IsZero() || t.Before(w.nextExpiry)) {
+		w.nextExpiry = t
+	}
+}
+
+/*
+	ExpireMessages removes the waiting messages whose retention period or time to live ended by now and returns
+	how many were removed. When moveTo is not nil each message is handed to it first, Ex: to append it to the
+	dead-letter queue, and a message stays in the queue if moveTo fails. The removal is written to the wal as an
+	EXPIRE item and the head moves past the messages, so they are not recovered and their wal files can be collected.
+	Messages in flight or scheduled expire once they are in the queue
+*/
+func (w *QueueInfo) ExpireMessages(now time.Time, moveTo func(m *q.Message) error) (int, error) {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	if w.nextExpiry.IsZero() || now.Before(w.nextExpiry) {
+		return 0, nil
+	}
+
+	//Set again from the messages that are kept
+	w.nextExpiry = time.Time{}
+
+	count := 0
+	var err error
+	w.Queue.Filter(func(m *q.Message) bool {
+
+		if err == nil && !m.ExpiresAt.IsZero() && !m.ExpiresAt.After(now) {
+			if moveTo != nil {
+				err = moveTo(m)
+			}
+			if err == nil {
+				err = w.logRemoved(m, EXPIRE)
+			}
+			if err == nil {
+				count++
+				return false
+			}
+		}
+
+		w.noteExpiry(m.ExpiresAt)
+		return true
+	})
+
+	if count == 0 {
+		return 0, err
+	}
+
+	w.advanceHead()
+	w.controlChanged = true
+
+	w.log().Debug("Expired messages", "count", count, "moved", moveTo != nil)
+
+	return count, err
+}
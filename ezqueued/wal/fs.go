@@ -0,0 +1,53 @@
+package wal
+
+import "os"
+
+//File is the part of *os.File the wal writes queue files through
+type File interface {
+	Write(b []byte) (int, error)
+	Sync() error
+	Close() error
+	Name() string
+}
+
+//FileSystem makes the changes to the logs directory. Crash tests replace FS with one that records
+//the writes so the files can be rebuilt as they would be after a crash at any point
+type FileSystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Rename(oldPath, newPath string) error
+	Remove(name string) error
+	Truncate(name string, size int64) error
+	SyncDir(name string) error //makes the creates, renames and removes in the directory last
+}
+
+//FS is used for every change to the queue files. Reads go to the os directly
+var FS FileSystem = osFileSystem{}
+
+type osFileSystem struct{}
+
+func (osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFileSystem) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFileSystem) Truncate(name string, size int64) error {
+	return os.Truncate(name, size)
+}
+
+func (osFileSystem) SyncDir(name string) error {
+
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,281 @@
+package wal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+//Lease keeps a received message hidden from other consumers until it is deleted or the deadline passes
+type Lease struct {
+	Message  *q.Message
+	Receipt  string
+	Deadline time.Time
+}
+
+//ReceivedMessage is the copy of a leased message handed to the caller
+type ReceivedMessage struct {
+	Id           string
+	Body         string
+	Receipt      string
+	ReceiveCount uint32
+	Deadline     time.Time
+	Attributes   map[string]string //attributes stored with the message, nil if it has none
+	GroupId      string            //group of the message, empty if it has none
+}
+
+//The receipt starts with the message id so it can be found without a second index.
+//The random part makes receipts from earlier leases of the same message stale
+func newReceipt(m *q.Message) string {
+
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return m.Id() + "." + hex.EncodeToString(b)
+}
+
+func (w *QueueInfo) receiptError(code int, message string) error {
+	return &e.Error{AppName: w.Queue.AppName, Name: w.Queue.Name, ErrorCode: code, ErrorMessage: message}
+}
+
+/*
+	lookupLease returns the lease that matches the receipt. The caller must hold the queue lock.
+	A receipt of an earlier lease of a message that was received again fails with RECEIPT_STALE. A receipt that was
+	never valid and one of a message that is not in flight anymore fail with RECEIPT_INVALID and a message that says which
+*/
+func (w *QueueInfo) lookupLease(receipt string) (*Lease, error) {
+
+	dot := strings.LastIndex(receipt, ".")
+	if dot < 0 {
+		return nil, w.receiptError(e.RECEIPT_INVALID, e.ErrorReceiptInvalid)
+	}
+
+	l, ok := w.inFlight[receipt[:dot]]
+	if !ok {
+		return nil, w.receiptError(e.RECEIPT_INVALID, e.ErrorReceiptNotInFlight)
+	}
+	if l.Receipt != receipt {
+		return nil, w.receiptError(e.RECEIPT_STALE, e.ErrorReceiptStale)
+	}
+
+	return l, nil
+}
+
+//available reports if m can be handed out, which it cannot while another message of its group is in flight.
+//The caller must hold the queue lock
+func (w *QueueInfo) available(m *q.Message) bool {
+	return len(m.GroupId) == 0 || !w.busyGroups[m.GroupId]
+}
+
+//next removes the first message of the queue that can be handed out, nil if there is none.
+//The caller must hold the queue lock
+func (w *QueueInfo) next() *q.Message {
+
+	if len(w.busyGroups) == 0 {
+		return w.Queue.Pop()
+	}
+
+	i, ok := w.Queue.Find(w.available)
+	if !ok {
+		return nil
+	}
+
+	return w.Queue.Remove(i)
+}
+
+//endLease forgets the lease of a message that was deleted or returned to the queue, which frees its group.
+//The caller must hold the queue lock
+func (w *QueueInfo) endLease(l *Lease) {
+
+	delete(w.inFlight, l.Message.Id())
+
+	if len(l.Message.GroupId) == 0 {
+		return
+	}
+	delete(w.busyGroups, l.Message.GroupId)
+
+	//Wake up the readers waiting for a message, the next one of the group can be handed out now
+	if w.appendSignal != nil {
+		close(w.appendSignal)
+		w.appendSignal = nil
+	}
+}
+
+/*
+	Receive hands out the message at the head of the queue with a lease. The message stays in the wal
+	and is hidden until it is deleted with the receipt or the lease runs out. Messages of a group are skipped
+	while another message of the group is in flight. ok is false if there is no message to hand out
+*/
+func (w *QueueInfo) Receive(visibility time.Duration) (ReceivedMessage, bool) {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	now := time.Now()
+	w.requeueExpired(now)
+	w.deliverDue(now)
+
+	if w.WalControlInfo.Paused {
+		return ReceivedMessage{}, false
+	}
+
+	m := w.next()
+	if m == nil {
+		return ReceivedMessage{}, false
+	}
+
+	m.ReceiveCount++
+
+	l := &Lease{Message: m, Receipt: newReceipt(m), Deadline: time.Now().Add(visibility)}
+
+	if w.inFlight == nil {
+		w.inFlight = make(map[string]*Lease)
+	}
+	w.inFlight[m.Id()] = l
+
+	if len(m.GroupId) != 0 {
+		if w.busyGroups == nil {
+			w.busyGroups = make(map[string]bool)
+		}
+		w.busyGroups[m.GroupId] = true
+	}
+
+	return ReceivedMessage{m.Id(), m.Value, l.Receipt, m.ReceiveCount, l.Deadline, m.Attributes, m.GroupId}, true
+}
+
+//DeleteMessage removes a received message for good
+func (w *QueueInfo) DeleteMessage(receipt string) error {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	l, err := w.lookupLease(receipt)
+	if err != nil {
+		return err
+	}
+
+	w.endLease(l)
+
+	return w.release(l.Message)
+}
+
+//ChangeVisibility moves the deadline of a lease to visibility from now. A zero visibility returns the message to the queue
+func (w *QueueInfo) ChangeVisibility(receipt string, visibility time.Duration) error {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	l, err := w.lookupLease(receipt)
+	if err != nil {
+		return err
+	}
+
+	l.Deadline = time.Now().Add(visibility)
+
+	if visibility == 0 {
+		w.requeueExpired(l.Deadline)
+	}
+
+	return nil
+}
+
+//VisibilityChange is one entry of ChangeVisibilityBatch
+type VisibilityChange struct {
+	Receipt    string
+	Visibility time.Duration
+}
+
+/*
+	ChangeVisibilityBatch is ChangeVisibility for many leases under one lock, so consumers that hold many messages
+	can extend their leases together. It returns the error of each change in the order of changes, nil where it succeeded
+*/
+func (w *QueueInfo) ChangeVisibilityBatch(changes []VisibilityChange) []error {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	now := time.Now()
+	errs := make([]error, len(changes))
+	requeue := false
+
+	for i, c := range changes {
+		l, err := w.lookupLease(c.Receipt)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		l.Deadline = now.Add(c.Visibility)
+		requeue = requeue || c.Visibility == 0
+	}
+
+	if requeue {
+		w.requeueExpired(now)
+	}
+
+	return errs
+}
+
+//RequeueExpired returns the messages whose lease ran out to the queue and reports how many were returned
+func (w *QueueInfo) RequeueExpired(now time.Time) int {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	return w.requeueExpired(now)
+}
+
+func (w *QueueInfo) requeueExpired(now time.Time) int {
+
+	count := 0
+
+	for id, l := range w.inFlight {
+		if l.Deadline.After(now) {
+			continue
+		}
+
+		w.endLease(l)
+		w.Queue.InsertInOrder(l.Message)
+		w.noteExpiry(l.Message.ExpiresAt)
+		count++
+
+		w.log().Debug("Returned message to the queue", "message_id", id, "receive_count", l.Message.ReceiveCount)
+	}
+
+	//Wake up the readers waiting for a message
+	if count != 0 && w.appendSignal != nil {
+		close(w.appendSignal)
+		w.appendSignal = nil
+	}
+
+	return count
+}
+
+//Counts returns the number of messages waiting in the queue, the number in flight and the number scheduled for later
+func (w *QueueInfo) Counts() (visible, inFlight, delayed int) {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	return int(w.Queue.Count), len(w.inFlight), w.timers.len()
+}
+
+//Purge deletes every message in the queue, including the ones in flight and the scheduled ones
+func (w *QueueInfo) Purge() error {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	w.Queue.Clear()
+	w.inFlight = nil
+	w.busyGroups = nil
+	w.nextExpiry = time.Time{}
+	w.timers.clear()
+	w.advanceHead()
+
+	return w.saveControlFile()
+}
@@ -0,0 +1,19 @@
+package wal
+
+import (
+	"time"
+
+	"github.com/coderagr/ezqueue-service/ezqueued/metrics"
+)
+
+var (
+	fsyncDuration = metrics.Default.NewHistogram("ezqueue_wal_fsync_duration_seconds",
+		"Time taken to fsync a wal or control file", metrics.DefBuckets, "file")
+
+	bytesWritten = metrics.Default.NewCounter("ezqueue_wal_written_bytes_total",
+		"Bytes appended to the wal files of a queue", "app", "queue")
+)
+
+func observeFsync(file string, start time.Time) {
+	fsyncDuration.Observe(time.Since(start).Seconds(), file)
+}
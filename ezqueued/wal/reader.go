@@ -0,0 +1,77 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+//ReadItems calls fn for every wal item in the file from startLsn on, until fn returns false or the file ends.
+//An item that was only partly written when the daemon stopped ends the file. It returns the number of bytes read
+func ReadItems(filePath string, startLsn uint64, fn func(item WalItem) bool) (int64, error) {
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := f.Seek(int64(startLsn), io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(f)
+	prefix := make([]byte, Sizes.GetWalItemPrefixSize())
+	read := int64(0)
+
+	for {
+		if _, err := io.ReadFull(r, prefix); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return read, nil
+		} else if err != nil {
+			return read, err
+		}
+
+		//A size past the end of the file is a partial item, or a damaged prefix that must not be allocated
+		remaining := fileInfo.Size() - int64(startLsn) - read - int64(len(prefix))
+		if size := binary.LittleEndian.Uint64(prefix[24:]); size > uint64(remaining) {
+			return read, nil
+		}
+
+		item, err := DecodeWalItemPrefix(prefix)
+		if err != nil {
+			return read, err
+		}
+
+		if _, err := io.ReadFull(r, item.Data); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return read, nil
+		} else if err != nil {
+			return read, err
+		}
+
+		read += int64(len(prefix)) + int64(len(item.Data))
+
+		if !fn(item) {
+			return read, nil
+		}
+	}
+}
+
+//DeletedId returns the id of the message a DELETE or EXPIRE item removes
+func DeletedId(item WalItem) (string, bool) {
+
+	if (item.ItemType != DELETE && item.ItemType != EXPIRE) || len(item.Data) != 16 {
+		return "", false
+	}
+
+	m := q.Message{WalFileNum: binary.LittleEndian.Uint64(item.Data[0:]), Lsn: binary.LittleEndian.Uint64(item.Data[8:])}
+
+	return m.Id(), true
+}
@@ -0,0 +1,77 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+//RecoverTail makes the control info of a queue agree with the end of its wal before recovery reads it, and returns
+//the control info with what was changed. The control file is saved after the wal is written, so after a crash the
+//wal can go on past the control info: a wal file the control file does not know of yet, items after nextlsn or a
+//partial item. Unsynced items lost in a power failure can leave the control info past the end of the wal instead.
+//The partial item is cut off, the tail is moved to the last wal file and nextlsn to its end, so new items are not
+//written over ones recovery reads. Unlike RepairQueue the head is kept, it is only moved back to the end of the wal
+func RecoverTail(dir string, c WalControl) (WalControl, []string, error) {
+
+	var changes []string
+	change := func(format string, args ...interface{}) {
+		changes = append(changes, fmt.Sprintf(format, args...))
+	}
+
+	nums, err := segmentNumbers(dir, c.MetaData.AppName, c.MetaData.Name)
+	if err != nil {
+		return c, nil, err
+	}
+
+	recovered := c
+	if len(nums) != 0 && nums[len(nums)-1] > recovered.TailLsnFileNum {
+		recovered.TailLsnFileNum = nums[len(nums)-1]
+		change("tail moved to wal file %d after wal file %d", recovered.TailLsnFileNum, c.TailLsnFileNum)
+	}
+
+	tailPath := path.Join(dir, SegmentName(c.MetaData.AppName, c.MetaData.Name, recovered.TailLsnFileNum))
+
+	var lastLsn uint64
+	enqueued := false
+	tail, _, err := ScanSegment(tailPath, recovered.TailLsnFileNum, func(item WalItem) {
+		if item.ItemType == ENQUEUE || item.ItemType == ENQUEUE_ATTRS || item.ItemType == ENQUEUE_OPTIONS {
+			lastLsn, enqueued = item.Lsn, true
+		}
+	})
+	if err != nil {
+		return c, changes, err
+	}
+
+	if tail.Missing {
+		f, err := FS.OpenFile(tailPath, os.O_CREATE|os.O_WRONLY, 0664)
+		if err != nil {
+			return c, changes, err
+		}
+		f.Close()
+		change("created the missing tail file %s", tail.Name)
+	}
+
+	if tail.End < tail.Size {
+		if err := FS.Truncate(tailPath, tail.End); err != nil {
+			return c, changes, err
+		}
+		change("cut off %d bytes of a partial item at the end of %s", tail.Size-tail.End, tail.Name)
+	}
+
+	if recovered.TailLsnFileNum != c.TailLsnFileNum || recovered.NextLsn != uint64(tail.End) {
+		recovered.NextLsn = uint64(tail.End)
+		change("nextlsn %d -> %d", c.NextLsn, recovered.NextLsn)
+	}
+
+	if recovered.HeadLsnFileNum == recovered.TailLsnFileNum && recovered.HeadLsn > recovered.NextLsn {
+		recovered.HeadLsn = recovered.NextLsn
+		change("head lsn %d is past the end of the wal, moved to %d", c.HeadLsn, recovered.HeadLsn)
+	}
+
+	if enqueued {
+		recovered.TailLsn = lastLsn
+	}
+
+	return recovered, changes, nil
+}
@@ -0,0 +1,123 @@
+package wal
+
+import (
+	"container/heap"
+	"time"
+
+	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
+)
+
+//timerHeap is a min heap of scheduled messages by delivery time, then by wal position
+type timerHeap []*q.Message
+
+func (h timerHeap) Len() int { return len(h) }
+
+func (h timerHeap) Less(i, j int) bool {
+
+	if !h[i].DeliverAt.Equal(h[j].DeliverAt) {
+		return h[i].DeliverAt.Before(h[j].DeliverAt)
+	}
+
+	return h[i].Before(h[j])
+}
+
+func (h timerHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *timerHeap) Push(x interface{}) { *h = append(*h, x.(*q.Message)) }
+
+func (h *timerHeap) Pop() interface{} {
+
+	old := *h
+	m := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+
+	return m
+}
+
+//timerIndex holds the messages scheduled for a later delivery. due hands them out by delivery time in O(log n),
+//order keeps them in wal order so the oldest one, which holds the head of the wal, is found without a scan.
+//A delivered message has a zero DeliverAt and is dropped from order once it reaches the front
+type timerIndex struct {
+	due   timerHeap
+	order []*q.Message
+	first int //index in order of the earliest message
+}
+
+func (t *timerIndex) len() int {
+	return len(t.due)
+}
+
+//add schedules m. Messages are added in wal order
+func (t *timerIndex) add(m *q.Message) {
+
+	heap.Push(&t.due, m)
+	t.order = append(t.order, m)
+}
+
+//popDue removes and returns the first message whose delivery time is not after now, nil if there is none
+func (t *timerIndex) popDue(now time.Time) *q.Message {
+
+	if len(t.due) == 0 || t.due[0].DeliverAt.After(now) {
+		return nil
+	}
+
+	m := heap.Pop(&t.due).(*q.Message)
+	m.DeliverAt = time.Time{}
+
+	return m
+}
+
+//oldest returns the scheduled message written to the wal first, nil if there is none
+func (t *timerIndex) oldest() *q.Message {
+
+	for t.first < len(t.order) && t.order[t.first].DeliverAt.IsZero() {
+		t.order[t.first] = nil
+		t.first++
+	}
+
+	//Give back the delivered part of order once it is half of it
+	if t.first > len(t.order)/2 {
+		t.order = append([]*q.Message(nil), t.order[t.first:]...)
+		t.first = 0
+	}
+
+	if t.first == len(t.order) {
+		return nil
+	}
+
+	return t.order[t.first]
+}
+
+func (t *timerIndex) clear() {
+	*t = timerIndex{}
+}
+
+//deliverDue moves the scheduled messages whose delivery time is not after now to the queue and returns how many were moved.
+//The caller must hold the queue lock
+func (w *QueueInfo) deliverDue(now time.Time) int {
+
+	count := 0
+	for m := w.timers.popDue(now); m != nil; m = w.timers.popDue(now) {
+		w.Queue.InsertInOrder(m)
+		w.noteExpiry(m.ExpiresAt)
+		count++
+	}
+
+	//Wake up the readers waiting for a message
+	if count != 0 && w.appendSignal != nil {
+		close(w.appendSignal)
+		w.appendSignal = nil
+	}
+
+	return count
+}
+
+//DeliverScheduled moves the scheduled messages whose delivery time is not after now to the queue and reports how many were moved
+func (w *QueueInfo) DeliverScheduled(now time.Time) int {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	return w.deliverDue(now)
+}
@@ -4,11 +4,12 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"path"
 	"reflect"
+	"time"
 
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
 	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
 )
 
@@ -16,35 +17,54 @@ const (
 	Logsextn        = ".wal"
 	ControlFileExtn = ".control"
 	MaxFileSize     = 20000 //bytes
+
+	controlTmpExtn = ".tmp" //added to the control file name while a new one is written
 )
 
+//ConfigPath is the config file of the daemon. The wal settings are read from it at startup
+const ConfigPath = "/etc/ezqueue/ezqueue.config"
+
 type WalConfig struct {
-	Logspath string `json:"logspath"`
+	Logspath           string `json:"logspath"`
+	DedupWindowSeconds int    `json:"dedupwindowseconds"` //how long deduplication ids are remembered. 300 when 0
 }
 
 var Config = WalConfig{}
 
 func init() {
-	filepath := "/etc/ezqueue/ezqueue.config"
-	w, ferr := os.ReadFile(filepath)
-	if ferr != nil {
-		log.Panicf("Unable to read the config file %s", filepath)
-		return
+
+	//Tools that only read wal files, Ex: ezqueue-wal, run without the config file.
+	//The daemon reads the same file for its own settings and stops if it cannot
+	if err := LoadConfig(ConfigPath); err != nil && !os.IsNotExist(err) {
+		logging.Default().Error("Unable to read the config file", "path", ConfigPath, "error", err)
+		panic("unable to read the config file " + ConfigPath)
 	}
+}
 
-	if ferr = json.Unmarshal(w, &Config); ferr != nil {
-		log.Panicf("Unable to read the config file %s", filepath)
-		return
+//LoadConfig reads the wal settings from a config file
+func LoadConfig(filePath string) error {
+
+	w, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
 	}
+
+	return json.Unmarshal(w, &Config)
 }
 
 //Each wal type can be an Enqueue, Dequeue or Delete.
+//An enqueue with attributes, Ex: the trace context of the producer, is written as ENQUEUE_ATTRS.
+//An enqueue with message options, Ex: a priority, is written as ENQUEUE_OPTIONS.
+//EXPIRE removes a message whose retention period or time to live ended, it holds the same data as DELETE
 type WalType uint64
 
 const (
-	ENQUEUE WalType = 0
-	DEQUEUE WalType = 1
-	DELETE  WalType = 2
+	ENQUEUE         WalType = 0
+	DEQUEUE         WalType = 1
+	DELETE          WalType = 2
+	ENQUEUE_ATTRS   WalType = 3
+	ENQUEUE_OPTIONS WalType = 4
+	EXPIRE          WalType = 5
 )
 
 type WalItemPrefix struct {
@@ -60,8 +80,22 @@ type WalItem struct {
 	Data       []byte
 }
 
+//Id returns the id of the message an enqueue item adds
+func (item WalItem) Id() string {
+
+	m := q.Message{WalFileNum: item.WalFileNum, Lsn: item.Lsn}
+	return m.Id()
+}
+
 func Create(appName, queueName string, delay, visibilityTimeout uint16) (*QueueInfo, error) {
 
+	return CreateQueue(QueueMetaData{AppName: appName, Name: queueName, DelaySeconds: delay, VisibilityTimeout: visibilityTimeout})
+}
+
+//CreateQueue creates the wal and control files of a new queue with the settings in metaData
+func CreateQueue(metaData QueueMetaData) (*QueueInfo, error) {
+
+	appName, queueName := metaData.AppName, metaData.Name
 	fullQueueName := appName + queueName
 
 	//Create the wal info and control structures
@@ -69,52 +103,65 @@ func Create(appName, queueName string, delay, visibilityTimeout uint16) (*QueueI
 	walControl := new(WalControl)
 	walInfo.WalControlInfo = walControl
 
-	walControl.MetaData.AppName = appName
-	walControl.MetaData.Name = queueName
-	walControl.MetaData.DelaySeconds = delay
-	walControl.MetaData.VisibilityTimeout = visibilityTimeout
+	walControl.MetaData = metaData
 
 	walControl.TailLsnFileNum = uint64(1)
 	walControl.HeadLsn = 0
 	walControl.HeadLsnFileNum = walControl.TailLsnFileNum
 	walControl.TailLsn = 0
 
-	walc, err := json.Marshal(&walControl)
-	if err != nil {
+	if err := walInfo.removeCreateLeftovers(); err != nil {
+		logging.Default().Error("Queue files already exist", "app", appName, "queue", queueName, "error", err)
 		return nil, err
 	}
 
-	//create the wal control file
-	walControlFile := fullQueueName + ControlFileExtn
-	filePath := path.Join(Config.Logspath, walControlFile)
-	err = os.WriteFile(filePath, walc, 0644)
-	if err != nil {
-		return nil, err
+	//create the wal log file. O_EXCL keeps a create from appending to the wal of a queue that was not recovered
+	filePath := path.Join(Config.Logspath, walInfo.LogFileName(walControl.TailLsnFileNum))
+	walFile, werr := FS.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_APPEND|os.O_WRONLY, 0664)
+	if werr != nil {
+		msg := fmt.Sprintf("Unable to open wal file for %s", walInfo.LogFileName(walControl.TailLsnFileNum))
+		logging.Default().Error("Unable to open the wal file", "app", appName, "queue", queueName, "path", filePath, "error", werr)
+		return nil, &FileError{Message: msg}
 	}
+	walInfo.WalFile = walFile
 
-	//open the walfile control file
-	walCtrlFilePtr, cerr := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0664)
-	if cerr != nil {
-		msg := fmt.Sprintf("Unable to open wal file for %s", filePath)
-		log.Panicf(msg)
+	//The control file is written last, a queue without one is not recovered
+	if err := walInfo.saveControlFile(); err != nil {
+		msg := fmt.Sprintf("Unable to write the control file for %s", fullQueueName)
+		logging.Default().Error("Unable to write the control file", "app", appName, "queue", queueName, "path", walInfo.ControlFilePath(), "error", err)
+		walFile.Close()
 		return nil, &FileError{Message: msg}
 	}
 
-	//create the wal log file
-	filePath = path.Join(Config.Logspath, walInfo.LogFileName(walControl.TailLsnFileNum))
-	walFile, werr := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0664)
-	if werr != nil {
-		msg := fmt.Sprintf("Unable to open wal file for %s", walInfo.LogFileName(walControl.TailLsnFileNum))
-		log.Panicf(msg)
-		return nil, &FileError{Message: msg}
+	walInfo.Queue = metaData.NewQueue()
+
+	return walInfo, nil
+}
+
+//removeCreateLeftovers removes the empty first wal file a create leaves when it stops before the control file is written.
+//Any other file of the queue is data of a queue that was not recovered, and the create fails rather than write over it
+func (w *QueueInfo) removeCreateLeftovers() error {
+
+	fullQueueName := w.WalControlInfo.MetaData.AppName + w.WalControlInfo.MetaData.Name
+
+	if _, err := os.Stat(w.ControlFilePath()); !os.IsNotExist(err) {
+		return &FileError{Message: fmt.Sprintf("The control file of %s already exists", fullQueueName)}
 	}
 
-	walInfo.WalFile = walFile
-	walInfo.WalControlFile = walCtrlFilePtr
+	nums, err := segmentNumbers(Config.Logspath, w.WalControlInfo.MetaData.AppName, w.WalControlInfo.MetaData.Name)
+	if err != nil {
+		return err
+	}
+	if len(nums) == 0 {
+		return nil
+	}
 
-	walInfo.Queue = q.NewQueue(appName, queueName, "", delay, visibilityTimeout)
+	firstPath := path.Join(Config.Logspath, w.LogFileName(1))
+	if info, err := os.Stat(firstPath); len(nums) > 1 || nums[0] != 1 || err != nil || info.Size() != 0 {
+		return &FileError{Message: fmt.Sprintf("The wal files of %s already exist", fullQueueName)}
+	}
 
-	return walInfo, nil
+	return FS.Remove(firstPath)
 }
 
 func EncodeWalItem(item WalItem, size uint64) ([]byte, error) {
@@ -144,6 +191,240 @@ func DecodeWalItemPrefix(itemPrefix []byte) (WalItem, error) {
 	return walItem, nil
 }
 
+//EncodeMessage returns the data of an ENQUEUE_ATTRS item. It holds the number of attributes,
+//each key and value prefixed with its length, followed by the message body
+func EncodeMessage(msg string, attributes map[string]string) []byte {
+
+	size := 2 + len(msg)
+	for k, v := range attributes {
+		size += 2 + len(k) + 4 + len(v)
+	}
+
+	buf := make([]byte, size)
+	binary.LittleEndian.PutUint16(buf[0:], uint16(len(attributes)))
+
+	offset := 2
+	for k, v := range attributes {
+		binary.LittleEndian.PutUint16(buf[offset:], uint16(len(k)))
+		offset += 2 + copy(buf[offset+2:], k)
+
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(len(v)))
+		offset += 4 + copy(buf[offset+4:], v)
+	}
+
+	copy(buf[offset:], msg)
+
+	return buf
+}
+
+//MessageOptions are the settings of a message that are written with it in an ENQUEUE_OPTIONS item
+type MessageOptions struct {
+	Priority        uint8     //0 to queue.MaxPriority, only used by priority queues
+	GroupId         string    //messages of a group are handed out one at a time in order
+	DeduplicationId string    //a message with the same id within the dedup window is not appended again
+	EnqueuedAt      time.Time //when the message was appended. Written with deduplication ids so their window lasts through a restart
+	ExpiresAt       time.Time //when the message expires, zero if it does not
+	DeliverAt       time.Time //when the message becomes visible, zero to deliver it right away
+}
+
+//Tags of the options in an ENQUEUE_OPTIONS item. Options with a tag that is not known are skipped,
+//so older versions can still read the message
+const (
+	optionPriority        uint8 = 1
+	optionGroupId         uint8 = 2
+	optionDeduplicationId uint8 = 3
+	optionEnqueuedAt      uint8 = 4
+	optionExpiresAt       uint8 = 5
+	optionDeliverAt       uint8 = 6
+)
+
+//IsZero reports if no option is set. A message without options is written as an ENQUEUE or ENQUEUE_ATTRS item
+func (o MessageOptions) IsZero() bool {
+	return o.Priority == 0 && len(o.GroupId) == 0 && len(o.DeduplicationId) == 0 && o.EnqueuedAt.IsZero() && o.ExpiresAt.IsZero() && o.DeliverAt.IsZero()
+}
+
+//appendOption adds an option with a tag, the length of its value and the value
+func appendOption(options []byte, tag uint8, value []byte) []byte {
+
+	options = append(options, tag, 0, 0)
+	binary.LittleEndian.PutUint16(options[len(options)-2:], uint16(len(value)))
+
+	return append(options, value...)
+}
+
+//encodeTime returns the value of a time option, the unix time in nanoseconds
+func encodeTime(t time.Time) []byte {
+
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, uint64(t.UnixNano()))
+
+	return value
+}
+
+func decodeTime(value []byte) time.Time {
+	return time.Unix(0, int64(binary.LittleEndian.Uint64(value)))
+}
+
+//EncodeOptions returns the data of an ENQUEUE_OPTIONS item. It holds the length of the options,
+//each option as a tag, the length of its value and the value, followed by the data of an ENQUEUE_ATTRS item
+func EncodeOptions(msg string, attributes map[string]string, opts MessageOptions) []byte {
+
+	var options []byte
+	if opts.Priority != 0 {
+		options = appendOption(options, optionPriority, []byte{opts.Priority})
+	}
+	if len(opts.GroupId) != 0 {
+		options = appendOption(options, optionGroupId, []byte(opts.GroupId))
+	}
+	if len(opts.DeduplicationId) != 0 {
+		options = appendOption(options, optionDeduplicationId, []byte(opts.DeduplicationId))
+	}
+	if !opts.EnqueuedAt.IsZero() {
+		options = appendOption(options, optionEnqueuedAt, encodeTime(opts.EnqueuedAt))
+	}
+	if !opts.ExpiresAt.IsZero() {
+		options = appendOption(options, optionExpiresAt, encodeTime(opts.ExpiresAt))
+	}
+	if !opts.DeliverAt.IsZero() {
+		options = appendOption(options, optionDeliverAt, encodeTime(opts.DeliverAt))
+	}
+
+	message := EncodeMessage(msg, attributes)
+
+	buf := make([]byte, 2+len(options)+len(message))
+	binary.LittleEndian.PutUint16(buf[0:], uint16(len(options)))
+	copy(buf[2:], options)
+	copy(buf[2+len(options):], message)
+
+	return buf
+}
+
+//splitOptions returns the options and the message data of an ENQUEUE_OPTIONS item
+func splitOptions(item WalItem) ([]byte, []byte, error) {
+
+	corrupt := &FileError{Message: fmt.Sprintf("wal item %d-%d has corrupt options", item.WalFileNum, item.Lsn)}
+
+	if len(item.Data) < 2 {
+		return nil, nil, corrupt
+	}
+
+	size := int(binary.LittleEndian.Uint16(item.Data))
+	if len(item.Data) < 2+size {
+		return nil, nil, corrupt
+	}
+
+	return item.Data[2 : 2+size], item.Data[2+size:], nil
+}
+
+//DecodeOptions returns the options of an enqueue item. Items of the other enqueue types have none
+func DecodeOptions(item WalItem) (MessageOptions, error) {
+
+	var opts MessageOptions
+	if item.ItemType != ENQUEUE_OPTIONS {
+		return opts, nil
+	}
+
+	options, _, err := splitOptions(item)
+	if err != nil {
+		return opts, err
+	}
+
+	for len(options) != 0 {
+		if len(options) < 3 {
+			return opts, &FileError{Message: fmt.Sprintf("wal item %d-%d has corrupt options", item.WalFileNum, item.Lsn)}
+		}
+		tag, size := options[0], int(binary.LittleEndian.Uint16(options[1:]))
+		options = options[3:]
+
+		if len(options) < size {
+			return opts, &FileError{Message: fmt.Sprintf("wal item %d-%d has corrupt options", item.WalFileNum, item.Lsn)}
+		}
+		value := options[:size]
+		options = options[size:]
+
+		switch tag {
+		case optionPriority:
+			if size == 1 {
+				opts.Priority = value[0]
+			}
+		case optionGroupId:
+			opts.GroupId = string(value)
+		case optionDeduplicationId:
+			opts.DeduplicationId = string(value)
+		case optionEnqueuedAt:
+			if size == 8 {
+				opts.EnqueuedAt = decodeTime(value)
+			}
+		case optionExpiresAt:
+			if size == 8 {
+				opts.ExpiresAt = decodeTime(value)
+			}
+		case optionDeliverAt:
+			if size == 8 {
+				opts.DeliverAt = decodeTime(value)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+//DecodeMessage returns the body and attributes of an ENQUEUE, ENQUEUE_ATTRS or ENQUEUE_OPTIONS item
+func DecodeMessage(item WalItem) (string, map[string]string, error) {
+
+	if item.ItemType == ENQUEUE {
+		return string(item.Data), nil, nil
+	}
+
+	data := item.Data
+	switch item.ItemType {
+	case ENQUEUE_ATTRS:
+	case ENQUEUE_OPTIONS:
+		_, message, err := splitOptions(item)
+		if err != nil {
+			return "", nil, err
+		}
+		data = message
+	default:
+		return "", nil, &FileError{Message: fmt.Sprintf("wal item %d-%d is not a message", item.WalFileNum, item.Lsn)}
+	}
+
+	corrupt := &FileError{Message: fmt.Sprintf("wal item %d-%d has corrupt attributes", item.WalFileNum, item.Lsn)}
+
+	if len(data) < 2 {
+		return "", nil, corrupt
+	}
+
+	count := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+
+	attributes := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		if len(data) < 2 {
+			return "", nil, corrupt
+		}
+		keyLen := int(binary.LittleEndian.Uint16(data))
+		data = data[2:]
+
+		if len(data) < keyLen+4 {
+			return "", nil, corrupt
+		}
+		key := string(data[:keyLen])
+		data = data[keyLen:]
+
+		valueLen := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+
+		if len(data) < valueLen {
+			return "", nil, corrupt
+		}
+		attributes[key] = string(data[:valueLen])
+		data = data[valueLen:]
+	}
+
+	return string(data), attributes, nil
+}
+
 type TypeSizes struct {
 	IntSize           uint64
 	WalItemPrefixSize uint64
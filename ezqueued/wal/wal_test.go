@@ -31,8 +31,18 @@ func init() {
 
 var appendMutex sync.Mutex
 
+//tempLogsPath points the logs path to a directory of the test, so a test does not find the files of an earlier run
+func tempLogsPath(t *testing.T) {
+
+	logspath := Config.Logspath
+	Config.Logspath = t.TempDir()
+	t.Cleanup(func() { Config.Logspath = logspath })
+}
+
 func TestCreate(t *testing.T) {
 
+	tempLogsPath(t)
+
 	walInfo, err := Create("TestApp", "TestQueue", 10, 1)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -80,6 +90,14 @@ func TestCreate(t *testing.T) {
 
 func fileSetup(t *testing.T) (*QueueInfo, error) {
 	//BEGIN: Setup the unit test situation
+	tempLogsPath(t)
+
+	created, err := Create("TestApp", "TestQueue", 10, 1)
+	if err != nil {
+		return nil, err
+	}
+	created.Close()
+
 	fullQueueName := "TestAppTestQueue"
 	walInfo := new(QueueInfo)
 	walControl := new(WalControl)
@@ -179,10 +197,13 @@ func TestMoveHead(t *testing.T) {
 	defer walInfo.WalControlFile.Close()
 	defer walInfo.WalFile.Close()
 
+	//The in-memory queue starts empty, so give MoveHead something to dequeue
+	walInfo.Append("Message for MoveHead")
+
 	prevHeadLsn := walInfo.WalControlInfo.HeadLsn
 	prevTailLsn := walInfo.WalControlInfo.TailLsn
 
-	err := walInfo.MoveHead()
+	_, err := walInfo.MoveHead()
 
 	if err != nil {
 		t.Errorf("Error my moving queue head in the WAL")
@@ -199,3 +220,159 @@ func TestMoveHead(t *testing.T) {
 		return
 	}
 }
+
+func TestEncodeMessage(t *testing.T) {
+
+	attributes := map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "tracestate": ""}
+	data := EncodeMessage("body with attributes", attributes)
+
+	body, decoded, err := DecodeMessage(WalItem{ItemType: ENQUEUE_ATTRS, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "body with attributes" || len(decoded) != 2 || decoded["traceparent"] != attributes["traceparent"] {
+		t.Errorf("Want the message back, got %q %v", body, decoded)
+	}
+
+	//A cut off item is reported rather than read past its end
+	if _, _, err := DecodeMessage(WalItem{ItemType: ENQUEUE_ATTRS, Data: data[:10]}); err == nil {
+		t.Errorf("Want an error for a truncated item")
+	}
+
+	if body, decoded, _ := DecodeMessage(WalItem{ItemType: ENQUEUE, Data: []byte("plain")}); body != "plain" || decoded != nil {
+		t.Errorf("Want a plain enqueue item without attributes, got %q %v", body, decoded)
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+
+	attributes := map[string]string{"tracestate": "vendor=1"}
+	item := WalItem{ItemType: ENQUEUE_OPTIONS, Data: EncodeOptions("urgent", attributes, MessageOptions{Priority: 7})}
+
+	body, decoded, err := DecodeMessage(item)
+	if err != nil || body != "urgent" || decoded["tracestate"] != "vendor=1" {
+		t.Errorf("DecodeMessage: want the message back, got %q %v %v", body, decoded, err)
+	}
+	if opts, err := DecodeOptions(item); err != nil || opts.Priority != 7 {
+		t.Errorf("DecodeOptions: want priority 7, got %+v %v", opts, err)
+	}
+
+	item = WalItem{ItemType: ENQUEUE_OPTIONS, Data: EncodeOptions("grouped", nil, MessageOptions{GroupId: "customer-42"})}
+	if opts, err := DecodeOptions(item); err != nil || opts.GroupId != "customer-42" || opts.Priority != 0 {
+		t.Errorf("DecodeOptions: want group customer-42, got %+v %v", opts, err)
+	}
+	if body, _, err := DecodeMessage(item); err != nil || body != "grouped" {
+		t.Errorf("DecodeMessage with a group: want grouped, got %q %v", body, err)
+	}
+
+	enqueuedAt := time.Unix(1700000000, 123456789)
+	item = WalItem{ItemType: ENQUEUE_OPTIONS, Data: EncodeOptions("once", nil, MessageOptions{DeduplicationId: "order-7", EnqueuedAt: enqueuedAt})}
+	if opts, err := DecodeOptions(item); err != nil || opts.DeduplicationId != "order-7" || !opts.EnqueuedAt.Equal(enqueuedAt) {
+		t.Errorf("DecodeOptions: want deduplication id order-7 enqueued at %v, got %+v %v", enqueuedAt, opts, err)
+	}
+	if body, _, err := DecodeMessage(item); err != nil || body != "once" {
+		t.Errorf("DecodeMessage with a deduplication id: want once, got %q %v", body, err)
+	}
+
+	expiresAt := enqueuedAt.Add(time.Hour)
+	item = WalItem{ItemType: ENQUEUE_OPTIONS, Data: EncodeOptions("short lived", nil, MessageOptions{ExpiresAt: expiresAt})}
+	if opts, err := DecodeOptions(item); err != nil || !opts.ExpiresAt.Equal(expiresAt) || !opts.EnqueuedAt.IsZero() {
+		t.Errorf("DecodeOptions: want the message to expire at %v, got %+v %v", expiresAt, opts, err)
+	}
+
+	deliverAt := enqueuedAt.Add(24 * time.Hour)
+	item = WalItem{ItemType: ENQUEUE_OPTIONS, Data: EncodeOptions("reminder", nil, MessageOptions{DeliverAt: deliverAt})}
+	if opts, err := DecodeOptions(item); err != nil || !opts.DeliverAt.Equal(deliverAt) || !opts.ExpiresAt.IsZero() {
+		t.Errorf("DecodeOptions: want the message delivered at %v, got %+v %v", deliverAt, opts, err)
+	}
+
+	//Options written by a later version are skipped
+	unknown := []byte{9, 2, 0, 'x', 'y'}
+	data := append([]byte{byte(len(unknown) + 4), 0}, unknown...)
+	data = append(data, optionPriority, 1, 0, 3)
+	data = append(data, EncodeMessage("later", nil)...)
+	item = WalItem{ItemType: ENQUEUE_OPTIONS, Data: data}
+	if opts, err := DecodeOptions(item); err != nil || opts.Priority != 3 {
+		t.Errorf("DecodeOptions with an unknown option: want priority 3, got %+v %v", opts, err)
+	}
+	if body, _, err := DecodeMessage(item); err != nil || body != "later" {
+		t.Errorf("DecodeMessage with an unknown option: want later, got %q %v", body, err)
+	}
+
+	//A cut off item is reported rather than read past its end
+	if _, err := DecodeOptions(WalItem{ItemType: ENQUEUE_OPTIONS, Data: data[:4]}); err == nil {
+		t.Errorf("DecodeOptions: want an error for a truncated item")
+	}
+	if opts, err := DecodeOptions(WalItem{ItemType: ENQUEUE, Data: []byte("plain")}); err != nil || !opts.IsZero() {
+		t.Errorf("DecodeOptions of a plain enqueue item: want no options, got %+v %v", opts, err)
+	}
+}
+
+func TestDedupIndex(t *testing.T) {
+
+	var d dedupIndex
+	now := time.Now()
+	d.add(&dedupEntry{id: "a", messageId: "1", walFileNum: 3, expires: now.Add(time.Second)})
+	d.add(&dedupEntry{id: "b", messageId: "2", walFileNum: 4, expires: now.Add(time.Minute)})
+
+	if id, ok := d.lookup("a", now); !ok || id != "1" {
+		t.Errorf("lookup: want message 1, got %q %v", id, ok)
+	}
+	if d.firstFileNum() != 3 {
+		t.Errorf("firstFileNum: want 3, got %d", d.firstFileNum())
+	}
+
+	//An id is forgotten once its window ends and the files before its successor are no longer needed
+	later := now.Add(2 * time.Second)
+	if _, ok := d.lookup("a", later); ok {
+		t.Errorf("lookup: want no match after the window ended")
+	}
+	d.expire(later)
+	if _, ok := d.ids["a"]; ok || len(d.entries) != 1 || d.firstFileNum() != 4 {
+		t.Errorf("expire: want only b left in file 4, got %v %d", d.ids, d.firstFileNum())
+	}
+
+	d.expire(now.Add(time.Hour))
+	if len(d.ids) != 0 || d.firstFileNum() != 0 {
+		t.Errorf("expire: want an empty index, got %v", d.ids)
+	}
+}
+
+func TestTimerIndex(t *testing.T) {
+
+	now := time.Now()
+	var timers timerIndex
+
+	//Added in wal order, due in a different order
+	var messages []*q.Message
+	for lsn, delay := range []time.Duration{3 * time.Hour, time.Hour, 2 * time.Hour, time.Hour} {
+		m := &q.Message{WalFileNum: 1, Lsn: uint64(lsn), DeliverAt: now.Add(delay)}
+		messages = append(messages, m)
+		timers.add(m)
+	}
+
+	if m := timers.popDue(now); m != nil {
+		t.Errorf("popDue: want nothing due yet, got lsn %d", m.Lsn)
+	}
+
+	//Messages due at the same time come out in wal order
+	var due []uint64
+	for m := timers.popDue(now.Add(150 * time.Minute)); m != nil; m = timers.popDue(now.Add(150 * time.Minute)) {
+		if !m.DeliverAt.IsZero() {
+			t.Errorf("popDue: want the delivery time cleared, got %v", m.DeliverAt)
+		}
+		due = append(due, m.Lsn)
+	}
+	if fmt.Sprint(due) != "[1 3 2]" || timers.len() != 1 {
+		t.Errorf("popDue: want lsns [1 3 2] with one left, got %v with %d left", due, timers.len())
+	}
+
+	if m := timers.oldest(); m != messages[0] {
+		t.Errorf("oldest: want lsn 0, got %v", m)
+	}
+	timers.popDue(now.Add(4 * time.Hour))
+	if m := timers.oldest(); m != nil || len(timers.order) != 0 {
+		t.Errorf("oldest: want no scheduled messages, got %v with %d in order", m, len(timers.order))
+	}
+}
@@ -1,14 +1,16 @@
 package wal
 
 import (
+	"encoding/binary"
 	"encoding/json"
-	"fmt"
-	"log"
 	"os"
 	"path"
 	"strconv"
 	"sync"
+	"time"
 
+	e "github.com/coderagr/ezqueue-service/ezqueued/errors"
+	"github.com/coderagr/ezqueue-service/ezqueued/logging"
 	q "github.com/coderagr/ezqueue-service/ezqueued/queue"
 )
 
@@ -16,147 +18,218 @@ import (
 //Walitems are stores in the wal files
 //Wal Control has information about the instantaneous state of the wal file
 
+//The files, the control info and the queue of a QueueInfo are only changed by its methods, which hold
+//queueAccessMutex while they do. Other packages read them through the methods as well
 type QueueInfo struct {
-	WalFile        *os.File
-	WalControlFile *os.File
+	WalFile        File
+	WalControlFile File
 	WalControlInfo *WalControl
 	Queue          *q.Queue
 
 	queueAccessMutex sync.Mutex
+	appendSignal     chan struct{}     //closed when the next message is appended
+	inFlight         map[string]*Lease //messages handed out with a lease, by message id
+	busyGroups       map[string]bool   //groups with a message in flight, their other messages wait until it is done
+	dedup            dedupIndex        //deduplication ids appended within the dedup window
+	nextExpiry       time.Time         //earliest expiry of a waiting message, zero if none of them expires
+	timers           timerIndex        //messages scheduled for a later delivery
+	controlChanged   bool              //the control info changed since the control file was saved
+}
+
+//MessageAdded returns a channel that is closed the next time a message is appended to the queue.
+//Long polling readers wait on it instead of checking the queue in a loop
+func (w *QueueInfo) MessageAdded() <-chan struct{} {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	if w.appendSignal == nil {
+		w.appendSignal = make(chan struct{})
+	}
+
+	return w.appendSignal
+}
+
+//log returns a logger for records about the queue
+func (w *QueueInfo) log() *logging.Logger {
+	return logging.Default().With("app", w.WalControlInfo.MetaData.AppName, "queue", w.WalControlInfo.MetaData.Name)
 }
 
 func (w *QueueInfo) LogFileName(walFileNum uint64) string {
 
-	return w.WalControlInfo.MetaData.AppName + w.WalControlInfo.MetaData.Name + "-" + strconv.FormatUint(walFileNum, 10) + Logsextn
+	return SegmentName(w.WalControlInfo.MetaData.AppName, w.WalControlInfo.MetaData.Name, walFileNum)
+
+}
+
+//ControlFilePath returns the path of the queue's control file
+func (w *QueueInfo) ControlFilePath() string {
+	return path.Join(Config.Logspath, w.WalControlInfo.MetaData.AppName+w.WalControlInfo.MetaData.Name+ControlFileExtn)
+}
 
+//SegmentName returns the name of wal file walFileNum of a queue
+func SegmentName(appName, queueName string, walFileNum uint64) string {
+	return appName + queueName + "-" + strconv.FormatUint(walFileNum, 10) + Logsextn
 }
 
 /*
-	MoveHead method advances the Head lsn by one item in the walfile and saves the current position the control file
+	MoveHead method removes the message at the head of the queue and moves the head lsn to the
+	oldest message that is still in the queue, in flight or scheduled. The new position is saved with the next flush.
+	Messages of a group with a message in flight are skipped. The removed message is returned to the caller
 */
-func (w *QueueInfo) MoveHead() (string, error) {
+func (w *QueueInfo) MoveHead() (*q.Message, error) {
 
 	w.queueAccessMutex.Lock()
 	defer w.queueAccessMutex.Unlock()
 
-	walFileNum := w.WalControlInfo.HeadLsnFileNum
-
-	var nextLsn uint64
-	var err error
-	var fileSize int64
+	w.deliverDue(time.Now())
 
-	msg := w.Queue.Head.Value
+	var m *q.Message
+	if !w.WalControlInfo.Paused {
+		m = w.next()
+	}
+	if m == nil {
+		return nil, &e.Error{AppName: w.Queue.AppName, Name: w.Queue.Name, ErrorCode: e.QUEUE_EMPTY, ErrorMessage: e.ErrorQueueEmpty}
+	}
 
-	//Case where head and tail are in the same file
-	if w.WalControlInfo.TailLsnFileNum == walFileNum {
+	if err := w.release(m); err != nil {
+		return nil, err
+	}
 
-		//Same file, single item in the queue
-		if w.WalControlInfo.HeadLsn == w.WalControlInfo.TailLsn {
-			w.Queue.DeQueue()
-			return msg, nil
-		}
+	return m, nil
+}
 
-		//Head is behind tail. So move it one item ahead
-		nextLsn, _, err = w.getNextLsn(walFileNum)
-		if err != nil {
-			return "", err
-		}
+//Peek returns the message at the head of the queue without removing it
+func (w *QueueInfo) Peek() (string, error) {
 
-	} else { //Case where tail is in another file with a higher file number
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
 
-		nextLsn, fileSize, err = w.getNextLsn(walFileNum)
-		if err != nil {
-			return "", err
-		}
+	w.deliverDue(time.Now())
 
-		if nextLsn > uint64(fileSize) { //We have reached the end of the file. Move to the next file
-			nextLsn = 0 //lsn for a new file always starts at 0
-			w.WalControlInfo.HeadLsnFileNum = walFileNum + 1
-		}
+	i, ok := w.Queue.Find(w.available)
+	if !ok {
+		return "", &e.Error{AppName: w.Queue.AppName, Name: w.Queue.Name, ErrorCode: e.QUEUE_EMPTY, ErrorMessage: e.ErrorQueueEmpty}
 	}
 
-	w.WalControlInfo.HeadLsn = nextLsn
+	return w.Queue.At(i).Value, nil
+}
 
-	//Save the new control file values for this queue
-	if err := w.saveControlFile(); err != nil {
-		return "", err
+//release records that a message has left the queue for good and advances the head lsn
+func (w *QueueInfo) release(m *q.Message) error {
+
+	if err := w.logRemoved(m, DELETE); err != nil {
+		return err
 	}
 
-	///Now we are ready to dequeue from the actual queue
-	w.Queue.DeQueue()
+	w.advanceHead()
+	w.controlChanged = true
 
-	return msg, nil
+	return nil
 }
 
-func (w *QueueInfo) getNextLsn(walFileNum uint64) (uint64, int64, error) {
-	fileName := w.LogFileName(walFileNum)
-	filePath := path.Join(Config.Logspath, fileName)
-
-	f, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
-	if err != nil {
-		return 0, 0, err
-	}
+//logRemoved writes a DELETE or EXPIRE item for a message that left the queue for good. The head lsn
+//moves past the message as well, but it is only saved with the next flush, so recovery skips the
+//message for its removal item until then
+func (w *QueueInfo) logRemoved(m *q.Message, itemType WalType) error {
 
-	defer f.Close()
-	fileInfo, err := f.Stat()
-	s := fileInfo.Size()
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint64(data[0:], m.WalFileNum)
+	binary.LittleEndian.PutUint64(data[8:], m.Lsn)
 
-	//Seek to the current head
-	_, serr := f.Seek(int64(w.WalControlInfo.HeadLsn), 0)
+	_, _, err := w.appendRecord(itemType, data)
 
-	if serr != nil {
-		return 0, 0, err
-	}
+	return err
+}
 
-	//Prep to read the wal item at the currrent head
-	var itemPrefixBytes = make([]byte, Sizes.GetWalItemPrefixSize())
+//advanceHead points the head lsn at the oldest message still in the queue, in flight or scheduled.
+//When there are none it points at the position of the next wal item
+func (w *QueueInfo) advanceHead() {
 
-	//at this point get the itemprefix bytes
-	_, err = f.Read(itemPrefixBytes)
-	if err != nil {
-		return 0, 0, err
+	oldest := w.Queue.Oldest()
+	if m := w.timers.oldest(); m != nil && (oldest == nil || m.Before(oldest)) {
+		oldest = m
+	}
+	for _, l := range w.inFlight {
+		if oldest == nil || l.Message.Before(oldest) {
+			oldest = l.Message
+		}
 	}
 
-	//Decode the current head
-	item, derr := DecodeWalItemPrefix(itemPrefixBytes)
-	if derr != nil {
-		return 0, 0, derr
+	if oldest == nil {
+		w.WalControlInfo.HeadLsnFileNum = w.WalControlInfo.TailLsnFileNum
+		w.WalControlInfo.HeadLsn = w.WalControlInfo.NextLsn
+		return
 	}
 
-	//Calculate the next lsn and set it in the control ds
-	return w.WalControlInfo.HeadLsn + Sizes.GetWalItemPrefixSize() + item.Size, s, nil
+	w.WalControlInfo.HeadLsnFileNum = oldest.WalFileNum
+	w.WalControlInfo.HeadLsn = oldest.Lsn
 }
 
+//saveControlFile replaces the control file with the current control info. The info is written to a new file that is
+//synced before it is renamed over the control file, so a crash leaves either the old or the new control file and
+//never a partial one. A rename does not carry the data with it, without the sync a power loss could leave an empty
+//control file. The directory is synced last so the rename itself lasts
 func (w *QueueInfo) saveControlFile() error {
 
-	//START: Push wal control info to disk
 	walc, err := json.Marshal(w.WalControlInfo)
 	if err != nil {
 		return err
 	}
 
-	//Empty out the current file
-	ferr := w.WalControlFile.Truncate(0)
-	if ferr != nil {
-		return ferr
+	filePath := w.ControlFilePath()
+	f, err := FS.OpenFile(filePath+controlTmpExtn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(walc); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := FS.Rename(filePath+controlTmpExtn, filePath); err != nil {
+		f.Close()
+		return err
+	}
+
+	//The new file is the control file now
+	if w.WalControlFile != nil {
+		w.WalControlFile.Close()
 	}
+	w.WalControlFile = f
 
-	//Seek to the begining of the file
-	//Write the latest walcontrolinfo into the file
-	w.WalControlFile.Seek(0, 0)
-	if _, err := w.WalControlFile.Write(walc); err != nil {
+	if err := FS.SyncDir(path.Dir(filePath)); err != nil {
 		return err
 	}
+	w.controlChanged = false
 
 	return nil
 }
 
+//FlushControlFile saves the control info if it changed since the last save. Appends and removals only change it
+//in memory, recovery finds what they did in the wal, so the control file is written once per flush and not per call
 func (w *QueueInfo) FlushControlFile() error {
 	w.queueAccessMutex.Lock()
 	defer w.queueAccessMutex.Unlock()
 
-	if err := w.WalControlFile.Sync(); err != nil {
-		log.Printf("Error saving %s: %s", w.WalControlFile.Name(), err.Error())
+	return w.flushControl()
+}
+
+func (w *QueueInfo) flushControl() error {
+
+	if !w.controlChanged {
+		return nil
+	}
+
+	defer observeFsync("control", time.Now())
+
+	if err := w.saveControlFile(); err != nil {
+		w.log().Error("Unable to save the control file", "path", w.ControlFilePath(), "error", err)
 		return err
 	}
 
@@ -167,8 +240,10 @@ func (w *QueueInfo) FlushWalFile() error {
 	w.queueAccessMutex.Lock()
 	defer w.queueAccessMutex.Unlock()
 
+	defer observeFsync("wal", time.Now())
+
 	if err := w.WalFile.Sync(); err != nil {
-		log.Printf("Error saving %s: %s", w.WalFile.Name(), err.Error())
+		w.log().Error("Unable to sync the wal file", "path", w.WalFile.Name(), "error", err)
 		return err
 	}
 
@@ -186,9 +261,7 @@ func (w *QueueInfo) saveWalItem(itemBytes []byte) error {
 		return err
 	}
 
-	fileInfo, _ := w.WalFile.Stat()
-	s := fileInfo.Size()
-	fmt.Println("File Size", s)
+	bytesWritten.Add(float64(len(walItemBytes)), w.WalControlInfo.MetaData.AppName, w.WalControlInfo.MetaData.Name)
 
 	return nil
 }
@@ -196,19 +269,27 @@ func (w *QueueInfo) saveWalItem(itemBytes []byte) error {
 func (w *QueueInfo) segmentWalFile() error {
 
 	if w.WalControlInfo.NextLsn >= MaxFileSize {
-		//Cose the current file
+
+		//Recovery reads the wal files in order, so a file is synced before items go to the next one
+		if err := w.WalFile.Sync(); err != nil {
+			w.log().Error("Unable to sync the wal file", "path", w.WalFile.Name(), "error", err)
+			return err
+		}
 		w.WalFile.Close()
 
 		//increment the walfile number
 		w.WalControlInfo.TailLsnFileNum++
 		fileName := w.LogFileName(w.WalControlInfo.TailLsnFileNum)
 		fullPath := path.Join(Config.Logspath, fileName)
-		fptr, err := os.OpenFile(fullPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		//Recovery moves the tail to the last wal file, so a next file that exists holds data of its own
+		fptr, err := FS.OpenFile(fullPath, os.O_CREATE|os.O_EXCL|os.O_APPEND|os.O_WRONLY, 0644)
 		if err != nil {
-			fmt.Println(err)
+			w.log().Error("Unable to open the next wal file", "path", fullPath, "error", err)
 			return err
 		}
 
+		w.log().Debug("Started a new wal file", "wal_file", w.WalControlInfo.TailLsnFileNum)
+
 		w.WalFile = fptr
 		w.WalControlInfo.NextLsn = 0
 	}
@@ -216,51 +297,242 @@ func (w *QueueInfo) segmentWalFile() error {
 	return nil
 }
 
-func (w *QueueInfo) Append(msg string) error {
-
-	//Protect this whole function from another go routine that is trying to enqueue into the same unique queue
-	w.queueAccessMutex.Lock()
-	defer w.queueAccessMutex.Unlock()
-
-	fmt.Println("Saving", msg)
-
-	//Build a message object
-	msgBytes := []byte(msg)
+//appendRecord writes a wal item at the tail of the wal and returns the file number and lsn it was written at
+func (w *QueueInfo) appendRecord(itemType WalType, data []byte) (uint64, uint64, error) {
 
 	//update the filenum if it exceeds the file size
 	if err := w.segmentWalFile(); err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	item := WalItem{w.WalControlInfo.NextLsn, ENQUEUE, w.WalControlInfo.TailLsnFileNum, uint64(len(msgBytes)), msgBytes}
+	walFileNum := w.WalControlInfo.TailLsnFileNum
+	lsn := w.WalControlInfo.NextLsn
+
+	item := WalItem{lsn, itemType, walFileNum, uint64(len(data)), data}
 
-	size := Sizes.GetWalItemPrefixSize() + uint64(len(msgBytes))
+	size := Sizes.GetWalItemPrefixSize() + uint64(len(data))
 
 	itemBytes, err := EncodeWalItem(item, size)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	w.WalControlInfo.TailLsn = w.WalControlInfo.NextLsn
+	//append the wal item
+	if err := w.saveWalItem(itemBytes); err != nil {
+		return 0, 0, err
+	}
 
 	//size of the file until previous block will be the lsn of the next wal item
 	w.WalControlInfo.NextLsn += size
 
-	//save the control file
-	err = w.saveControlFile()
-	if err != nil {
-		return err
+	return walFileNum, lsn, nil
+}
+
+//Append writes the message to the wal, adds it to the queue and returns the message id
+func (w *QueueInfo) Append(msg string) (string, error) {
+	return w.AppendWithAttributes(msg, nil)
+}
+
+//AppendWithAttributes is Append for a message that carries attributes, Ex: the trace context of the producer.
+//A message without attributes is written as a plain ENQUEUE item
+func (w *QueueInfo) AppendWithAttributes(msg string, attributes map[string]string) (string, error) {
+	return w.AppendWithOptions(msg, attributes, MessageOptions{})
+}
+
+//AppendWithOptions is AppendWithAttributes for a message with options, Ex: its priority.
+//The options are written with the message so recovery puts it back where it was.
+//A message with a deduplication id that was appended within the dedup window is not appended again,
+//the id of the first message is returned instead. The retention period of the queue caps opts.ExpiresAt.
+//A message with a later opts.DeliverAt is kept out of the queue until then
+func (w *QueueInfo) AppendWithOptions(msg string, attributes map[string]string, opts MessageOptions) (string, error) {
+
+	//Protect this whole function from another go routine that is trying to enqueue into the same unique queue
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	now := time.Now()
+	w.dedup.expire(now)
+	w.WalControlInfo.DedupFileNum = w.dedup.firstFileNum()
+
+	if len(opts.DeduplicationId) != 0 {
+		if id, ok := w.dedup.lookup(opts.DeduplicationId, now); ok {
+			w.log().Debug("Skipped a duplicate message", "message_id", id, "deduplication_id", opts.DeduplicationId)
+			return id, nil
+		}
+
+		//The time is written with the id so its window does not start over at recovery
+		opts.EnqueuedAt = now
 	}
 
-	//append the wal item
-	err = w.saveWalItem(itemBytes)
+	if retention := w.WalControlInfo.MetaData.RetentionSeconds; retention != 0 {
+		if expires := now.Add(time.Duration(retention) * time.Second); opts.ExpiresAt.IsZero() || expires.Before(opts.ExpiresAt) {
+			opts.ExpiresAt = expires
+		}
+	}
+
+	itemType, data := ENQUEUE, []byte(msg)
+	if !opts.IsZero() {
+		itemType, data = ENQUEUE_OPTIONS, EncodeOptions(msg, attributes, opts)
+	} else if len(attributes) != 0 {
+		itemType, data = ENQUEUE_ATTRS, EncodeMessage(msg, attributes)
+	}
+
+	walFileNum, lsn, err := w.appendRecord(itemType, data)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	w.Queue.Enqueue(msg)
+	w.WalControlInfo.TailLsn = lsn
 
-	return nil
+	m := &q.Message{Value: msg, Attributes: attributes, WalFileNum: walFileNum, Lsn: lsn, EnqueuedAt: now, Priority: opts.Priority, GroupId: opts.GroupId, ExpiresAt: opts.ExpiresAt}
+	if opts.DeliverAt.After(now) {
+		m.DeliverAt = opts.DeliverAt
+		w.timers.add(m)
+	} else {
+		w.Queue.Push(m)
+		w.noteExpiry(m.ExpiresAt)
+	}
+
+	if len(opts.DeduplicationId) != 0 {
+		w.dedup.add(&dedupEntry{id: opts.DeduplicationId, messageId: m.Id(), walFileNum: walFileNum, expires: now.Add(DedupWindow())})
+		w.WalControlInfo.DedupFileNum = w.dedup.firstFileNum()
+	}
+
+	//The first message in an empty queue becomes the head of the wal
+	if w.Queue.Count+uint64(w.timers.len()) == 1 {
+		w.advanceHead()
+	}
+
+	w.controlChanged = true
+
+	//Wake up the readers waiting for a message
+	if w.appendSignal != nil {
+		close(w.appendSignal)
+		w.appendSignal = nil
+	}
+
+	if l := w.log(); l.Enabled(logging.LevelDebug) {
+		l.Debug("Appended message", "message_id", m.Id(), "wal_file", walFileNum, "lsn", lsn, "payload", l.Payload(msg))
+	}
+
+	return m.Id(), nil
+}
+
+//RecoverMessage adds a message read back from the wal to the end of the queue, or to the scheduled messages
+//when its delivery time has not come yet. Messages are recovered in wal order
+func (w *QueueInfo) RecoverMessage(m *q.Message) {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	if m.DeliverAt.After(time.Now()) {
+		w.timers.add(m)
+		return
+	}
+
+	m.DeliverAt = time.Time{}
+	w.Queue.Push(m)
+	w.noteExpiry(m.ExpiresAt)
+}
+
+//Messages returns the messages waiting in the queue from the head to the tail
+func (w *QueueInfo) Messages() []string {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	messages := make([]string, 0, w.Queue.Count)
+	for i := uint64(0); i < w.Queue.Count; i++ {
+		messages = append(messages, w.Queue.At(i).Value)
+	}
+
+	return messages
+}
+
+//Stats is a snapshot of a queue for monitoring
+type Stats struct {
+	Visible    int       //messages waiting in the queue
+	InFlight   int       //messages handed out with a lease
+	Delayed    int       //messages scheduled for a later delivery
+	OldestTime time.Time //when the oldest waiting or in flight message was enqueued, zero if there are none
+}
+
+func (w *QueueInfo) Stats() Stats {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	s := Stats{Visible: int(w.Queue.Count), InFlight: len(w.inFlight), Delayed: w.timers.len()}
+
+	//The queue is in wal order within a priority, so only the oldest of the fronts can be older than the leases
+	if m := w.Queue.Oldest(); m != nil {
+		s.OldestTime = m.EnqueuedAt
+	}
+	for _, l := range w.inFlight {
+		if s.OldestTime.IsZero() || l.Message.EnqueuedAt.Before(s.OldestTime) {
+			s.OldestTime = l.Message.EnqueuedAt
+		}
+	}
+
+	return s
+}
+
+//WalSize returns the number of wal files of the queue and their total size on disk
+func (w *QueueInfo) WalSize() (segments int, bytes int64) {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	for walFileNum := uint64(1); walFileNum <= w.WalControlInfo.TailLsnFileNum; walFileNum++ {
+		fileInfo, err := os.Stat(path.Join(Config.Logspath, w.LogFileName(walFileNum)))
+		if err != nil {
+			continue
+		}
+
+		segments++
+		bytes += fileInfo.Size()
+	}
+
+	return segments, bytes
+}
+
+//Close saves the control info, syncs the queue files and closes them. The files stay in the logs directory
+func (w *QueueInfo) Close() error {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	//The wal file first, so the control file never points past what is on disk
+	err := w.WalFile.Sync()
+	if err == nil {
+		err = w.saveControlFile()
+	}
+
+	w.WalFile.Close()
+	w.WalControlFile.Close()
+
+	return err
+}
+
+//Remove closes the queue files and deletes them from the logs directory
+func (w *QueueInfo) Remove() error {
+
+	w.queueAccessMutex.Lock()
+	defer w.queueAccessMutex.Unlock()
+
+	w.WalFile.Close()
+	w.WalControlFile.Close()
+
+	bytesWritten.Delete(w.WalControlInfo.MetaData.AppName, w.WalControlInfo.MetaData.Name)
+
+	for walFileNum := uint64(1); walFileNum <= w.WalControlInfo.TailLsnFileNum; walFileNum++ {
+		err := FS.Remove(path.Join(Config.Logspath, w.LogFileName(walFileNum)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return FS.Remove(w.ControlFilePath())
 }
 
 type QueueMetaData struct {
@@ -268,6 +540,20 @@ type QueueMetaData struct {
 	Name              string `json:"queueName"`
 	DelaySeconds      uint16 `json:"delayseconds"`
 	VisibilityTimeout uint16 `json:"visibilitytimeout"`
+	Priority          bool   `json:"priority,omitempty"` //messages are handed out by priority instead of in wal order
+
+	RetentionSeconds uint32 `json:"retentionseconds,omitempty"` //messages expire this long after they were appended, 0 to keep them until consumed
+	DeadLetterQueue  string `json:"deadletterqueue,omitempty"`  //queue of the same app expired messages are moved to, empty to drop them
+}
+
+//NewQueue returns an empty queue of the type and settings in the metadata
+func (m QueueMetaData) NewQueue() *q.Queue {
+
+	if m.Priority {
+		return q.NewPriorityQueue(m.AppName, m.Name, "", m.DelaySeconds, m.VisibilityTimeout)
+	}
+
+	return q.NewQueue(m.AppName, m.Name, "", m.DelaySeconds, m.VisibilityTimeout)
 }
 
 type WalControl struct {
@@ -277,4 +563,17 @@ type WalControl struct {
 	TailLsnFileNum uint64        `json:"taillsnfilenum"`
 	NextLsn        uint64        `json:"nextlsn"`
 	MetaData       QueueMetaData `json:"queuemetadata"`
+	Paused         bool          `json:"paused,omitempty"`       //consumers see the queue as empty, enqueues still go through
+	DedupFileNum   uint64        `json:"dedupfilenum,omitempty"` //first wal file with a deduplication id that is still in its window, 0 if none
+}
+
+//FirstFileNum returns the first wal file recovery reads. That is the head file, or an earlier one
+//when it holds deduplication ids that are still in their window
+func (c WalControl) FirstFileNum() uint64 {
+
+	if c.DedupFileNum != 0 && c.DedupFileNum < c.HeadLsnFileNum {
+		return c.DedupFileNum
+	}
+
+	return c.HeadLsnFileNum
 }